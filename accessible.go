@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+var accessibleMode bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&accessibleMode, "accessible", "", false, "Screen reader friendly output: no colors, album art or progress lines, and lengths spelled out")
+}
+
+// formatSongLength formats a song's length for text output: in the --duration-format,
+// or spelled out in --accessible mode unless another format is asked for, e.g.
+// "4 minutes 32 seconds", which screen readers don't mistake for a time of day
+func formatSongLength(song *Song) string {
+	if !accessibleMode || durationFormat != DurationColon {
+		return song.FormatLength()
+	}
+	return spokenDuration(song.Length)
+}
+
+// spokenDuration spells a duration out in hours, minutes and seconds
+func spokenDuration(d time.Duration) string {
+	total := int(d.Seconds())
+	units := []struct {
+		name  string
+		count int
+	}{
+		{"hour", total / 3600},
+		{"minute", total % 3600 / 60},
+		{"second", total % 60},
+	}
+	var parts []string
+	for _, unit := range units {
+		if unit.count == 0 {
+			continue
+		}
+		part := fmt.Sprintf("%d %s", unit.count, unit.name)
+		if unit.count != 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return "0 seconds"
+	}
+	return strings.Join(parts, " ")
+}
+
+// browseTheme is the look of the browse view, as SGR attributes for each of its parts
+type browseTheme struct {
+	Header   []color.Attribute // the column headers
+	Selected []color.Attribute // the selected row
+	Muted    []color.Attribute // the separator and help line
+	Match    []color.Attribute // the parts of names and artists matching the search
+}
+
+// Browse themes for --tui-theme
+const (
+	ThemeDefault           = "default"
+	ThemeHighContrast      = "high-contrast"
+	ThemeHighContrastLight = "high-contrast-light"
+)
+
+// browseThemes are the themes of the browse view. The high-contrast ones use bright
+// colors instead of dimmed text and reverse video, for dark and light terminals.
+var browseThemes = map[string]browseTheme{
+	ThemeDefault: {
+		Header:   []color.Attribute{color.Bold},
+		Selected: []color.Attribute{color.ReverseVideo},
+		Muted:    []color.Attribute{color.Faint},
+		Match:    []color.Attribute{color.Underline, color.ReverseVideo},
+	},
+	ThemeHighContrast: {
+		Header:   []color.Attribute{color.Bold, color.Underline, color.FgHiWhite},
+		Selected: []color.Attribute{color.Bold, color.FgBlack, color.BgHiYellow},
+		Muted:    []color.Attribute{color.FgHiWhite},
+		Match:    []color.Attribute{color.Bold, color.Underline, color.FgHiCyan},
+	},
+	ThemeHighContrastLight: {
+		Header:   []color.Attribute{color.Bold, color.Underline, color.FgBlack},
+		Selected: []color.Attribute{color.Bold, color.FgHiWhite, color.BgBlack},
+		Muted:    []color.Attribute{color.FgBlack},
+		Match:    []color.Attribute{color.Bold, color.Underline, color.FgBlue},
+	},
+}
+
+// lookupBrowseTheme returns the browse theme called name
+func lookupBrowseTheme(name string) (browseTheme, error) {
+	if theme, ok := browseThemes[strings.ToLower(name)]; ok {
+		return theme, nil
+	}
+	names := make([]string, 0, len(browseThemes))
+	for name := range browseThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return browseTheme{}, fmt.Errorf("unknown --tui-theme %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// sgr returns the escape sequence that turns on the given attributes
+func sgr(attrs []color.Attribute) string {
+	codes := make([]string, len(attrs))
+	for i, attr := range attrs {
+		codes[i] = strconv.Itoa(int(attr))
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// styled wraps text in the escape sequences of the given attributes
+func styled(text string, attrs []color.Attribute) string {
+	return sgr(attrs) + text + "\x1b[0m"
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// Ways to draw album art, for --art
+const (
+	ArtAuto   = "auto"
+	ArtKitty  = "kitty"
+	ArtITerm2 = "iterm2"
+	ArtSixel  = "sixel"
+	ArtASCII  = "ascii"
+	ArtNone   = "none"
+)
+
+// artProtocols lists the values accepted by --art
+var artProtocols = []string{ArtAuto, ArtKitty, ArtITerm2, ArtSixel, ArtASCII, ArtNone}
+
+// albumArtNames are the file names Clone Hero reads album art from, in order of preference
+var albumArtNames = []string{"album.png", "album.jpg", "album.jpeg"}
+
+// asciiRamp are the characters of ASCII art, from dark to bright
+const asciiRamp = " .:-=+*#%@"
+
+var artProtocol string
+
+func init() {
+	for _, cmd := range []*cobra.Command{showCmd, browseCmd} {
+		cmd.Flags().StringVar(&artProtocol, "art", ArtAuto, "How to draw album art: auto, kitty, iterm2, sixel, ascii or none")
+	}
+}
+
+// resolveArtProtocol validates --art and resolves auto to what the terminal supports.
+// Album art is only drawn on a terminal, and never in CI, porcelain or accessible mode.
+func resolveArtProtocol(protocol string) (string, error) {
+	valid := false
+	for _, p := range artProtocols {
+		valid = valid || p == protocol
+	}
+	if !valid {
+		return "", fmt.Errorf("unknown --art %q (available: %s)", protocol, strings.Join(artProtocols, ", "))
+	}
+	if isCI() || porcelainMode() || accessibleMode || !isatty.IsTerminal(os.Stdout.Fd()) {
+		return ArtNone, nil
+	}
+	if protocol != ArtAuto {
+		return protocol, nil
+	}
+	return detectArtProtocol(), nil
+}
+
+// detectArtProtocol guesses the best graphics protocol of the terminal from its
+// environment, falling back to ASCII art
+func detectArtProtocol() string {
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || term == "xterm-ghostty" || program == "ghostty":
+		return ArtKitty
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return ArtITerm2
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		strings.HasPrefix(term, "yaft") || os.Getenv("WT_SESSION") != "":
+		return ArtSixel
+	}
+	return ArtASCII
+}
+
+// findAlbumArt returns the album art file of the song folder dir, or "" if it has none
+func findAlbumArt(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, name := range albumArtNames {
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(entry.Name(), name) {
+				return filepath.Join(dir, entry.Name())
+			}
+		}
+	}
+	return ""
+}
+
+// loadAlbumArt decodes the album art of a song, from its folder or its .sng archive
+func loadAlbumArt(song *Song) (image.Image, error) {
+	if song.Packed {
+		archive, err := OpenSng(song.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range albumArtNames {
+			if _, ok := archive.Lookup(name); ok {
+				data, err := archive.ReadFile(name)
+				if err != nil {
+					return nil, err
+				}
+				img, _, err := image.Decode(bytes.NewReader(data))
+				return img, err
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+
+	path := findAlbumArt(filepath.Dir(song.Path))
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// AlbumArt is album art drawn for the terminal, cols cells wide and rows cells high:
+// either lines of text, or an escape sequence drawing an image at the cursor
+type AlbumArt struct {
+	Lines    []string
+	Graphics string
+	Cols     int
+	Rows     int
+}
+
+// renderAlbumArt draws the album art of song in at most cols x rows cells with the
+// given (resolved) protocol. It returns nil if the song has no readable album art.
+func renderAlbumArt(song *Song, protocol string, cols, rows int) *AlbumArt {
+	if protocol == ArtNone || cols <= 0 || rows <= 0 {
+		return nil
+	}
+	img, err := loadAlbumArt(song)
+	if err != nil {
+		return nil
+	}
+
+	// Keep the image's aspect ratio; a cell is about twice as high as it's wide
+	cellWidth, cellHeight := 10, 20
+	if w, h, err := cellSize(int(os.Stdout.Fd())); err == nil && w > 0 && h > 0 {
+		cellWidth, cellHeight = w, h
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil
+	}
+	if fitted := bounds.Dx() * rows * cellHeight / (bounds.Dy() * cellWidth); fitted < cols {
+		cols = max(fitted, 1)
+	} else {
+		rows = max(cols*cellWidth*bounds.Dy()/(bounds.Dx()*cellHeight), 1)
+	}
+
+	art := &AlbumArt{Cols: cols, Rows: rows}
+	switch protocol {
+	case ArtASCII:
+		art.Lines = asciiArt(scaleImage(img, cols, rows))
+	case ArtSixel:
+		art.Graphics = sixelImage(scaleImage(img, cols*cellWidth, rows*cellHeight))
+	default:
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, scaleImage(img, cols*cellWidth, rows*cellHeight)); err != nil {
+			return nil
+		}
+		data := base64.StdEncoding.EncodeToString(encoded.Bytes())
+		if protocol == ArtKitty {
+			art.Graphics = kittyImage(data, cols, rows)
+		} else {
+			art.Graphics = fmt.Sprintf("\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=0:%s\a", encoded.Len(), cols, rows, data)
+		}
+	}
+	return art
+}
+
+// Write draws the art at the cursor and moves the cursor to the line below it. Space
+// for images is made first, so that drawing them never scrolls the terminal.
+func (a *AlbumArt) Write(w io.Writer) {
+	if a.Lines != nil {
+		for _, line := range a.Lines {
+			fmt.Fprintln(w, line)
+		}
+		return
+	}
+	fmt.Fprintf(w, "%s\x1b[%dA\x1b7%s\x1b8\x1b[%dB", strings.Repeat("\n", a.Rows), a.Rows, a.Graphics, a.Rows)
+}
+
+// scaleImage resizes img to width x height pixels, averaging the pixels that end up in
+// each pixel of the result
+func scaleImage(img image.Image, width, height int) *image.RGBA {
+	bounds := img.Bounds()
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(bounds.Min.X+(x+1)*bounds.Dx()/width, x0+1)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			scaled.SetRGBA(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(b / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return scaled
+}
+
+// asciiArt draws one character per pixel of img, denser for brighter pixels
+func asciiArt(img *image.RGBA) []string {
+	bounds := img.Bounds()
+	lines := make([]string, bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		var line strings.Builder
+		for x := 0; x < bounds.Dx(); x++ {
+			gray := color.GrayModel.Convert(img.At(x, y)).(color.Gray)
+			line.WriteByte(asciiRamp[int(gray.Y)*len(asciiRamp)/256])
+		}
+		lines[y] = line.String()
+	}
+	return lines
+}
+
+// kittyImage draws PNG data (base64-encoded) over cols x rows cells with the kitty
+// graphics protocol, without moving the cursor or asking for a response. The data is
+// sent in chunks of at most 4096 bytes, as the protocol requires.
+func kittyImage(data string, cols, rows int) string {
+	var b strings.Builder
+	for first := true; first || data != ""; first = false {
+		chunk := data[:min(4096, len(data))]
+		data = data[len(chunk):]
+		more := 0
+		if data != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&b, "\x1b_Ga=T,f=100,q=2,C=1,c=%d,r=%d,m=%d;%s\x1b\\", cols, rows, more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return b.String()
+}
+
+// kittyClear removes every image drawn with the kitty graphics protocol
+const kittyClear = "\x1b_Ga=d,d=A,q=2\x1b\\"
+
+// sixelImage draws img as sixels, dithered to the 216 web-safe colors
+func sixelImage(img *image.RGBA) string {
+	bounds := img.Bounds()
+	paletted := image.NewPaletted(bounds, palette.WebSafe)
+	draw.FloydSteinberg.Draw(paletted, bounds, img, bounds.Min)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1bPq\"1;1;%d;%d", bounds.Dx(), bounds.Dy())
+	for i, c := range palette.WebSafe {
+		r, g, bl, _ := c.RGBA()
+		fmt.Fprintf(&b, "#%d;2;%d;%d;%d", i, r*100/0xffff, g*100/0xffff, bl*100/0xffff)
+	}
+
+	// Each band of six rows is drawn once per color it uses, going back to the start of
+	// the band with $ in between
+	row := make([]byte, bounds.Dx())
+	for top := 0; top < bounds.Dy(); top += 6 {
+		used := make(map[uint8]bool)
+		for y := top; y < min(top+6, bounds.Dy()); y++ {
+			for x := 0; x < bounds.Dx(); x++ {
+				used[paletted.ColorIndexAt(x, y)] = true
+			}
+		}
+		first := true
+		for index := range palette.WebSafe {
+			if !used[uint8(index)] {
+				continue
+			}
+			for x := 0; x < bounds.Dx(); x++ {
+				var bits byte
+				for bit := 0; bit < 6 && top+bit < bounds.Dy(); bit++ {
+					if paletted.ColorIndexAt(x, top+bit) == uint8(index) {
+						bits |= 1 << bit
+					}
+				}
+				row[x] = '?' + bits
+			}
+			if !first {
+				b.WriteByte('$')
+			}
+			first = false
+			fmt.Fprintf(&b, "#%d", index)
+			writeSixelRuns(&b, row)
+		}
+		b.WriteByte('-')
+	}
+	b.WriteString("\x1b\\")
+	return b.String()
+}
+
+// writeSixelRuns writes a row of sixel characters, run-length encoding repeats
+func writeSixelRuns(b *strings.Builder, row []byte) {
+	for i := 0; i < len(row); {
+		j := i
+		for j < len(row) && row[j] == row[i] {
+			j++
+		}
+		if j-i > 3 {
+			fmt.Fprintf(b, "!%d%c", j-i, row[i])
+		} else {
+			b.Write(row[i:j])
+		}
+		i = j
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias [name [= arguments...]]",
+	Short: "List, show or define command aliases",
+	Long: `Aliases are one-word shortcuts for longer command lines, stored in the config file:
+
+  cloneheroer alias drumnight = --instrument drums --has-difficulty expert --sort name
+  cloneheroer -d /mnt/songs drumnight
+
+An alias is expanded where a command name would go, and any other arguments are kept, so
+"cloneheroer drumnight --genre metal" adds a filter. Aliases can also start with a command
+("setlist --max-duration 45m"). Built-in commands can't be overridden.
+
+Without arguments, all aliases are listed; with a name, that alias is shown. "alias name ="
+with nothing after it removes the alias.`,
+	DisableFlagParsing: true,
+	RunE:               runAlias,
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+}
+
+// isBuiltinCommand reports whether name is a command (or command alias) of the CLI
+func isBuiltinCommand(name string) bool {
+	if name == "help" || name == "completion" {
+		return true
+	}
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == name || cmd.HasAlias(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagTakesValue reports whether a flag argument such as "--sort" or "-s" consumes the
+// next argument as its value
+func flagTakesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	for _, flags := range []*pflag.FlagSet{rootCmd.Flags(), rootCmd.PersistentFlags()} {
+		var flag *pflag.Flag
+		if name, ok := strings.CutPrefix(arg, "--"); ok {
+			flag = flags.Lookup(name)
+		} else {
+			// Combined short flags ("-cs name"): only the last one can take a value
+			flag = flags.ShorthandLookup(arg[len(arg)-1:])
+		}
+		if flag != nil {
+			return flag.NoOptDefVal == ""
+		}
+	}
+	return false
+}
+
+// expandAliases replaces the command-name position of a command line with the arguments
+// of a user-defined alias
+func expandAliases(args []string, aliases map[string]string) ([]string, error) {
+	if len(aliases) == 0 {
+		return args, nil
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return args, nil
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			if flagTakesValue(arg) {
+				i++
+			}
+			continue
+		}
+
+		value, ok := aliases[arg]
+		if !ok || isBuiltinCommand(arg) {
+			return args, nil
+		}
+		words, err := splitCommandLine(value)
+		if err != nil {
+			return nil, fmt.Errorf("alias %s: %w", arg, err)
+		}
+		expanded := append(append(append([]string{}, args[:i]...), words...), args[i+1:]...)
+		return expanded, nil
+	}
+	return args, nil
+}
+
+// splitCommandLine splits an alias into arguments like a shell would, honouring single
+// and double quotes
+func splitCommandLine(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func runAlias(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+	// Accept "name=args" as well as "name = args"
+	if len(args) > 0 && strings.Contains(args[0], "=") {
+		name, rest, _ := strings.Cut(args[0], "=")
+		split := []string{name, "="}
+		if rest != "" {
+			split = append(split, rest)
+		}
+		args = append(split, args[1:]...)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case len(args) == 0:
+		if len(config.Aliases) == 0 {
+			fmt.Println("No aliases defined")
+			return nil
+		}
+		for _, name := range sortedKeys(config.Aliases) {
+			fmt.Printf("%s = %s\n", name, config.Aliases[name])
+		}
+		return nil
+	case len(args) == 1:
+		value, ok := config.Aliases[args[0]]
+		if !ok {
+			return fmt.Errorf("no alias named %q", args[0])
+		}
+		fmt.Printf("%s = %s\n", args[0], value)
+		return nil
+	case args[1] != "=":
+		return fmt.Errorf("usage: alias <name> = <arguments...>")
+	}
+
+	name := args[0]
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	if isBuiltinCommand(name) {
+		return fmt.Errorf("%q is a built-in command and can't be an alias", name)
+	}
+	value := formatArgs(args[2:])
+	if len(args) == 3 {
+		// A single quoted argument holds the whole command line
+		value = args[2]
+	}
+	if _, err := splitCommandLine(value); err != nil {
+		return fmt.Errorf("alias %s: %w", name, err)
+	}
+
+	err = updateConfig(func(root *yaml.Node) {
+		aliases := mappingValue(root, "aliases")
+		for i := 0; i+1 < len(aliases.Content); i += 2 {
+			if aliases.Content[i].Value == name {
+				aliases.Content = append(aliases.Content[:i], aliases.Content[i+2:]...)
+				break
+			}
+		}
+		if value != "" {
+			aliases.Content = append(aliases.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: name},
+				&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		fmt.Fprintf(os.Stderr, "Removed alias %s\n", name)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s = %s\n", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// recommendedArtSize is the largest album art the game needs, in pixels on each side;
+// bigger images only take longer to load in the song list
+const recommendedArtSize = 512
+
+var (
+	artMaxSize   int
+	artFixResize bool
+	artFailOn    string
+
+	artCheckCmd = &cobra.Command{
+		Use:   "art-check",
+		Short: "Report missing, oversized and corrupt album art",
+		Long: `Check the album art (album.png or album.jpg) of every matching song: songs without
+any get a blank cover (warning), art that can't be decoded shows nothing or stalls the
+song list (error), and art larger than --max-size pixels on a side (default 512) only
+slows the song list down (info).
+
+With --fix-resize, oversized art is scaled down to fit --max-size and re-encoded in
+the format of its file name. art-check fails while problems of --fail-on severity or
+worse remain (default: error).`,
+		Args: cobra.NoArgs,
+		RunE: runArtCheck,
+	}
+)
+
+func init() {
+	artCheckCmd.Flags().IntVar(&artMaxSize, "max-size", recommendedArtSize, "Largest width and height of album art in pixels")
+	artCheckCmd.Flags().BoolVar(&artFixResize, "fix-resize", false, "Scale oversized album art down to --max-size")
+	artCheckCmd.Flags().StringVar(&artFailOn, "fail-on", string(SeverityError), "Fail when problems of this severity or worse remain (error, warning, info)")
+	rootCmd.AddCommand(artCheckCmd)
+}
+
+// artProblem is what's wrong with the album art of a song, if anything
+type artProblem struct {
+	Rule     string // missing-art, corrupt-art or oversized-art
+	Severity LintSeverity
+	Message  string
+	Image    image.Image // the decoded art, for oversized art
+}
+
+// checkAlbumArt decodes the album art of a song and reports what's wrong with it
+func checkAlbumArt(song *Song, maxSize int) *artProblem {
+	img, err := loadAlbumArt(song)
+	if errors.Is(err, os.ErrNotExist) {
+		return &artProblem{Rule: "missing-art", Severity: SeverityWarning, Message: "no album art (album.png or album.jpg)"}
+	}
+	if err != nil {
+		return &artProblem{Rule: "corrupt-art", Severity: SeverityError, Message: fmt.Sprintf("album art can't be decoded: %v", err)}
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return &artProblem{Rule: "corrupt-art", Severity: SeverityError, Message: "album art is empty"}
+	}
+	if bounds.Dx() > maxSize || bounds.Dy() > maxSize {
+		return &artProblem{
+			Rule:     "oversized-art",
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("album art is %dx%d, larger than %dx%d", bounds.Dx(), bounds.Dy(), maxSize, maxSize),
+			Image:    img,
+		}
+	}
+	return nil
+}
+
+// fitArtSize returns the size of an image scaled down to fit maxSize on both sides,
+// keeping its aspect ratio
+func fitArtSize(width, height, maxSize int) (int, int) {
+	if width >= height {
+		return maxSize, max(height*maxSize/width, 1)
+	}
+	return max(width*maxSize/height, 1), maxSize
+}
+
+// resizeAlbumArt scales a song's album art down to fit maxSize and writes it back in
+// the format of its file name
+func resizeAlbumArt(song *Song, img image.Image, maxSize int) error {
+	if song.Packed {
+		return packedEditError(song.Path)
+	}
+	path := findAlbumArt(filepath.Dir(song.Path))
+	if path == "" {
+		return os.ErrNotExist
+	}
+
+	bounds := img.Bounds()
+	width, height := fitArtSize(bounds.Dx(), bounds.Dy(), maxSize)
+	scaled := scaleImage(img, width, height)
+
+	var encoded bytes.Buffer
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		err = png.Encode(&encoded, scaled)
+	} else {
+		err = jpeg.Encode(&encoded, scaled, &jpeg.Options{Quality: 90})
+	}
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return writeLibraryFile(path, encoded.Bytes(), info.Mode().Perm())
+}
+
+func runArtCheck(cmd *cobra.Command, args []string) error {
+	if artMaxSize <= 0 {
+		return fmt.Errorf("--max-size must be positive")
+	}
+	failOn, err := parseSeverity(artFailOn)
+	if err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("art-check needs a local library")
+	}
+	if artFixResize {
+		if err := ensureWritable("resize album art"); err != nil {
+			return err
+		}
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	report := LintReport{SchemaVersion: SchemaVersion, Checked: len(songs), Counts: make(map[LintSeverity]int), Issues: []LintIssueRecord{}}
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		problem := checkAlbumArt(song, artMaxSize)
+		if problem == nil {
+			continue
+		}
+		record := LintIssueRecord{
+			Path:     songFolder(song),
+			Rule:     problem.Rule,
+			Severity: problem.Severity,
+			Message:  problem.Message,
+			Fixable:  problem.Image != nil && !song.Packed,
+		}
+		if artFixResize && record.Fixable {
+			if err := resizeAlbumArt(song, problem.Image, artMaxSize); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to resize the album art of %s: %v\n", record.Path, err)
+			} else {
+				record.Fixed = true
+				report.Fixed++
+			}
+		}
+		report.Issues = append(report.Issues, record)
+	}
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Severity.rank() < report.Issues[j].Severity.rank()
+	})
+
+	failing := 0
+	for _, issue := range report.Issues {
+		report.Counts[issue.Severity]++
+		if !issue.Fixed && issue.Severity.rank() <= failOn.rank() {
+			failing++
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeLintReport(writer, report)
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked the album art of %d song(s): %d corrupt, %d missing, %d oversized, %d resized\n", len(songs),
+		report.Counts[SeverityError], report.Counts[SeverityWarning], report.Counts[SeverityInfo], report.Fixed)
+	if failing > 0 {
+		return fmt.Errorf("%d album art problem(s) of severity %s or worse found", failing, failOn)
+	}
+	return nil
+}
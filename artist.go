@@ -0,0 +1,61 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// featuringPattern matches the "feat." style markers that introduce featured artists,
+// optionally wrapped in parentheses or brackets (e.g. "Artist (feat. Someone)")
+var featuringPattern = regexp.MustCompile(`(?i)\s*[\(\[]?\s*\b(?:feat\.?|ft\.?|featuring)\s+`)
+
+// splitArtist splits an artist credit into the primary artist and any featured artists.
+// "A feat. B", "A ft. B" and "A (featuring B & C)" all yield primary "A". Only the
+// featured part is split on "&" and ",", which appear in plenty of band names, such as
+// "Simon & Garfunkel" or "Earth, Wind & Fire".
+func splitArtist(artist string) (string, []string) {
+	artist = collapseSpaces(artist)
+	if artist == "" {
+		return "", nil
+	}
+
+	var featured []string
+	primary := artist
+
+	if loc := featuringPattern.FindStringIndex(artist); loc != nil && loc[0] > 0 {
+		primary = artist[:loc[0]]
+		rest := strings.TrimRight(artist[loc[1]:], ")] ")
+		featured = append(featured, splitArtistList(rest)...)
+	}
+
+	return strings.TrimSpace(primary), featured
+}
+
+// splitArtistList splits a list of artists separated by commas or ampersands
+func splitArtistList(s string) []string {
+	var result []string
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '&' }) {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// collapseSpaces trims the string and collapses runs of whitespace into single spaces
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// PrimaryArtist returns the canonical primary artist with featured artists removed
+func (s *Song) PrimaryArtist() string {
+	primary, _ := splitArtist(s.Artist)
+	return primary
+}
+
+// FeaturedArtists returns the artists credited as featured on the song
+func (s *Song) FeaturedArtists() []string {
+	_, featured := splitArtist(s.Artist)
+	return featured
+}
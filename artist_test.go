@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitArtist(t *testing.T) {
+	tests := []struct {
+		artist   string
+		primary  string
+		featured []string
+	}{
+		{"Polyphia", "Polyphia", nil},
+		{"", "", nil},
+		{"Polyphia feat. Steve Vai", "Polyphia", []string{"Steve Vai"}},
+		{"Polyphia ft. Steve Vai", "Polyphia", []string{"Steve Vai"}},
+		{"Polyphia (featuring Steve Vai & Ichika)", "Polyphia", []string{"Steve Vai", "Ichika"}},
+		{"Polyphia [Feat. Steve Vai, Ichika]", "Polyphia", []string{"Steve Vai", "Ichika"}},
+		{"Simon & Garfunkel", "Simon & Garfunkel", nil},
+		{"Earth, Wind & Fire", "Earth, Wind & Fire", nil},
+		{"Crosby, Stills, Nash & Young", "Crosby, Stills, Nash & Young", nil},
+		{"Earth, Wind & Fire feat. The Emotions", "Earth, Wind & Fire", []string{"The Emotions"}},
+		{"  Simon   &  Garfunkel ", "Simon & Garfunkel", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.artist, func(t *testing.T) {
+			primary, featured := splitArtist(tt.artist)
+			if primary != tt.primary || !slices.Equal(featured, tt.featured) {
+				t.Errorf("splitArtist(%q) = %q, %q, want %q, %q", tt.artist, primary, featured, tt.primary, tt.featured)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// audioStems are the audio file names Clone Hero loads from a song folder, without extension
+var audioStems = []string{"song", "guitar", "rhythm", "bass", "keys", "vocals", "vocals_1", "vocals_2",
+	"drums", "drums_1", "drums_2", "drums_3", "drums_4", "crowd", "backing"}
+
+// audioExtensions are the audio formats whose duration can be read
+var audioExtensions = []string{".ogg", ".opus", ".mp3", ".wav", ".flac"}
+
+// errUnknownDuration is returned when an audio file's duration can't be determined
+var errUnknownDuration = errors.New("unable to determine audio duration")
+
+// songAudioFiles returns the audio stems present in a song folder
+func songAudioFiles(dir string) []string {
+	var files []string
+	for _, stem := range audioStems {
+		for _, ext := range audioExtensions {
+			path := filepath.Join(dir, stem+ext)
+			if _, err := os.Stat(path); err == nil {
+				files = append(files, path)
+			}
+		}
+	}
+	return files
+}
+
+// FolderAudioDuration returns the length of the longest audio stem in a song folder
+func FolderAudioDuration(dir string) (time.Duration, error) {
+	files := songAudioFiles(dir)
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no audio files found in %s", dir)
+	}
+
+	var longest time.Duration
+	var lastErr error
+	for _, path := range files {
+		duration, err := AudioDuration(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if duration > longest {
+			longest = duration
+		}
+	}
+	if longest == 0 {
+		return 0, lastErr
+	}
+	return longest, nil
+}
+
+// AudioDuration reads the duration of an ogg (Vorbis/Opus), mp3, wav or flac file from
+// its headers without decoding any audio
+func AudioDuration(path string) (time.Duration, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var duration time.Duration
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ogg", ".opus":
+		duration, err = oggDuration(file, info.Size())
+	case ".wav":
+		duration, err = wavDuration(file)
+	case ".mp3":
+		duration, err = mp3Duration(file, info.Size())
+	case ".flac":
+		duration, err = flacDuration(file)
+	default:
+		return 0, fmt.Errorf("unsupported audio format: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return duration, nil
+}
+
+// samplesToDuration converts a sample count at the given rate to a duration
+func samplesToDuration(samples int64, rate int64) time.Duration {
+	if rate <= 0 || samples <= 0 {
+		return 0
+	}
+	return time.Duration(samples * int64(time.Second) / rate)
+}
+
+// oggDuration reads the sample rate from the first page and the final granule
+// position from the last page of an Ogg Vorbis or Opus stream
+func oggDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	head := make([]byte, 128)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	if len(head) < 28 || !bytes.HasPrefix(head, []byte("OggS")) {
+		return 0, errUnknownDuration
+	}
+	packet := head[27+int(head[26]):]
+
+	var rate, preSkip int64
+	switch {
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		rate = int64(binary.LittleEndian.Uint32(packet[12:16]))
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+		// Opus granule positions are always at 48kHz
+		rate = 48000
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+	default:
+		return 0, errUnknownDuration
+	}
+
+	// Search backwards from the end of the file for the last page header
+	for window := int64(64 * 1024); ; window *= 4 {
+		if window > size {
+			window = size
+		}
+		tail := make([]byte, window)
+		n, err := r.ReadAt(tail, size-window)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		tail = tail[:n]
+
+		for i := bytes.LastIndex(tail, []byte("OggS")); i >= 0; i = bytes.LastIndex(tail[:i], []byte("OggS")) {
+			if i+14 > len(tail) || tail[i+4] != 0 {
+				continue
+			}
+			granule := int64(binary.LittleEndian.Uint64(tail[i+6 : i+14]))
+			if granule > 0 {
+				return samplesToDuration(granule-preSkip, rate), nil
+			}
+		}
+		if window == size {
+			return 0, errUnknownDuration
+		}
+	}
+}
+
+// wavDuration divides the size of the data chunk by the byte rate from the fmt chunk
+func wavDuration(r io.ReadSeeker) (time.Duration, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return 0, errUnknownDuration
+	}
+
+	var byteRate int64
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return 0, errUnknownDuration
+		}
+		id := string(chunk[0:4])
+		size := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil || size < 12 {
+				return 0, errUnknownDuration
+			}
+			byteRate = int64(binary.LittleEndian.Uint32(format[8:12]))
+			if size%2 == 1 {
+				r.Seek(1, io.SeekCurrent)
+			}
+		case "data":
+			if byteRate == 0 {
+				return 0, errUnknownDuration
+			}
+			return time.Duration(size * int64(time.Second) / byteRate), nil
+		default:
+			// Chunks are padded to an even size
+			if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// flacDuration reads the total sample count and sample rate from the STREAMINFO block
+func flacDuration(r io.Reader) (time.Duration, error) {
+	header := make([]byte, 4+4+34)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, errUnknownDuration
+	}
+	if string(header[0:4]) != "fLaC" || header[4]&0x7F != 0 {
+		return 0, errUnknownDuration
+	}
+
+	info := header[8:]
+	rate := int64(info[10])<<12 | int64(info[11])<<4 | int64(info[12])>>4
+	samples := int64(info[13]&0x0F)<<32 | int64(binary.BigEndian.Uint32(info[14:18]))
+	if samples == 0 {
+		return 0, errUnknownDuration
+	}
+	return samplesToDuration(samples, rate), nil
+}
+
+// mp3Bitrates are the MPEG bitrates in kbps, indexed by [MPEG-1][layer-1][index]
+var mp3Bitrates = [2][3][16]int64{
+	{ // MPEG-2/2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+	{ // MPEG-1
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+}
+
+// mp3SampleRates are indexed by [version bits][index]
+var mp3SampleRates = [4][3]int64{
+	{11025, 12000, 8000},  // MPEG-2.5
+	{0, 0, 0},             // reserved
+	{22050, 24000, 16000}, // MPEG-2
+	{44100, 48000, 32000}, // MPEG-1
+}
+
+// mp3Duration uses the Xing/Info or VBRI frame count when present, and otherwise
+// estimates the duration from the first frame's bitrate
+func mp3Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	offset := int64(0)
+	id3 := make([]byte, 10)
+	if _, err := r.ReadAt(id3, 0); err == nil && string(id3[0:3]) == "ID3" {
+		// ID3v2 sizes are syncsafe integers
+		offset = 10 + (int64(id3[6])<<21 | int64(id3[7])<<14 | int64(id3[8])<<7 | int64(id3[9]))
+		if id3[5]&0x10 != 0 {
+			offset += 10
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+	n, _ := r.ReadAt(buf, offset)
+	buf = buf[:n]
+
+	for i := 0; i+4 <= len(buf); i++ {
+		if buf[i] != 0xFF || buf[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version := (buf[i+1] >> 3) & 0x03
+		layer := (buf[i+1] >> 1) & 0x03
+		bitrateIndex := buf[i+2] >> 4
+		rateIndex := (buf[i+2] >> 2) & 0x03
+		if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+
+		mpeg1 := 0
+		if version == 3 {
+			mpeg1 = 1
+		}
+		layerIndex := 3 - int(layer) // layer bits: 3 = Layer I, 1 = Layer III
+		bitrate := mp3Bitrates[mpeg1][layerIndex][bitrateIndex] * 1000
+		rate := mp3SampleRates[version][rateIndex]
+
+		samplesPerFrame := int64(1152)
+		switch {
+		case layerIndex == 0:
+			samplesPerFrame = 384
+		case layerIndex == 2 && mpeg1 == 0:
+			samplesPerFrame = 576
+		}
+
+		frame := buf[i:]
+		if frames := mp3FrameCount(frame, mpeg1 == 1, (buf[i+3]>>6) == 3); frames > 0 {
+			return samplesToDuration(frames*samplesPerFrame, rate), nil
+		}
+
+		audioBytes := size - offset - int64(i)
+		tag := make([]byte, 3)
+		if _, err := r.ReadAt(tag, size-128); err == nil && string(tag) == "TAG" {
+			audioBytes -= 128
+		}
+		return time.Duration(audioBytes * 8 * int64(time.Second) / bitrate), nil
+	}
+	return 0, errUnknownDuration
+}
+
+// mp3FrameCount returns the frame count from a Xing/Info or VBRI header in the first
+// frame, or 0 if there is none
+func mp3FrameCount(frame []byte, mpeg1, mono bool) int64 {
+	// The Xing header follows the side information, whose size depends on the stream
+	sideInfo := 17
+	switch {
+	case mpeg1 && !mono:
+		sideInfo = 32
+	case !mpeg1 && mono:
+		sideInfo = 9
+	}
+	if x := 4 + sideInfo; len(frame) >= x+12 {
+		tag := string(frame[x : x+4])
+		if (tag == "Xing" || tag == "Info") && frame[x+7]&0x01 != 0 {
+			return int64(binary.BigEndian.Uint32(frame[x+8 : x+12]))
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		return int64(binary.BigEndian.Uint32(frame[36+14 : 36+18]))
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AudioTags are the title and artist tagged in an audio file
+type AudioTags struct {
+	Title  string
+	Artist string
+}
+
+// ReadAudioTags reads the title and artist of an mp3 (ID3v2 or ID3v1), flac or ogg
+// (Vorbis comments or OpusTags) file. Tags that are missing are left empty.
+func ReadAudioTags(path string) (AudioTags, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return AudioTags{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return AudioTags{}, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		tags := id3v2Tags(file)
+		if tags.Title == "" {
+			tags = id3v1Tags(file, info.Size())
+		}
+		return tags, nil
+	case ".flac":
+		return flacTags(file), nil
+	case ".ogg", ".opus":
+		return oggTags(file), nil
+	}
+	return AudioTags{}, nil
+}
+
+// id3v2Tags reads the TIT2 and TPE1 frames (TT2 and TP1 in ID3v2.2) of an ID3v2 tag
+func id3v2Tags(r io.ReaderAt) AudioTags {
+	var tags AudioTags
+	header := make([]byte, 10)
+	if _, err := r.ReadAt(header, 0); err != nil || string(header[0:3]) != "ID3" {
+		return tags
+	}
+	version := header[3]
+	data := make([]byte, syncsafe(header[6:10]))
+	n, _ := r.ReadAt(data, 10)
+	data = data[:n]
+
+	// The extended header says nothing about titles
+	if header[5]&0x40 != 0 && version >= 3 && len(data) >= 4 {
+		size := int(binary.BigEndian.Uint32(data[0:4])) + 4
+		if version == 4 {
+			size = syncsafe(data[0:4])
+		}
+		data = data[min(size, len(data)):]
+	}
+
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		id := string(data[:idSize])
+		var size int
+		switch version {
+		case 2:
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 4:
+			size = syncsafe(data[4:8])
+		default:
+			size = int(binary.BigEndian.Uint32(data[4:8]))
+		}
+		if size <= 0 || headerSize+size > len(data) {
+			break
+		}
+		frame := data[headerSize : headerSize+size]
+		switch id {
+		case "TIT2", "TT2":
+			tags.Title = id3Text(frame)
+		case "TPE1", "TP1":
+			tags.Artist = id3Text(frame)
+		}
+		data = data[headerSize+size:]
+	}
+	return tags
+}
+
+// syncsafe decodes an ID3v2 syncsafe integer, which keeps the top bit of each byte clear
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+// id3Text decodes an ID3v2 text frame: an encoding byte followed by the text, of which
+// only the first value is kept
+func id3Text(frame []byte) string {
+	if len(frame) < 2 {
+		return ""
+	}
+	text := frame[1:]
+	switch frame[0] {
+	case 1: // UTF-16 with a byte order mark
+		return firstID3Value(decodeText(text))
+	case 2: // UTF-16BE
+		return firstID3Value(decodeUTF16(text, binary.BigEndian))
+	}
+	// ISO-8859-1 or UTF-8; decodeText reads the former as Windows-1252, a superset
+	return firstID3Value(decodeText(text))
+}
+
+// firstID3Value cuts text at the null that separates the values of ID3v2.4 frames
+func firstID3Value(text string) string {
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
+
+// id3v1Tags reads the fixed-size title and artist of an ID3v1 tag at the end of a file
+func id3v1Tags(r io.ReaderAt, size int64) AudioTags {
+	tag := make([]byte, 128)
+	if size < 128 {
+		return AudioTags{}
+	}
+	if _, err := r.ReadAt(tag, size-128); err != nil || string(tag[0:3]) != "TAG" {
+		return AudioTags{}
+	}
+	field := func(b []byte) string {
+		return strings.TrimSpace(decodeText(bytes.TrimRight(b, "\x00 ")))
+	}
+	return AudioTags{Title: field(tag[3:33]), Artist: field(tag[33:63])}
+}
+
+// flacTags reads the VORBIS_COMMENT metadata block of a flac file
+func flacTags(r io.Reader) AudioTags {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return AudioTags{}
+	}
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return AudioTags{}
+		}
+		last, blockType := header[0]&0x80 != 0, header[0]&0x7F
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if blockType == 4 {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(r, block); err != nil {
+				return AudioTags{}
+			}
+			return vorbisCommentTags(block)
+		}
+		if last {
+			return AudioTags{}
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return AudioTags{}
+		}
+	}
+}
+
+// oggTags reads the comment header of an Ogg Vorbis or Opus stream, which follows the
+// identification header near the start of the file
+func oggTags(r io.ReaderAt) AudioTags {
+	head := make([]byte, 64*1024)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	for _, magic := range []string{"\x03vorbis", "OpusTags"} {
+		if i := bytes.Index(head, []byte(magic)); i >= 0 {
+			return vorbisCommentTags(head[i+len(magic):])
+		}
+	}
+	return AudioTags{}
+}
+
+// vorbisCommentTags reads the TITLE and ARTIST fields of a Vorbis comment list, which
+// flac and ogg files share. A list cut short, as when it spans several Ogg pages, gives
+// the fields read so far.
+func vorbisCommentTags(data []byte) AudioTags {
+	var tags AudioTags
+	next := func() ([]byte, bool) {
+		if len(data) < 4 {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(data[0:4]))
+		if size < 0 || 4+size > len(data) {
+			return nil, false
+		}
+		field := data[4 : 4+size]
+		data = data[4+size:]
+		return field, true
+	}
+
+	if _, ok := next(); !ok { // vendor string
+		return tags
+	}
+	if len(data) < 4 {
+		return tags
+	}
+	count := binary.LittleEndian.Uint32(data[0:4])
+	data = data[4:]
+	for range count {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(string(comment), "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			if tags.Title == "" {
+				tags.Title = strings.TrimSpace(value)
+			}
+		case "ARTIST":
+			if tags.Artist == "" {
+				tags.Artist = strings.TrimSpace(value)
+			}
+		}
+	}
+	return tags
+}
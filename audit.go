@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditFailOn  string
+	auditRecheck bool
+
+	auditCmd = &cobra.Command{
+		Use:   "audit",
+		Short: "Check song folders for missing or empty audio, notes, album art and backgrounds",
+		Long: `Check the files of every matching song folder and report what's missing: songs
+without a notes file or playable audio fail to load in-game (errors), songs without
+album art show a blank cover (warnings), and songs without a background image or video
+use the default one (info).
+
+Results are cached per song folder and reused until the folder changes, so re-runs
+only look at the folders that did. --recheck ignores the cache, e.g. after replacing a
+file in place. audit fails while problems of --fail-on severity or worse remain
+(default: error).`,
+		Args: cobra.NoArgs,
+		RunE: runAudit,
+	}
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditFailOn, "fail-on", string(SeverityError), "Fail when problems of this severity or worse remain (error, warning, info)")
+	auditCmd.Flags().BoolVar(&auditRecheck, "recheck", false, "Check every folder again instead of reusing cached results")
+	rootCmd.AddCommand(auditCmd)
+}
+
+// unplayableAudioExtensions are audio formats found in song folders that the game doesn't
+// play, usually left over from converting a chart
+var unplayableAudioExtensions = []string{".m4a", ".aac", ".wma"}
+
+// backgroundStems are the names the game reads a song's background from, with an image
+// or a video extension
+var backgroundStems = []string{"background", "video"}
+
+// backgroundExtensions are the image and video formats of backgrounds
+var backgroundExtensions = []string{".png", ".jpg", ".jpeg", ".mp4", ".webm", ".avi", ".mpeg", ".mpg", ".vp8"}
+
+// auditFinding is a problem with the files of a song folder
+type auditFinding struct {
+	Rule     string       `json:"rule"` // notes, audio, album-art or background
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+// auditFiles checks the files of a song folder, or .sng archive, for the assets the game
+// loads
+func auditFiles(files []ManifestFile) []auditFinding {
+	var findings []auditFinding
+	find := func(names ...string) (ManifestFile, bool) {
+		for _, name := range names {
+			for _, file := range files {
+				if strings.EqualFold(file.Name, name) {
+					return file, true
+				}
+			}
+		}
+		return ManifestFile{}, false
+	}
+	empty := func(rule string, severity LintSeverity, file ManifestFile) {
+		findings = append(findings, auditFinding{rule, severity, fmt.Sprintf("%s is empty", file.Name)})
+	}
+
+	if notes, ok := find(chartFiles...); !ok {
+		findings = append(findings, auditFinding{"notes", SeverityError, "no notes.chart or notes.mid"})
+	} else if notes.Size == 0 {
+		empty("notes", SeverityError, notes)
+	}
+
+	var playable, unplayable, emptied []string
+	for _, file := range files {
+		ext := strings.ToLower(path.Ext(file.Name))
+		stem := strings.ToLower(strings.TrimSuffix(file.Name, path.Ext(file.Name)))
+		if !containsFold(audioStems, stem) {
+			continue
+		}
+		switch {
+		case containsFold(audioExtensions, ext) && file.Size == 0:
+			empty("audio", SeverityError, file)
+			emptied = append(emptied, file.Name)
+		case containsFold(audioExtensions, ext):
+			playable = append(playable, file.Name)
+		case containsFold(unplayableAudioExtensions, ext):
+			unplayable = append(unplayable, file.Name)
+		}
+	}
+	if len(playable) == 0 && len(unplayable) > 0 {
+		findings = append(findings, auditFinding{"audio", SeverityError, fmt.Sprintf("no audio the game can play, only %s", strings.Join(unplayable, ", "))})
+	} else if len(playable) == 0 && len(emptied) == 0 {
+		findings = append(findings, auditFinding{"audio", SeverityError, "no audio files"})
+	}
+
+	if art, ok := find(albumArtNames...); !ok {
+		findings = append(findings, auditFinding{"album-art", SeverityWarning, "no album art (album.png or album.jpg)"})
+	} else if art.Size == 0 {
+		empty("album-art", SeverityWarning, art)
+	}
+
+	var backgrounds []string
+	for _, stem := range backgroundStems {
+		for _, ext := range backgroundExtensions {
+			backgrounds = append(backgrounds, stem+ext)
+		}
+	}
+	if _, ok := find(backgrounds...); !ok {
+		findings = append(findings, auditFinding{"background", SeverityInfo, "no background image or video"})
+	}
+	return findings
+}
+
+// auditCacheVersion is bumped when the checks change, so older results are redone
+const auditCacheVersion = 1
+
+// auditCache holds the findings of the last audit of a library per song folder, with the
+// folder's mod time when it was checked
+type auditCache struct {
+	Version int                   `json:"version"`
+	Folders map[string]auditEntry `json:"folders"`
+	changed bool
+}
+
+// auditEntry is the cached audit of one song folder
+type auditEntry struct {
+	ModTime  string         `json:"mod_time"`
+	Findings []auditFinding `json:"findings,omitempty"`
+}
+
+// auditCacheFile returns where the audit results of the scanner's library are cached,
+// next to its cache so that cache gc handles both
+func (s *Scanner) auditCacheFile() string {
+	return strings.TrimSuffix(s.cacheFile, ".json") + ".audit.json"
+}
+
+// loadAuditCache reads an audit cache, starting afresh if it's missing, unreadable or
+// from another version
+func loadAuditCache(path string) *auditCache {
+	cache := &auditCache{Version: auditCacheVersion, Folders: make(map[string]auditEntry)}
+	if auditRecheck {
+		return cache
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var cached auditCache
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Version != auditCacheVersion || cached.Folders == nil {
+		return cache
+	}
+	return &cached
+}
+
+// save writes the audit cache if anything in it changed
+func (c *auditCache) save(path string) error {
+	if !c.changed {
+		touchFile(path)
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// auditSong returns the findings for a song's folder, from the cache while the folder
+// (or .sng file) hasn't changed since it was last checked. Adding, removing or renaming
+// a file changes the folder.
+func (c *auditCache) auditSong(song *Song) ([]auditFinding, error) {
+	folder := songFolder(song)
+	info, err := os.Stat(folder)
+	if err != nil {
+		return nil, err
+	}
+	modTime := info.ModTime().UTC().Format(time.RFC3339Nano)
+	if entry, ok := c.Folders[folder]; ok && entry.ModTime == modTime {
+		return entry.Findings, nil
+	}
+	files, err := localFolderFiles(song)
+	if err != nil {
+		return nil, err
+	}
+	findings := auditFiles(files)
+	c.Folders[folder] = auditEntry{ModTime: modTime, Findings: findings}
+	c.changed = true
+	return findings, nil
+}
+
+func runAudit(cmd *cobra.Command, args []string) error {
+	failOn, err := parseSeverity(auditFailOn)
+	if err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("audit needs a local library")
+	}
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	caches := make(map[string]*auditCache)
+	var issues []LintIssueRecord
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		root := songRoot(song)
+		cache, ok := caches[root]
+		if !ok {
+			cache = loadAuditCache(NewScanner(root, ScanOptions{}).auditCacheFile())
+			caches[root] = cache
+		}
+		findings, err := cache.auditSong(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to audit %s: %v\n", songFolder(song), err)
+			continue
+		}
+		for _, finding := range findings {
+			issues = append(issues, LintIssueRecord{Path: songFolder(song), Rule: finding.Rule, Severity: finding.Severity, Message: finding.Message})
+		}
+	}
+	for root, cache := range caches {
+		if err := cache.save(NewScanner(root, ScanOptions{}).auditCacheFile()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save audit cache: %v\n", err)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Severity.rank() < issues[j].Severity.rank() })
+
+	report := LintReport{SchemaVersion: SchemaVersion, Checked: len(songs), Counts: make(map[LintSeverity]int), Issues: issues}
+	if report.Issues == nil {
+		report.Issues = []LintIssueRecord{}
+	}
+	failing := 0
+	unloadable := make(map[string]bool)
+	for _, issue := range issues {
+		report.Counts[issue.Severity]++
+		if issue.Severity.rank() <= failOn.rank() {
+			failing++
+		}
+		if issue.Severity == SeverityError {
+			unloadable[issue.Path] = true
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeLintReport(writer, report)
+	}
+
+	fmt.Fprintf(os.Stderr, "Audited %d song(s): %d won't load, %d warning(s), %d info\n", len(songs),
+		len(unloadable), report.Counts[SeverityWarning], report.Counts[SeverityInfo])
+	if failing > 0 {
+		return fmt.Errorf("%d audit problem(s) of severity %s or worse found", failing, failOn)
+	}
+	return nil
+}
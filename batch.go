@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <queries.jsonl>",
+	Short: "Run many queries against the library in one process",
+	Long: `Run every query in a JSON Lines file ('-' for stdin) against a single loaded library,
+writing one JSON result line per query. Each query line holds filter criteria (the same
+keys as --filter-file) plus optional "id", "sort", "count" and "limit" keys:
+
+  {"id": "plini", "artist": "plini", "sort": "year"}
+  {"id": "long-drums", "instrument": "drums", "length": ">6:00", "count": true}
+
+Filter flags given on the command line apply to every query.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runBatch,
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+}
+
+// BatchQuery is a single query line in a batch file
+type BatchQuery struct {
+	ID    string `json:"id"`
+	Sort  string `json:"sort"`
+	Count bool   `json:"count"`
+	Limit int    `json:"limit"`
+	FilterSpec
+}
+
+// BatchResult is the output line written for each query
+type BatchResult struct {
+	SchemaVersion int          `json:"schema_version"`
+	ID            string       `json:"id"`
+	Line          int          `json:"line"`
+	Count         int          `json:"count"`
+	Total         int          `json:"total"`
+	Songs         []SongRecord `json:"songs,omitempty"`
+	Error         string       `json:"error,omitempty"`
+}
+
+// batchLine is a parsed query line, with the filter spec it runs or why it can't
+type batchLine struct {
+	number int
+	query  BatchQuery
+	spec   FilterSpec
+	err    error
+}
+
+func runBatch(cmd *cobra.Command, args []string) error {
+	var input io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open queries: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	baseSpec, err := buildFilterSpec()
+	if err != nil {
+		return err
+	}
+	if err := validateFilterSpec(baseSpec); err != nil {
+		return err
+	}
+	if err := validateInstrumentSource(instrumentSource); err != nil {
+		return err
+	}
+
+	// Read every query first, so notes files and scores are loaded once if any needs them
+	var queries []batchLine
+	readsCharts, usesScores := false, false
+	lines := bufio.NewScanner(input)
+	lines.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	lineNumber := 0
+	for lines.Scan() {
+		lineNumber++
+		line := lines.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		query, spec, err := parseBatchQuery(line, baseSpec)
+		queries = append(queries, batchLine{number: lineNumber, query: query, spec: spec, err: err})
+		if err == nil {
+			readsCharts = readsCharts || spec.readsCharts()
+			usesScores = usesScores || spec.usesScores() || strings.EqualFold(cmp.Or(query.Sort, sortBy), sortScore)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return err
+	}
+
+	songs, err := loadLibrary()
+	if err != nil {
+		return err
+	}
+	if readsCharts {
+		if err := loadChartedDifficulties(songs); err != nil {
+			return err
+		}
+	}
+	if usesScores {
+		if err := loadSongScores(songs); err != nil {
+			return err
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	buffered := bufio.NewWriter(writer)
+	defer buffered.Flush()
+	encoder := json.NewEncoder(buffered)
+
+	// Most queries search by name, artist or charter, so index those once up front
+	index := NewSearchIndex(songs)
+
+	for _, line := range queries {
+		result := BatchResult{ID: line.query.ID, Total: len(songs)}
+		if line.err != nil {
+			result.Error = line.err.Error()
+		} else {
+			result = runBatchQuery(line.query, line.spec, index)
+		}
+		result.SchemaVersion = SchemaVersion
+		result.Line = line.number
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBatchQuery parses a query line and checks the filter spec it runs, the command
+// line filters plus its own
+func parseBatchQuery(line []byte, baseSpec FilterSpec) (BatchQuery, FilterSpec, error) {
+	// Reject misspelled keys, which would otherwise drop a criterion and match more
+	// songs than asked for, as --filter-file does
+	var query BatchQuery
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&query); err != nil {
+		return BatchQuery{}, FilterSpec{}, fmt.Errorf("invalid query: %w", err)
+	}
+	if decoder.More() {
+		return BatchQuery{}, FilterSpec{}, fmt.Errorf("invalid query: more than one JSON value on the line")
+	}
+
+	spec := baseSpec
+	spec.All = append(append([]FilterSpec{}, baseSpec.All...), query.FilterSpec)
+	if err := validateFilterSpec(spec); err != nil {
+		return query, FilterSpec{}, fmt.Errorf("invalid query: %w", err)
+	}
+	return query, spec, nil
+}
+
+// runBatchQuery runs a single parsed query
+func runBatchQuery(query BatchQuery, spec FilterSpec, index *SearchIndex) BatchResult {
+	songs := index.songs
+	result := BatchResult{ID: query.ID, Total: len(songs)}
+	filter, err := NewFilter(spec)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid query: %v", err)
+		return result
+	}
+	matched := filter.Apply(index.Narrow(query.FilterSpec))
+
+	// Apply returns the input slice when nothing filters, so sort a copy
+	matched = append([]*Song(nil), matched...)
+	sortKey := query.Sort
+	if sortKey == "" {
+		sortKey = sortBy
+	}
+	NewSorter(sortKey).RankBy(spec.nameQueries()).Sort(matched)
+
+	result.Count = len(matched)
+	if !query.Count {
+		if query.Limit > 0 && len(matched) > query.Limit {
+			matched = matched[:query.Limit]
+		}
+		result.Songs = newSongRecords(matched)
+	}
+	return result
+}
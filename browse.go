@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+var browseCmd = &cobra.Command{
+	Use:   "browse",
+	Short: "Browse the matching songs in an interactive terminal view",
+	Long: `Open a full-screen view of the matching songs. Typing searches names (fuzzy) and artists
+as you type, Tab and Shift-Tab change the sort column, Ctrl-R reverses the order, and the pane
+at the bottom shows every detail of the selected song next to its album art (see --art). Enter
+quits and prints the selected song's path; Esc or Ctrl-C quits without printing anything.
+
+--tui-theme high-contrast (or high-contrast-light, for light terminals) swaps dimmed text
+and reverse video for bright, bold colors.`,
+	Args: cobra.NoArgs,
+	RunE: runBrowse,
+}
+
+var browseThemeName string
+
+func init() {
+	browseCmd.Flags().StringVar(&browseThemeName, "tui-theme", ThemeDefault, "Colors of the view: default, high-contrast or high-contrast-light")
+	rootCmd.AddCommand(browseCmd)
+}
+
+// browseColumn is a column of the browse view
+type browseColumn struct {
+	Header string
+	Sort   string // --sort field the column sorts by
+	Field  string // filter field highlighted in the column, if any
+	Width  int    // fixed width; 0 shares the width left over
+	Right  bool
+	Value  func(song *Song) string
+}
+
+// browseColumns are the columns of the browse view
+var browseColumns = []browseColumn{
+	{Header: "Name", Sort: "name", Field: "name", Value: func(s *Song) string { return s.Name }},
+	{Header: "Artist", Sort: "artist", Field: "artist", Value: func(s *Song) string { return s.Artist }},
+	{Header: "Year", Sort: "year", Width: 5, Right: true, Value: func(s *Song) string { return optionalInt(s.Year) }},
+	{Header: "Length", Sort: "length", Width: 7, Right: true, Value: func(s *Song) string { return s.FormatLength() }},
+	{Header: "Genre", Sort: "genre", Width: 14, Value: func(s *Song) string { return s.Genre }},
+	{Header: "Charter", Sort: "charter", Width: 16, Value: plainCharters},
+}
+
+// browser is the state of the browse view
+type browser struct {
+	songs   []*Song      // songs matching the command line filters
+	index   *SearchIndex // of songs, so each keystroke only filters the songs that can match
+	visible []*Song      // songs matching the search as well, sorted
+	filter  *Filter      // the search, for highlighting
+
+	query   string
+	column  int // index of the sort column in browseColumns
+	reverse bool
+	cursor  int // index of the selected song in visible
+	offset  int // index of the first song on screen
+	width   int
+	height  int
+
+	art      string // resolved --art protocol
+	artCache map[browseArtKey]*AlbumArt
+	theme    browseTheme
+}
+
+// browseArtKey identifies album art drawn for the detail pane
+type browseArtKey struct {
+	song       *Song
+	cols, rows int
+}
+
+// albumArt returns the album art of song drawn for the detail pane, or nil if there is none
+func (b *browser) albumArt(song *Song, rows int) *AlbumArt {
+	key := browseArtKey{song, min(2*rows, b.width/3), rows}
+	art, ok := b.artCache[key]
+	if !ok {
+		art = renderAlbumArt(song, b.art, key.cols, key.rows)
+		b.artCache[key] = art
+	}
+	return art
+}
+
+// newBrowser creates the view of songs, sorted by the column of sortBy if there is one
+func newBrowser(songs []*Song, sortBy string) *browser {
+	b := &browser{songs: songs, index: NewSearchIndex(songs), column: 1, art: ArtNone, artCache: make(map[browseArtKey]*AlbumArt), theme: browseThemes[ThemeDefault]}
+	for i, column := range browseColumns {
+		if column.Sort == strings.ToLower(sortBy) {
+			b.column = i
+		}
+	}
+	b.refresh()
+	return b
+}
+
+// refresh applies the search and sort order after either changed
+func (b *browser) refresh() {
+	var selected *Song
+	if b.cursor < len(b.visible) {
+		selected = b.visible[b.cursor]
+	}
+
+	spec := FilterSpec{}
+	if b.query != "" {
+		spec.Any = []FilterSpec{{Name: b.query}, {Artist: b.query}}
+	}
+	// Name and artist searches have nothing to fail on
+	b.filter, _ = NewFilter(spec)
+	// Without a search Apply returns the indexed songs themselves, whose order the index
+	// relies on, so sort a copy
+	b.visible = append([]*Song(nil), b.filter.Apply(b.index.Narrow(spec))...)
+	NewSorter(browseColumns[b.column].Sort).Sort(b.visible)
+	if b.reverse {
+		for i, j := 0, len(b.visible)-1; i < j; i, j = i+1, j-1 {
+			b.visible[i], b.visible[j] = b.visible[j], b.visible[i]
+		}
+	}
+
+	// Keep the selected song selected if it still matches
+	b.cursor = 0
+	for i, song := range b.visible {
+		if song == selected {
+			b.cursor = i
+			break
+		}
+	}
+}
+
+// layout returns the number of list rows and detail pane lines that fit on screen: the
+// rest of the screen is the search line, the header, a separator and the help line
+func (b *browser) layout() (int, int) {
+	available := max(b.height-4, 2)
+	detail := min(12, available/3)
+	return available - detail, detail
+}
+
+// move moves the selection by delta songs, scrolling the list to keep it on screen
+func (b *browser) move(delta int) {
+	b.cursor = max(0, min(b.cursor+delta, len(b.visible)-1))
+	rows, _ := b.layout()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+	b.offset = max(0, min(b.offset, len(b.visible)-rows))
+}
+
+// handleKey applies a key press, reporting whether the view should close
+func (b *browser) handleKey(key string) bool {
+	rows, _ := b.layout()
+	switch key {
+	case "esc", "ctrl-c":
+		return true
+	case "enter":
+		return len(b.visible) > 0
+	case "up":
+		b.move(-1)
+	case "down":
+		b.move(1)
+	case "pgup":
+		b.move(-rows)
+	case "pgdn":
+		b.move(rows)
+	case "home":
+		b.move(-len(b.visible))
+	case "end":
+		b.move(len(b.visible))
+	case "tab", "shift-tab":
+		step := 1
+		if key == "shift-tab" {
+			step = len(browseColumns) - 1
+		}
+		b.column = (b.column + step) % len(browseColumns)
+		b.refresh()
+		b.move(0)
+	case "ctrl-r":
+		b.reverse = !b.reverse
+		b.refresh()
+		b.move(0)
+	case "backspace":
+		if b.query != "" {
+			_, size := utf8.DecodeLastRuneInString(b.query)
+			b.query = b.query[:len(b.query)-size]
+			b.refresh()
+			b.move(0)
+		}
+	case "ctrl-u":
+		b.query = ""
+		b.refresh()
+		b.move(0)
+	default:
+		if strings.HasPrefix(key, "text:") {
+			b.query += strings.TrimPrefix(key, "text:")
+			b.refresh()
+			b.move(0)
+		}
+	}
+	return false
+}
+
+// selected returns the selected song, or nil if no song matches the search
+func (b *browser) selected() *Song {
+	if b.cursor < len(b.visible) {
+		return b.visible[b.cursor]
+	}
+	return nil
+}
+
+// columnWidths fits the columns to the screen, sharing what the fixed-width columns
+// leave between the others
+func (b *browser) columnWidths() []int {
+	widths := make([]int, len(browseColumns))
+	left := b.width - 2*(len(browseColumns)-1)
+	shared := 0
+	for i, column := range browseColumns {
+		if column.Width > 0 {
+			widths[i] = column.Width
+			left -= column.Width
+		} else {
+			shared++
+		}
+	}
+	for i, column := range browseColumns {
+		if column.Width == 0 {
+			widths[i] = max(left/shared, 4)
+		}
+	}
+	return widths
+}
+
+// render draws the whole view
+func (b *browser) render(w io.Writer) {
+	rows, detail := b.layout()
+	widths := b.columnWidths()
+	output := &Output{writer: os.Stdout, highlighter: b.filter, matchStyle: b.theme.Match}
+	var lines []string
+
+	order := "▲"
+	if b.reverse {
+		order = "▼"
+	}
+	status := fmt.Sprintf("%d of %d song(s), by %s %s", len(b.visible), len(b.songs), browseColumns[b.column].Sort, order)
+	search := "Search: " + b.query + "▏"
+	lines = append(lines, padWidth(truncateWidth(search, b.width-displayWidth(status)-2), b.width-displayWidth(status))+status)
+
+	header := make([]string, len(browseColumns))
+	for i, column := range browseColumns {
+		name := column.Header
+		if i == b.column {
+			name += order
+		}
+		header[i] = align(truncateWidth(name, widths[i]), widths[i], column.Right)
+	}
+	lines = append(lines, styled(strings.Join(header, "  "), b.theme.Header))
+
+	for row := 0; row < rows; row++ {
+		i := b.offset + row
+		if i >= len(b.visible) {
+			lines = append(lines, "")
+			continue
+		}
+		song := b.visible[i]
+		cells := make([]string, len(browseColumns))
+		for c, column := range browseColumns {
+			value := truncateWidth(column.Value(song), widths[c])
+			cell := align(value, widths[c], column.Right)
+			if column.Field != "" && i != b.cursor {
+				cell = strings.Replace(cell, value, output.highlight(column.Field, value), 1)
+			}
+			cells[c] = cell
+		}
+		line := strings.Join(cells, "  ")
+		if i == b.cursor {
+			line = styled(line, b.theme.Selected)
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, styled(strings.Repeat("─", b.width), b.theme.Muted))
+	paneTop := len(lines)
+
+	// The album art goes to the left of the details
+	var details []string
+	var art *AlbumArt
+	if song := b.selected(); song != nil {
+		var buf bytes.Buffer
+		(&Output{writer: &buf}).WriteDetail(song)
+		details = strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+		art = b.albumArt(song, detail)
+	}
+	for i := 0; i < detail; i++ {
+		line, textWidth := "", b.width
+		if art != nil {
+			if i < len(art.Lines) {
+				line = art.Lines[i]
+			}
+			line = padWidth(line, art.Cols+2)
+			textWidth -= art.Cols + 2
+		}
+		if i < len(details) {
+			line += truncateWidth(details[i], textWidth)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, styled(truncateWidth("type to search  ↑↓ PgUp PgDn select  Tab sort  Ctrl-R reverse  Ctrl-U clear  Enter print path  Esc quit", b.width), b.theme.Muted))
+
+	var frame strings.Builder
+	if b.art == ArtKitty {
+		frame.WriteString(kittyClear)
+	}
+	frame.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			frame.WriteString("\r\n")
+		}
+		frame.WriteString(line)
+		frame.WriteString("\x1b[K")
+	}
+	frame.WriteString("\x1b[J")
+	if art != nil && art.Graphics != "" {
+		// Images are drawn over the cells left blank for them, keeping the cursor where it was
+		fmt.Fprintf(&frame, "\x1b7\x1b[%d;1H%s\x1b8", paneTop+1, art.Graphics)
+	}
+	io.WriteString(w, frame.String())
+}
+
+// parseKeys splits a chunk of terminal input into key names: "up", "enter" and so on
+// for special keys, and "text:..." for typed characters
+func parseKeys(input []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1bOA": "up", "\x1bOB": "down",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdn",
+		"\x1b[H": "home", "\x1b[F": "end", "\x1bOH": "home", "\x1bOF": "end",
+		"\x1b[1~": "home", "\x1b[4~": "end", "\x1b[Z": "shift-tab",
+	}
+	controls := map[byte]string{
+		0x03: "ctrl-c", 0x09: "tab", 0x0d: "enter", 0x0a: "enter", 0x12: "ctrl-r",
+		0x15: "ctrl-u", 0x7f: "backspace", 0x08: "backspace",
+	}
+
+	var keys []string
+	for len(input) > 0 {
+		if input[0] == 0x1b {
+			if len(input) == 1 {
+				keys = append(keys, "esc")
+				break
+			}
+			matched := false
+			for sequence, name := range sequences {
+				if bytes.HasPrefix(input, []byte(sequence)) {
+					keys = append(keys, name)
+					input = input[len(sequence):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// Skip an unknown escape sequence up to its final byte
+				end := 2
+				for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+					end++
+				}
+				input = input[min(end+1, len(input)):]
+			}
+			continue
+		}
+		if name, ok := controls[input[0]]; ok {
+			keys = append(keys, name)
+			input = input[1:]
+			continue
+		}
+		r, size := utf8.DecodeRune(input)
+		if r >= 0x20 && r != utf8.RuneError {
+			keys = append(keys, "text:"+string(input[:size]))
+		}
+		input = input[size:]
+	}
+	return keys
+}
+
+func runBrowse(cmd *cobra.Command, args []string) error {
+	if !isInteractive() {
+		return fmt.Errorf("browse needs a terminal; use --format table to list songs instead")
+	}
+	protocol, err := resolveArtProtocol(artProtocol)
+	if err != nil {
+		return err
+	}
+	if userConfig.TUITheme != "" && !cmd.Flags().Changed("tui-theme") {
+		browseThemeName = userConfig.TUITheme
+	}
+	theme, err := lookupBrowseTheme(browseThemeName)
+	if err != nil {
+		return err
+	}
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	song, err := browse(songs, sortBy, protocol, theme)
+	if err != nil || song == nil {
+		return err
+	}
+	fmt.Println(song.Path)
+	return nil
+}
+
+// browse runs the browse view until it's closed, returning the song chosen with Enter.
+// Album art is drawn with the given --art protocol, and the rest in the colors of theme.
+func browse(songs []*Song, sortBy, art string, theme browseTheme) (*Song, error) {
+	in := int(os.Stdin.Fd())
+	restore, err := makeRaw(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	defer restore()
+
+	// Use the alternate screen, so the shell's scrollback is left as it was
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+	if art == ArtKitty {
+		defer fmt.Print(kittyClear)
+	}
+
+	b := newBrowser(songs, sortBy)
+	b.art = art
+	b.theme = theme
+	resize := func() {
+		if width, height, err := terminalSize(int(os.Stdout.Fd())); err == nil {
+			b.width, b.height = width, height
+		} else {
+			b.width, b.height = 80, 24
+		}
+		b.move(0)
+	}
+	resize()
+
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	input := make(chan []byte)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(input)
+				return
+			}
+			input <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	ctx := commandContext()
+	for {
+		b.render(os.Stdout)
+		select {
+		case <-ctx.Done():
+			return nil, errInterrupted
+		case <-resized:
+			resize()
+		case chunk, ok := <-input:
+			if !ok {
+				return nil, nil
+			}
+			for _, key := range parseKeys(chunk) {
+				if b.handleKey(key) {
+					if key == "enter" {
+						return b.selected(), nil
+					}
+					return nil, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// cacheBackups is how many previous good caches are kept next to the cache, newest first
+const cacheBackups = 2
+
+// cacheBackupFile returns the path of the nth most recent cache backup, from 1
+func (s *Scanner) cacheBackupFile(n int) string {
+	return fmt.Sprintf("%s.bak%d.json", strings.TrimSuffix(s.cacheFile, ".json"), n)
+}
+
+// rotateCacheBackups moves the current cache to the first backup slot, shifting the
+// older backups down and dropping the oldest
+func (s *Scanner) rotateCacheBackups() {
+	for n := cacheBackups; n > 1; n-- {
+		os.Rename(s.cacheBackupFile(n-1), s.cacheBackupFile(n))
+	}
+	if err := os.Rename(s.cacheFile, s.cacheBackupFile(1)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to back up the cache: %v\n", err)
+	}
+	s.cacheGood = false
+}
+
+// recoverCache handles a cache file that can't be read, typically one truncated by a
+// power loss: it warns and restores the most recent backup that reads, which the scan
+// then brings up to date. With no usable backup the library is rescanned.
+func (s *Scanner) recoverCache(cause error) (*Cache, error) {
+	for n := 1; n <= cacheBackups; n++ {
+		cache, err := readCacheFile(s.cacheBackupFile(n))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Warning: cache %s is corrupted (%v); restored the last good copy\n", s.cacheFile, cause)
+		if err := s.writeCache(cache); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save restored cache: %v\n", err)
+		}
+		return cache, nil
+	}
+	fmt.Fprintf(os.Stderr, "Warning: cache %s is corrupted (%v); rebuilding it\n", s.cacheFile, cause)
+	return nil, cause
+}
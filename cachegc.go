@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheTTL     string
+	cacheMaxSize string
+	cacheDryRun  bool
+
+	cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of scanned libraries",
+	}
+
+	cacheGCCmd = &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the caches of libraries that are gone or haven't been used in a while",
+		Long: `Remove stale files from the cache folder: the caches of libraries that no longer exist,
+caches not used within --cache-ttl, and the least recently used caches beyond
+--cache-max-size. Saved search results (--diff-last) are handled the same way.
+
+Without --cache-ttl or --cache-max-size, only the caches of missing libraries are
+removed. Caches of cloud libraries are never considered missing.`,
+		Args: cobra.NoArgs,
+		RunE: runCacheGC,
+	}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&cacheTTL, "cache-ttl", "", "", "Remove caches of libraries not used within this time (e.g. 30d, 2w or 12h) after each scan")
+	rootCmd.PersistentFlags().StringVarP(&cacheMaxSize, "cache-max-size", "", "", "Keep the cache folder under this size (e.g. 500MB) by removing the least recently used caches after each scan")
+	cacheGCCmd.Flags().BoolVar(&cacheDryRun, "dry-run", false, "List what would be removed without removing anything")
+	cacheCmd.AddCommand(cacheGCCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// cacheDir returns the folder holding the caches of every library: the one chosen in
+// setup, or a folder in the temp folder
+func cacheDir() string {
+	if userConfig.CacheDir != "" {
+		return userConfig.CacheDir
+	}
+	return filepath.Join(os.TempDir(), "cloneheroer")
+}
+
+// cacheGroupName matches the files of one cache: the library cache, its quick index,
+// audit results, backups and cloud mirror, or a saved search result
+var cacheGroupName = regexp.MustCompile(`^((?:cache|results)_[0-9a-f]{16})(?:\.json|\.idx\.json|\.audit\.json|\.bak\d+\.json|_remote)$`)
+
+// cacheGroup is a cache and the files that belong with it
+type cacheGroup struct {
+	name  string   // e.g. cache_384bc605d2041159
+	paths []string // files and folders of the cache
+	size  int64
+	used  time.Time // last time any of its files was written or read from
+	root  string    // library the cache is for, "" if unknown; only read by cache gc
+}
+
+// CacheLimits are the --cache-ttl and --cache-max-size limits; zero means no limit
+type CacheLimits struct {
+	TTL     time.Duration
+	MaxSize int64
+}
+
+// cacheLimits parses --cache-ttl and --cache-max-size
+func cacheLimits() (CacheLimits, error) {
+	var limits CacheLimits
+	var err error
+	if cacheTTL != "" {
+		if limits.TTL, err = parseTTL(cacheTTL); err != nil {
+			return CacheLimits{}, err
+		}
+	}
+	if cacheMaxSize != "" {
+		if limits.MaxSize, err = parseSize(cacheMaxSize); err != nil {
+			return CacheLimits{}, err
+		}
+	}
+	return limits, nil
+}
+
+// ttlPattern matches --cache-ttl values in days or weeks, which time.ParseDuration lacks
+var ttlPattern = regexp.MustCompile(`^(\d+)([dw])$`)
+
+// parseTTL parses a --cache-ttl value: a number of days or weeks (30d, 2w) or a duration
+// (12h)
+func parseTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	if matches := ttlPattern.FindStringSubmatch(strings.TrimSpace(value)); matches != nil {
+		n, _ := strconv.Atoi(matches[1])
+		ttl = time.Duration(n) * 24 * time.Hour
+		if matches[2] == "w" {
+			ttl *= 7
+		}
+	} else if d, err := time.ParseDuration(value); err == nil {
+		ttl = d
+	} else {
+		return 0, fmt.Errorf("invalid --cache-ttl %q (expected e.g. 30d, 2w or 12h)", value)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("invalid --cache-ttl %q: must be longer than 0", value)
+	}
+	return ttl, nil
+}
+
+// sizePattern matches --cache-max-size values
+var sizePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*([KMGT]?)i?B?$`)
+
+// parseSize parses a size such as 500MB or 2G, with binary units as formatSize prints them
+func parseSize(value string) (int64, error) {
+	matches := sizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid --cache-max-size %q (expected e.g. 500MB or 2GB)", value)
+	}
+	n, _ := strconv.ParseFloat(matches[1], 64)
+	exp := strings.Index("KMGT", strings.ToUpper(matches[2])) + 1
+	for range exp {
+		n *= 1024
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("invalid --cache-max-size %q: must be larger than 0", value)
+	}
+	return int64(n), nil
+}
+
+// listCacheGroups lists the caches in the cache folder, least recently used first
+func listCacheGroups() ([]*cacheGroup, error) {
+	entries, err := os.ReadDir(cacheDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*cacheGroup)
+	for _, entry := range entries {
+		matches := cacheGroupName.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+		group, ok := groups[matches[1]]
+		if !ok {
+			group = &cacheGroup{name: matches[1]}
+			groups[matches[1]] = group
+		}
+		path := filepath.Join(cacheDir(), entry.Name())
+		group.paths = append(group.paths, path)
+		filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				group.size += info.Size()
+				if info.ModTime().After(group.used) {
+					group.used = info.ModTime()
+				}
+			}
+			return nil
+		})
+	}
+
+	sorted := make([]*cacheGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if !sorted[i].used.Equal(sorted[j].used) {
+			return sorted[i].used.Before(sorted[j].used)
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted, nil
+}
+
+// cacheRoot returns the library a cache or saved search result was written for, or ""
+// for files written before it was recorded
+func cacheRoot(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	var header struct {
+		Root      string `json:"root"`
+		Directory string `json:"directory"`
+	}
+	if err := json.NewDecoder(file).Decode(&header); err != nil {
+		return ""
+	}
+	return header.Root + header.Directory
+}
+
+// staleReason returns why a cache should be removed, or "" to keep it. Missing libraries
+// only count when checkMissing is set.
+func (group *cacheGroup) staleReason(limits CacheLimits, now time.Time, checkMissing bool) string {
+	if checkMissing {
+		group.root = cacheRoot(filepath.Join(cacheDir(), group.name+".json"))
+	}
+	if checkMissing && group.root != "" && !isRemoteLocation(group.root) {
+		if _, err := os.Stat(group.root); os.IsNotExist(err) {
+			return "library no longer exists"
+		}
+	}
+	if limits.TTL > 0 && now.Sub(group.used) > limits.TTL {
+		return fmt.Sprintf("not used for %d day(s)", int(now.Sub(group.used).Hours()/24))
+	}
+	return ""
+}
+
+// cacheRemoval is a cache picked by collectCaches, and why
+type cacheRemoval struct {
+	group  *cacheGroup
+	reason string
+}
+
+// collectCaches picks the caches to remove: stale ones, then the least recently used
+// until the rest fit in MaxSize. The caches in keep, those of the library in use, are
+// never removed.
+func collectCaches(limits CacheLimits, checkMissing bool, keep ...string) ([]cacheRemoval, error) {
+	groups, err := listCacheGroups()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var removals []cacheRemoval
+	var kept []*cacheGroup
+	var total int64
+	for _, group := range groups {
+		reason := group.staleReason(limits, now, checkMissing)
+		if reason != "" && !containsFold(keep, group.name) {
+			removals = append(removals, cacheRemoval{group, reason})
+			continue
+		}
+		kept = append(kept, group)
+		total += group.size
+	}
+	if limits.MaxSize > 0 {
+		// kept is least recently used first
+		for _, group := range kept {
+			if total <= limits.MaxSize {
+				break
+			}
+			if containsFold(keep, group.name) {
+				continue
+			}
+			removals = append(removals, cacheRemoval{group, fmt.Sprintf("over the %s cache size limit", formatSize(limits.MaxSize))})
+			total -= group.size
+		}
+	}
+	return removals, nil
+}
+
+// removeCache deletes the files of a cache
+func removeCache(group *cacheGroup) error {
+	for _, path := range group.paths {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneCaches applies --cache-ttl and --cache-max-size after a scan, keeping the caches
+// of the scanned libraries. Failures are only warned about: the scan itself succeeded.
+func pruneCaches(limits CacheLimits, scanners ...*Scanner) {
+	if limits.TTL == 0 && limits.MaxSize == 0 {
+		return
+	}
+	keep := make([]string, len(scanners))
+	for i, scanner := range scanners {
+		keep[i] = scanner.cacheName()
+	}
+	removals, err := collectCaches(limits, false, keep...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to prune the cache: %v\n", err)
+		return
+	}
+	for _, removal := range removals {
+		if err := removeCache(removal.group); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove cache %s: %v\n", removal.group.name, err)
+		}
+	}
+}
+
+// absLibrary returns the absolute path of a local library, or a cloud location as is
+func absLibrary(dir string) string {
+	if isRemoteLocation(dir) {
+		return dir
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
+	}
+	return dir
+}
+
+// cacheName returns the name of the scanner's cache, the common prefix of its files
+func (s *Scanner) cacheName() string {
+	return strings.TrimSuffix(filepath.Base(s.cacheFile), ".json")
+}
+
+// touchFile marks a cache file as used now, for --cache-ttl and --cache-max-size, when it
+// is read without being rewritten
+func touchFile(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+func runCacheGC(cmd *cobra.Command, args []string) error {
+	limits, err := cacheLimits()
+	if err != nil {
+		return err
+	}
+	removals, err := collectCaches(limits, true)
+	if err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	var freed int64
+	for _, removal := range removals {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		group := removal.group
+		root := group.root
+		if root == "" {
+			root = "unknown library"
+		}
+		fmt.Fprintf(writer, "remove: %s (%s, %s, last used %s): %s\n", group.name, root, formatSize(group.size), group.used.Format("2006-01-02"), removal.reason)
+		if cacheDryRun {
+			continue
+		}
+		if err := removeCache(group); err != nil {
+			return fmt.Errorf("failed to remove cache %s: %w", group.name, err)
+		}
+		freed += group.size
+	}
+
+	if cacheDryRun {
+		fmt.Fprintf(os.Stderr, "Would remove %d cache(s)\n", len(removals))
+	} else {
+		fmt.Fprintf(os.Stderr, "Removed %d cache(s), freed %s\n", len(removals), formatSize(freed))
+	}
+	return nil
+}
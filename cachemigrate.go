@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// CacheSchemaVersion is the version of the cache format written by this build. Bump it
+// and add a migration whenever a change to CacheEntry or Cache would leave older caches
+// missing data.
+const CacheSchemaVersion = 5
+
+// cacheMigration upgrades a cache by one schema version. Migrations run in order, each
+// seeing the result of the previous one.
+type cacheMigration struct {
+	Description string
+	Migrate     func(s *Scanner, cache *Cache) error
+}
+
+// cacheMigrations[v] upgrades a version v cache to version v+1. Caches written before
+// versioning have no version and count as version 0.
+var cacheMigrations = []cacheMigration{
+	{"move the single Charter field to Charters", migrateCharters},
+	{"re-read song.ini difficulty keys for pro and unknown instruments", migrateInstruments},
+	{"strip rich text tags from text fields", migrateRichText},
+	{"checksum notes files to detect moved songs", migrateChecksums},
+	{"re-read song.ini difficulty keys to keep tier 0 parts", migrateInstruments},
+}
+
+// migrateCache brings a cache loaded from disk up to CacheSchemaVersion, reporting
+// whether anything changed. Caches from a newer build can't be read.
+func (s *Scanner) migrateCache(cache *Cache) (bool, error) {
+	if cache.Version > CacheSchemaVersion {
+		return false, fmt.Errorf("cache schema %d is newer than this version supports (%d)", cache.Version, CacheSchemaVersion)
+	}
+	if cache.Version == CacheSchemaVersion {
+		return false, nil
+	}
+	for cache.Version < CacheSchemaVersion {
+		migration := cacheMigrations[cache.Version]
+		if err := migration.Migrate(s, cache); err != nil {
+			return false, fmt.Errorf("cache migration to schema %d (%s) failed: %w", cache.Version+1, migration.Description, err)
+		}
+		cache.Version++
+	}
+	return true, nil
+}
+
+// migrateCharters moves the charter of caches written before songs could have several
+// charters into Charters
+func migrateCharters(s *Scanner, cache *Cache) error {
+	for i := range cache.Songs {
+		entry := &cache.Songs[i]
+		if len(entry.Charters) == 0 && entry.Charter != "" {
+			entry.Charters = []string{entry.Charter}
+		}
+		entry.Charter = ""
+	}
+	return nil
+}
+
+// migrateInstruments re-reads the difficulty keys of every cached song, which older
+// caches dropped for pro parts, diff_* keys of other games and tier 0 parts. Only song.ini files that
+// are still there are read; the rest are refreshed by the next scan that sees them change.
+func migrateInstruments(s *Scanner, cache *Cache) error {
+	for i := range cache.Songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		entry := &cache.Songs[i]
+		if _, err := os.Stat(entry.Path); err != nil {
+			continue
+		}
+		parse := ParseSong
+		if entry.Packed {
+			parse = ParseSng
+		}
+		song, err := parse(entry.Path)
+		if err != nil {
+			continue
+		}
+		for inst, diff := range song.Instruments {
+			if entry.Instruments == nil {
+				entry.Instruments = make(map[string]int)
+			}
+			entry.Instruments[string(inst)] = diff
+		}
+	}
+	return nil
+}
+
+// migrateRichText sanitizes the text fields of songs cached before tags were stripped
+// at parse time
+func migrateRichText(s *Scanner, cache *Cache) error {
+	for i := range cache.Songs {
+		entry := &cache.Songs[i]
+		song := &Song{Name: entry.Name, Artist: entry.Artist, Album: entry.Album, Genre: entry.Genre, LoadingPhrase: entry.LoadingPhrase}
+		song.sanitize()
+		entry.Name, entry.Artist, entry.Album, entry.Genre, entry.LoadingPhrase = song.Name, song.Artist, song.Album, song.Genre, song.LoadingPhrase
+		entry.Raw = song.Raw
+	}
+	return nil
+}
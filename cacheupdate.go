@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Commands that edit a few song.ini files would otherwise leave the next search to
+// rescan the whole library, since the edits change the directory hash. Instead the
+// files written are recorded as they're written, and once the command is done the cache
+// is updated in place: the edited songs are parsed again and the hash is updated for
+// just the entries that changed. Songs moved to another folder keep their entries, under
+// their new path.
+
+// treeHash is an order-independent hash of a directory tree: the XOR of the hashes of
+// each entry's path and mod time, so an entry can be swapped for its new mod time
+// without walking the tree again
+type treeHash [sha256.Size]byte
+
+// toggle adds an entry to the hash, or removes it if it's already in
+func (h *treeHash) toggle(relPath, modTime string) {
+	sum := sha256.Sum256([]byte(relPath + "\x00" + modTime))
+	for i := range h {
+		h[i] ^= sum[i]
+	}
+}
+
+func (h *treeHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// parseTreeHash reads back the String form of a treeHash
+func parseTreeHash(s string) (treeHash, bool) {
+	var h treeHash
+	data, err := hex.DecodeString(s)
+	if err != nil || len(data) != len(h) {
+		return h, false
+	}
+	copy(h[:], data)
+	return h, true
+}
+
+// libraryEdits are the mod times of the files written by writeLibraryFile, and of their
+// folders, before the first write of this run, by path
+var libraryEdits = make(map[string]string)
+
+// recordLibraryEdit remembers the mod times of a file about to be written and of its
+// folder. New files aren't recorded: a song that wasn't there before can't be updated
+// in place, so the hash is left to differ and the next search rescans.
+func recordLibraryEdit(path string) {
+	for _, p := range []string{path, filepath.Dir(path)} {
+		if _, ok := libraryEdits[p]; ok {
+			continue
+		}
+		if info, err := os.Lstat(p); err == nil {
+			libraryEdits[p] = info.ModTime().String()
+		}
+	}
+}
+
+// applyLibraryEdits updates the cache of each library for the files written in this run.
+// Nothing is updated when the cache doesn't describe the library as it was before the
+// edits, or an edited song can't be parsed; the next search then rescans as it would
+// have anyway.
+func applyLibraryEdits() {
+	if len(libraryEdits) == 0 {
+		return
+	}
+	policy, err := parsePolicy()
+	if err != nil {
+		return
+	}
+	for _, dir := range directories {
+		if isRemoteLocation(dir) {
+			continue
+		}
+		scanner := NewScanner(dir, ScanOptions{Network: networkMode, OnError: policy, ExcludeDirs: excludeDirs})
+		edits := scanner.editsInLibrary(libraryEdits)
+		if len(edits) == 0 {
+			continue
+		}
+		if err := scanner.updateCacheEntries(edits); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to update the cache for the edited songs: %v\n", err)
+		}
+	}
+}
+
+// editsInLibrary returns the edits to files inside the scanner's library. With a single
+// library every edit is kept, so edits outside of it still leave the cache alone.
+func (s *Scanner) editsInLibrary(edits map[string]string) map[string]string {
+	if !multipleLibraries() {
+		return edits
+	}
+	inside := make(map[string]string)
+	for path, modTime := range edits {
+		if relPath, err := filepath.Rel(s.rootDir, path); err == nil && filepath.IsLocal(relPath) {
+			inside[path] = modTime
+		}
+	}
+	return inside
+}
+
+// updateCacheEntries applies edits, the mod times before editing by path, and the moves
+// of this run to the cache
+func (s *Scanner) updateCacheEntries(edits map[string]string) error {
+	cache, err := s.loadCache()
+	if err != nil || cache.Partial {
+		return nil
+	}
+	hash, ok := parseTreeHash(cache.Hash)
+	if !ok {
+		return nil
+	}
+	if cache.Decoded {
+		s.opts.OnError = ParseRetry
+	}
+
+	edits = maps.Clone(edits)
+	if !s.applyMoves(cache, &hash, edits) {
+		return nil
+	}
+
+	paths := make([]string, 0, len(edits))
+	for path := range edits {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	entries := make(map[string]int, len(cache.Songs))
+	for i, entry := range cache.Songs {
+		entries[entry.Path] = i
+	}
+	for _, path := range paths {
+		relPath, err := filepath.Rel(s.rootDir, path)
+		if err != nil || !filepath.IsLocal(relPath) || s.inExcludedDir(path) {
+			return nil
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil
+		}
+		hash.toggle(relPath, edits[path])
+		hash.toggle(relPath, info.ModTime().String())
+
+		if containsFold(chartFiles, filepath.Base(path)) {
+			if i, ok := entries[filepath.Join(filepath.Dir(path), "song.ini")]; ok {
+				entry := &cache.Songs[i]
+				song := &Song{Path: entry.Path, Checksum: entry.Checksum, ChartModTime: entry.ChartModTime}
+				refreshChecksum(song)
+				entry.Checksum, entry.ChartModTime = song.Checksum, song.ChartModTime
+			}
+			continue
+		}
+		if filepath.Base(path) != "song.ini" {
+			continue
+		}
+		i, ok := entries[path]
+		if !ok {
+			return nil
+		}
+		song, err := s.parseFile(path)
+		if err != nil {
+			return nil
+		}
+		song.ModTime = info.ModTime().String()
+		song.Checksum, song.ChartModTime = cache.Songs[i].Checksum, cache.Songs[i].ChartModTime
+		refreshChecksum(song)
+		cache.Songs[i] = newCacheEntry(song)
+	}
+
+	cache.Hash = hash.String()
+	return s.writeCache(cache)
+}
+
+// inExcludedDir reports whether path is inside a folder scans leave out
+func (s *Scanner) inExcludedDir(path string) bool {
+	root := filepath.Clean(s.rootDir)
+	for dir := filepath.Dir(path); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if s.isExcludedDir(dir) {
+			return true
+		}
+	}
+	return false
+}
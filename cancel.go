@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// errInterrupted is returned by commands stopped with Ctrl-C or SIGTERM
+var errInterrupted = errors.New("interrupted")
+
+// runContext is cancelled when the user interrupts the program; main replaces it with
+// one tied to Ctrl-C and SIGTERM
+var runContext = context.Background()
+
+// commandContext returns the context of the running command
+func commandContext() context.Context {
+	return runContext
+}
+
+// interrupted returns errInterrupted once the program has been interrupted. Long loops
+// check it between items so they stop at a clean point rather than mid-operation.
+func interrupted() error {
+	if commandContext().Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into
+// place, so an interrupted write never leaves a truncated file behind
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name()) // no-op once renamed
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Chmod(perm); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ChartMetadata holds the [Song] block of a .chart file and the tracks it contains
+type ChartMetadata struct {
+	Name         string
+	Artist       string
+	Charter      string
+	Album        string
+	Genre        string
+	Year         int
+	Offset       float64 // seconds
+	Resolution   int
+	PreviewStart float64 // seconds
+	PreviewEnd   float64 // seconds
+	MusicStream  string
+	Values       map[string]string // every [Song] key, unquoted
+	Sections     []string          // names of every section in the file, in order
+}
+
+// chartDifficulties are the difficulty prefixes of .chart track section names
+var chartDifficulties = []string{"Expert", "Hard", "Medium", "Easy"}
+
+// ParseChartMetadata reads the [Song] block and the section list of a .chart file
+func ParseChartMetadata(path string) (*ChartMetadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chart: %w", err)
+	}
+	defer file.Close()
+	return parseChartMetadataReader(file)
+}
+
+// parseChartMetadataReader reads the [Song] block and the section list of .chart data
+func parseChartMetadataReader(r io.Reader) (*ChartMetadata, error) {
+	meta := &ChartMetadata{Values: make(map[string]string)}
+	section := ""
+
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lines.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(lines.Text(), "\ufeff"))
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			meta.Sections = append(meta.Sections, section)
+			continue
+		}
+		if !strings.EqualFold(section, "Song") || line == "{" || line == "}" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		meta.Values[strings.TrimSpace(key)] = unquoteChartValue(value)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chart: %w", err)
+	}
+
+	meta.Name = meta.Values["Name"]
+	meta.Artist = meta.Values["Artist"]
+	meta.Charter = meta.Values["Charter"]
+	meta.Album = meta.Values["Album"]
+	meta.Genre = meta.Values["Genre"]
+	meta.MusicStream = meta.Values["MusicStream"]
+	// Years are conventionally written as ", 2003"
+	meta.Year, _ = strconv.Atoi(strings.TrimSpace(strings.TrimLeft(meta.Values["Year"], ", ")))
+	meta.Offset, _ = strconv.ParseFloat(meta.Values["Offset"], 64)
+	meta.Resolution, _ = strconv.Atoi(meta.Values["Resolution"])
+	meta.PreviewStart, _ = strconv.ParseFloat(meta.Values["PreviewStart"], 64)
+	meta.PreviewEnd, _ = strconv.ParseFloat(meta.Values["PreviewEnd"], 64)
+
+	return meta, nil
+}
+
+// unquoteChartValue trims a .chart value and removes surrounding quotes
+func unquoteChartValue(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Instruments returns the instruments that have at least one charted difficulty
+func (m *ChartMetadata) Instruments() []Instrument {
+	seen := make(map[Instrument]bool)
+	var instruments []Instrument
+	for _, section := range m.Sections {
+		for _, difficulty := range chartDifficulties {
+			inst, ok := chartTrackInstruments[strings.TrimPrefix(section, difficulty)]
+			if ok && strings.HasPrefix(section, difficulty) && !seen[inst] {
+				seen[inst] = true
+				instruments = append(instruments, inst)
+			}
+		}
+	}
+	return instruments
+}
+
+// setChartValues updates keys in the [Song] block of a .chart file, leaving the rest of
+// the file untouched. Values are written as given, so strings must already be quoted.
+func setChartValues(path string, values map[string]string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	newline := "\n"
+	if strings.Contains(string(data), "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	pending := make(map[string]string, len(values))
+	for key, value := range values {
+		pending[key] = value
+	}
+
+	inSong, found := false, false
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(strings.TrimPrefix(lines[i], "\ufeff"))
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSong = strings.EqualFold(trimmed, "[Song]")
+			found = found || inSong
+			continue
+		}
+		if !inSong {
+			continue
+		}
+
+		if trimmed == "}" {
+			// Add keys the block doesn't have yet before it closes
+			var added []string
+			for _, key := range sortedKeys(pending) {
+				added = append(added, "  "+key+" = "+pending[key])
+			}
+			lines = append(lines[:i], append(added, lines[i:]...)...)
+			pending = nil
+			break
+		}
+
+		key, _, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if value, ok := pending[key]; ok {
+			indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+			lines[i] = indent + key + " = " + value
+			delete(pending, key)
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: no [Song] section found", path)
+	}
+
+	return writeLibraryFile(path, []byte(strings.Join(lines, newline)), info.Mode().Perm())
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	chartSyncTo string
+
+	chartCheckCmd = &cobra.Command{
+		Use:   "chart-check",
+		Short: "Compare notes.chart [Song] metadata with song.ini",
+		Long: `Report songs whose notes.chart [Song] block disagrees with song.ini (name, artist,
+album, genre, year, charter or offset). Fields that are only set on one side are not
+reported.
+
+With --sync ini, song.ini is updated from the chart; with --sync chart, the chart is
+updated from song.ini.`,
+		RunE: runChartCheck,
+	}
+)
+
+func init() {
+	chartCheckCmd.Flags().StringVar(&chartSyncTo, "sync", "", "Resolve mismatches by updating 'ini' (from the chart) or 'chart' (from song.ini)")
+	rootCmd.AddCommand(chartCheckCmd)
+}
+
+// chartField is a metadata field stored in both song.ini and the chart's [Song] block
+type chartField struct {
+	Name     string
+	IniKey   string
+	ChartKey string
+	// normalize converts a raw value from either file to a comparable form
+	normalize func(value string) string
+	// iniValue and chartValue format a normalized value for each file
+	iniValue   func(value string) string
+	chartValue func(value string) string
+}
+
+// chartFields lists the fields compared by chart-check
+var chartFields = []chartField{
+	textChartField("name", "name", "Name"),
+	textChartField("artist", "artist", "Artist"),
+	textChartField("album", "album", "Album"),
+	textChartField("genre", "genre", "Genre"),
+	textChartField("charter", "charter", "Charter"),
+	{
+		Name:     "year",
+		IniKey:   "year",
+		ChartKey: "Year",
+		normalize: func(value string) string {
+			return strings.TrimSpace(strings.TrimLeft(unquoteChartValue(value), ", "))
+		},
+		iniValue:   func(value string) string { return value },
+		chartValue: func(value string) string { return `", ` + value + `"` },
+	},
+	{
+		// song.ini stores the offset in milliseconds as delay, the chart in seconds
+		Name:     "offset",
+		IniKey:   "delay",
+		ChartKey: "Offset",
+		normalize: func(value string) string {
+			ms, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return ""
+			}
+			return strconv.FormatInt(int64(ms), 10)
+		},
+		iniValue: func(value string) string { return value },
+		chartValue: func(value string) string {
+			ms, _ := strconv.ParseInt(value, 10, 64)
+			return strconv.FormatFloat(float64(ms)/1000, 'f', -1, 64)
+		},
+	},
+}
+
+// textChartField describes a plain string field, quoted in the chart
+func textChartField(name, iniKey, chartKey string) chartField {
+	return chartField{
+		Name:       name,
+		IniKey:     iniKey,
+		ChartKey:   chartKey,
+		normalize:  func(value string) string { return strings.TrimSpace(unquoteChartValue(value)) },
+		iniValue:   func(value string) string { return value },
+		chartValue: func(value string) string { return `"` + strings.ReplaceAll(value, `"`, `'`) + `"` },
+	}
+}
+
+// ChartMismatch is a field whose value differs between song.ini and notes.chart
+type ChartMismatch struct {
+	Song       *Song
+	ChartPath  string
+	Field      chartField
+	IniValue   string
+	ChartValue string
+}
+
+// findChartMismatches compares a song's song.ini with its notes.chart, if it has one
+func findChartMismatches(song *Song) ([]ChartMismatch, error) {
+	chartPath := filepath.Join(songFolder(song), "notes.chart")
+	meta, err := loadSongChartMetadata(song)
+	if meta == nil || err != nil {
+		return nil, err
+	}
+	iniValues, err := readIniValues(song.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []ChartMismatch
+	for _, field := range chartFields {
+		iniValue := iniValues[field.IniKey]
+		chartValue := meta.Values[field.ChartKey]
+		if field.Name == "offset" {
+			// Offsets default to zero when missing
+			if iniValue == "" {
+				iniValue = "0"
+			}
+			if chartValue == "" {
+				chartValue = "0"
+			}
+			if seconds, err := strconv.ParseFloat(chartValue, 64); err == nil {
+				chartValue = strconv.FormatFloat(seconds*1000, 'f', -1, 64)
+			}
+		}
+
+		iniNorm, chartNorm := field.normalize(iniValue), field.normalize(chartValue)
+		if iniNorm == "" || chartNorm == "" || iniNorm == chartNorm {
+			continue
+		}
+		mismatches = append(mismatches, ChartMismatch{
+			Song:       song,
+			ChartPath:  chartPath,
+			Field:      field,
+			IniValue:   iniNorm,
+			ChartValue: chartNorm,
+		})
+	}
+	return mismatches, nil
+}
+
+func runChartCheck(cmd *cobra.Command, args []string) error {
+	switch chartSyncTo {
+	case "", "ini", "chart":
+	default:
+		return fmt.Errorf("invalid --sync value %q (expected 'ini' or 'chart')", chartSyncTo)
+	}
+	if chartSyncTo != "" {
+		if err := ensureWritable("sync chart metadata"); err != nil {
+			return err
+		}
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	total, remaining := 0, 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		mismatches, err := findChartMismatches(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to check %s: %v\n", song.Path, err)
+			continue
+		}
+		if len(mismatches) == 0 {
+			continue
+		}
+
+		for _, m := range mismatches {
+			fmt.Fprintf(writer, "%s: %s differs: song.ini %q, notes.chart %q\n", song.Path, m.Field.Name, m.IniValue, m.ChartValue)
+		}
+		total += len(mismatches)
+
+		if chartSyncTo == "" {
+			remaining += len(mismatches)
+			continue
+		}
+		if err := syncChartMismatches(mismatches, chartSyncTo); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to sync %s: %v\n", song.Path, err)
+			remaining += len(mismatches)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d song(s): %d mismatch(es), %d synced\n", len(songs), total, total-remaining)
+	if remaining > 0 {
+		return fmt.Errorf("%d chart mismatch(es) found", remaining)
+	}
+	return nil
+}
+
+// syncChartMismatches resolves the mismatches of one song by updating the target file
+func syncChartMismatches(mismatches []ChartMismatch, target string) error {
+	if song := mismatches[0].Song; song.Packed {
+		return packedEditError(song.Path)
+	}
+	values := make(map[string]string, len(mismatches))
+	for _, m := range mismatches {
+		if target == "ini" {
+			values[m.Field.IniKey] = m.Field.iniValue(m.ChartValue)
+		} else {
+			values[m.Field.ChartKey] = m.Field.chartValue(m.IniValue)
+		}
+	}
+
+	if target == "ini" {
+		return setIniValues(mismatches[0].Song.Path, values)
+	}
+	return setChartValues(mismatches[0].ChartPath, values)
+}
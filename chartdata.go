@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Instrument sources for --instrument-source
+const (
+	InstrumentSourceIni   = "ini"
+	InstrumentSourceChart = "chart"
+)
+
+// instrumentSources lists the values accepted by --instrument-source
+var instrumentSources = []string{InstrumentSourceIni, InstrumentSourceChart}
+
+var instrumentSource string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&instrumentSource, "instrument-source", "", InstrumentSourceIni, "Where --instrument looks for a part: ini (the diff_* values) or chart (the tracks of the notes file)")
+}
+
+// validateInstrumentSource checks the value of --instrument-source
+func validateInstrumentSource(source string) error {
+	for _, s := range instrumentSources {
+		if source == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown instrument source %q (available: %s)", source, strings.Join(instrumentSources, ", "))
+}
+
+// readChartData fills in what the notes file says about a song: the difficulties charted
+// per instrument, the stats of the hardest of them, when each instrument starts and the
+// practice sections
+func (s *Song) readChartData(chart *Chart) {
+	s.Charted = chart.ChartedDifficulties()
+	s.FirstNotes = chart.FirstNotes()
+	s.Opens, s.Taps = chart.OpensAndTaps()
+	s.NoteCounts = make(map[Instrument]int, len(s.Charted))
+	s.PartStats = make(map[Instrument]ChartStats, len(s.Charted))
+	for inst, charted := range s.Charted {
+		stats := chart.Stats(inst, charted[len(charted)-1])
+		s.NoteCounts[inst] = stats.Notes
+		s.PartStats[inst] = stats
+	}
+	s.Sections = nil
+	for _, section := range chart.Sections() {
+		s.Sections = append(s.Sections, section.Name)
+	}
+}
+
+// HasPart reports whether a song has a part for inst. Like IsGHL, the notes file decides
+// once it has been read, and song.ini otherwise. Instruments that have no note track,
+// such as those only known from a diff_* key, always go by song.ini.
+func (s *Song) HasPart(inst Instrument) bool {
+	if len(s.Charted) == 0 || !isChartInstrument(inst) {
+		return s.HasInstrument(inst)
+	}
+	return len(s.Charted[inst]) > 0
+}
+
+// isChartInstrument reports whether inst has note tracks in .chart and .mid files
+func isChartInstrument(inst Instrument) bool {
+	for _, trackInst := range chartTrackInstruments {
+		if trackInst == inst {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Chart hash algorithms of --show-hash
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+// chartHashes are the algorithms --show-hash can hash notes files with
+var chartHashes = map[string]func() hash.Hash{
+	HashMD5:    md5.New,
+	HashSHA1:   sha1.New,
+	HashSHA256: sha256.New,
+}
+
+var showHash string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&showHash, "show-hash", "", "", "Show the hash of each song's notes file: md5 (the default, as Clone Hero and Chorus compute it), sha1 or sha256")
+	rootCmd.PersistentFlags().Lookup("show-hash").NoOptDefVal = HashMD5
+}
+
+// validateShowHash checks --show-hash
+func validateShowHash() error {
+	showHash = strings.ToLower(showHash)
+	if _, ok := chartHashes[showHash]; showHash == "" || ok {
+		return nil
+	}
+	names := make([]string, 0, len(chartHashes))
+	for name := range chartHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown --show-hash %q (available: %s)", showHash, strings.Join(names, ", "))
+}
+
+// songChecksum returns the MD5 checksum of a song's notes file, which Clone Hero uses to
+// identify songs in scoredata.bin and .setlist files, and Chorus to tell charts apart
+func songChecksum(song *Song) (string, error) {
+	return hashChartFile(song, md5.New())
+}
+
+// hashChartFile hashes the bytes of a song's notes file as they are on disk, or as
+// packed in its .sng file, the way the game does: nothing is normalized first
+func hashChartFile(song *Song, h hash.Hash) (string, error) {
+	if song.Packed {
+		name, err := findSongChartFile(song)
+		if err != nil {
+			return "", err
+		}
+		data, err := readSongFile(song, name)
+		if err != nil {
+			return "", err
+		}
+		h.Write(data)
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	path, err := findChartFile(filepath.Dir(song.Path))
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// shownHash returns the --show-hash hash of a song, or "" without --show-hash
+func shownHash(song *Song) string {
+	if showHash == "" {
+		return ""
+	}
+	return songHash(song, showHash)
+}
+
+// songHash hashes a song's notes file with algorithm, or returns "" when it can't be
+// read. The MD5 checksum kept in the cache is used when it's there.
+func songHash(song *Song, algorithm string) string {
+	if algorithm == HashMD5 && song.Checksum != "" {
+		return song.Checksum
+	}
+	sum, err := hashChartFile(song, chartHashes[algorithm]())
+	if err != nil {
+		return ""
+	}
+	return sum
+}
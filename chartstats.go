@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsDifficulty string
+	statsTiers      bool
+
+	statsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Show note counts, density and techniques per charted part",
+		Long: `For every matching song, read the notes file and show the number of notes and the note
+density of each charted part at --difficulty, along with how many of the notes are chords,
+HOPOs and taps and how much of the part is sustained. Guitar Hero Live (6-fret) parts are
+listed separately from five-fret guitar and bass, with the notes on each lane.
+
+With --tiers, count the matching songs per instrument and song.ini difficulty tier
+(diff_* value) instead, without reading any notes file.`,
+		Args: cobra.NoArgs,
+		RunE: runStats,
+	}
+)
+
+func init() {
+	statsCmd.Flags().StringVar(&statsDifficulty, "difficulty", string(DifficultyExpert), "Difficulty to count (easy, medium, hard, expert)")
+	statsCmd.Flags().BoolVar(&statsTiers, "tiers", false, "Count songs per instrument and difficulty tier (song.ini diff_* value) instead")
+	rootCmd.AddCommand(statsCmd)
+}
+
+// ChartStats summarizes the notes of one instrument at one difficulty
+type ChartStats struct {
+	Notes    int            // chords count as one note
+	Duration time.Duration  // from the first to the last note
+	Lanes    map[string]int // GHL parts only: notes per lane, a chord counting on each of its lanes
+
+	Chords         int           // notes of two or more frets (or pads, strings or keys)
+	HOPOs          int           // hammer-ons and pull-offs, natural or forced; not taps
+	Taps           int           // tap notes
+	Opens          int           // open notes, alone or in a chord
+	Sustains       int           // notes held for a while
+	SustainTime    time.Duration // time during which a note is held
+	LongestSustain time.Duration
+}
+
+// NotesPerSecond returns the average note density, or 0 for charts shorter than a second
+func (s ChartStats) NotesPerSecond() float64 {
+	if s.Duration < time.Second {
+		return 0
+	}
+	return float64(s.Notes) / s.Duration.Seconds()
+}
+
+// Notes returns the notes of inst at difficulty. Guitar can be charted on both the
+// lead and co-op tracks; the longer one is used.
+func (c *Chart) Notes(inst Instrument, difficulty Difficulty) []ChartNote {
+	var notes []ChartNote
+	for part, partInst := range chartTrackInstruments {
+		track := c.Tracks[difficulty.trackPrefix()+part]
+		if partInst == inst && len(track) > len(notes) {
+			notes = track
+		}
+	}
+	return notes
+}
+
+// Stats counts the notes, chords, HOPOs, taps and sustains of inst at difficulty
+func (c *Chart) Stats(inst Instrument, difficulty Difficulty) ChartStats {
+	var stats ChartStats
+	notes := c.Notes(inst, difficulty)
+	if isGHLInstrument(inst) {
+		stats.Lanes = make(map[string]int)
+		for _, note := range notes {
+			for _, lane := range ghlLanes {
+				if lane.Fret == note.Fret {
+					stats.Lanes[lane.Name]++
+				}
+			}
+		}
+	}
+
+	positions := notePositions(inst, notes)
+	threshold := c.hopoThreshold()
+	held := int64(-1) // sustains are counted up to this tick, so overlaps count once
+	for i, position := range positions {
+		stats.Notes++
+		if position.isChord() {
+			stats.Chords++
+		}
+		if hasHOPOs(inst) {
+			var prev *notePosition
+			if i > 0 {
+				prev = &positions[i-1]
+			}
+			if position.tap {
+				stats.Taps++
+			} else if position.isHOPO(prev, threshold) {
+				stats.HOPOs++
+			}
+			if position.isOpen() {
+				stats.Opens++
+			}
+		}
+		if position.length > 0 {
+			stats.Sustains++
+			start, end := max(position.tick, held), position.tick+position.length
+			stats.LongestSustain = max(stats.LongestSustain, c.TickToTime(end)-c.TickToTime(position.tick))
+			if end > start {
+				stats.SustainTime += c.TickToTime(end) - c.TickToTime(start)
+				held = end
+			}
+		}
+	}
+	if len(positions) > 0 {
+		stats.Duration = c.TickToTime(positions[len(positions)-1].tick) - c.TickToTime(positions[0].tick)
+	}
+	return stats
+}
+
+// isNoteFret reports whether a .chart fret number is a playable note rather than a
+// modifier such as forced (5), tap (6) or a cymbal marker. Every lane of a pro part is
+// a string or key.
+func isNoteFret(inst Instrument, fret int) bool {
+	if isProInstrument(inst) {
+		return true
+	}
+	if inst == InstrumentDrums {
+		return fret <= 5 || fret == 32
+	}
+	return fret <= 8 && fret != 5 && fret != 6
+}
+
+// formatLanes lists the notes per lane of a GHL part, e.g. "open 12, W1 140, ..."
+func formatLanes(lanes map[string]int) string {
+	parts := make([]string, 0, len(ghlLanes))
+	for _, lane := range ghlLanes {
+		parts = append(parts, fmt.Sprintf("%s %d", lane.Name, lanes[lane.Name]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// statsDocument is the JSON representation of stats
+type statsDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Difficulty    Difficulty        `json:"difficulty"`
+	Songs         []songStatsRecord `json:"songs"`
+}
+
+// songStatsRecord is the stats of one song in statsDocument
+type songStatsRecord struct {
+	Song  SongRecord        `json:"song"`
+	Error string            `json:"error,omitempty"` // why the notes file couldn't be read
+	Parts []partStatsRecord `json:"parts"`
+}
+
+// partStatsRecord is the stats of one charted part at the counted difficulty
+type partStatsRecord struct {
+	Instrument       Instrument     `json:"instrument"`
+	Notes            int            `json:"notes"`
+	NotesPerSecond   float64        `json:"notes_per_second"`
+	DurationMs       int64          `json:"duration_ms"`
+	Lanes            map[string]int `json:"lanes,omitempty"`
+	Chords           int            `json:"chords"`
+	HOPOs            int            `json:"hopos"`
+	Taps             int            `json:"taps"`
+	Opens            int            `json:"opens"`
+	Sustains         int            `json:"sustains"`
+	SustainMs        int64          `json:"sustain_ms"`
+	LongestSustainMs int64          `json:"longest_sustain_ms"`
+}
+
+// newPartStatsRecord converts the stats of a part to its JSON representation
+func newPartStatsRecord(inst Instrument, stats ChartStats) partStatsRecord {
+	return partStatsRecord{
+		Instrument:       inst,
+		Notes:            stats.Notes,
+		NotesPerSecond:   stats.NotesPerSecond(),
+		DurationMs:       stats.Duration.Milliseconds(),
+		Lanes:            stats.Lanes,
+		Chords:           stats.Chords,
+		HOPOs:            stats.HOPOs,
+		Taps:             stats.Taps,
+		Opens:            stats.Opens,
+		Sustains:         stats.Sustains,
+		SustainMs:        stats.SustainTime.Milliseconds(),
+		LongestSustainMs: stats.LongestSustain.Milliseconds(),
+	}
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if statsTiers {
+		return runTierStats()
+	}
+	difficulty, err := parseDifficulty(statsDifficulty)
+	if err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("stats needs a local library")
+	}
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	doc := statsDocument{SchemaVersion: SchemaVersion, Difficulty: difficulty, Songs: []songStatsRecord{}}
+	failed := 0
+	for i, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		chart, err := loadSongChart(song)
+		if err != nil {
+			failed++
+		}
+		if reportJSON() {
+			record := songStatsRecord{Song: NewSongRecord(song), Parts: []partStatsRecord{}}
+			if err != nil {
+				record.Error = err.Error()
+			} else {
+				for _, inst := range chartedOn(chart, difficulty) {
+					record.Parts = append(record.Parts, newPartStatsRecord(inst, chart.Stats(inst, difficulty)))
+				}
+			}
+			doc.Songs = append(doc.Songs, record)
+			continue
+		}
+
+		fmt.Fprintf(writer, "%d. %s - %s\n", i+1, song.Artist, song.Name)
+		if err != nil {
+			fmt.Fprintf(writer, "   (couldn't read the notes file: %v)\n\n", err)
+			continue
+		}
+		instruments := chartedOn(chart, difficulty)
+		if len(instruments) == 0 {
+			fmt.Fprintf(writer, "   (nothing charted on %s)\n", difficulty)
+		}
+		for _, inst := range instruments {
+			stats := chart.Stats(inst, difficulty)
+			line := fmt.Sprintf("   %s %5d notes, %4.1f notes/s", padWidth(string(inst)+":", 10), stats.Notes, stats.NotesPerSecond())
+			if stats.Lanes != nil {
+				line += "  (" + formatLanes(stats.Lanes) + ")"
+			}
+			fmt.Fprintln(writer, line)
+			fmt.Fprintf(writer, "   %s %s\n", padWidth("", 10), formatTechniques(inst, stats))
+		}
+		fmt.Fprintln(writer)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't read the notes file of %d song(s)\n", failed)
+	}
+	if reportJSON() {
+		return writeReport(writer, doc)
+	}
+	return nil
+}
+
+// chartedOn returns the instruments charted on difficulty, by name
+func chartedOn(chart *Chart, difficulty Difficulty) []Instrument {
+	var instruments []Instrument
+	for inst, charted := range chart.ChartedDifficulties() {
+		if slices.Contains(charted, difficulty) {
+			instruments = append(instruments, inst)
+		}
+	}
+	slices.Sort(instruments)
+	return instruments
+}
+
+// maxTier is the highest difficulty tier counted on its own by stats --tiers; higher
+// diff_* values are counted with it
+const maxTier = 6
+
+// tierCounts counts the songs with a part for each instrument per difficulty tier, from 0
+// to maxTier. Uncharted (-1) parts aren't kept by the scanner, so they aren't counted.
+func tierCounts(songs []*Song) map[Instrument][]int {
+	counts := make(map[Instrument][]int)
+	for _, song := range songs {
+		for inst, diff := range song.Instruments {
+			if counts[inst] == nil {
+				counts[inst] = make([]int, maxTier+1)
+			}
+			counts[inst][min(diff, maxTier)]++
+		}
+	}
+	return counts
+}
+
+// tierLabel names a column of stats --tiers: the tier, or "6+" for maxTier and above
+func tierLabel(tier int) string {
+	if tier == maxTier {
+		return strconv.Itoa(tier) + "+"
+	}
+	return strconv.Itoa(tier)
+}
+
+// tierStatsDocument is the JSON representation of stats --tiers
+type tierStatsDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Count         int               `json:"count"`
+	Instruments   []tierCountRecord `json:"instruments"`
+}
+
+// tierCountRecord is the number of songs per difficulty tier of one instrument, keyed by
+// tierLabel
+type tierCountRecord struct {
+	Instrument Instrument     `json:"instrument"`
+	Tiers      map[string]int `json:"tiers"`
+	Total      int            `json:"total"`
+}
+
+// runTierStats prints the cross-tab of stats --tiers: a row per instrument and a column
+// per difficulty tier
+func runTierStats() error {
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	counts := tierCounts(songs)
+	instruments := make([]string, 0, len(counts))
+	for inst := range counts {
+		instruments = append(instruments, string(inst))
+	}
+	sort.Strings(instruments)
+
+	if reportJSON() {
+		doc := tierStatsDocument{SchemaVersion: SchemaVersion, Count: len(songs), Instruments: []tierCountRecord{}}
+		for _, name := range instruments {
+			record := tierCountRecord{Instrument: Instrument(name), Tiers: make(map[string]int)}
+			for tier, count := range counts[Instrument(name)] {
+				record.Tiers[tierLabel(tier)] = count
+				record.Total += count
+			}
+			doc.Instruments = append(doc.Instruments, record)
+		}
+		return writeReport(writer, doc)
+	}
+
+	width := len("Instrument")
+	for _, name := range instruments {
+		width = max(width, displayWidth(name))
+	}
+	header := padWidth("Instrument", width)
+	for tier := 0; tier <= maxTier; tier++ {
+		header += "  " + align(tierLabel(tier), 5, true)
+	}
+	fmt.Fprintln(writer, header+"  "+align("Total", 5, true))
+	for _, name := range instruments {
+		line := padWidth(name, width)
+		total := 0
+		for _, count := range counts[Instrument(name)] {
+			line += "  " + align(strconv.Itoa(count), 5, true)
+			total += count
+		}
+		fmt.Fprintln(writer, line+"  "+align(strconv.Itoa(total), 5, true))
+	}
+	fmt.Fprintf(writer, "\n%d song(s)\n", len(songs))
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTierCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.ini")
+	ini := "[song]\nname = Tier Zero\nartist = Test\ndiff_guitar = 0\ndiff_bass = 3\ndiff_drums = -1\ndiff_keys = 9\n"
+	if err := os.WriteFile(path, []byte(ini), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	song, err := parseSongFile(path)
+	if err != nil {
+		t.Fatalf("parseSongFile: %v", err)
+	}
+
+	counts := tierCounts([]*Song{song})
+	tests := []struct {
+		inst Instrument
+		want []int
+	}{
+		{InstrumentGuitar, []int{1, 0, 0, 0, 0, 0, 0}},
+		{InstrumentBass, []int{0, 0, 0, 1, 0, 0, 0}},
+		{InstrumentKeys, []int{0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.inst), func(t *testing.T) {
+			if got := counts[tt.inst]; !slices.Equal(got, tt.want) {
+				t.Errorf("tierCounts()[%s] = %v, want %v", tt.inst, got, tt.want)
+			}
+		})
+	}
+	if got, ok := counts[InstrumentDrums]; ok {
+		t.Errorf("tierCounts()[drums] = %v, want no entry for an uncharted part", got)
+	}
+}
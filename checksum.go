@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// checksumFileName is the name of the checksum file of a pack, as written by sha256sum
+const checksumFileName = "SHA256SUMS"
+
+var (
+	checksumFile string
+
+	checksumCmd = &cobra.Command{
+		Use:   "checksum",
+		Short: "Create and verify SHA-256 checksums of a pack",
+		Long: `Create a SHA-256 checksum file for a pack, or verify a downloaded pack against it, to
+confirm no file was corrupted or tampered with.
+
+The checksum file is called ` + checksumFileName + ` and sits in the pack folder, unless --file
+is given. It lists every file of the pack (system files such as .DS_Store left out) in
+the format of sha256sum, so "sha256sum -c" can verify it too.`,
+	}
+
+	checksumCreateCmd = &cobra.Command{
+		Use:   "create <folder>",
+		Short: "Write the checksums of every file of a pack",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runChecksumCreate,
+	}
+
+	checksumVerifyCmd = &cobra.Command{
+		Use:   "verify <folder>",
+		Short: "Check the files of a pack against its checksums",
+		Long: `Check the files of a pack against its checksum file, reporting files that changed,
+files that are missing and files that aren't listed. Any of these is an error.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runChecksumVerify,
+	}
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{checksumCreateCmd, checksumVerifyCmd} {
+		cmd.Flags().StringVar(&checksumFile, "file", "", "Checksum file (default: "+checksumFileName+" in the pack folder)")
+		checksumCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(checksumCmd)
+}
+
+// FileChecksum is the SHA-256 checksum of a file of a pack
+type FileChecksum struct {
+	Path string // relative to the pack folder, with forward slashes
+	Sum  string // lowercase hex
+}
+
+// packChecksumPath returns the checksum file of a pack folder
+func packChecksumPath(folder string) string {
+	if checksumFile != "" {
+		return checksumFile
+	}
+	return filepath.Join(folder, checksumFileName)
+}
+
+// packFiles lists the files of a pack folder, relative to it and sorted, leaving out
+// system files and the checksum file
+func packFiles(folder, checksumPath string) ([]string, error) {
+	checksumPath, _ = filepath.Abs(checksumPath)
+	var files []string
+	err := filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+		if isReleaseJunk(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); d.IsDir() || abs == checksumPath {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// sha256File returns the SHA-256 checksum of a file
+func sha256File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// encodeChecksums writes checksums the way sha256sum does: one "<sum>  <path>" line per
+// file, sorted by path
+func encodeChecksums(checksums []FileChecksum) []byte {
+	sort.Slice(checksums, func(i, j int) bool { return checksums[i].Path < checksums[j].Path })
+	var b bytes.Buffer
+	for _, checksum := range checksums {
+		fmt.Fprintf(&b, "%s  %s\n", checksum.Sum, checksum.Path)
+	}
+	return b.Bytes()
+}
+
+// parseChecksums reads a checksum file written by encodeChecksums or sha256sum. Paths
+// marked as binary ("<sum> *<path>") are read too.
+func parseChecksums(data []byte) ([]FileChecksum, error) {
+	var checksums []FileChecksum
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		sum, path, ok := strings.Cut(text, " ")
+		if raw, err := hex.DecodeString(sum); !ok || err != nil || len(raw) != sha256.Size || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("line %d is not a SHA-256 checksum line", line)
+		}
+		checksums = append(checksums, FileChecksum{Path: path[1:], Sum: strings.ToLower(sum)})
+	}
+	return checksums, scanner.Err()
+}
+
+// packFolder resolves the folder argument of the checksum commands
+func packFolder(arg string) (string, error) {
+	folder, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s is not a folder", arg)
+	}
+	return folder, nil
+}
+
+func runChecksumCreate(cmd *cobra.Command, args []string) error {
+	folder, err := packFolder(args[0])
+	if err != nil {
+		return err
+	}
+	checksumPath := packChecksumPath(folder)
+	files, err := packFiles(folder, checksumPath)
+	if err != nil {
+		return err
+	}
+
+	checksums := make([]FileChecksum, 0, len(files))
+	for _, file := range files {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		sum, err := sha256File(filepath.Join(folder, filepath.FromSlash(file)))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		checksums = append(checksums, FileChecksum{Path: file, Sum: sum})
+	}
+	if err := writeLibraryFile(checksumPath, encodeChecksums(checksums), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", checksumPath, err)
+	}
+	fmt.Printf("Wrote the checksums of %d file(s) to %s\n", len(checksums), checksumPath)
+	return nil
+}
+
+func runChecksumVerify(cmd *cobra.Command, args []string) error {
+	folder, err := packFolder(args[0])
+	if err != nil {
+		return err
+	}
+	checksumPath := packChecksumPath(folder)
+	data, err := os.ReadFile(checksumPath)
+	if err != nil {
+		return fmt.Errorf("failed to read checksums: %w", err)
+	}
+	checksums, err := parseChecksums(data)
+	if err != nil {
+		return fmt.Errorf("invalid checksum file %s: %w", checksumPath, err)
+	}
+	files, err := packFiles(folder, checksumPath)
+	if err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	listed := make(map[string]bool, len(checksums))
+	changed, missing, unlisted := 0, 0, 0
+	for _, checksum := range checksums {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		listed[checksum.Path] = true
+		sum, err := sha256File(filepath.Join(folder, filepath.FromSlash(checksum.Path)))
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(writer, "missing: %s\n", checksum.Path)
+			missing++
+		case err != nil:
+			return fmt.Errorf("failed to read %s: %w", checksum.Path, err)
+		case sum != checksum.Sum:
+			fmt.Fprintf(writer, "changed: %s\n", checksum.Path)
+			changed++
+		}
+	}
+	for _, file := range files {
+		if !listed[file] {
+			fmt.Fprintf(writer, "not listed: %s\n", file)
+			unlisted++
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Verified %d file(s): %d changed, %d missing, %d not listed\n", len(checksums), changed, missing, unlisted)
+	if problems := changed + missing + unlisted; problems > 0 {
+		return fmt.Errorf("%s doesn't match its checksums: %d problem(s)", folder, problems)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// ciEnv enables CI mode without passing --ci, e.g. in a container's environment
+const ciEnv = "CLONEHEROER_CI"
+
+var ciMode bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&ciMode, "ci", "", false, "Machine-friendly mode for containers and cron: no colors or prompts, NDJSON events on stdout, deterministic order")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := firstRunSetup(cmd); err != nil {
+			return err
+		}
+		applyConfigDefaults()
+		if err := selectDirectories(); err != nil {
+			return err
+		}
+		if err := validatePorcelain(); err != nil {
+			return err
+		}
+		if err := validateLimits(); err != nil {
+			return err
+		}
+		if err := validateDurationFormat(); err != nil {
+			return err
+		}
+		if err := validateShowHash(); err != nil {
+			return err
+		}
+		if err := validateExcludeDirs(); err != nil {
+			return err
+		}
+		if err := applyColorMode(); err != nil {
+			return err
+		}
+		if err := applyTheme(); err != nil {
+			return err
+		}
+		startPager(cmd)
+		return nil
+	}
+}
+
+// isCI reports whether CI mode is enabled
+func isCI() bool {
+	if ciMode {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(ciEnv))
+	return enabled
+}
+
+// emitEvent writes one NDJSON event line to stdout in CI mode, unless stdout is reserved
+// for --porcelain output. Events carry no timings so that repeated runs over the same
+// library produce identical output.
+func emitEvent(event string, fields map[string]any) {
+	if !isCI() || porcelainMode() {
+		return
+	}
+	record := map[string]any{"schema_version": SchemaVersion, "event": event}
+	for key, value := range fields {
+		record[key] = value
+	}
+	json.NewEncoder(os.Stdout).Encode(record)
+}
+
+// emitSongEvents writes a "song" event per song, embedding its JSON record
+func emitSongEvents(songs []*Song) {
+	for _, song := range songs {
+		data, err := json.Marshal(NewSongRecord(song))
+		if err != nil {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(data, &fields); err != nil {
+			continue
+		}
+		emitEvent("song", fields)
+	}
+}
+
+// sortByPath orders songs by path, the default order in CI mode
+func sortByPath(songs []*Song) {
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Path < songs[j].Path })
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// coldIndexFile marks a directory as a cold-storage archive and records where each
+// archived song came from
+const coldIndexFile = ".cloneheroer-cold.json"
+
+var (
+	coldCmd = &cobra.Command{
+		Use:   "cold",
+		Short: "Move matching songs into a cold-storage archive",
+		Long: `Move the folders of all songs matching the filter flags into a cold-storage archive
+directory, keeping the in-game song list small. Archived songs are excluded from scans
+(even if the archive lives inside the library) until they are brought back with "thaw".
+At least one filter is required.
+
+To archive the songs you rarely play or rated low, filter on your Clone Hero scores with
+--unplayed or --max-plays, and on the "rating" key of song.ini with --max-rating, e.g.
+"cold --max-plays 2 --max-rating 2".`,
+		Args: cobra.NoArgs,
+		RunE: runCold,
+	}
+
+	thawCmd = &cobra.Command{
+		Use:   "thaw [name]",
+		Short: "Move songs from the cold-storage archive back into the library",
+		Long:  "Move archived songs matching the filter flags (and the optional name argument) back to where they were archived from.",
+		RunE:  runThaw,
+	}
+
+	coldArchive string
+	coldDryRun  bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{coldCmd, thawCmd} {
+		cmd.Flags().StringVar(&coldArchive, "archive", "", "Cold-storage archive directory (default: <directory>_cold next to the library)")
+		cmd.Flags().BoolVar(&coldDryRun, "dry-run", false, "Only print what would be moved")
+		rootCmd.AddCommand(cmd)
+	}
+}
+
+// ColdIndex is the contents of an archive's index file
+type ColdIndex struct {
+	Songs []ColdEntry `json:"songs"`
+}
+
+// ColdEntry records a single archived song folder
+type ColdEntry struct {
+	ArchivedPath string    `json:"archived_path"` // relative to the archive directory
+	OriginalPath string    `json:"original_path"` // absolute folder path before archiving
+	Name         string    `json:"name"`
+	Artist       string    `json:"artist"`
+	ArchivedAt   time.Time `json:"archived_at"`
+}
+
+// isColdArchive reports whether dir is a cold-storage archive
+func isColdArchive(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, coldIndexFile))
+	return err == nil
+}
+
+// coldArchiveDir returns the archive directory for the library being scanned
+func coldArchiveDir() (string, error) {
+	if coldArchive != "" {
+		return filepath.Abs(coldArchive)
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+	return root + "_cold", nil
+}
+
+// loadColdIndex reads an archive index, returning an empty index if there is none yet
+func loadColdIndex(archive string) (*ColdIndex, error) {
+	data, err := os.ReadFile(filepath.Join(archive, coldIndexFile))
+	if os.IsNotExist(err) {
+		return &ColdIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index ColdIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid cold archive index: %w", err)
+	}
+	return &index, nil
+}
+
+// save writes the archive index, which also marks the directory as an archive
+func (index *ColdIndex) save(archive string) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(archive, 0755); err != nil {
+		return err
+	}
+	return writeLibraryFile(filepath.Join(archive, coldIndexFile), data, 0644)
+}
+
+// archive moves a song folder into the archive at rel and records it in the index, which
+// is saved after every move so an interrupted run never loses track of a song. It's false
+// with a warning if something is already archived at rel.
+func (index *ColdIndex) archive(archive, rel, folder string, song *Song) (bool, error) {
+	dest := filepath.Join(archive, rel)
+	if _, err := os.Stat(dest); err == nil {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %s: %s already exists\n", rel, dest)
+		return false, nil
+	}
+	if err := moveLibraryPath(folder, dest); err != nil {
+		return false, fmt.Errorf("failed to archive %s: %w", rel, err)
+	}
+
+	index.Songs = append(index.Songs, ColdEntry{
+		ArchivedPath: rel,
+		OriginalPath: folder,
+		Name:         song.Name,
+		Artist:       song.Artist,
+		ArchivedAt:   time.Now().UTC(),
+	})
+	if err := index.save(archive); err != nil {
+		return false, fmt.Errorf("failed to update cold archive index: %w", err)
+	}
+	return true, nil
+}
+
+func runCold(cmd *cobra.Command, args []string) error {
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	if err := ensureWritable("archive songs"); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("cold storage is only supported for local libraries")
+	}
+
+	_, filteredSongs, filter, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	if !filter.Spec().hasCriteria() {
+		return fmt.Errorf("refusing to archive the whole library: pass at least one filter")
+	}
+
+	archive, err := coldArchiveDir()
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	index, err := loadColdIndex(archive)
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for _, song := range filteredSongs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		folder, err := filepath.Abs(songFolder(song))
+		if err != nil || folder == root {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: song.ini is not in its own folder\n", song.Path)
+			continue
+		}
+		rel, err := filepath.Rel(root, folder)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: outside of %s\n", song.Path, root)
+			continue
+		}
+
+		fmt.Printf("cold: %s -> %s\n", rel, filepath.Join(archive, rel))
+		if coldDryRun {
+			continue
+		}
+		ok, err := index.archive(archive, rel, folder, song)
+		if err != nil {
+			return err
+		}
+		if ok {
+			moved++
+		}
+	}
+
+	fmt.Printf("Archived %d song(s) to %s\n", moved, archive)
+	return nil
+}
+
+func runThaw(cmd *cobra.Command, args []string) error {
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	if err := ensureWritable("restore songs"); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		filterName = []string{strings.Join(args, " ")}
+	}
+
+	archive, err := coldArchiveDir()
+	if err != nil {
+		return err
+	}
+	index, err := loadColdIndex(archive)
+	if err != nil {
+		return err
+	}
+	if len(index.Songs) == 0 {
+		return fmt.Errorf("no archived songs in %s", archive)
+	}
+
+	scanner := NewScanner(archive, ScanOptions{Network: networkMode, IncludeCold: true, Context: commandContext()})
+	songs, err := scanner.LoadSongs()
+	if err != nil {
+		return fmt.Errorf("failed to load archived songs: %w", err)
+	}
+	spec, err := buildFilterSpec()
+	if err != nil {
+		return err
+	}
+	filter, err := NewFilter(spec)
+	if err != nil {
+		return err
+	}
+	matched := make(map[string]bool)
+	for _, song := range filter.Apply(songs) {
+		if rel, err := filepath.Rel(archive, songFolder(song)); err == nil {
+			matched[rel] = true
+		}
+	}
+
+	remaining := []ColdEntry{}
+	thawed := 0
+	for i, entry := range index.Songs {
+		if interrupted() != nil {
+			// Keep the songs not restored yet in the index
+			remaining = append(remaining, index.Songs[i:]...)
+			break
+		}
+		if !matched[entry.ArchivedPath] {
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		src := filepath.Join(archive, entry.ArchivedPath)
+		fmt.Printf("thaw: %s -> %s\n", entry.ArchivedPath, entry.OriginalPath)
+		if coldDryRun {
+			remaining = append(remaining, entry)
+			continue
+		}
+		if _, err := os.Stat(entry.OriginalPath); err == nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %s already exists\n", entry.ArchivedPath, entry.OriginalPath)
+			remaining = append(remaining, entry)
+			continue
+		}
+		if err := moveLibraryPath(src, entry.OriginalPath); err != nil {
+			remaining = append(remaining, entry)
+			fmt.Fprintf(os.Stderr, "Warning: failed to restore %s: %v\n", entry.ArchivedPath, err)
+			continue
+		}
+		thawed++
+	}
+
+	if !coldDryRun {
+		index.Songs = remaining
+		if err := index.save(archive); err != nil {
+			return fmt.Errorf("failed to update cold archive index: %w", err)
+		}
+	}
+	fmt.Printf("Restored %d song(s) from %s\n", thawed, archive)
+	return nil
+}
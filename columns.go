@@ -0,0 +1,96 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Column is a song field that can be exported to tabular formats
+type Column struct {
+	Name    string // key used to select the column
+	Header  string // human-readable header
+	Numeric bool   // whether values are numbers (empty for unset)
+	Value   func(song *Song) string
+}
+
+// songColumns lists every exportable column in its default order
+var songColumns = []Column{
+	{Name: "name", Header: "Name", Value: func(s *Song) string { return s.Name }},
+	{Name: "artist", Header: "Artist", Value: func(s *Song) string { return s.Artist }},
+	{Name: "primary_artist", Header: "Primary Artist", Value: func(s *Song) string { return s.PrimaryArtist() }},
+	{Name: "featured", Header: "Featured Artists", Value: func(s *Song) string { return strings.Join(s.FeaturedArtists(), ", ") }},
+	{Name: "album", Header: "Album", Value: func(s *Song) string { return s.Album }},
+	{Name: "album_track", Header: "Album Track", Numeric: true, Value: func(s *Song) string { return optionalInt(s.AlbumTrack) }},
+	{Name: "genre", Header: "Genre", Value: func(s *Song) string { return s.Genre }},
+	{Name: "year", Header: "Year", Numeric: true, Value: func(s *Song) string { return optionalInt(s.Year) }},
+	{Name: "charter", Header: "Charter", Value: func(s *Song) string { return plainCharters(s) }},
+	{Name: "length", Header: "Length", Value: func(s *Song) string { return s.DataLength() }},
+	{Name: "length_ms", Header: "Length (ms)", Numeric: true, Value: func(s *Song) string { return strconv.FormatInt(s.Length.Milliseconds(), 10) }},
+	{Name: "instruments", Header: "Instruments", Value: func(s *Song) string { return s.InstrumentList() }},
+	{Name: "playlist_track", Header: "Playlist Track", Numeric: true, Value: func(s *Song) string { return optionalInt(s.PlaylistTrack) }},
+	{Name: "preview_start", Header: "Preview Start (ms)", Numeric: true, Value: func(s *Song) string { return strconv.FormatInt(s.PreviewStart, 10) }},
+	{Name: "icon", Header: "Icon", Value: func(s *Song) string { return s.Icon }},
+	{Name: "path", Header: "Path", Value: func(s *Song) string { return s.Path }},
+	{Name: "root", Header: "Library", Value: func(s *Song) string { return s.Root }},
+	{Name: "hash", Header: "Hash", Value: columnHash},
+}
+
+// defaultColumns are used when no columns are selected
+var defaultColumns = []string{"name", "artist", "album", "genre", "year", "charter", "length", "instruments", "path"}
+
+// selectColumns resolves a list of column names, using the defaults when names is empty
+func selectColumns(names []string) ([]Column, error) {
+	if len(names) == 0 {
+		names = defaultColumns
+	}
+
+	columns := make([]Column, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, column := range songColumns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q (available: %s)", name, strings.Join(columnNames(), ", "))
+		}
+	}
+	return columns, nil
+}
+
+// columnNames returns the names of all available columns
+func columnNames() []string {
+	names := make([]string, len(songColumns))
+	for i, column := range songColumns {
+		names[i] = column.Name
+	}
+	return names
+}
+
+// optionalInt formats n, leaving zero (unset) values empty
+func optionalInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// plainCharters joins a song's charters with any color tags removed
+func plainCharters(song *Song) string {
+	charters := make([]string, len(song.Charters))
+	for i, charter := range song.Charters {
+		charters[i] = plainCharter(charter)
+	}
+	return strings.Join(charters, ", ")
+}
+
+// columnHash is the hash column: the --show-hash hash of a song, by default its MD5
+func columnHash(song *Song) string {
+	return songHash(song, cmp.Or(showHash, HashMD5))
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+// Color modes for --color
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+var (
+	colorMode  string
+	songLimit  int
+	songOffset int
+	songTop    int
+	summary    []summaryField
+	summarized = map[string]int{}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&colorMode, "color", "", ColorAuto, "When to color output: auto (on a terminal), always or never")
+	rootCmd.PersistentFlags().IntVarP(&songLimit, "limit", "", 0, "Only use the first N matching songs, after sorting (0 for all)")
+	rootCmd.PersistentFlags().IntVarP(&songOffset, "offset", "", 0, "Skip the first N matching songs, after sorting; with --limit, pages through results")
+	rootCmd.PersistentFlags().IntVarP(&songTop, "top", "", 0, "Only use the N best matching songs by --sort (same as --limit)")
+}
+
+// openOutput returns where a command writes its results: the --output file, or stdout.
+// The returned function closes the file (and does nothing for stdout).
+func openOutput() (io.Writer, func() error, error) {
+	if outputFile == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return file, file.Close, nil
+}
+
+// reportFormats are the --format values of commands that write a report rather than a
+// list of songs
+var reportFormats = []string{FormatText, FormatJSON, FormatNDJSON}
+
+// validateReportFormat checks that cmd can write the --format. A format the config file
+// picks for song lists falls back to text instead.
+func validateReportFormat(cmd *cobra.Command) error {
+	if slices.Contains(reportFormats, outputFormat) {
+		return nil
+	}
+	if !rootCmd.PersistentFlags().Changed("format") {
+		outputFormat = FormatText
+		return nil
+	}
+	return fmt.Errorf("%s can't write --format %s (available: %s)", cmd.Name(), outputFormat, strings.Join(reportFormats, ", "))
+}
+
+// reportJSON reports whether --format asks a report command for JSON
+func reportJSON() bool {
+	return outputFormat == FormatJSON || outputFormat == FormatNDJSON
+}
+
+// writeReport writes a command's report as an indented JSON document, or on a single
+// line with --format ndjson
+func writeReport(w io.Writer, report any) error {
+	encoder := json.NewEncoder(w)
+	if outputFormat == FormatJSON {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(report)
+}
+
+// applyColorMode turns colors on or off according to --color, --porcelain, --accessible
+// and CI mode
+func applyColorMode() error {
+	switch colorMode {
+	case ColorAuto:
+		// color decides by itself, from NO_COLOR and whether stdout is a terminal
+	case ColorAlways:
+		color.NoColor = false
+	case ColorNever:
+		color.NoColor = true
+	default:
+		return fmt.Errorf("unknown --color %q (available: %s, %s, %s)", colorMode, ColorAuto, ColorAlways, ColorNever)
+	}
+	if porcelainMode() || isCI() || accessibleMode {
+		color.NoColor = true
+	}
+	return nil
+}
+
+// validateLimits checks --limit, --offset and --top, folding --top into --limit
+func validateLimits() error {
+	switch {
+	case songLimit < 0:
+		return fmt.Errorf("--limit can't be negative")
+	case songOffset < 0:
+		return fmt.Errorf("--offset can't be negative")
+	case songTop < 0:
+		return fmt.Errorf("--top can't be negative")
+	case songTop > 0 && songLimit > 0 && songTop != songLimit:
+		return fmt.Errorf("--top and --limit can't be used together")
+	}
+	if songTop > 0 {
+		songLimit = songTop
+	}
+	return nil
+}
+
+// limitSongs skips the first --offset songs and cuts the rest down to --limit
+func limitSongs(songs []*Song) []*Song {
+	if songOffset >= len(songs) {
+		return songs[:0]
+	}
+	songs = songs[songOffset:]
+	if songLimit > 0 && len(songs) > songLimit {
+		return songs[:songLimit]
+	}
+	return songs
+}
+
+// summaryField is a key=value pair of the --porcelain summary line
+type summaryField struct {
+	key   string
+	value string
+}
+
+// summarize sets a field of the --porcelain summary line; fields keep the order they
+// were first set in
+func summarize(key string, value any) {
+	text := fmt.Sprint(value)
+	if i, ok := summarized[key]; ok {
+		summary[i].value = text
+		return
+	}
+	summarized[key] = len(summary)
+	summary = append(summary, summaryField{key, text})
+}
+
+// recordFilterSummary records how many songs a command works on for the summary line
+func recordFilterSummary(matched, count, total int) {
+	summarize("matched", matched)
+	summarize("count", count)
+	summarize("total", total)
+}
+
+// printSummary writes the --porcelain summary line for the command that ran (nil if
+// none did) and its error, e.g.
+//
+//	summary	version=v1	command=setlist	status=ok	exit=0	matched=12	count=10	total=2000
+//
+// Fields are tab-separated and quoted like those of porcelain records.
+func printSummary(cmd *cobra.Command, err error) {
+	if !porcelainMode() {
+		return
+	}
+	status, exit := "ok", 0
+	if errors.Is(err, errInterrupted) {
+		status, exit = "interrupted", 130
+	} else if err != nil {
+		status, exit = "error", 1
+	}
+
+	fields := []summaryField{
+		{"version", porcelainVersion},
+		{"command", summaryCommand(cmd)},
+		{"status", status},
+		{"exit", strconv.Itoa(exit)},
+	}
+	fields = append(fields, summary...)
+	if err != nil {
+		fields = append(fields, summaryField{"error", err.Error()})
+	}
+
+	var line strings.Builder
+	line.WriteString("summary")
+	for _, field := range fields {
+		fmt.Fprintf(&line, "\t%s=%s", field.key, porcelainValue(field.value))
+	}
+	fmt.Fprintln(os.Stderr, line.String())
+}
+
+// summaryCommand names cmd for the summary line: its path below the root command with
+// dashes for spaces, or "search" for the root command itself
+func summaryCommand(cmd *cobra.Command) string {
+	if cmd == nil {
+		return "none"
+	}
+	if cmd == rootCmd {
+		return "search"
+	}
+	path := strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" ")
+	return strings.ReplaceAll(path, " ", "-")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the user's config file, ~/.config/cloneheroer/config.yaml (or the platform's
+// equivalent user config folder), as written by setup and alias:
+//
+//	directory: /mnt/songs
+//	cache_dir: /home/me/.cache/cloneheroer
+//	color: never
+//	format: table
+//	presets:
+//	  metal:
+//	    genre: metal
+//	aliases:
+//	  drumnight: --instrument drums --has-difficulty expert --sort name
+type Config struct {
+	Directory      string                 `yaml:"directory,omitempty"`       // songs folder used without -d
+	CacheDir       string                 `yaml:"cache_dir,omitempty"`       // where caches go instead of the temp folder
+	Color          string                 `yaml:"color,omitempty"`           // --color used without the flag
+	Format         string                 `yaml:"format,omitempty"`          // --format used without the flag
+	DurationFormat string                 `yaml:"duration_format,omitempty"` // --duration-format used without the flag
+	Accessible     bool                   `yaml:"accessible,omitempty"`      // --accessible without the flag
+	TUITheme       string                 `yaml:"tui_theme,omitempty"`       // browse --tui-theme used without the flag
+	Theme          string                 `yaml:"theme,omitempty"`           // --theme used without the flag
+	Themes         map[string]OutputTheme `yaml:"themes,omitempty"`          // themes --theme can pick besides the built-in ones
+	UsageLog       bool                   `yaml:"usage_log,omitempty"`       // keep the local log summarized by usage
+	ExcludeDirs    []string               `yaml:"exclude_dirs,omitempty"`    // --exclude-dir used without the flag
+	Presets        map[string]FilterSpec  `yaml:"presets,omitempty"`         // saved filters picked with --preset
+	Aliases        map[string]string      `yaml:"aliases,omitempty"`
+}
+
+// userConfig is the config file read at startup
+var userConfig = &Config{}
+
+// configFile returns the path of the config file
+func configFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloneheroer", "config.yaml"), nil
+}
+
+// loadConfig reads the config file; a missing file is an empty config
+func loadConfig() (*Config, error) {
+	config := &Config{}
+	path, err := configFile()
+	if err != nil {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// updateConfig applies change to the config file's YAML document and writes it back,
+// keeping comments and keys it doesn't touch
+func updateConfig(change func(root *yaml.Node)) error {
+	path, err := configFile()
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("invalid config file %s: expected a mapping", path)
+	}
+	change(root)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, out.Bytes(), 0644)
+}
+
+// mappingValue returns the value node of key in a YAML mapping, adding an empty mapping
+// for it if needed
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value
+}
+
+// setMappingScalar sets key to a plain value in a YAML mapping, or removes it when value
+// is empty
+func setMappingScalar(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		if value == "" {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+		} else {
+			mapping.Content[i+1] = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+		}
+		return
+	}
+	if value != "" {
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &yaml.Node{Kind: yaml.ScalarNode, Value: value})
+	}
+}
+
+// applyConfigDefaults uses the config file's settings for the flags that weren't given
+func applyConfigDefaults() {
+	flags := rootCmd.PersistentFlags()
+	if userConfig.Directory != "" && !flags.Changed("directory") {
+		directories = []string{userConfig.Directory}
+	}
+	if userConfig.Color != "" && !flags.Changed("color") {
+		colorMode = userConfig.Color
+	}
+	if userConfig.Format != "" && !flags.Changed("format") {
+		outputFormat = userConfig.Format
+	}
+	durationFormatSet = flags.Changed("duration-format") || userConfig.DurationFormat != ""
+	if !flags.Changed("duration-format") {
+		durationFormat = cmp.Or(userConfig.DurationFormat, localeDurationFormat())
+	}
+	if len(userConfig.ExcludeDirs) > 0 && !flags.Changed("exclude-dir") {
+		excludeDirs = userConfig.ExcludeDirs
+	}
+	if userConfig.Accessible && !flags.Changed("accessible") {
+		accessibleMode = true
+	}
+}
+
+// presetNames lists the filter presets of the config file
+func presetNames() []string {
+	names := make([]string, 0, len(userConfig.Presets))
+	for name := range userConfig.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
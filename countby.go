@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var countBy string
+
+func init() {
+	rootCmd.Flags().StringVarP(&countBy, "count-by", "", "", "Count matching songs per genre, charter, artist, year or decade (implies --count)")
+}
+
+// unknownGroup is the group of songs without a value for --count-by
+const unknownGroup = "(unknown)"
+
+// countGroupers return the groups a song is counted in for each --count-by value; songs
+// with several charters count once for each of them, and songs featuring other artists
+// only for their primary artist
+var countGroupers = map[string]func(song *Song) []string{
+	"genre":   playlistGroupers["genre"],
+	"charter": playlistGroupers["charter"],
+	"decade":  playlistGroupers["decade"],
+	"artist": func(song *Song) []string {
+		if artist := song.PrimaryArtist(); artist != "" {
+			return []string{artist}
+		}
+		return nil
+	},
+	"year": func(song *Song) []string {
+		if song.Year <= 0 {
+			return nil
+		}
+		return []string{strconv.Itoa(song.Year)}
+	},
+}
+
+// validateCountBy checks --count-by
+func validateCountBy() error {
+	countBy = strings.ToLower(strings.TrimSpace(countBy))
+	if _, ok := countGroupers[countBy]; countBy == "" || ok {
+		return nil
+	}
+	names := make([]string, 0, len(countGroupers))
+	for name := range countGroupers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown --count-by %q (available: %s)", countBy, strings.Join(names, ", "))
+}
+
+// GroupCount is the number of matching songs in a --count-by group
+type GroupCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// countGroups counts songs per group, merging names that differ only in case. Years and
+// decades are listed in order, other groups most songs first; songs without a value
+// are counted last, as unknownGroup.
+func countGroups(songs []*Song, by string) []GroupCount {
+	grouper := countGroupers[by]
+	byKey := make(map[string]*GroupCount)
+	unknown := 0
+	for _, song := range songs {
+		names := grouper(song)
+		if len(names) == 0 {
+			unknown++
+		}
+		for _, name := range names {
+			key := strings.ToLower(name)
+			group, ok := byKey[key]
+			if !ok {
+				group = &GroupCount{Name: name}
+				byKey[key] = group
+			}
+			group.Count++
+		}
+	}
+
+	groups := make([]GroupCount, 0, len(byKey)+1)
+	for _, group := range byKey {
+		groups = append(groups, *group)
+	}
+	chronological := by == "year" || by == "decade"
+	sort.Slice(groups, func(i, j int) bool {
+		if !chronological && groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
+	})
+	if unknown > 0 {
+		groups = append(groups, GroupCount{Name: unknownGroup, Count: unknown})
+	}
+	return groups
+}
+
+// countByHeader names the group column of the --count-by table, e.g. "Genre"
+func countByHeader(by string) string {
+	return strings.ToUpper(by[:1]) + by[1:]
+}
+
+// countByDocument is the JSON representation of --count-by results
+type countByDocument struct {
+	SchemaVersion int          `json:"schema_version"`
+	Count         int          `json:"count"`
+	Total         int          `json:"total"`
+	By            string       `json:"by"`
+	Groups        []GroupCount `json:"groups"`
+}
+
+// CountBy makes Write count the songs per group of by instead of listing them
+func (o *Output) CountBy(by string) {
+	o.countBy = by
+}
+
+// writeCountBy writes the number of songs in each --count-by group
+func (o *Output) writeCountBy(total int, filteredSongs []*Song) error {
+	groups := countGroups(filteredSongs, o.countBy)
+	switch o.format {
+	case FormatJSON:
+		encoder := json.NewEncoder(o.writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(countByDocument{SchemaVersion, len(filteredSongs), total, o.countBy, groups})
+	case FormatNDJSON:
+		encoder := json.NewEncoder(o.writer)
+		for _, group := range groups {
+			if err := encoder.Encode(struct {
+				SchemaVersion int    `json:"schema_version"`
+				By            string `json:"by"`
+				GroupCount
+			}{SchemaVersion, o.countBy, group}); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatPorcelain:
+		for _, group := range groups {
+			o.writePorcelainRecord("group", o.countBy, group.Name, strconv.Itoa(group.Count))
+		}
+		o.writePorcelainRecord("count", strconv.Itoa(len(filteredSongs)), strconv.Itoa(total))
+		return nil
+	case FormatCSV, FormatTSV:
+		writer := csv.NewWriter(o.writer)
+		if o.format == FormatTSV {
+			writer.Comma = '\t'
+		}
+		writer.Write([]string{countByHeader(o.countBy), "Songs"})
+		for _, group := range groups {
+			writer.Write([]string{group.Name, strconv.Itoa(group.Count)})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", o.format, err)
+		}
+		return nil
+	}
+
+	if len(groups) == 0 {
+		fmt.Fprintf(o.writer, "0 song(s) (out of %d total)\n", total)
+		return nil
+	}
+	header := countByHeader(o.countBy)
+	nameWidth, countWidth := displayWidth(header), len("Songs")
+	for _, group := range groups {
+		nameWidth = max(nameWidth, displayWidth(group.Name))
+		countWidth = max(countWidth, len(strconv.Itoa(group.Count)))
+	}
+	fmt.Fprintln(o.writer, o.styled(fmt.Sprintf("%s  %*s", padWidth(header, nameWidth), countWidth, "Songs"), outputStyles.Header))
+	for _, group := range groups {
+		fmt.Fprintf(o.writer, "%s  %*d\n", padWidth(group.Name, nameWidth), countWidth, group.Count)
+	}
+	fmt.Fprintf(o.writer, "\n%d song(s) (out of %d total) in %d %s(s)\n", len(filteredSongs), total, len(groups), o.countBy)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	deadAirThreshold   time.Duration
+	deadAirSuggestTrim bool
+
+	deadAirCmd = &cobra.Command{
+		Use:   "dead-air",
+		Short: "Find songs with long silence after the last note",
+		Long: `Compare the end of each song's last chart note with the end of its audio and report the
+songs where the gap exceeds --threshold, largest first. Badly trimmed customs often keep
+minutes of audio after the chart ends.`,
+		RunE: runDeadAir,
+	}
+)
+
+func init() {
+	deadAirCmd.Flags().DurationVar(&deadAirThreshold, "threshold", 60*time.Second, "Report songs with more dead air than this")
+	deadAirCmd.Flags().BoolVar(&deadAirSuggestTrim, "suggest-trim", false, "Print ffmpeg commands that trim the audio to just after the last note")
+	rootCmd.AddCommand(deadAirCmd)
+}
+
+// trimPadding is the audio kept after the last note when suggesting a trim
+const trimPadding = 5 * time.Second
+
+// DeadAir is the gap between the last chart note and the end of a song's audio
+type DeadAir struct {
+	Song     *Song
+	LastNote time.Duration
+	AudioEnd time.Duration
+}
+
+// Gap returns the length of the silence after the last note
+func (d DeadAir) Gap() time.Duration {
+	return d.AudioEnd - d.LastNote
+}
+
+// measureDeadAir reads the last note time and audio duration of a song
+func measureDeadAir(song *Song) (DeadAir, error) {
+	if song.Packed {
+		return DeadAir{}, errPackedAudio
+	}
+	dir := filepath.Dir(song.Path)
+	chart, err := LoadChart(dir)
+	if err != nil {
+		return DeadAir{}, err
+	}
+	audioEnd, err := FolderAudioDuration(dir)
+	if err != nil {
+		return DeadAir{}, err
+	}
+	return DeadAir{Song: song, LastNote: chart.LastNoteTime(), AudioEnd: audioEnd}, nil
+}
+
+// deadAirDocument is the JSON representation of dead-air
+type deadAirDocument struct {
+	SchemaVersion int             `json:"schema_version"`
+	Checked       int             `json:"checked"`
+	Measured      int             `json:"measured"`
+	ThresholdMs   int64           `json:"threshold_ms"`
+	Songs         []deadAirRecord `json:"songs"`
+}
+
+// deadAirRecord is a single flagged song in deadAirDocument
+type deadAirRecord struct {
+	DeadAirMs  int64      `json:"dead_air_ms"`
+	LastNoteMs int64      `json:"last_note_ms"`
+	AudioEndMs int64      `json:"audio_end_ms"`
+	TrimToMs   int64      `json:"trim_to_ms,omitempty"` // with --suggest-trim
+	Song       SongRecord `json:"song"`
+}
+
+func runDeadAir(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("dead-air needs a local library")
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	var flagged []DeadAir
+	measured := 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		deadAir, err := measureDeadAir(song)
+		if err != nil {
+			continue
+		}
+		measured++
+		if deadAir.Gap() > deadAirThreshold {
+			flagged = append(flagged, deadAir)
+		}
+	}
+	sort.SliceStable(flagged, func(i, j int) bool { return flagged[i].Gap() > flagged[j].Gap() })
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if reportJSON() {
+		doc := deadAirDocument{
+			SchemaVersion: SchemaVersion,
+			Checked:       len(songs),
+			Measured:      measured,
+			ThresholdMs:   deadAirThreshold.Milliseconds(),
+			Songs:         make([]deadAirRecord, len(flagged)),
+		}
+		for i, d := range flagged {
+			doc.Songs[i] = deadAirRecord{
+				DeadAirMs:  d.Gap().Milliseconds(),
+				LastNoteMs: d.LastNote.Milliseconds(),
+				AudioEndMs: d.AudioEnd.Milliseconds(),
+				Song:       NewSongRecord(d.Song),
+			}
+			if deadAirSuggestTrim {
+				doc.Songs[i].TrimToMs = d.trimEnd().Milliseconds()
+			}
+		}
+		return writeReport(writer, doc)
+	}
+
+	fmt.Fprintf(writer, "Checked %d song(s) with chart and audio (of %d): %d with more than %s of dead air\n",
+		measured, len(songs), len(flagged), deadAirThreshold)
+	for _, d := range flagged {
+		fmt.Fprintf(writer, "\n%s - %s\n", d.Song.Artist, d.Song.Name)
+		fmt.Fprintf(writer, "   Dead air: %s (last note %s, audio ends %s)\n",
+			formatMillis(d.Gap().Milliseconds()), formatMillis(d.LastNote.Milliseconds()), formatMillis(d.AudioEnd.Milliseconds()))
+		fmt.Fprintf(writer, "   Path: %s\n", d.Song.Path)
+		if deadAirSuggestTrim {
+			writeTrimSuggestion(writer, d)
+		}
+	}
+	return nil
+}
+
+// trimEnd returns where a trim of the song's audio should end, shortly after the last note
+func (d DeadAir) trimEnd() time.Duration {
+	return (d.LastNote + trimPadding).Truncate(time.Millisecond)
+}
+
+// writeTrimSuggestion prints ffmpeg commands that cut every audio stem shortly after the
+// last note, plus the matching song_length
+func writeTrimSuggestion(w io.Writer, d DeadAir) {
+	end := d.trimEnd()
+	seconds := strconv.FormatFloat(end.Seconds(), 'f', 3, 64)
+
+	fmt.Fprintf(w, "   Trim to %s:\n", formatMillis(end.Milliseconds()))
+	for _, path := range songAudioFiles(filepath.Dir(d.Song.Path)) {
+		ext := filepath.Ext(path)
+		trimmed := path[:len(path)-len(ext)] + ".trimmed" + ext
+		fmt.Fprintf(w, "     ffmpeg -i %q -t %s -c copy %q\n", path, seconds, trimmed)
+	}
+	fmt.Fprintf(w, "     then set song_length = %d in song.ini\n", end.Milliseconds())
+}
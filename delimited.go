@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+)
+
+// SetColumns selects the columns written by the csv and tsv formats
+func (o *Output) SetColumns(columns []Column) {
+	o.columns = columns
+}
+
+// writeDelimited writes a header row and one row per song, separated by commas or tabs.
+// Values are quoted as spreadsheets expect when they contain the separator, quotes or
+// line breaks.
+func (o *Output) writeDelimited(filteredSongs []*Song) error {
+	columns := o.columns
+	if columns == nil {
+		var err error
+		if columns, err = selectColumns(nil); err != nil {
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(o.writer)
+	if o.format == FormatTSV {
+		writer.Comma = '\t'
+	}
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = column.Header
+	}
+	if err := writer.Write(row); err != nil {
+		return err
+	}
+	for _, song := range filteredSongs {
+		for i, column := range columns {
+			row[i] = column.Value(song)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", o.format, err)
+	}
+	return nil
+}
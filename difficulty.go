@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var difficultiesCmd = &cobra.Command{
+	Use:   "difficulties",
+	Short: "Report which difficulties are charted per instrument",
+	Long: `For every matching song, read the notes file and report which difficulties (easy, medium,
+hard, expert) actually contain notes for each instrument. The diff_* values in song.ini only
+rate how hard a part is; they don't say whether the reductions exist.`,
+	RunE: runDifficulties,
+}
+
+func init() {
+	rootCmd.AddCommand(difficultiesCmd)
+}
+
+// Difficulty is a chart difficulty level
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+	DifficultyExpert Difficulty = "expert"
+)
+
+// difficulties lists every difficulty from easiest to hardest
+var difficulties = []Difficulty{DifficultyEasy, DifficultyMedium, DifficultyHard, DifficultyExpert}
+
+// difficultyMarks are the single-letter abbreviations used in reports
+var difficultyMarks = map[Difficulty]string{DifficultyEasy: "E", DifficultyMedium: "M", DifficultyHard: "H", DifficultyExpert: "X"}
+
+// parseDifficulty validates a difficulty name
+func parseDifficulty(name string) (Difficulty, error) {
+	for _, difficulty := range difficulties {
+		if strings.EqualFold(name, string(difficulty)) {
+			return difficulty, nil
+		}
+	}
+	return "", fmt.Errorf("unknown difficulty %q (available: easy, medium, hard, expert)", name)
+}
+
+// trackPrefix returns the difficulty prefix of .chart track names (e.g. "Expert")
+func (d Difficulty) trackPrefix() string {
+	return strings.ToUpper(string(d[:1])) + string(d[1:])
+}
+
+// ChartedDifficulties returns, per instrument, the difficulties that contain notes,
+// ordered from easiest to hardest
+func (c *Chart) ChartedDifficulties() map[Instrument][]Difficulty {
+	charted := make(map[Instrument][]Difficulty)
+	for _, difficulty := range difficulties {
+		prefix := difficulty.trackPrefix()
+		seen := make(map[Instrument]bool)
+		for part, inst := range chartTrackInstruments {
+			if len(c.Tracks[prefix+part]) > 0 && !seen[inst] {
+				seen[inst] = true
+				charted[inst] = append(charted[inst], difficulty)
+			}
+		}
+	}
+	return charted
+}
+
+// HasDifficulty reports whether a song's notes file charts difficulty for inst
+func (s *Song) HasDifficulty(inst Instrument, difficulty Difficulty) bool {
+	for _, d := range s.Charted[inst] {
+		if d == difficulty {
+			return true
+		}
+	}
+	return false
+}
+
+// loadChartedDifficulties reads the notes file of every song to find out which
+// difficulties are actually charted, along with its note counts and sections
+func loadChartedDifficulties(songs []*Song) error {
+	if anyRemoteLibrary() {
+		return fmt.Errorf("filters that read the notes file need a local library")
+	}
+
+	failed := 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		chart, err := loadSongChart(song)
+		if err != nil {
+			failed++
+			song.Charted = map[Instrument][]Difficulty{}
+			continue
+		}
+		song.readChartData(chart)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't read the notes file of %d song(s)\n", failed)
+	}
+	return nil
+}
+
+// difficultyFilters returns every difficulty used by the spec or its nested clauses
+func (spec FilterSpec) difficultyFilters() []string {
+	var names []string
+	if spec.HasDifficulty != "" {
+		names = append(names, spec.HasDifficulty)
+	}
+	if spec.MissingDifficulty != "" {
+		names = append(names, spec.MissingDifficulty)
+	}
+	for _, clause := range spec.clauses() {
+		names = append(names, clause.difficultyFilters()...)
+	}
+	return names
+}
+
+// difficultiesDocument is the JSON representation of difficulties
+type difficultiesDocument struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Count         int                    `json:"count"`
+	Complete      int                    `json:"complete"` // songs with every difficulty of every part
+	Songs         []songDifficultyRecord `json:"songs"`
+}
+
+// songDifficultyRecord is the charted difficulties of one song's parts
+type songDifficultyRecord struct {
+	Song     SongRecord             `json:"song"`
+	Complete bool                   `json:"complete"`
+	Parts    []partDifficultyRecord `json:"parts"`
+}
+
+// partDifficultyRecord is the difficulties charted and missing for one instrument
+type partDifficultyRecord struct {
+	Instrument Instrument   `json:"instrument"`
+	Charted    []Difficulty `json:"charted"`
+	Missing    []Difficulty `json:"missing"`
+}
+
+// newSongDifficultyRecord lists which difficulties each charted part of a song has, by
+// instrument name
+func newSongDifficultyRecord(song *Song) songDifficultyRecord {
+	record := songDifficultyRecord{Song: NewSongRecord(song), Complete: true, Parts: []partDifficultyRecord{}}
+	instruments := make([]string, 0, len(song.Charted))
+	for inst := range song.Charted {
+		instruments = append(instruments, string(inst))
+	}
+	sort.Strings(instruments)
+
+	for _, name := range instruments {
+		part := partDifficultyRecord{Instrument: Instrument(name), Charted: []Difficulty{}, Missing: []Difficulty{}}
+		for _, difficulty := range difficulties {
+			if song.HasDifficulty(part.Instrument, difficulty) {
+				part.Charted = append(part.Charted, difficulty)
+			} else {
+				part.Missing = append(part.Missing, difficulty)
+				record.Complete = false
+			}
+		}
+		record.Parts = append(record.Parts, part)
+	}
+	return record
+}
+
+func runDifficulties(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	if len(songs) > 0 && songs[0].Charted == nil {
+		if err := loadChartedDifficulties(songs); err != nil {
+			return err
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	doc := difficultiesDocument{SchemaVersion: SchemaVersion, Count: len(songs), Songs: make([]songDifficultyRecord, len(songs))}
+	for i, song := range songs {
+		doc.Songs[i] = newSongDifficultyRecord(song)
+		if len(song.Charted) > 0 && doc.Songs[i].Complete {
+			doc.Complete++
+		}
+	}
+	if reportJSON() {
+		return writeReport(writer, doc)
+	}
+
+	for i, record := range doc.Songs {
+		fmt.Fprintf(writer, "%d. %s - %s\n", i+1, songs[i].Artist, songs[i].Name)
+		if len(record.Parts) == 0 {
+			fmt.Fprintf(writer, "   (no charted parts found)\n\n")
+			continue
+		}
+		for _, part := range record.Parts {
+			marks := make([]string, len(difficulties))
+			for j, difficulty := range difficulties {
+				marks[j] = "-"
+				if slices.Contains(part.Charted, difficulty) {
+					marks[j] = difficultyMarks[difficulty]
+				}
+			}
+			line := fmt.Sprintf("   %s %s", padWidth(string(part.Instrument)+":", 10), strings.Join(marks, " "))
+			if len(part.Missing) > 0 {
+				missing := make([]string, len(part.Missing))
+				for j, difficulty := range part.Missing {
+					missing[j] = string(difficulty)
+				}
+				line += "  (missing " + strings.Join(missing, ", ") + ")"
+			}
+			fmt.Fprintln(writer, line)
+		}
+		fmt.Fprintln(writer)
+	}
+
+	fmt.Fprintf(writer, "%d of %d song(s) have every difficulty charted for every part\n", doc.Complete, len(songs))
+	return nil
+}
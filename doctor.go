@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	doctorYes bool
+
+	doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Find the problems of the library and fix the ones you pick",
+		Long: `Run every check in turn, audit, lint, dupes and verify, and list what they find from
+worst to mildest in one numbered checklist. Pick the problems to fix by number
+("1,3-5"), "all" or "none"; the rest are left for you to fix by hand.
+
+  audit   missing or empty notes, audio, album art and backgrounds
+  lint    metadata problems and misnamed folders, fixed like lint --fix
+  dupes   copies of the same chart in several folders; the extra copies are moved
+          to cold storage, where thaw can bring them back
+  verify  song.ini files that don't parse, and charts without a song.ini, for which
+          one is created like generate-ini does
+
+Without a terminal the checklist is only printed; --yes fixes everything that can be.`,
+		Args: cobra.NoArgs,
+		RunE: runDoctor,
+	}
+)
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorYes, "yes", false, "Fix every fixable problem without asking")
+	doctorCmd.Flags().StringVar(&coldArchive, "archive", "", "Cold-storage archive duplicate copies are moved to (default: <directory>_cold next to the library)")
+	doctorCmd.Flags().StringVar(&lintFolderTemplate, "folder-template", defaultFolderTemplate, "Folder name the folder-name rule renames song folders to")
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorProblem is one entry of the doctor checklist
+type doctorProblem struct {
+	Check    string // audit, lint, dupes or verify
+	Severity LintSeverity
+	Path     string
+	Message  string
+	Fix      func() error // nil for problems to fix by hand
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("doctor needs a local library")
+	}
+	if err := validateFolderTemplate(lintFolderTemplate); err != nil {
+		return err
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+
+	scanners, err := newLibraryScanners()
+	if err != nil {
+		return err
+	}
+	spec, err := buildFilterSpec()
+	if err != nil {
+		return err
+	}
+	_, songs, _, err := filterLibrary(scanners, spec)
+	if err != nil {
+		return err
+	}
+
+	var problems []doctorProblem
+	checks := []struct {
+		name string
+		run  func() ([]doctorProblem, error)
+	}{
+		{"audit", func() ([]doctorProblem, error) { return doctorAudit(songs) }},
+		{"lint", func() ([]doctorProblem, error) { return doctorLint(songs) }},
+		{"dupes", func() ([]doctorProblem, error) { return doctorDupes(root, songs) }},
+		{"verify", func() ([]doctorProblem, error) { return doctorVerify(root, scanners[0].Errors()) }},
+	}
+	for _, check := range checks {
+		found, err := check.run()
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", check.name, err)
+		}
+		fmt.Fprintf(os.Stderr, "%-6s  %d problem(s)\n", check.name, len(found))
+		problems = append(problems, found...)
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Severity.rank() < problems[j].Severity.rank() })
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if len(problems) == 0 && !reportJSON() {
+		fmt.Fprintf(writer, "Checked %d song(s): no problems found\n", len(songs))
+		return nil
+	}
+	fixable := 0
+	for _, problem := range problems {
+		if problem.Fix != nil {
+			fixable++
+		}
+	}
+	if !reportJSON() {
+		fmt.Fprintln(writer)
+		writeDoctorChecklist(writer, problems)
+	}
+
+	// JSON goes out once the fixes are done, so there's no checklist to pick from
+	var selected []bool
+	switch {
+	case fixable == 0:
+	case doctorYes:
+		selected = make([]bool, fixable)
+		for i := range selected {
+			selected[i] = true
+		}
+	case isInteractive() && !reportJSON():
+		fmt.Fprintln(writer)
+		if selected, err = askDoctorSelection(bufio.NewReader(os.Stdin), os.Stderr, fixable); err != nil {
+			return err
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "\nNo terminal to ask which problems to fix; pass --yes to fix all of them.")
+	}
+	if slices.Contains(selected, true) {
+		if err := ensureWritable("fix problems"); err != nil {
+			return err
+		}
+	}
+
+	records := make([]doctorProblemRecord, len(problems))
+	fixed, failed, number := 0, 0, 0
+	for i, problem := range problems {
+		records[i] = doctorProblemRecord{Check: problem.Check, Severity: problem.Severity, Path: problem.Path, Message: problem.Message}
+		if problem.Fix == nil {
+			continue
+		}
+		number++
+		records[i].Number = number
+		if number > len(selected) || !selected[number-1] {
+			continue
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+		if err := problem.Fix(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to fix %s: %v\n", problem.Path, err)
+			records[i].FixError = err.Error()
+			failed++
+			continue
+		}
+		records[i].Fixed = true
+		fixed++
+	}
+
+	if reportJSON() {
+		err = writeReport(writer, doctorDocument{
+			SchemaVersion: SchemaVersion,
+			Checked:       len(songs),
+			Found:         len(problems),
+			Fixed:         fixed,
+			Failed:        failed,
+			Left:          len(problems) - fixed,
+			Problems:      records,
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(writer, "\nChecked %d song(s): %d problem(s) found, %d fixed, %d failed to fix, %d left\n",
+			len(songs), len(problems), fixed, failed, len(problems)-fixed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d fix(es) failed", failed)
+	}
+	return nil
+}
+
+// doctorDocument is the JSON representation of doctor
+type doctorDocument struct {
+	SchemaVersion int                   `json:"schema_version"`
+	Checked       int                   `json:"checked"`
+	Found         int                   `json:"found"`
+	Fixed         int                   `json:"fixed"`
+	Failed        int                   `json:"failed"` // fixes that failed
+	Left          int                   `json:"left"`
+	Problems      []doctorProblemRecord `json:"problems"`
+}
+
+// doctorProblemRecord is a single problem in doctorDocument
+type doctorProblemRecord struct {
+	Number   int          `json:"number,omitempty"` // its number in the checklist, for fixable problems
+	Check    string       `json:"check"`
+	Severity LintSeverity `json:"severity"`
+	Path     string       `json:"path"`
+	Message  string       `json:"message"`
+	Fixed    bool         `json:"fixed"`
+	FixError string       `json:"fix_error,omitempty"`
+}
+
+// doctorAudit runs audit over songs; its problems are fixed by hand
+func doctorAudit(songs []*Song) ([]doctorProblem, error) {
+	caches := make(map[string]*auditCache)
+	var problems []doctorProblem
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return nil, err
+		}
+		root := songRoot(song)
+		cache, ok := caches[root]
+		if !ok {
+			cache = loadAuditCache(NewScanner(root, ScanOptions{}).auditCacheFile())
+			caches[root] = cache
+		}
+		findings, err := cache.auditSong(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to audit %s: %v\n", songFolder(song), err)
+			continue
+		}
+		for _, finding := range findings {
+			problems = append(problems, doctorProblem{Check: "audit", Severity: finding.Severity, Path: songFolder(song), Message: finding.Message})
+		}
+	}
+	for root, cache := range caches {
+		if err := cache.save(NewScanner(root, ScanOptions{}).auditCacheFile()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save audit cache: %v\n", err)
+		}
+	}
+	return problems, nil
+}
+
+// doctorLint runs every lint rule over songs, with the automatic fixes of lint --fix
+func doctorLint(songs []*Song) ([]doctorProblem, error) {
+	issues, err := lintSongs(songs, lintRuleSet)
+	if err != nil {
+		return nil, err
+	}
+	problems := make([]doctorProblem, len(issues))
+	for i, issue := range issues {
+		problems[i] = doctorProblem{Check: "lint", Severity: issue.Severity, Path: issue.Song.Path, Message: fmt.Sprintf("[%s] %s", issue.Rule, issue.Message)}
+		if issue.Fix != nil || issue.Rename != "" {
+			problems[i].Fix = func() error { return fixLintIssue(issue) }
+		}
+	}
+	return problems, nil
+}
+
+// doctorDupes finds songs whose notes file is the same as that of a song in another
+// folder. The first copy in path order is kept; fixing moves the others to cold storage.
+// Different charts of what looks like the same song, by the same artist under names
+// that normalize alike ("Pt. II" and "Part 2"), are listed to check by hand.
+func doctorDupes(root string, songs []*Song) ([]doctorProblem, error) {
+	copies := make(map[string][]*Song)
+	for _, song := range songs {
+		if song.Checksum != "" {
+			copies[song.Checksum] = append(copies[song.Checksum], song)
+		}
+	}
+	archive, err := coldArchiveDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []doctorProblem
+	for _, group := range copies {
+		if len(group) < 2 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool { return songFolder(group[i]) < songFolder(group[j]) })
+		kept, _ := filepath.Rel(root, songFolder(group[0]))
+		for _, song := range group[1:] {
+			problems = append(problems, doctorProblem{
+				Check:    "dupes",
+				Severity: SeverityWarning,
+				Path:     songFolder(song),
+				Message:  fmt.Sprintf("same chart as %s; fixing moves this copy to cold storage", kept),
+				Fix:      func() error { return archiveDuplicate(root, archive, song) },
+			})
+		}
+	}
+	problems = append(problems, doctorAlikeSongs(root, songs)...)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems, nil
+}
+
+// doctorAlikeSongs finds the charts of a song whose artist and normalized name are those
+// of an earlier chart in path order, leaving out copies of the same chart
+func doctorAlikeSongs(root string, songs []*Song) []doctorProblem {
+	sorted := slices.Clone(songs)
+	sort.Slice(sorted, func(i, j int) bool { return songFolder(sorted[i]) < songFolder(sorted[j]) })
+
+	first := make(map[string]*Song)
+	charts := make(map[string]bool)
+	var problems []doctorProblem
+	for _, song := range sorted {
+		if song.Checksum == "" || charts[song.Checksum] {
+			continue
+		}
+		charts[song.Checksum] = true
+		key := normalizeName(song.Artist) + "\x00" + normalizeName(song.Name)
+		original, ok := first[key]
+		if !ok {
+			first[key] = song
+			continue
+		}
+		other, _ := filepath.Rel(root, songFolder(original))
+		problems = append(problems, doctorProblem{
+			Check:    "dupes",
+			Severity: SeverityInfo,
+			Path:     songFolder(song),
+			Message:  fmt.Sprintf("another chart of %s - %s, like %s; check by hand", song.Artist, song.Name, other),
+		})
+	}
+	return problems
+}
+
+// archiveDuplicate moves a duplicate copy of a song into the cold-storage archive
+func archiveDuplicate(root, archive string, song *Song) error {
+	folder, err := filepath.Abs(songFolder(song))
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, folder)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("song.ini is not in its own folder inside %s", root)
+	}
+	index, err := loadColdIndex(archive)
+	if err != nil {
+		return err
+	}
+	ok, err := index.archive(archive, rel, folder, song)
+	if err == nil && !ok {
+		err = fmt.Errorf("%s is already archived", rel)
+	}
+	return err
+}
+
+// doctorVerify reports the song.ini files of the scan that failed to parse, and the
+// charts without a song.ini, which get one generated as their fix
+func doctorVerify(root string, failures []ParseFailure) ([]doctorProblem, error) {
+	var problems []doctorProblem
+	for _, failure := range failures {
+		problems = append(problems, doctorProblem{Check: "verify", Severity: SeverityError, Path: failure.Path, Message: failure.Error})
+	}
+
+	folders, err := findBareChartFolders(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range folders {
+		problems = append(problems, doctorProblem{
+			Check:    "verify",
+			Severity: SeverityWarning,
+			Path:     dir,
+			Message:  "notes.chart without a song.ini; fixing creates one from the chart",
+			Fix: func() error {
+				content, err := generateSongIni(dir)
+				if err != nil {
+					return err
+				}
+				return writeLibraryFile(filepath.Join(dir, "song.ini"), []byte(content), 0644)
+			},
+		})
+	}
+	return problems, nil
+}
+
+// writeDoctorChecklist prints the problems under a heading per severity, numbering the
+// ones that can be fixed
+func writeDoctorChecklist(w io.Writer, problems []doctorProblem) {
+	headings := map[LintSeverity]string{SeverityError: "Errors", SeverityWarning: "Warnings", SeverityInfo: "Info"}
+	counts := make(map[LintSeverity]int)
+	for _, problem := range problems {
+		counts[problem.Severity]++
+	}
+
+	var current LintSeverity
+	number := 0
+	for _, problem := range problems {
+		if problem.Severity != current {
+			if current != "" {
+				fmt.Fprintln(w)
+			}
+			current = problem.Severity
+			fmt.Fprintf(w, "%s (%d):\n", headings[current], counts[current])
+		}
+		marker := "    -"
+		if problem.Fix != nil {
+			number++
+			marker = fmt.Sprintf("%4d.", number)
+		}
+		fmt.Fprintf(w, "%s %-6s %s: %s\n", marker, problem.Check, problem.Path, problem.Message)
+	}
+	if number < len(problems) {
+		fmt.Fprintf(w, "\nProblems marked - have no automatic fix.\n")
+	}
+}
+
+// askDoctorSelection asks which of the fixable problems to fix, all of them by default
+func askDoctorSelection(in *bufio.Reader, out io.Writer, fixable int) ([]bool, error) {
+	for {
+		answer, err := ask(in, out, fmt.Sprintf("Fix which problems? all, none or numbers like 1,3-5 (1-%d)", fixable), "all")
+		if err != nil {
+			return nil, err
+		}
+		selected, err := parseDoctorSelection(answer, fixable)
+		if err == nil {
+			return selected, nil
+		}
+		fmt.Fprintf(out, "%v\n", err)
+	}
+}
+
+// parseDoctorSelection reads "all", "none" or a comma-separated list of numbers and
+// ranges into which of n problems are selected
+func parseDoctorSelection(answer string, n int) ([]bool, error) {
+	selected := make([]bool, n)
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "all", "a":
+		for i := range selected {
+			selected[i] = true
+		}
+		return selected, nil
+	case "none", "n", "":
+		return selected, nil
+	}
+
+	for _, part := range strings.Split(answer, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		last := first
+		if err == nil && isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(to))
+		}
+		if err != nil || first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("%q isn't a number or range between 1 and %d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			selected[i-1] = true
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats of --duration-format
+const (
+	DurationColon   = "colon"   // 4:32, 1:05:00
+	DurationHuman   = "human"   // 4 min 32 s, 1 h 05 min
+	DurationSeconds = "seconds" // 272, 3900
+	DurationISO8601 = "iso8601" // PT4M32S, PT1H5M
+)
+
+// durationFormats are the values of --duration-format
+var durationFormats = []string{DurationColon, DurationHuman, DurationSeconds, DurationISO8601}
+
+var (
+	durationFormat string
+
+	// durationFormatSet is whether --duration-format or duration_format picked the format,
+	// rather than the locale
+	durationFormatSet bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&durationFormat, "duration-format", "", "", "How lengths and totals are written: colon, human, seconds or iso8601 (default from the locale for text, colon for data formats)")
+}
+
+// localeDurationFormat is the --duration-format of the locale, from LC_ALL, LC_TIME or
+// LANG, the first one set: colon (1:05:00) in English and the C locale, human
+// (1 h 05 min) in the others. CI mode always uses colon.
+func localeDurationFormat() string {
+	if ciMode {
+		return DurationColon
+	}
+	var locale string
+	for _, name := range []string{"LC_ALL", "LC_TIME", "LANG"} {
+		if locale = os.Getenv(name); locale != "" {
+			break
+		}
+	}
+	language, _, _ := strings.Cut(strings.ToLower(locale), "_")
+	language, _, _ = strings.Cut(language, ".")
+	switch language {
+	case "", "c", "posix", "en":
+		return DurationColon
+	}
+	return DurationHuman
+}
+
+// validateDurationFormat checks --duration-format
+func validateDurationFormat() error {
+	durationFormat = strings.ToLower(durationFormat)
+	for _, format := range durationFormats {
+		if durationFormat == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown --duration-format %q (available: %s)", durationFormat, strings.Join(durationFormats, ", "))
+}
+
+// formatDataDuration writes a length or a total for JSON, CSV, TSV, Excel and serve: in
+// the --duration-format if one was picked, else as colon, so the locale doesn't change
+// what scripts read
+func formatDataDuration(d time.Duration) string {
+	if !durationFormatSet {
+		return formatClock(d)
+	}
+	return formatDuration(d)
+}
+
+// formatDuration writes a song length or a total in the --duration-format, to the second
+func formatDuration(d time.Duration) string {
+	total := int(d.Seconds())
+	hours, minutes, seconds := total/3600, total%3600/60, total%60
+	switch durationFormat {
+	case DurationHuman:
+		switch {
+		case hours > 0:
+			return fmt.Sprintf("%d h %02d min", hours, minutes)
+		case minutes > 0:
+			return fmt.Sprintf("%d min %02d s", minutes, seconds)
+		}
+		return fmt.Sprintf("%d s", seconds)
+	case DurationSeconds:
+		return fmt.Sprint(total)
+	case DurationISO8601:
+		if total == 0 {
+			return "PT0S"
+		}
+		var b strings.Builder
+		b.WriteString("PT")
+		for _, part := range []struct {
+			count int
+			unit  string
+		}{{hours, "H"}, {minutes, "M"}, {seconds, "S"}} {
+			if part.count > 0 {
+				fmt.Fprintf(&b, "%d%s", part.count, part.unit)
+			}
+		}
+		return b.String()
+	}
+	return formatClock(d)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	enrichApply bool
+	enrichOnly  []string
+
+	enrichCmd = &cobra.Command{
+		Use:   "enrich",
+		Short: "Suggest missing metadata for matching songs",
+		Long: `Run the enrichers over the matching songs and print the metadata they suggest for
+fields that are empty or hold a placeholder. Nothing is written unless --apply is given,
+which updates only the suggested keys in song.ini.
+
+Enrichers:
+  genre   Suggest a genre for songs without one, from --genre-map, the genres of the
+          artist's other songs in the library, or MusicBrainz tags with --musicbrainz`,
+		RunE: runEnrich,
+	}
+)
+
+func init() {
+	enrichCmd.Flags().BoolVar(&enrichApply, "apply", false, "Write the suggestions to song.ini")
+	enrichCmd.Flags().StringSliceVar(&enrichOnly, "only", nil, "Only run these enrichers (default: all)")
+	enrichCmd.Flags().StringVar(&genreMapFile, "genre-map", "", "YAML/JSON file mapping artists to genres")
+	enrichCmd.Flags().BoolVar(&genreMusicBrainz, "musicbrainz", false, "Look up artist genres on MusicBrainz (online, about one request per second)")
+	rootCmd.AddCommand(enrichCmd)
+}
+
+// Enricher suggests values for song.ini keys that are missing
+type Enricher struct {
+	Name        string
+	Description string
+	// Prepare is called once with the whole library before any suggestions are made
+	Prepare func(library []*Song) error
+	// Suggest returns the song.ini values to set and where they came from, or nil
+	Suggest func(song *Song) (map[string]string, string, error)
+}
+
+// enrichers lists every enricher in the order they run
+var enrichers = []Enricher{
+	{
+		Name:        "genre",
+		Description: "genre from an artist map, the library or MusicBrainz",
+		Prepare:     prepareGenreClassifier,
+		Suggest:     suggestGenre,
+	},
+}
+
+// selectEnrichers returns the enrichers named in --only, or all of them
+func selectEnrichers(names []string) ([]Enricher, error) {
+	if len(names) == 0 {
+		return enrichers, nil
+	}
+	var selected []Enricher
+	for _, name := range names {
+		found := false
+		for _, enricher := range enrichers {
+			if enricher.Name == strings.ToLower(strings.TrimSpace(name)) {
+				selected = append(selected, enricher)
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, len(enrichers))
+			for i, enricher := range enrichers {
+				available[i] = enricher.Name
+			}
+			return nil, fmt.Errorf("unknown enricher %q (available: %s)", name, strings.Join(available, ", "))
+		}
+	}
+	return selected, nil
+}
+
+func runEnrich(cmd *cobra.Command, args []string) error {
+	selected, err := selectEnrichers(enrichOnly)
+	if err != nil {
+		return err
+	}
+	if enrichApply {
+		if err := ensureWritable("apply enrichments"); err != nil {
+			return err
+		}
+	}
+
+	library, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	for _, enricher := range selected {
+		if enricher.Prepare != nil {
+			if err := enricher.Prepare(library); err != nil {
+				return fmt.Errorf("%s: %w", enricher.Name, err)
+			}
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	suggested, applied := 0, 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		for _, enricher := range selected {
+			values, source, err := enricher.Suggest(song)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %s - %s: %v\n", enricher.Name, song.Artist, song.Name, err)
+				continue
+			}
+			if len(values) == 0 {
+				continue
+			}
+			suggested++
+
+			var changes []string
+			for _, key := range sortedKeys(values) {
+				changes = append(changes, fmt.Sprintf("%s = %s", key, values[key]))
+			}
+			status := ""
+			if enrichApply {
+				if err := setIniValues(song.Path, values); err != nil {
+					return err
+				}
+				applied++
+				status = " [applied]"
+			}
+			fmt.Fprintf(writer, "%s: [%s] %s (from %s)%s\n", song.Path, enricher.Name, strings.Join(changes, "; "), source, status)
+		}
+	}
+
+	if enrichApply {
+		fmt.Fprintf(os.Stderr, "%d suggestion(s), %d applied\n", suggested, applied)
+	} else {
+		fmt.Fprintf(os.Stderr, "%d suggestion(s); run with --apply to write them\n", suggested)
+	}
+	return nil
+}
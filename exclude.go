@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	excludeArtist  []string
+	excludeGenre   []string
+	excludeCharter []string
+	excludeNot     []string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVarP(&excludeArtist, "exclude-artist", "", nil, "Leave out songs by this artist; comma-separated or repeated to leave out several")
+	rootCmd.PersistentFlags().StringSliceVarP(&excludeGenre, "exclude-genre", "", nil, "Leave out songs of this genre; comma-separated or repeated to leave out several")
+	rootCmd.PersistentFlags().StringSliceVarP(&excludeCharter, "exclude-charter", "", nil, "Leave out songs by this charter; comma-separated or repeated to leave out several")
+	rootCmd.PersistentFlags().StringArrayVarP(&excludeNot, "not", "", nil, "Leave out songs matching a filter file key and value (e.g. genre=meme or length=>8:00); repeat to leave out several")
+}
+
+// exclusionFilters returns a "not" clause for every --exclude-* and --not value
+func exclusionFilters() ([]FilterSpec, error) {
+	var clauses []FilterSpec
+	for _, artist := range trimValues(excludeArtist) {
+		if artist != "" {
+			clauses = append(clauses, FilterSpec{Artist: artist})
+		}
+	}
+	for _, genre := range trimValues(excludeGenre) {
+		if genre != "" {
+			clauses = append(clauses, FilterSpec{Genre: genre})
+		}
+	}
+	for _, charter := range trimValues(excludeCharter) {
+		if charter != "" {
+			clauses = append(clauses, FilterSpec{Charter: charter})
+		}
+	}
+	for _, value := range excludeNot {
+		clause, err := parseNot(value)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// parseNot parses a --not value, a filter file key and its value separated by "="
+func parseNot(value string) (FilterSpec, error) {
+	key, criterion, ok := strings.Cut(value, "=")
+	key, criterion = strings.TrimSpace(key), strings.TrimSpace(criterion)
+	if !ok || key == "" || criterion == "" {
+		return FilterSpec{}, fmt.Errorf("invalid --not %q (expected key=value, e.g. genre=meme)", value)
+	}
+	spec, err := specFromKey(key, criterion)
+	if err != nil {
+		return FilterSpec{}, fmt.Errorf("invalid --not %q: %w", value, err)
+	}
+	return spec, nil
+}
+
+// specFromKey builds a spec from a single filter file key and its value, decoded as it
+// would be in a filter file, so year=2005 and ghl=true work
+func specFromKey(key, value string) (FilterSpec, error) {
+	// A node rather than YAML text, so values such as >8:00 aren't read as YAML syntax
+	node := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: key},
+		{Kind: yaml.ScalarNode, Value: value},
+	}}
+	var spec FilterSpec
+	if err := node.Decode(&spec); err != nil || spec.isZero() {
+		return FilterSpec{}, fmt.Errorf("unknown key or bad value for %s", key)
+	}
+	return spec, nil
+}
+
+// isZero reports whether the spec has no criteria at all
+func (spec FilterSpec) isZero() bool {
+	filter, err := NewFilter(spec)
+	return err == nil && filter.isEmpty()
+}
+
+// hasCriteria reports whether the spec leaves any song out. Nested clauses without
+// criteria, such as an empty filter file, don't count, and "any" only narrows when each
+// of its clauses does.
+func (spec FilterSpec) hasCriteria() bool {
+	flat := spec
+	flat.All, flat.Any, flat.Not = nil, nil, nil
+	if !flat.isZero() {
+		return true
+	}
+	for _, clause := range spec.All {
+		if clause.hasCriteria() {
+			return true
+		}
+	}
+	if len(spec.Any) > 0 {
+		narrows := true
+		for _, clause := range spec.Any {
+			narrows = narrows && clause.hasCriteria()
+		}
+		if narrows {
+			return true
+		}
+	}
+	for _, clause := range spec.Not {
+		if clause.hasCriteria() {
+			return true
+		}
+	}
+	return false
+}
+
+// clauses returns the nested "all", "any" and "not" clauses of the spec
+func (spec FilterSpec) clauses() []FilterSpec {
+	clauses := make([]FilterSpec, 0, len(spec.All)+len(spec.Any)+len(spec.Not))
+	clauses = append(clauses, spec.All...)
+	clauses = append(clauses, spec.Any...)
+	return append(clauses, spec.Not...)
+}
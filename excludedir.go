@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var excludeDirs []string
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVarP(&excludeDirs, "exclude-dir", "", nil, "Skip folders matching this glob when scanning (e.g. '__MACOSX' or 'Projects/*/build'); comma-separated or repeated to skip several")
+}
+
+// validateExcludeDirs checks the --exclude-dir patterns, dropping the trailing slashes
+// they're often written with
+func validateExcludeDirs() error {
+	patterns := make([]string, 0, len(excludeDirs))
+	for _, pattern := range trimValues(excludeDirs) {
+		pattern = strings.TrimRight(filepath.ToSlash(pattern), "/")
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude-dir %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	excludeDirs = patterns
+	return nil
+}
+
+// matchesExcludeDir reports whether a folder of a library matches one of patterns,
+// ignoring case. Patterns with a slash match the folder's path inside the library, e.g.
+// "to-sort" or "Projects/*/build"; the others match its name anywhere, e.g. "__MACOSX".
+func matchesExcludeDir(rel string, patterns []string) bool {
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	name := rel[strings.LastIndex(rel, "/")+1:]
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		target := name
+		if strings.Contains(pattern, "/") {
+			target = rel
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
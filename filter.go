@@ -2,33 +2,137 @@ package main
 
 import (
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Filter handles filtering songs based on various criteria
 type Filter struct {
-	name    string
-	artist  string
-	genre   string
-	charter string
-	year    int
-	length  string // e.g., ">5:00" or "<3:30"
-	inst    string
+	name          string
+	artist        string
+	primaryArtist string
+	featured      string
+	genre         string
+	charter       string
+	year          int
+	length        string // e.g., ">5:00" or "<3:30"
+	inst          string
+	hasDiff       Difficulty
+	missingDiff   Difficulty
+	ghl           *bool         // true for Guitar Hero Live charts only, false to leave them out
+	pro           bool          // only songs with a pro guitar, bass or keys part
+	maxIntro      time.Duration // longest time before the first note, 0 for any
+	noOpens       bool          // leave out songs with open notes
+	noTaps        bool          // leave out songs with tap notes
+	path          string        // glob or substring of the folders the song must be under
+	root          string        // substring of the library the song must be in
+	played        *bool         // true for songs with a score only, false for songs never played
+	fc            *bool         // true for full combo'd songs only, false for the rest
+	maxPlays      *int          // most times a song may have been played, nil for any
+	maxRating     int           // highest rating of rated songs, 0 for any
+	all           []*Filter     // nested clauses that must all match
+	any           []*Filter     // nested clauses of which at least one must match
+	not           []*Filter     // nested clauses none of which may match
+	spec          FilterSpec    // the criteria the filter was built from
 }
 
-// NewFilter creates a new Filter instance
-func NewFilter(name, artist, genre, charter string, year int, length, inst string) *Filter {
-	return &Filter{
-		name:    name,
-		artist:  artist,
-		genre:   genre,
-		charter: charter,
-		year:    year,
-		length:  length,
-		inst:    inst,
+// FilterSpec describes filter criteria. It is built from the command line flags or
+// loaded from a YAML/JSON filter file, where clauses can be nested with "all", "any" and
+// "not".
+type FilterSpec struct {
+	Name              string       `yaml:"name,omitempty" json:"name,omitempty"`
+	Artist            string       `yaml:"artist,omitempty" json:"artist,omitempty"`
+	PrimaryArtist     string       `yaml:"primary_artist,omitempty" json:"primary_artist,omitempty"`
+	Featured          string       `yaml:"featured,omitempty" json:"featured,omitempty"`
+	Genre             string       `yaml:"genre,omitempty" json:"genre,omitempty"`
+	Charter           string       `yaml:"charter,omitempty" json:"charter,omitempty"`
+	Year              int          `yaml:"year,omitempty" json:"year,omitempty"`
+	Length            string       `yaml:"length,omitempty" json:"length,omitempty"`
+	Instrument        string       `yaml:"instrument,omitempty" json:"instrument,omitempty"`
+	HasDifficulty     string       `yaml:"has_difficulty,omitempty" json:"has_difficulty,omitempty"`
+	MissingDifficulty string       `yaml:"missing_difficulty,omitempty" json:"missing_difficulty,omitempty"`
+	GHL               *bool        `yaml:"ghl,omitempty" json:"ghl,omitempty"`
+	Pro               bool         `yaml:"pro,omitempty" json:"pro,omitempty"`
+	MaxIntro          string       `yaml:"max_intro,omitempty" json:"max_intro,omitempty"`
+	NoOpens           bool         `yaml:"no_opens,omitempty" json:"no_opens,omitempty"`
+	NoTaps            bool         `yaml:"no_taps,omitempty" json:"no_taps,omitempty"`
+	Path              string       `yaml:"path,omitempty" json:"path,omitempty"`
+	Root              string       `yaml:"root,omitempty" json:"root,omitempty"`
+	Played            *bool        `yaml:"played,omitempty" json:"played,omitempty"`
+	FC                *bool        `yaml:"fc,omitempty" json:"fc,omitempty"`
+	MaxPlays          *int         `yaml:"max_plays,omitempty" json:"max_plays,omitempty"`
+	MaxRating         int          `yaml:"max_rating,omitempty" json:"max_rating,omitempty"`
+	All               []FilterSpec `yaml:"all,omitempty" json:"all,omitempty"`
+	Any               []FilterSpec `yaml:"any,omitempty" json:"any,omitempty"`
+	Not               []FilterSpec `yaml:"not,omitempty" json:"not,omitempty"`
+}
+
+// NewFilter creates a new Filter instance, failing on an invalid max_intro
+func NewFilter(spec FilterSpec) (*Filter, error) {
+	f := &Filter{
+		name:          spec.Name,
+		artist:        spec.Artist,
+		primaryArtist: spec.PrimaryArtist,
+		featured:      spec.Featured,
+		genre:         spec.Genre,
+		charter:       spec.Charter,
+		year:          spec.Year,
+		length:        spec.Length,
+		inst:          spec.Instrument,
+		hasDiff:       Difficulty(strings.ToLower(spec.HasDifficulty)),
+		missingDiff:   Difficulty(strings.ToLower(spec.MissingDifficulty)),
+		ghl:           spec.GHL,
+		pro:           spec.Pro,
+		noOpens:       spec.NoOpens,
+		noTaps:        spec.NoTaps,
+		path:          spec.Path,
+		root:          spec.Root,
+		played:        spec.Played,
+		fc:            spec.FC,
+		maxPlays:      spec.MaxPlays,
+		maxRating:     spec.MaxRating,
+		spec:          spec,
+	}
+	if spec.MaxIntro != "" {
+		intro, err := parseIntro(spec.MaxIntro)
+		if err != nil {
+			return nil, err
+		}
+		f.maxIntro = intro
+	}
+	var err error
+	if f.all, err = newFilters(spec.All); err != nil {
+		return nil, err
+	}
+	if f.any, err = newFilters(spec.Any); err != nil {
+		return nil, err
+	}
+	if f.not, err = newFilters(spec.Not); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// newFilters creates the filters of nested clauses
+func newFilters(specs []FilterSpec) ([]*Filter, error) {
+	var filters []*Filter
+	for _, spec := range specs {
+		filter, err := NewFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
 	}
+	return filters, nil
+}
+
+// Spec returns the criteria the filter was built from
+func (f *Filter) Spec() FilterSpec {
+	return f.spec
 }
 
 // Apply applies all filters to the song list
@@ -36,41 +140,51 @@ func (f *Filter) Apply(songs []*Song) []*Song {
 	if f.isEmpty() {
 		return songs
 	}
-	
+
 	var filtered []*Song
 	for _, song := range songs {
 		if f.matches(song) {
 			filtered = append(filtered, song)
 		}
 	}
-	
+
 	return filtered
 }
 
 // isEmpty checks if any filters are set
 func (f *Filter) isEmpty() bool {
-	return f.name == "" && f.artist == "" && f.genre == "" && 
-		f.charter == "" && f.year == 0 && f.length == "" && f.inst == ""
+	return f.name == "" && f.artist == "" && f.primaryArtist == "" && f.featured == "" && f.genre == "" &&
+		f.charter == "" && f.year == 0 && f.length == "" && f.inst == "" && f.hasDiff == "" && f.missingDiff == "" &&
+		f.ghl == nil && !f.pro && f.maxIntro == 0 && !f.noOpens && !f.noTaps && f.path == "" && f.root == "" && f.played == nil && f.fc == nil && f.maxPlays == nil && f.maxRating == 0 && len(f.all) == 0 && len(f.any) == 0 &&
+		len(f.not) == 0
 }
 
 // matches checks if a song matches all filter criteria
 func (f *Filter) matches(song *Song) bool {
-	if f.name != "" && !fuzzyMatch(song.Name, f.name) {
+	if f.name != "" && !matchesName(song.Name, f.name) {
 		return false
 	}
-	
+
 	if f.artist != "" && !strings.Contains(strings.ToLower(song.Artist), strings.ToLower(f.artist)) {
 		return false
 	}
-	
+
+	if f.primaryArtist != "" && !strings.EqualFold(song.PrimaryArtist(), collapseSpaces(f.primaryArtist)) {
+		return false
+	}
+
+	if f.featured != "" && !f.matchesFeatured(song) {
+		return false
+	}
+
 	if f.genre != "" && !strings.Contains(strings.ToLower(song.Genre), strings.ToLower(f.genre)) {
 		return false
 	}
-	
+
 	if f.charter != "" {
 		charterMatch := false
 		for _, charter := range song.Charters {
-			if strings.Contains(strings.ToLower(charter), strings.ToLower(f.charter)) {
+			if strings.Contains(strings.ToLower(plainCharter(charter)), strings.ToLower(f.charter)) {
 				charterMatch = true
 				break
 			}
@@ -79,19 +193,84 @@ func (f *Filter) matches(song *Song) bool {
 			return false
 		}
 	}
-	
+
 	if f.year != 0 && song.Year != f.year {
 		return false
 	}
-	
+
 	if f.length != "" && !f.matchesLength(song) {
 		return false
 	}
-	
+
 	if f.inst != "" && !f.matchesInstrument(song) {
 		return false
 	}
-	
+
+	if f.hasDiff != "" && !f.matchesDifficulty(song, f.hasDiff, true) {
+		return false
+	}
+
+	if f.missingDiff != "" && !f.matchesDifficulty(song, f.missingDiff, false) {
+		return false
+	}
+
+	if f.ghl != nil && song.IsGHL() != *f.ghl {
+		return false
+	}
+
+	if f.pro && !song.HasProPart() {
+		return false
+	}
+
+	if f.maxIntro > 0 && !f.matchesIntro(song) {
+		return false
+	}
+
+	if (f.noOpens || f.noTaps) && !f.matchesTechniques(song) {
+		return false
+	}
+
+	if (f.played != nil || f.fc != nil || f.maxPlays != nil) && !f.matchesScores(song) {
+		return false
+	}
+
+	if f.maxRating > 0 && (song.Rating <= 0 || song.Rating > f.maxRating) {
+		return false
+	}
+
+	if f.path != "" && !matchesPath(song, f.path) {
+		return false
+	}
+
+	if f.root != "" && !matchesRoot(song, f.root) {
+		return false
+	}
+
+	for _, clause := range f.all {
+		if !clause.matches(song) {
+			return false
+		}
+	}
+
+	if len(f.any) > 0 {
+		anyMatch := false
+		for _, clause := range f.any {
+			if clause.matches(song) {
+				anyMatch = true
+				break
+			}
+		}
+		if !anyMatch {
+			return false
+		}
+	}
+
+	for _, clause := range f.not {
+		if clause.matches(song) {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -100,21 +279,21 @@ func (f *Filter) matchesLength(song *Song) bool {
 	if f.length == "" {
 		return true
 	}
-	
+
 	// Parse length filter (e.g., ">5:00", "<3:30", "=2:15")
 	re := regexp.MustCompile(`^([><=]+)(\d+):(\d+)$`)
 	matches := re.FindStringSubmatch(f.length)
 	if len(matches) != 4 {
 		return true // Invalid format, don't filter
 	}
-	
+
 	op := matches[1]
 	filterMinutes, _ := strconv.Atoi(matches[2])
 	filterSeconds, _ := strconv.Atoi(matches[3])
 	filterDuration := time.Duration(filterMinutes)*time.Minute + time.Duration(filterSeconds)*time.Second
-	
+
 	songDuration := song.Length
-	
+
 	switch op {
 	case ">":
 		return songDuration > filterDuration
@@ -136,35 +315,173 @@ func (f *Filter) matchesLength(song *Song) bool {
 	}
 }
 
+// matchesFeatured checks if any featured artist on the song matches the filter
+func (f *Filter) matchesFeatured(song *Song) bool {
+	for _, artist := range song.FeaturedArtists() {
+		if strings.Contains(strings.ToLower(artist), strings.ToLower(f.featured)) {
+			return true
+		}
+	}
+	return false
+}
+
 // matchesInstrument checks if song has the specified instrument
 func (f *Filter) matchesInstrument(song *Song) bool {
 	if f.inst == "" {
 		return true
 	}
-	
-	inst := Instrument(strings.ToLower(f.inst))
-	return song.HasInstrument(inst)
+
+	inst := ParseInstrument(f.inst)
+	return song.HasPart(inst)
 }
 
-// fuzzyMatch performs simple fuzzy matching (substring match with case insensitivity)
-// For better fuzzy matching, you could use a library like github.com/sahilm/fuzzy
-func fuzzyMatch(text, pattern string) bool {
-	text = strings.ToLower(text)
-	pattern = strings.ToLower(pattern)
-	
-	// Simple substring match
-	if strings.Contains(text, pattern) {
-		return true
+// matchesDifficulty checks whether the instrument filtered on (or, without an instrument
+// filter, any charted instrument) has or lacks a charted difficulty
+func (f *Filter) matchesDifficulty(song *Song, difficulty Difficulty, want bool) bool {
+	var instruments []Instrument
+	if f.inst != "" {
+		instruments = []Instrument{ParseInstrument(f.inst)}
+	} else {
+		for inst := range song.Charted {
+			instruments = append(instruments, inst)
+		}
 	}
-	
-	// Check if all pattern characters appear in order in text
-	patternIdx := 0
-	for i := 0; i < len(text) && patternIdx < len(pattern); i++ {
-		if text[i] == pattern[patternIdx] {
-			patternIdx++
+
+	for _, inst := range instruments {
+		if song.HasDifficulty(inst, difficulty) == want {
+			return true
 		}
 	}
-	
-	return patternIdx == len(pattern)
+	return false
 }
 
+// matchesIntro checks whether the instrument filtered on (or, without an instrument
+// filter, any instrument) plays its first note within the maximum intro
+func (f *Filter) matchesIntro(song *Song) bool {
+	var inst Instrument
+	if f.inst != "" {
+		inst = ParseInstrument(f.inst)
+	}
+	intro, ok := song.Intro(inst)
+	return ok && intro <= f.maxIntro
+}
+
+// matchesTechniques checks that the instrument filtered on (or, without an instrument
+// filter, every part) has no open notes with noOpens and no tap notes with noTaps
+func (f *Filter) matchesTechniques(song *Song) bool {
+	var inst Instrument
+	if f.inst != "" {
+		inst = ParseInstrument(f.inst)
+	}
+	return !(f.noOpens && song.HasOpens(inst)) && !(f.noTaps && song.HasTaps(inst))
+}
+
+// matchesName reports whether a song name matches a --name pattern, as written or once
+// both are normalized (see normalizeName)
+func matchesName(name, pattern string) bool {
+	_, ok := nameScore(name, pattern)
+	return ok
+}
+
+// MatchRanges returns the byte ranges within text that matched the filter for the
+// given field ("name", "artist", "genre" or "charter"), for highlighting in output
+func (f *Filter) MatchRanges(field, text string) [][2]int {
+	ranges := f.ownMatchRanges(field, text)
+	if len(f.all) == 0 && len(f.any) == 0 {
+		return ranges
+	}
+
+	for _, clause := range append(f.all, f.any...) {
+		ranges = append(ranges, clause.MatchRanges(field, text)...)
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	return ranges
+}
+
+// ownMatchRanges returns the match ranges for this filter's criteria, ignoring nested clauses
+func (f *Filter) ownMatchRanges(field, text string) [][2]int {
+	switch field {
+	case "name":
+		if f.name == "" {
+			return nil
+		}
+		if r := indexFold(text, f.name); r != nil {
+			return r
+		}
+		return subsequenceRanges(text, f.name)
+	case "artist":
+		var ranges [][2]int
+		if f.artist != "" {
+			ranges = append(ranges, indexFold(text, f.artist)...)
+		}
+		if f.primaryArtist != "" {
+			ranges = append(ranges, indexFold(text, collapseSpaces(f.primaryArtist))...)
+		}
+		if f.featured != "" {
+			ranges = append(ranges, indexFold(text, f.featured)...)
+		}
+		sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+		return ranges
+	case "genre":
+		if f.genre == "" {
+			return nil
+		}
+		return indexFold(text, f.genre)
+	case "charter":
+		if f.charter == "" {
+			return nil
+		}
+		return indexFold(text, f.charter)
+	}
+	return nil
+}
+
+// indexFold finds the first case-insensitive occurrence of pattern in text and returns
+// its byte range in text, or nil if there is none
+func indexFold(text, pattern string) [][2]int {
+	if pattern == "" {
+		return nil
+	}
+	for i := range text {
+		if len(text)-i < len(pattern) {
+			break
+		}
+		end, ok := hasPrefixFold(text[i:], pattern)
+		if ok {
+			return [][2]int{{i, i + end}}
+		}
+	}
+	return nil
+}
+
+// hasPrefixFold reports whether text starts with pattern ignoring case, returning
+// the number of bytes of text consumed by the match
+func hasPrefixFold(text, pattern string) (int, bool) {
+	ti := 0
+	for _, pr := range pattern {
+		if ti >= len(text) {
+			return 0, false
+		}
+		tr, size := utf8.DecodeRuneInString(text[ti:])
+		if unicode.ToLower(tr) != unicode.ToLower(pr) {
+			return 0, false
+		}
+		ti += size
+	}
+	return ti, true
+}
+
+// subsequenceRanges returns the byte ranges of each pattern character matched in order
+// within text, at the best scoring positions fuzzyScore finds for them
+func subsequenceRanges(text, pattern string) [][2]int {
+	_, positions, ok := fuzzyAlign(text, pattern)
+	if !ok {
+		return nil
+	}
+	ranges := make([][2]int, len(positions))
+	for i, offset := range positions {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		ranges[i] = [2]int{offset, offset + size}
+	}
+	return ranges
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFilterSpec reads filter criteria from a YAML or JSON file, or from stdin when path
+// is "-". Top-level criteria must all match; nested clauses are combined with "all" and
+// "any", e.g.
+//
+//	genre: metal
+//	any:
+//	  - artist: Metallica
+//	  - artist: Megadeth
+//	    year: 1990
+func LoadFilterSpec(path string) (FilterSpec, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return FilterSpec{}, fmt.Errorf("failed to read filter file: %w", err)
+	}
+
+	var spec FilterSpec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil && err != io.EOF {
+		return FilterSpec{}, fmt.Errorf("invalid filter file %s: %w", path, err)
+	}
+	return spec, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	findAudioTolerance time.Duration
+
+	findByAudioCmd = &cobra.Command{
+		Use:   "find-by-audio <file>",
+		Short: "Check whether the library already has a chart for an audio file",
+		Long: `Read the title, artist and duration of an audio file (mp3, ogg, opus, flac or wav) and look
+for songs in the library that chart the same track, before you chart it yourself.
+
+The title and artist come from the file's ID3 tags or Vorbis comments, or from a file
+name like "Artist - Title.mp3" when it has none. Songs with the same name and artist,
+once normalized, and a length within --tolerance are reported as charted; the same name
+with another length may be a different version or edit of the track. Without a name
+match, songs whose length is within --tolerance are listed as possible matches, closest
+first.
+
+Lengths come from song_length in song.ini; pass --length-source audio to measure the
+audio of songs that don't have one.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runFindByAudio,
+	}
+)
+
+func init() {
+	findByAudioCmd.Flags().DurationVar(&findAudioTolerance, "tolerance", 3*time.Second, "How far a song's length may be from the file's duration to match")
+	rootCmd.AddCommand(findByAudioCmd)
+}
+
+// maxLengthMatches caps the songs listed only because their length is close, which in a
+// big library are mostly unrelated songs
+const maxLengthMatches = 5
+
+// How an audio file matched a song
+const (
+	AudioMatchCharted  = "charted"   // same name and artist, and a close length
+	AudioMatchSameName = "same-name" // same name and artist, but another length
+	AudioMatchLength   = "length"    // only a close length
+)
+
+// AudioMatch is a library song that may chart an audio file
+type AudioMatch struct {
+	Song       *Song
+	Match      string
+	LengthDiff time.Duration // -1 when the song's length is unknown
+}
+
+// audioFileInfo is what find-by-audio knows about the audio file
+type audioFileInfo struct {
+	Path     string
+	Title    string
+	Artist   string
+	Duration time.Duration
+}
+
+// readAudioFileInfo reads the tags and duration of an audio file, falling back to the
+// file name for the title and artist
+func readAudioFileInfo(path string) (audioFileInfo, error) {
+	duration, err := AudioDuration(path)
+	if err != nil {
+		return audioFileInfo{}, err
+	}
+	tags, err := ReadAudioTags(path)
+	if err != nil {
+		return audioFileInfo{}, err
+	}
+	if tags.Title == "" {
+		tags = tagsFromFileName(path)
+	}
+	return audioFileInfo{Path: path, Title: tags.Title, Artist: tags.Artist, Duration: duration}, nil
+}
+
+// tagsFromFileName reads "Artist - Title" or "01 - Artist - Title" from a file name
+func tagsFromFileName(path string) AudioTags {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	parts := strings.Split(base, " - ")
+	if len(parts) > 2 && strings.Trim(parts[0], "0123456789. ") == "" {
+		parts = parts[1:]
+	}
+	if len(parts) < 2 {
+		return AudioTags{Title: strings.TrimSpace(base)}
+	}
+	return AudioTags{Artist: strings.TrimSpace(parts[0]), Title: strings.TrimSpace(strings.Join(parts[1:], " - "))}
+}
+
+// similarName reports whether two names are the same once normalized, or one is the
+// other with words added, as in "Song (Remastered)" or "Song - Live"
+func similarName(a, b string) bool {
+	a, b = normalizeName(a), normalizeName(b)
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.Contains(" "+a+" ", " "+b+" ") || strings.Contains(" "+b+" ", " "+a+" ")
+}
+
+// findAudioMatches ranks the songs that may chart the audio file: charted first, then
+// the same name with another length, then the closest lengths
+func findAudioMatches(info audioFileInfo, songs []*Song, tolerance time.Duration) []AudioMatch {
+	var named, timed []AudioMatch
+	for _, song := range songs {
+		diff := time.Duration(-1)
+		if song.Length > 0 {
+			diff = song.Length - info.Duration
+			if diff < 0 {
+				diff = -diff
+			}
+		}
+		closeLength := diff >= 0 && diff <= tolerance
+
+		sameName := info.Title != "" && similarName(song.Name, info.Title) &&
+			(info.Artist == "" || song.Artist == "" || similarName(song.Artist, info.Artist))
+		switch {
+		case sameName && closeLength:
+			named = append(named, AudioMatch{Song: song, Match: AudioMatchCharted, LengthDiff: diff})
+		case sameName:
+			named = append(named, AudioMatch{Song: song, Match: AudioMatchSameName, LengthDiff: diff})
+		case closeLength:
+			timed = append(timed, AudioMatch{Song: song, Match: AudioMatchLength, LengthDiff: diff})
+		}
+	}
+
+	sort.SliceStable(named, func(i, j int) bool {
+		if named[i].Match != named[j].Match {
+			return named[i].Match == AudioMatchCharted
+		}
+		return lengthDiffLess(named[i].LengthDiff, named[j].LengthDiff)
+	})
+	sort.SliceStable(timed, func(i, j int) bool { return timed[i].LengthDiff < timed[j].LengthDiff })
+	if len(timed) > maxLengthMatches {
+		timed = timed[:maxLengthMatches]
+	}
+	return append(named, timed...)
+}
+
+// lengthDiffLess orders length differences smallest first, unknown lengths last
+func lengthDiffLess(a, b time.Duration) bool {
+	if (a < 0) != (b < 0) {
+		return b < 0
+	}
+	return a < b
+}
+
+// findAudioDocument is the JSON representation of find-by-audio's results
+type findAudioDocument struct {
+	SchemaVersion int                `json:"schema_version"`
+	File          string             `json:"file"`
+	Title         string             `json:"title,omitempty"`
+	Artist        string             `json:"artist,omitempty"`
+	LengthMs      int64              `json:"length_ms"`
+	Length        string             `json:"length"`
+	Charted       bool               `json:"charted"`
+	Matches       []audioMatchRecord `json:"matches"`
+}
+
+// audioMatchRecord is a single match in findAudioDocument
+type audioMatchRecord struct {
+	Match        string     `json:"match"`
+	LengthDiffMs *int64     `json:"length_diff_ms"` // null when the song's length is unknown
+	Song         SongRecord `json:"song"`
+}
+
+func runFindByAudio(cmd *cobra.Command, args []string) error {
+	if findAudioTolerance < 0 {
+		return fmt.Errorf("--tolerance can't be negative")
+	}
+	info, err := readAudioFileInfo(args[0])
+	if err != nil {
+		return err
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	matches := findAudioMatches(info, songs, findAudioTolerance)
+	charted := len(matches) > 0 && matches[0].Match == AudioMatchCharted
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		doc := findAudioDocument{
+			SchemaVersion: SchemaVersion,
+			File:          info.Path,
+			Title:         info.Title,
+			Artist:        info.Artist,
+			LengthMs:      info.Duration.Milliseconds(),
+			Length:        formatDataDuration(info.Duration),
+			Charted:       charted,
+			Matches:       make([]audioMatchRecord, len(matches)),
+		}
+		for i, match := range matches {
+			doc.Matches[i] = audioMatchRecord{Match: match.Match, Song: NewSongRecord(match.Song)}
+			if match.LengthDiff >= 0 {
+				diff := match.LengthDiff.Milliseconds()
+				doc.Matches[i].LengthDiffMs = &diff
+			}
+		}
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(doc)
+	}
+
+	track := info.Title
+	if info.Artist != "" {
+		track = info.Artist + " - " + info.Title
+	}
+	fmt.Fprintf(writer, "%s (%s)\n", track, formatDuration(info.Duration))
+	switch {
+	case charted:
+		fmt.Fprintln(writer, "Already charted in the library")
+	case len(matches) > 0 && matches[0].Match == AudioMatchSameName:
+		fmt.Fprintln(writer, "Charted under the same name, but with another length; it may be another version")
+	case len(matches) > 0:
+		fmt.Fprintf(writer, "No chart with this name; %d song(s) within %s of its length\n", len(matches), findAudioTolerance)
+	default:
+		fmt.Fprintln(writer, "No chart found in the library")
+	}
+	for _, match := range matches {
+		fmt.Fprintf(writer, "\n%s - %s [%s]\n", match.Song.Artist, match.Song.Name, match.Match)
+		if match.LengthDiff >= 0 {
+			fmt.Fprintf(writer, "   Length: %s (%.1fs off)\n", match.Song.FormatLength(), match.LengthDiff.Seconds())
+		} else {
+			fmt.Fprintln(writer, "   Length: unknown")
+		}
+		if len(match.Song.Charters) > 0 {
+			charters := make([]string, len(match.Song.Charters))
+			for i, charter := range match.Song.Charters {
+				charters[i] = plainCharter(charter)
+			}
+			fmt.Fprintf(writer, "   Charter: %s\n", strings.Join(charters, ", "))
+		}
+		fmt.Fprintf(writer, "   Path: %s\n", match.Song.Path)
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	fixtureSongs     int
+	fixtureSeed      int64
+	fixtureMalformed []string
+	fixtureCharts    bool
+
+	genFixtureCmd = &cobra.Command{
+		Use:   "gen-fixture <dir>",
+		Short: "Generate a synthetic song library for benchmarking",
+		Long: `Generate a library of synthetic song folders in <dir> (which must be empty or not exist
+yet) for benchmarking scans and trying filters at scale without a real library.
+
+Songs are spread over artist folders with random names, genres, years, lengths, charters
+and difficulties. --malformed makes a share of the song.ini files broken the way real
+downloads are, either all kinds at once ("0.02") or per kind ("utf16=0.01"):
+
+  no-section  keys without a [song] header
+  garbage     random binary data
+  empty       an empty file
+  truncated   cut off halfway through a line
+  utf16       saved as UTF-16 (readable with --on-parse-error retry)
+  cp1252      saved as Windows-1252 (readable with --on-parse-error retry)
+
+The same --seed always generates the same library.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runGenFixture,
+	}
+)
+
+func init() {
+	genFixtureCmd.Flags().IntVar(&fixtureSongs, "songs", 1000, "Number of song folders to generate")
+	genFixtureCmd.Flags().Int64Var(&fixtureSeed, "seed", 1, "Random seed")
+	genFixtureCmd.Flags().StringArrayVar(&fixtureMalformed, "malformed", nil, "Share of malformed song.ini files: a rate for every kind, or \"<kind>=<rate>\" (repeatable)")
+	genFixtureCmd.Flags().BoolVar(&fixtureCharts, "charts", false, "Also write a small notes.chart to every folder, for filters that read notes files")
+	rootCmd.AddCommand(genFixtureCmd)
+}
+
+// fixtureMalformations are the kinds of broken song.ini files gen-fixture can write
+var fixtureMalformations = []string{"no-section", "garbage", "empty", "truncated", "utf16", "cp1252"}
+
+// Word lists the synthetic metadata is drawn from
+var (
+	fixtureSyllables = []string{"ka", "lo", "mer", "vin", "dra", "zel", "tor", "ae", "quin", "bro", "sha", "rex", "ul", "mo", "ny", "th"}
+	fixtureWords     = []string{"Black", "Glass", "River", "Static", "Northern", "Hollow", "Ember", "Signal", "Golden", "Wolves", "Neon", "Silent", "Iron", "Paper", "Storm", "Ghost", "Velvet", "Echo"}
+	fixtureGenres    = []string{"Rock", "Metal", "Progressive Metal", "Pop Punk", "Alternative", "Indie", "Djent", "Math Rock", "Punk", "Pop", "Electronic", "Country"}
+	fixtureCharters  = []string{"Harmonix", "Neversoft", "ACJGaming89", "Zantor", "XEntombmentX", "FigNeutered", "<color=#FF8000>Miscellany</color>", "OCBG0LD"}
+)
+
+// parseMalformed reads the --malformed values into a rate per malformation kind
+func parseMalformed(values []string) (map[string]float64, error) {
+	rates := make(map[string]float64)
+	for _, value := range values {
+		kind, rateText, perKind := strings.Cut(value, "=")
+		if !perKind {
+			rateText = kind
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateText), 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid --malformed %q: rates are between 0 and 1", value)
+		}
+		if !perKind {
+			for _, kind := range fixtureMalformations {
+				rates[kind] += rate / float64(len(fixtureMalformations))
+			}
+			continue
+		}
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		known := false
+		for _, k := range fixtureMalformations {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown --malformed kind %q (available: %s)", kind, strings.Join(fixtureMalformations, ", "))
+		}
+		rates[kind] += rate
+	}
+
+	total := 0.0
+	for _, rate := range rates {
+		total += rate
+	}
+	if total > 1 {
+		return nil, fmt.Errorf("--malformed rates add up to more than 1")
+	}
+	return rates, nil
+}
+
+// fixtureName makes up a capitalised name of a few syllables
+func fixtureName(r *rand.Rand) string {
+	var b strings.Builder
+	for i := 0; i < 2+r.Intn(2); i++ {
+		b.WriteString(fixtureSyllables[r.Intn(len(fixtureSyllables))])
+	}
+	name := b.String()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// fixtureTitle makes up a song title of one to three words
+func fixtureTitle(r *rand.Rand) string {
+	words := make([]string, 1+r.Intn(3))
+	for i := range words {
+		words[i] = fixtureWords[r.Intn(len(fixtureWords))]
+	}
+	return strings.Join(words, " ")
+}
+
+// fixtureSongIni writes the song.ini of a synthetic song
+func fixtureSongIni(r *rand.Rand, artist, name string) string {
+	var b strings.Builder
+	b.WriteString("[song]\n")
+	fmt.Fprintf(&b, "name = %s\n", name)
+	fmt.Fprintf(&b, "artist = %s\n", artist)
+	fmt.Fprintf(&b, "album = %s\n", fixtureTitle(r))
+	fmt.Fprintf(&b, "genre = %s\n", fixtureGenres[r.Intn(len(fixtureGenres))])
+	fmt.Fprintf(&b, "year = %d\n", 1965+r.Intn(60))
+	fmt.Fprintf(&b, "charter = %s\n", fixtureCharters[r.Intn(len(fixtureCharters))])
+	fmt.Fprintf(&b, "song_length = %d\n", 90000+r.Intn(510000))
+	fmt.Fprintf(&b, "album_track = %d\n", 1+r.Intn(14))
+	for _, inst := range []Instrument{InstrumentGuitar, InstrumentBass, InstrumentDrums, InstrumentKeys, InstrumentRhythm} {
+		diff := -1
+		if r.Intn(4) > 0 {
+			diff = r.Intn(7)
+		}
+		fmt.Fprintf(&b, "%s = %d\n", instrumentKey(inst), diff)
+	}
+	if r.Intn(10) == 0 {
+		fmt.Fprintf(&b, "tags = %s\n", strings.ToLower(fixtureWords[r.Intn(len(fixtureWords))]))
+	}
+	return b.String()
+}
+
+// malformSongIni breaks a song.ini in the given way
+func malformSongIni(r *rand.Rand, kind, content string) []byte {
+	switch kind {
+	case "no-section":
+		return []byte(strings.TrimPrefix(content, "[song]\n"))
+	case "garbage":
+		data := make([]byte, 64+r.Intn(512))
+		r.Read(data)
+		return data
+	case "empty":
+		return nil
+	case "truncated":
+		return []byte(content[:len(content)/2])
+	case "utf16":
+		units := utf16.Encode([]rune(content))
+		data := []byte{0xFF, 0xFE}
+		for _, unit := range units {
+			data = binary.LittleEndian.AppendUint16(data, unit)
+		}
+		return data
+	case "cp1252":
+		// "Mot\xf6rhead" and "Caf\xe9" are Latin-1, which is also Windows-1252
+		content = strings.Replace(content, "name = ", "name = Caf\xe9 ", 1)
+		return []byte(strings.Replace(content, "artist = ", "artist = Mot\xf6r", 1))
+	}
+	return []byte(content)
+}
+
+// fixtureChart is a minimal notes.chart with a few expert guitar notes
+const fixtureChart = `[Song]
+{
+  Resolution = 192
+}
+[SyncTrack]
+{
+  0 = B 120000
+}
+[ExpertSingle]
+{
+  768 = N 0 0
+  960 = N 1 0
+  1152 = N 2 0
+  1344 = N 3 96
+}
+`
+
+func runGenFixture(cmd *cobra.Command, args []string) error {
+	root := args[0]
+	if fixtureSongs <= 0 {
+		return fmt.Errorf("--songs must be at least 1")
+	}
+	rates, err := parseMalformed(fixtureMalformed)
+	if err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(root); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty; pick a new folder for the fixture", root)
+	}
+
+	r := rand.New(rand.NewSource(fixtureSeed))
+	// Assign malformations up front so their share is exact rather than approximate
+	kinds := make([]string, fixtureSongs)
+	next := 0
+	for _, kind := range fixtureMalformations {
+		for n := int(rates[kind]*float64(fixtureSongs) + 0.5); n > 0 && next < len(kinds); n-- {
+			kinds[next] = kind
+			next++
+		}
+	}
+	r.Shuffle(len(kinds), func(i, j int) { kinds[i], kinds[j] = kinds[j], kinds[i] })
+
+	// Roughly eight songs per artist, like a library of full albums
+	artists := make([]string, fixtureSongs/8+1)
+	for i := range artists {
+		artists[i] = fixtureName(r)
+		if r.Intn(3) == 0 {
+			artists[i] += " " + fixtureName(r)
+		}
+	}
+
+	malformed := make(map[string]int)
+	for i := 0; i < fixtureSongs; i++ {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		artist := artists[r.Intn(len(artists))]
+		name := fixtureTitle(r)
+		dir := filepath.Join(root, artist, fmt.Sprintf("%s - %s (%05d)", artist, name, i+1))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		content := fixtureSongIni(r, artist, name)
+		data := []byte(content)
+		if kind := kinds[i]; kind != "" {
+			data = malformSongIni(r, kind, content)
+			malformed[kind]++
+		}
+		if err := os.WriteFile(filepath.Join(dir, "song.ini"), data, 0644); err != nil {
+			return err
+		}
+		if fixtureCharts {
+			if err := os.WriteFile(filepath.Join(dir, "notes.chart"), []byte(fixtureChart), 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Printf("Generated %d song(s) in %s\n", fixtureSongs, root)
+	if len(malformed) > 0 {
+		kinds := make([]string, 0, len(malformed))
+		for kind := range malformed {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			fmt.Printf("  %s: %d malformed song.ini file(s)\n", kind, malformed[kind])
+		}
+	}
+	return nil
+}
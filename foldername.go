@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultFolderTemplate names song folders "Artist - Name (Charter)", as release does
+const defaultFolderTemplate = "{artist} - {name} ({charter})"
+
+var lintFolderTemplate string
+
+func init() {
+	lintCmd.Flags().StringVar(&lintFolderTemplate, "folder-template", defaultFolderTemplate, "Folder name the folder-name rule renames song folders to; placeholders: {artist}, {name}, {album}, {genre}, {year}, {charter}")
+}
+
+// folderPlaceholder matches a placeholder of a folder name template
+var folderPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// emptyBrackets matches the brackets left behind by placeholders with no value
+var emptyBrackets = regexp.MustCompile(`\(\s*\)|\[\s*\]`)
+
+// folderField returns the value of a folder name template placeholder
+func folderField(song *Song, placeholder string) (string, bool) {
+	switch placeholder {
+	case "{artist}":
+		return song.Artist, true
+	case "{name}":
+		return song.Name, true
+	case "{album}":
+		return song.Album, true
+	case "{genre}":
+		return song.Genre, true
+	case "{year}":
+		if song.Year > 0 {
+			return strconv.Itoa(song.Year), true
+		}
+		return "", true
+	case "{charter}":
+		return plainCharters(song), true
+	}
+	return "", false
+}
+
+// validateFolderTemplate checks that a template only uses known placeholders and names
+// the song
+func validateFolderTemplate(template string) error {
+	for _, placeholder := range folderPlaceholder.FindAllString(template, -1) {
+		if _, ok := folderField(&Song{}, placeholder); !ok {
+			return fmt.Errorf("unknown placeholder %s in folder template (available: {artist}, {name}, {album}, {genre}, {year}, {charter})", placeholder)
+		}
+	}
+	if !strings.Contains(template, "{name}") {
+		return fmt.Errorf("folder template %q doesn't contain {name}", template)
+	}
+	return nil
+}
+
+// formatFolderName names a song's folder after a template. Characters that aren't
+// allowed in file names are dropped, as are brackets left empty by missing fields.
+// Packed songs keep their .sng extension.
+func formatFolderName(song *Song, template string) string {
+	name := folderPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, _ := folderField(song, placeholder)
+		return value
+	})
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(invalidFolderChars, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = emptyBrackets.ReplaceAllString(name, "")
+	name = strings.TrimRight(strings.Trim(collapseSpaces(name), " -"), ". ")
+	if song.Packed {
+		name += ".sng"
+	}
+	return name
+}
+
+// foldForFolder reduces a name to its lowercase letters and digits, so "AC/DC" and
+// "acdc" compare equal
+func foldForFolder(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// checkFolderName flags songs whose folder name doesn't contain the song's name, such
+// as "New folder (3)", which can't be found in a file manager
+func checkFolderName(song *Song) []LintIssue {
+	folder := songFolder(song)
+	name := foldForFolder(song.Name)
+	if name == "" || isRemoteLocation(songRoot(song)) {
+		return nil
+	}
+	if root, err := filepath.Abs(songRoot(song)); err == nil {
+		if abs, err := filepath.Abs(folder); err == nil && abs == root {
+			return nil // the library root isn't the song's own folder
+		}
+	}
+	base := filepath.Base(folder)
+	if song.Packed {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	if strings.Contains(foldForFolder(base), name) {
+		return nil
+	}
+
+	issue := LintIssue{Song: song, Rule: "folder-name", Message: fmt.Sprintf("folder %q doesn't mention %q", filepath.Base(folder), song.Name)}
+	// Text that isn't UTF-8 (see the encoding rule) would make a garbled folder name
+	if rename := formatFolderName(song, lintFolderTemplate); rename != "" && utf8.ValidString(rename) {
+		issue.Rename = rename
+		issue.Message += fmt.Sprintf(" (fix: rename to %q)", rename)
+	}
+	return []LintIssue{issue}
+}
+
+// renameSongFolder renames the folder of a song within its parent folder, updating the
+// song's path
+func renameSongFolder(song *Song, name string) error {
+	folder := songFolder(song)
+	dest := filepath.Join(filepath.Dir(folder), name)
+	if dest == folder {
+		return nil
+	}
+	if _, err := os.Stat(dest); err == nil && !strings.EqualFold(dest, folder) {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err := moveLibraryPath(folder, dest); err != nil {
+		return err
+	}
+	if song.Packed {
+		song.Path = dest
+	} else {
+		song.Path = filepath.Join(dest, filepath.Base(song.Path))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"unicode"
+)
+
+// sortRelevance is the --sort value ordering songs by how well their name matches --name
+const sortRelevance = "relevance"
+
+// Scores of fuzzyAlign, in the spirit of fzf: every matched character scores, matches at
+// the start of a word or right after the previous match score more, and characters
+// skipped between two matches cost a little
+const (
+	fuzzyMatchScore  = 16
+	fuzzyGapStart    = 3 // the first character skipped between two matches
+	fuzzyGapExtend   = 1 // every further one
+	fuzzyBoundary    = 8 // a match at the start of a word
+	fuzzyCamelCase   = 7 // a match at a lower- to upper-case change
+	fuzzyConsecutive = 5 // a match right after the previous one, if it's worth more
+	fuzzyFirstFactor = 2 // the start-of-word bonus counts double for the first character
+)
+
+// fuzzyScore scores how well pattern matches text, ignoring case: higher is better. It
+// matches when the characters of pattern appear in text in order, e.g. "ttfaf" in
+// "Through the Fire and Flames".
+func fuzzyScore(text, pattern string) (int, bool) {
+	score, _, ok := fuzzyAlign(text, pattern)
+	return score, ok
+}
+
+// fuzzyAlign finds the best scoring way to match the characters of pattern in order in
+// text, returning its score and the byte offsets of the matched characters in text
+func fuzzyAlign(text, pattern string) (int, []int, bool) {
+	p := []rune(pattern)
+	for i, r := range p {
+		p[i] = unicode.ToLower(r)
+	}
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+	t := []rune(text)
+	offsets := make([]int, 0, len(t))
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	lower := make([]rune, len(t))
+	matched := 0
+	for j, r := range t {
+		lower[j] = unicode.ToLower(r)
+		if matched < len(p) && lower[j] == p[matched] {
+			matched++
+		}
+	}
+	if matched < len(p) {
+		return 0, nil, false
+	}
+
+	n, m := len(t), len(p)
+	bonus := make([]int, n)
+	for j, r := range t {
+		switch {
+		case !isWordRune(r):
+		case j == 0 || !isWordRune(t[j-1]):
+			bonus[j] = fuzzyBoundary
+		case unicode.IsLower(t[j-1]) && unicode.IsUpper(r):
+			bonus[j] = fuzzyCamelCase
+		}
+	}
+
+	// score[i][j] is the best score of p[:i+1] with p[i] matched at t[j], and from[i][j]
+	// where p[i-1] was matched in it
+	const none = math.MinInt / 2
+	score := make([][]int, m)
+	from := make([][]int, m)
+	for i := range score {
+		score[i] = make([]int, n)
+		from[i] = make([]int, n)
+	}
+	for j := range t {
+		score[0][j] = none
+		if lower[j] == p[0] {
+			score[0][j] = fuzzyMatchScore + bonus[j]*fuzzyFirstFactor
+		}
+	}
+	for i := 1; i < m; i++ {
+		// gap is the best score of a match of p[i-1] before t[j-1], less the cost of
+		// the characters skipped since
+		gap, gapFrom := none, -1
+		for j := range t {
+			score[i][j] = none
+			if gap != none {
+				gap -= fuzzyGapExtend
+			}
+			if j >= 2 && score[i-1][j-2] != none && score[i-1][j-2]-fuzzyGapStart > gap {
+				gap, gapFrom = score[i-1][j-2]-fuzzyGapStart, j-2
+			}
+			if j == 0 || lower[j] != p[i] {
+				continue
+			}
+			if prev := score[i-1][j-1]; prev != none {
+				score[i][j], from[i][j] = prev+fuzzyMatchScore+max(bonus[j], fuzzyConsecutive), j-1
+			}
+			if gap != none && gap+fuzzyMatchScore+bonus[j] > score[i][j] {
+				score[i][j], from[i][j] = gap+fuzzyMatchScore+bonus[j], gapFrom
+			}
+		}
+	}
+
+	best, end := none, -1
+	for j := range t {
+		if score[m-1][j] > best {
+			best, end = score[m-1][j], j
+		}
+	}
+	positions := make([]int, m)
+	for i := m - 1; i >= 0; i-- {
+		positions[i] = offsets[end]
+		end = from[i][end]
+	}
+	return best, positions, true
+}
+
+// isWordRune reports whether r is part of a word rather than a separator between words
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// nameQueries returns the --name values of a spec and the clauses it matches through,
+// which --sort relevance ranks by. Names in not clauses aren't wanted.
+func (spec FilterSpec) nameQueries() []string {
+	var names []string
+	if spec.Name != "" {
+		names = append(names, spec.Name)
+	}
+	for _, clause := range append(append([]FilterSpec{}, spec.All...), spec.Any...) {
+		names = append(names, clause.nameQueries()...)
+	}
+	return names
+}
+
+// relevanceScores scores the name of each song against the best matching of queries
+func relevanceScores(songs []*Song, queries []string) map[*Song]int {
+	scores := make(map[*Song]int, len(songs))
+	for _, song := range songs {
+		best := math.MinInt
+		for _, query := range queries {
+			if score, ok := nameScore(song.Name, query); ok && score > best {
+				best = score
+			}
+		}
+		scores[song] = best
+	}
+	return scores
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	generateDryRun bool
+
+	generateIniCmd = &cobra.Command{
+		Use:   "generate-ini",
+		Short: "Create song.ini files for chart folders that don't have one",
+		Long: `Find song folders that contain a notes.chart but no song.ini and create one from the
+chart's [Song] metadata and the audio duration. Missing names and artists are taken from
+the folder name ("Artist - Name (Charter)").`,
+		RunE: runGenerateIni,
+	}
+)
+
+func init() {
+	generateIniCmd.Flags().BoolVar(&generateDryRun, "dry-run", false, "Show the song.ini files that would be created without writing them")
+	rootCmd.AddCommand(generateIniCmd)
+}
+
+// folderNamePattern matches "Artist - Name (Charter)" style folder names, with an
+// optional leading track number and the charter in parentheses or brackets
+var folderNamePattern = regexp.MustCompile(`^(?:\d+\s*-\s*)?(.+?)\s+-\s+(.+?)(?:\s*[\(\[]([^\(\)\[\]]+)[\)\]])?$`)
+
+func runGenerateIni(cmd *cobra.Command, args []string) error {
+	if anyRemoteLibrary() {
+		return fmt.Errorf("generate-ini needs a local library")
+	}
+	if !generateDryRun {
+		if err := ensureWritable("generate song.ini files"); err != nil {
+			return err
+		}
+	}
+
+	var folders []string
+	for _, dir := range directories {
+		found, err := findBareChartFolders(dir)
+		if err != nil {
+			return err
+		}
+		folders = append(folders, found...)
+	}
+
+	created := 0
+	for _, dir := range folders {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		content, err := generateSongIni(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", dir, err)
+			continue
+		}
+
+		path := filepath.Join(dir, "song.ini")
+		if generateDryRun {
+			fmt.Printf("Would create %s:\n%s\n", path, content)
+			continue
+		}
+		if err := writeLibraryFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		fmt.Printf("Created %s\n", path)
+		created++
+	}
+
+	if !generateDryRun {
+		fmt.Printf("Created %d song.ini file(s)\n", created)
+	}
+	return nil
+}
+
+// findBareChartFolders returns every folder under root with a notes.chart but no song.ini
+func findBareChartFolders(root string) ([]string, error) {
+	charts := make(map[string]bool)
+	inis := make(map[string]bool)
+
+	err := NewScanner(root, ScanOptions{Network: networkMode, Context: commandContext(), ExcludeDirs: excludeDirs}).walkLibrary(func(path string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(d.Name()) {
+		case "notes.chart":
+			charts[filepath.Dir(path)] = true
+		case "song.ini":
+			inis[filepath.Dir(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var folders []string
+	for dir := range charts {
+		if !inis[dir] {
+			folders = append(folders, dir)
+		}
+	}
+	sort.Strings(folders)
+	return folders, nil
+}
+
+// generateSongIni builds the contents of a song.ini for a chart folder
+func generateSongIni(dir string) (string, error) {
+	meta, err := ParseChartMetadata(filepath.Join(dir, "notes.chart"))
+	if err != nil {
+		return "", err
+	}
+
+	name, artist, charter := meta.Name, meta.Artist, meta.Charter
+	if match := folderNamePattern.FindStringSubmatch(filepath.Base(dir)); match != nil {
+		if artist == "" {
+			artist = match[1]
+		}
+		if name == "" {
+			name = match[2]
+		}
+		if charter == "" {
+			charter = match[3]
+		}
+	}
+	if name == "" {
+		name = filepath.Base(dir)
+	}
+
+	var b strings.Builder
+	b.WriteString("[song]\n")
+	writeKey := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s = %s\n", key, value)
+		}
+	}
+
+	writeKey("name", name)
+	writeKey("artist", artist)
+	writeKey("album", meta.Album)
+	writeKey("genre", meta.Genre)
+	if meta.Year > 0 {
+		writeKey("year", strconv.Itoa(meta.Year))
+	}
+	writeKey("charter", charter)
+
+	if length, err := FolderAudioDuration(dir); err == nil {
+		writeKey("song_length", strconv.FormatInt(length.Milliseconds(), 10))
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", dir, err)
+	}
+	if meta.PreviewStart > 0 {
+		writeKey("preview_start_time", strconv.FormatInt(int64(meta.PreviewStart*1000), 10))
+	}
+	if meta.Offset != 0 {
+		writeKey("delay", strconv.FormatInt(int64(meta.Offset*1000), 10))
+	}
+
+	// The chart doesn't say how hard each part is, so charted parts get a tier estimated
+	// from the notes of their hardest difficulty, or the lowest tier if those can't be read.
+	// Estimates start at tier 1; 0 is left for charters rating a part by hand.
+	charted := make(map[Instrument]bool)
+	for _, inst := range meta.Instruments() {
+		charted[inst] = true
+	}
+	tiers := make(map[Instrument]int)
+	if chart, err := LoadChart(dir); err == nil {
+		for inst, difficulties := range chart.ChartedDifficulties() {
+			tiers[inst] = estimateTier(chart.Stats(inst, difficulties[len(difficulties)-1]))
+		}
+	}
+	for _, inst := range []Instrument{InstrumentGuitar, InstrumentRhythm, InstrumentBass, InstrumentDrums,
+		InstrumentKeys, InstrumentGuitarGHL, InstrumentBassGHL} {
+		value := "-1"
+		if charted[inst] {
+			value = strconv.Itoa(max(tiers[inst], 1))
+		}
+		writeKey(instrumentKey(inst), value)
+	}
+
+	return b.String(), nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	genreMapFile     string
+	genreMusicBrainz bool
+)
+
+// placeholderGenres are genre values that say nothing about the song
+var placeholderGenres = map[string]bool{
+	"":              true,
+	"-":             true,
+	"genre":         true,
+	"n/a":           true,
+	"none":          true,
+	"other":         true,
+	"unknown":       true,
+	"unknown genre": true,
+}
+
+// isPlaceholderGenre reports whether a song's genre is empty or a placeholder
+func isPlaceholderGenre(genre string) bool {
+	return placeholderGenres[strings.ToLower(strings.TrimSpace(genre))]
+}
+
+// musicBrainzURL is the MusicBrainz artist search endpoint
+const musicBrainzURL = "https://musicbrainz.org/ws/2/artist/"
+
+// musicBrainzInterval keeps lookups within MusicBrainz's rate limit of one request per second
+const musicBrainzInterval = 1100 * time.Millisecond
+
+// genreClassifier suggests genres by artist
+type genreClassifier struct {
+	artistMap   map[string]string // from --genre-map, by lowercased artist
+	library     map[string]string // most common genre of each artist in the library
+	musicBrainz map[string]string // cached lookups, "" when nothing was found
+	client      *http.Client
+	lastLookup  time.Time
+}
+
+var classifier *genreClassifier
+
+// prepareGenreClassifier loads the artist map and learns each artist's genre from the library
+func prepareGenreClassifier(library []*Song) error {
+	classifier = &genreClassifier{
+		artistMap:   make(map[string]string),
+		musicBrainz: make(map[string]string),
+		client:      &http.Client{Timeout: 15 * time.Second},
+	}
+	if genreMapFile != "" {
+		artistMap, err := loadGenreMap(genreMapFile)
+		if err != nil {
+			return err
+		}
+		classifier.artistMap = artistMap
+	}
+	classifier.library = libraryGenres(library)
+	return nil
+}
+
+// loadGenreMap reads a YAML or JSON file mapping artist names to genres
+func loadGenreMap(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genre map: %w", err)
+	}
+	var raw map[string]string
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid genre map %s: %w", path, err)
+	}
+	artistMap := make(map[string]string, len(raw))
+	for artist, genre := range raw {
+		artistMap[strings.ToLower(strings.TrimSpace(artist))] = strings.TrimSpace(genre)
+	}
+	return artistMap, nil
+}
+
+// libraryGenres returns the most common real genre of each primary artist in the library
+func libraryGenres(library []*Song) map[string]string {
+	counts := make(map[string]map[string]int)
+	for _, song := range library {
+		if isPlaceholderGenre(song.Genre) {
+			continue
+		}
+		artist := strings.ToLower(song.PrimaryArtist())
+		if counts[artist] == nil {
+			counts[artist] = make(map[string]int)
+		}
+		counts[artist][song.Genre]++
+	}
+
+	genres := make(map[string]string, len(counts))
+	for artist, byGenre := range counts {
+		names := make([]string, 0, len(byGenre))
+		for genre := range byGenre {
+			names = append(names, genre)
+		}
+		sort.Strings(names)
+		best := names[0]
+		for _, genre := range names[1:] {
+			if byGenre[genre] > byGenre[best] {
+				best = genre
+			}
+		}
+		genres[artist] = best
+	}
+	return genres
+}
+
+// suggestGenre is the Suggest function of the genre enricher
+func suggestGenre(song *Song) (map[string]string, string, error) {
+	if !isPlaceholderGenre(song.Genre) {
+		return nil, "", nil
+	}
+	genre, source, err := classifier.classify(song)
+	if err != nil || genre == "" {
+		return nil, "", err
+	}
+	return map[string]string{"genre": genre}, source, nil
+}
+
+// classify suggests a genre for a song, trying the artist map, the library and then
+// MusicBrainz
+func (c *genreClassifier) classify(song *Song) (string, string, error) {
+	for _, artist := range []string{song.Artist, song.PrimaryArtist()} {
+		if genre := c.artistMap[strings.ToLower(artist)]; genre != "" {
+			return genre, "genre map", nil
+		}
+	}
+	if genre := c.library[strings.ToLower(song.PrimaryArtist())]; genre != "" {
+		return genre, "library", nil
+	}
+	if genreMusicBrainz && song.PrimaryArtist() != "" {
+		genre, err := c.lookupMusicBrainz(song.PrimaryArtist())
+		if err != nil || genre == "" {
+			return "", "", err
+		}
+		return genre, "MusicBrainz", nil
+	}
+	return "", "", nil
+}
+
+// musicBrainzArtists is the part of a MusicBrainz artist search response we use
+type musicBrainzArtists struct {
+	Artists []struct {
+		Name  string `json:"name"`
+		Score int    `json:"score"`
+		Tags  []struct {
+			Count int    `json:"count"`
+			Name  string `json:"name"`
+		} `json:"tags"`
+	} `json:"artists"`
+}
+
+// lookupMusicBrainz returns the most voted tag of the best matching MusicBrainz artist
+func (c *genreClassifier) lookupMusicBrainz(artist string) (string, error) {
+	key := strings.ToLower(artist)
+	if genre, ok := c.musicBrainz[key]; ok {
+		return genre, nil
+	}
+
+	ctx := commandContext()
+	if wait := musicBrainzInterval - time.Since(c.lastLookup); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", errInterrupted
+		}
+	}
+	c.lastLookup = time.Now()
+
+	query := url.Values{"query": {fmt.Sprintf("artist:%q", artist)}, "fmt": {"json"}, "limit": {"1"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, musicBrainzURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "cloneheroer-songcli (https://github.com/mxygem/cloneheroer-songcli)")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("MusicBrainz lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("MusicBrainz lookup failed: %s", resp.Status)
+	}
+
+	var result musicBrainzArtists
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("invalid MusicBrainz response: %w", err)
+	}
+
+	genre := ""
+	if len(result.Artists) > 0 && strings.EqualFold(result.Artists[0].Name, artist) {
+		bestCount := 0
+		for _, tag := range result.Artists[0].Tags {
+			if tag.Count > bestCount {
+				genre, bestCount = titleCase(tag.Name), tag.Count
+			}
+		}
+	}
+	c.musicBrainz[key] = genre
+	return genre, nil
+}
+
+// titleCase capitalizes each word of a MusicBrainz tag ("progressive metal")
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,69 @@
+package main
+
+import "fmt"
+
+var (
+	ghlOnly bool
+	noGHL   bool
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&ghlOnly, "ghl-only", "", false, "Only songs with a Guitar Hero Live (6-fret) chart, read from the notes file")
+	rootCmd.PersistentFlags().BoolVarP(&noGHL, "no-ghl", "", false, "Leave out songs with a Guitar Hero Live (6-fret) chart, read from the notes file")
+}
+
+// ghlInstruments are the Guitar Hero Live parts, played with three black and three
+// white frets
+var ghlInstruments = []Instrument{InstrumentGuitarGHL, InstrumentBassGHL}
+
+// ghlLanes names the .chart fret numbers of a 6-fret track, in the order they're reported
+var ghlLanes = []struct {
+	Fret int
+	Name string
+}{{7, "open"}, {0, "W1"}, {1, "W2"}, {2, "W3"}, {3, "B1"}, {4, "B2"}, {8, "B3"}}
+
+// isGHLInstrument reports whether inst is a Guitar Hero Live part
+func isGHLInstrument(inst Instrument) bool {
+	return inst == InstrumentGuitarGHL || inst == InstrumentBassGHL
+}
+
+// IsGHL reports whether a song has a Guitar Hero Live chart. Once the notes file has
+// been read (see loadChartedDifficulties) its tracks decide; otherwise, or if it couldn't
+// be read, the diff_guitarghl and diff_bassghl values of song.ini do.
+func (s *Song) IsGHL() bool {
+	for _, inst := range ghlInstruments {
+		if len(s.Charted) > 0 {
+			if len(s.Charted[inst]) > 0 {
+				return true
+			}
+		} else if s.HasInstrument(inst) {
+			return true
+		}
+	}
+	return false
+}
+
+// ghlFilter returns the GHL criterion of the --ghl-only and --no-ghl flags, nil if
+// neither is set
+func ghlFilter() (*bool, error) {
+	if ghlOnly && noGHL {
+		return nil, fmt.Errorf("--ghl-only and --no-ghl can't be used together")
+	}
+	if !ghlOnly && !noGHL {
+		return nil, nil
+	}
+	return &ghlOnly, nil
+}
+
+// usesGHL reports whether the spec or any of its nested clauses filters on GHL charts
+func (spec FilterSpec) usesGHL() bool {
+	if spec.GHL != nil {
+		return true
+	}
+	for _, clause := range spec.clauses() {
+		if clause.usesGHL() {
+			return true
+		}
+	}
+	return false
+}
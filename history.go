@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "List recent searches",
+		Long: `List the most recent searches, newest first. Re-run one with "history run <n>", adding
+flags to tweak it: later flags override the ones from the original search.
+
+The last ` + strconv.Itoa(defaultHistorySize) + ` searches are kept; set ` + historySizeEnv + ` to keep a different number,
+or to 0 to stop recording.`,
+		Args: cobra.NoArgs,
+		RunE: runHistory,
+	}
+
+	historyRunCmd = &cobra.Command{
+		Use:                "run <n> [flags]",
+		Short:              "Re-run a previous search, optionally with extra flags",
+		DisableFlagParsing: true,
+		RunE:               runHistoryRun,
+	}
+
+	historyClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Forget all recorded searches",
+		Args:  cobra.NoArgs,
+		RunE:  runHistoryClear,
+	}
+
+	lastCmd = &cobra.Command{
+		Use:                "last [flags]",
+		Short:              "Re-run the most recent search, optionally with extra flags",
+		DisableFlagParsing: true,
+		RunE:               runLast,
+	}
+)
+
+func init() {
+	historyCmd.AddCommand(historyRunCmd)
+	historyCmd.AddCommand(historyClearCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(lastCmd)
+}
+
+// defaultHistorySize is the number of searches kept
+const defaultHistorySize = 50
+
+// historySizeEnv overrides the number of searches kept; 0 disables the history
+const historySizeEnv = "CLONEHEROER_HISTORY_SIZE"
+
+// HistoryEntry is a recorded search
+type HistoryEntry struct {
+	Time time.Time `json:"time"`
+	Dir  string    `json:"dir"`  // working directory, so relative paths still resolve
+	Args []string  `json:"args"` // command-line arguments, without the program name
+}
+
+// historySize returns how many searches to keep
+func historySize() int {
+	if value := os.Getenv(historySizeEnv); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size >= 0 {
+			return size
+		}
+	}
+	return defaultHistorySize
+}
+
+// historyFile returns the path of the history file in the user's config folder
+func historyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloneheroer", "history.json"), nil
+}
+
+// loadHistory reads the recorded searches, oldest first
+func loadHistory() ([]HistoryEntry, error) {
+	path, err := historyFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid history file %s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// saveHistory writes the recorded searches
+func saveHistory(entries []HistoryEntry) error {
+	path, err := historyFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// recordSearch adds the current command line to the history. Failing to record a search
+// never fails the search itself.
+func recordSearch(args []string) {
+	size := historySize()
+	if size == 0 {
+		return
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not recording search: %v\n", err)
+		return
+	}
+
+	wd, _ := os.Getwd()
+	entries = append(entries, HistoryEntry{Time: time.Now(), Dir: wd, Args: args})
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	if err := saveHistory(entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not recording search: %v\n", err)
+	}
+}
+
+// formatArgs joins arguments for display, quoting the ones that contain spaces
+func formatArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No searches recorded yet")
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		fmt.Printf("%4d  %s  %s\n", len(entries)-i, entry.Time.Local().Format("2006-01-02 15:04"), formatArgs(entry.Args))
+	}
+	return nil
+}
+
+func runHistoryRun(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		return cmd.Help()
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return fmt.Errorf("invalid history number %q", args[0])
+	}
+	return rerunSearch(n, args[1:])
+}
+
+func runLast(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return cmd.Help()
+	}
+	return rerunSearch(1, args)
+}
+
+func runHistoryClear(cmd *cobra.Command, args []string) error {
+	if err := saveHistory([]HistoryEntry{}); err != nil {
+		return err
+	}
+	fmt.Println("Search history cleared")
+	return nil
+}
+
+// rerunSearch runs the nth most recent search again with extra arguments appended, in
+// the directory it was originally run from
+func rerunSearch(n int, extra []string) error {
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	if n > len(entries) {
+		return fmt.Errorf("only %d search(es) recorded", len(entries))
+	}
+	entry := entries[len(entries)-n]
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, entry.Args...), extra...)
+	fmt.Fprintf(os.Stderr, "cloneheroer %s\n", formatArgs(args))
+
+	child := exec.Command(executable, args...)
+	child.Dir = entry.Dir
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := child.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// The search has already reported its own error
+			os.Exit(exitErr.ExitCode())
+		}
+		return err
+	}
+	return nil
+}
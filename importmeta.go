@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	importMap      string
+	importNoHeader bool
+	importDryRun   bool
+
+	importMetaCmd = &cobra.Command{
+		Use:   "import-meta <file.csv>",
+		Short: "Apply tags and ratings from a spreadsheet to the library",
+		Long: `Read a CSV file of songs with tags and ratings and write them to the matching songs'
+song.ini ("tags" and "rating" keys).
+
+--map names the CSV columns in order: name, artist, tag, rating, or "-" to ignore a column.
+Several columns can be tag columns, and a tag cell may hold several tags separated by
+commas or semicolons. Without --map the first row must be a header using those names. With
+--map the first row is skipped as a header, whatever it says, unless --no-header is given.
+
+Rows are matched to songs by fuzzy name (and artist, when mapped); if several songs match,
+an exact name match wins. Unmatched and ambiguous rows are reported and left alone. New
+tags are added to a song's existing tags; a rating replaces the old one.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runImportMeta,
+	}
+)
+
+func init() {
+	importMetaCmd.Flags().StringVar(&importMap, "map", "", "Comma-separated meaning of each CSV column: name, artist, tag, rating or - (default: read from the header row)")
+	importMetaCmd.Flags().BoolVar(&importNoHeader, "no-header", false, "The CSV file has no header row (with --map)")
+	importMetaCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show what would change without writing song.ini files")
+	rootCmd.AddCommand(importMetaCmd)
+}
+
+// importColumns are the column names accepted by --map
+var importColumns = map[string]bool{"name": true, "artist": true, "tag": true, "tags": true, "rating": true, "-": true}
+
+// MetaRow is one row of an import file
+type MetaRow struct {
+	Line   int
+	Name   string
+	Artist string
+	Tags   []string
+	Rating int // 0 if the row has no rating
+}
+
+// parseImportMap validates a --map value or header row
+func parseImportMap(columns []string) ([]string, error) {
+	mapping := make([]string, len(columns))
+	hasName := false
+	for i, column := range columns {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if column == "" {
+			column = "-"
+		}
+		if !importColumns[column] {
+			return nil, fmt.Errorf("unknown column %q (available: name, artist, tag, rating, -)", column)
+		}
+		if column == "tags" {
+			column = "tag"
+		}
+		hasName = hasName || column == "name"
+		mapping[i] = column
+	}
+	if !hasName {
+		return nil, fmt.Errorf("no name column in %s", strings.Join(columns, ","))
+	}
+	return mapping, nil
+}
+
+// readMetaRows reads the rows of an import file using the --map columns or its header row
+func readMetaRows(r io.Reader, mapSpec string, hasHeader bool) ([]MetaRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var mapping []string
+	if mapSpec != "" {
+		if mapping, err = parseImportMap(strings.Split(mapSpec, ",")); err != nil {
+			return nil, fmt.Errorf("invalid --map: %w", err)
+		}
+	} else if mapping, err = parseImportMap(records[0]); err != nil {
+		return nil, fmt.Errorf("invalid header row (or pass --map): %w", err)
+	}
+	first := 0
+	if hasHeader || mapSpec == "" {
+		first = 1
+	}
+
+	var rows []MetaRow
+	for i := first; i < len(records); i++ {
+		row := MetaRow{Line: i + 1}
+		for j, cell := range records[i] {
+			if j >= len(mapping) {
+				break
+			}
+			cell = strings.TrimSpace(cell)
+			switch mapping[j] {
+			case "name":
+				row.Name = cell
+			case "artist":
+				row.Artist = cell
+			case "tag":
+				for _, tag := range strings.FieldsFunc(cell, func(r rune) bool { return r == ',' || r == ';' }) {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						row.Tags = append(row.Tags, tag)
+					}
+				}
+			case "rating":
+				if cell == "" {
+					continue
+				}
+				rating, err := strconv.Atoi(cell)
+				if err != nil || rating < 0 {
+					return nil, fmt.Errorf("line %d: invalid rating %q", row.Line, cell)
+				}
+				row.Rating = rating
+			}
+		}
+		if row.Name == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// matchMetaRow finds the library song a row refers to
+func matchMetaRow(library []*Song, row MetaRow) (*Song, error) {
+	filter, err := NewFilter(FilterSpec{Name: row.Name, Artist: row.Artist})
+	if err != nil {
+		return nil, err
+	}
+	matches := filter.Apply(library)
+	if len(matches) > 1 {
+		var exact []*Song
+		for _, song := range matches {
+			if sameSongName(song.Name, row.Name) {
+				exact = append(exact, song)
+			}
+		}
+		if len(exact) > 0 {
+			matches = exact
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no song matches")
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d songs match: %s", len(matches), describeCandidates(matches))
+	}
+}
+
+// mergeTags adds new tags to existing ones, skipping case-insensitive duplicates
+func mergeTags(existing, added []string) []string {
+	merged := append([]string{}, existing...)
+	for _, tag := range added {
+		duplicate := false
+		for _, have := range merged {
+			if strings.EqualFold(have, tag) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+func runImportMeta(cmd *cobra.Command, args []string) error {
+	if anyRemoteLibrary() {
+		return fmt.Errorf("import-meta needs a local library")
+	}
+	if !importDryRun {
+		if err := ensureWritable("import tags and ratings"); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", args[0], err)
+	}
+	defer file.Close()
+	rows, err := readMetaRows(file, importMap, !importNoHeader)
+	if err != nil {
+		return err
+	}
+
+	library, err := loadLibrary()
+	if err != nil {
+		return err
+	}
+
+	updated, unmatched := 0, 0
+	for _, row := range rows {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		song, err := matchMetaRow(library, row)
+		if err != nil {
+			label := strconv.Quote(row.Name)
+			if row.Artist != "" {
+				label += " by " + strconv.Quote(row.Artist)
+			}
+			fmt.Fprintf(os.Stderr, "line %d: %s: %v\n", row.Line, label, err)
+			unmatched++
+			continue
+		}
+
+		values := make(map[string]string)
+		tags := mergeTags(song.Tags, row.Tags)
+		if len(tags) != len(song.Tags) {
+			values["tags"] = strings.Join(tags, ", ")
+		}
+		if row.Rating > 0 && row.Rating != song.Rating {
+			values["rating"] = strconv.Itoa(row.Rating)
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		var changes []string
+		for _, key := range sortedKeys(values) {
+			changes = append(changes, fmt.Sprintf("%s = %s", key, values[key]))
+		}
+		// Keep the song up to date in case later rows refer to it again
+		song.Tags = tags
+		if row.Rating > 0 {
+			song.Rating = row.Rating
+		}
+		if importDryRun {
+			fmt.Printf("Would update %s - %s: %s\n", song.Artist, song.Name, strings.Join(changes, "; "))
+			continue
+		}
+		if err := setIniValues(song.Path, values); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s - %s: %s\n", song.Artist, song.Name, strings.Join(changes, "; "))
+		updated++
+	}
+
+	fmt.Fprintf(os.Stderr, "%d row(s): %d applied, %d unmatched\n", len(rows), updated, unmatched)
+	return nil
+}
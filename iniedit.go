@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+)
+
+// setIniValues updates keys in the [song] section of a song.ini file, leaving every
+// other line (comments, ordering, unknown keys, line endings) untouched. Keys that
+// don't exist yet are appended to the end of the section.
+func setIniValues(path string, values map[string]string) error {
+	if isSngFile(path) {
+		return packedEditError(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	updated, err := updateIniValues(data, values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return writeLibraryFile(path, updated, info.Mode().Perm())
+}
+
+// updateIniValues applies values to the [song] section of an ini document. Only the
+// values of the keys being set change: keys keep the case and spacing they were written
+// with, and every line keeps its own line ending, so a file edited with no change in its
+// values comes back byte for byte. A key written more than once is set everywhere, since
+// the last of its values is the one read.
+func updateIniValues(data []byte, values map[string]string) ([]byte, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+
+	values = lowerKeys(values)
+	pending := maps.Clone(values)
+
+	sectionStart, sectionEnd := -1, len(lines)
+	for i, line := range lines {
+		body, ending := cutLineEnding(line)
+		trimmed := strings.TrimSpace(strings.TrimPrefix(body, "\ufeff"))
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if sectionStart >= 0 {
+				sectionEnd = i
+				break
+			}
+			if strings.EqualFold(strings.TrimSpace(trimmed[1:len(trimmed)-1]), "song") {
+				sectionStart = i
+			}
+			continue
+		}
+		if sectionStart < 0 {
+			continue
+		}
+
+		key := iniLineKey(trimmed)
+		if value, ok := values[key]; ok {
+			lines[i] = replaceIniValue(body, value) + ending
+			delete(pending, key)
+		}
+	}
+	if sectionStart < 0 {
+		return nil, fmt.Errorf("no [song] section found")
+	}
+
+	if len(pending) > 0 {
+		// Insert after the last non-blank line of the section
+		insertAt := sectionEnd
+		for insertAt > sectionStart+1 && strings.TrimSpace(lines[insertAt-1]) == "" {
+			insertAt--
+		}
+
+		// New lines end like the line before them; a last line without a line ending
+		// gets one, and the last added line goes without instead
+		_, newline := cutLineEnding(lines[insertAt-1])
+		unterminated := newline == ""
+		if unterminated {
+			newline = documentLineEnding(data)
+			lines[insertAt-1] += newline
+		}
+		added := make([]string, 0, len(pending))
+		for _, key := range sortedKeys(pending) {
+			added = append(added, key+" = "+pending[key]+newline)
+		}
+		if unterminated {
+			last := len(added) - 1
+			added[last] = strings.TrimSuffix(added[last], newline)
+		}
+		lines = append(lines[:insertAt], append(added, lines[insertAt:]...)...)
+	}
+
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// cutLineEnding splits a line into its text and its line ending, "\r\n", "\n" or none
+func cutLineEnding(line string) (string, string) {
+	if body, ok := strings.CutSuffix(line, "\r\n"); ok {
+		return body, "\r\n"
+	}
+	if body, ok := strings.CutSuffix(line, "\n"); ok {
+		return body, "\n"
+	}
+	return line, ""
+}
+
+// documentLineEnding returns the line ending an ini document uses, "\n" if it has none
+func documentLineEnding(data []byte) string {
+	if bytes.Contains(data, []byte("\r\n")) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// replaceIniValue swaps the value of a key line for value, keeping the key as written and
+// the spacing around the value, in the "key = value", "key: value" or "key value" form
+func replaceIniValue(line, value string) string {
+	start := strings.IndexAny(line, "=:")
+	if start >= 0 {
+		start++
+	} else {
+		// The value starts after the first run of spaces following the key
+		indent := len(line) - len(strings.TrimLeft(line, " \t\ufeff"))
+		start = len(line)
+		if gap := strings.IndexAny(line[indent:], " \t"); gap >= 0 {
+			start = indent + gap
+		}
+	}
+
+	rest := line[start:]
+	if strings.TrimSpace(rest) == "" {
+		// An empty value: space it from the "=" like the key is
+		line = strings.TrimRight(line, " \t")
+		if strings.HasSuffix(line, "=") && !strings.HasSuffix(line, " =") ||
+			strings.HasSuffix(line, ":") && !strings.HasSuffix(line, " :") {
+			return line + value
+		}
+		return line + " " + value
+	}
+	valueStart := start + len(rest) - len(strings.TrimLeft(rest, " \t"))
+	valueEnd := start + len(strings.TrimRight(rest, " \t"))
+	return line[:valueStart] + value + line[valueEnd:]
+}
+
+// iniLineKey returns the lowercased key of an ini line, separated from its value by "="
+// or ":" as the scanner reads it, also accepting the malformed "key value" form some
+// charting tools write
+func iniLineKey(line string) string {
+	if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+		return ""
+	}
+	if idx := strings.IndexAny(line, "=:"); idx >= 0 {
+		return strings.ToLower(strings.TrimSpace(line[:idx]))
+	}
+	if fields := strings.Fields(line); len(fields) > 0 {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+// readIniValues returns the raw values of the [song] section of a song.ini file, or the
+// metadata of a .sng file, keyed by lowercased key name
+func readIniValues(path string) (map[string]string, error) {
+	if isSngFile(path) {
+		return readSngValues(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	inSong := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(strings.TrimPrefix(line, "\ufeff"))
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSong = strings.EqualFold(strings.TrimSpace(trimmed[1:len(trimmed)-1]), "song")
+			continue
+		}
+		if !inSong {
+			continue
+		}
+
+		key := iniLineKey(trimmed)
+		if key == "" {
+			continue
+		}
+		if idx := strings.IndexAny(trimmed, "=:"); idx >= 0 {
+			values[key] = strings.TrimSpace(trimmed[idx+1:])
+		} else if fields := strings.Fields(trimmed); len(fields) >= 2 {
+			values[key] = strings.Join(fields[1:], " ")
+		}
+	}
+	return values, nil
+}
+
+// lowerKeys returns values with its keys lowercased
+func lowerKeys(values map[string]string) map[string]string {
+	lower := make(map[string]string, len(values))
+	for key, value := range values {
+		lower[strings.ToLower(key)] = value
+	}
+	return lower
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateIniValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		values map[string]string
+		want   string
+	}{
+		{
+			name:   "unchanged values round trip",
+			input:  "[song]\nname = Kind\nartist=Plini\ngenre :  Prog  \n",
+			values: map[string]string{"name": "Kind", "artist": "Plini", "genre": "Prog"},
+			want:   "[song]\nname = Kind\nartist=Plini\ngenre :  Prog  \n",
+		},
+		{
+			name:   "byte order mark",
+			input:  "\ufeff[song]\r\nname = Kind\r\nartist = Plini\r\n",
+			values: map[string]string{"artist": "Plini & Friends"},
+			want:   "\ufeff[song]\r\nname = Kind\r\nartist = Plini & Friends\r\n",
+		},
+		{
+			name:   "CRLF",
+			input:  "[song]\r\nname = Kind\r\nyear = 2017\r\n",
+			values: map[string]string{"year": "2018"},
+			want:   "[song]\r\nname = Kind\r\nyear = 2018\r\n",
+		},
+		{
+			name:   "mixed line endings",
+			input:  "[song]\r\nname = Kind\nyear = 2017\r\ngenre = Prog\n",
+			values: map[string]string{"name": "Kind (Live)", "year": "2018"},
+			want:   "[song]\r\nname = Kind (Live)\nyear = 2018\r\ngenre = Prog\n",
+		},
+		{
+			name:   "comments",
+			input:  "; made by hand\n[song]\n# the name\nname = Kind\n; name = Old\n",
+			values: map[string]string{"name": "Kind"},
+			want:   "; made by hand\n[song]\n# the name\nname = Kind\n; name = Old\n",
+		},
+		{
+			name:   "unknown keys and key spelling",
+			input:  "[song]\nName = Kind\nmy_custom_key = 42\nDiff_Guitar=5\n",
+			values: map[string]string{"diff_guitar": "6", "name": "Kind"},
+			want:   "[song]\nName = Kind\nmy_custom_key = 42\nDiff_Guitar=6\n",
+		},
+		{
+			name:   "duplicate keys",
+			input:  "[song]\ngenre = Rock\nname = Kind\ngenre = Metal\n",
+			values: map[string]string{"genre": "Prog"},
+			want:   "[song]\ngenre = Prog\nname = Kind\ngenre = Prog\n",
+		},
+		{
+			name:   "missing final newline",
+			input:  "[song]\nname = Kind\nyear = 2017",
+			values: map[string]string{"year": "2018"},
+			want:   "[song]\nname = Kind\nyear = 2018",
+		},
+		{
+			name:   "appending to a missing final newline",
+			input:  "[song]\r\nname = Kind",
+			values: map[string]string{"year": "2018"},
+			want:   "[song]\r\nname = Kind\r\nyear = 2018",
+		},
+		{
+			name:   "later sections",
+			input:  "[song]\nname = Kind\n\n[other]\nname = Untouched\nyear = 1999\n",
+			values: map[string]string{"name": "Kind", "year": "2018"},
+			want:   "[song]\nname = Kind\nyear = 2018\n\n[other]\nname = Untouched\nyear = 1999\n",
+		},
+		{
+			name:   "appending keys",
+			input:  "[song]\r\nname = Kind\r\n",
+			values: map[string]string{"year": "2018", "album": "Sunhead"},
+			want:   "[song]\r\nname = Kind\r\nalbum = Sunhead\r\nyear = 2018\r\n",
+		},
+		{
+			name:   "other value forms",
+			input:  "[song]\nname:Kind\nartist Plini\ngenre =\n",
+			values: map[string]string{"name": "Kind", "artist": "Polyphia", "genre": "Prog"},
+			want:   "[song]\nname:Kind\nartist Polyphia\ngenre = Prog\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := updateIniValues([]byte(tt.input), tt.values)
+			if err != nil {
+				t.Fatalf("updateIniValues() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("updateIniValues() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateIniValuesWithoutSongSection(t *testing.T) {
+	if _, err := updateIniValues([]byte("[other]\nname = Kind\n"), map[string]string{"name": "Kind"}); err == nil {
+		t.Error("updateIniValues() without a [song] section should fail")
+	}
+}
+
+// TestSetIniValuesRoundTrip sets every value of a song.ini to what it already is and
+// expects the file back byte for byte
+func TestSetIniValuesRoundTrip(t *testing.T) {
+	original := "\ufeff; exported by a charting tool\r\n[Song]\r\nName = Kind\r\nartist=Plini\n" +
+		"genre :  Prog  \r\ncustom_key = x\r\ngenre = Prog\n\r\n[notes]\r\nname = other"
+	path := filepath.Join(t.TempDir(), "song.ini")
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readIniValues(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setIniValues(path, values); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != original {
+		t.Errorf("round trip = %q, want %q", got, original)
+	}
+}
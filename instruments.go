@@ -0,0 +1,110 @@
+package main
+
+import "strings"
+
+// Instrument represents available instruments in Clone Hero
+type Instrument string
+
+const (
+	InstrumentGuitar    Instrument = "guitar"
+	InstrumentRhythm    Instrument = "rhythm"
+	InstrumentBass      Instrument = "bass"
+	InstrumentDrums     Instrument = "drums"
+	InstrumentKeys      Instrument = "keys"
+	InstrumentBand      Instrument = "band"
+	InstrumentGuitarGHL Instrument = "guitarghl"
+	InstrumentBassGHL   Instrument = "bassghl"
+	InstrumentProGuitar Instrument = "proguitar"
+	InstrumentProBass   Instrument = "probass"
+	InstrumentProKeys   Instrument = "prokeys"
+)
+
+// diffKeyPrefix starts every song.ini difficulty key
+const diffKeyPrefix = "diff_"
+
+// InstrumentInfo describes an instrument the tool knows how to read
+type InstrumentInfo struct {
+	Name   Instrument
+	Keys   []string // song.ini difficulty keys; the first is written by generate-ini
+	Tracks []string // instrument part of its note tracks (e.g. "Single" in "ExpertSingle")
+}
+
+// instrumentRegistry lists the known instruments in the order they're reported. Other
+// diff_* keys found in song.ini files (e.g. diff_vocals) are kept as instruments named
+// after the key; see instrumentForKey.
+var instrumentRegistry = []InstrumentInfo{
+	{Name: InstrumentGuitar, Keys: []string{"diff_guitar"}, Tracks: []string{"Single", "DoubleGuitar"}},
+	{Name: InstrumentRhythm, Keys: []string{"diff_rhythm"}, Tracks: []string{"DoubleRhythm"}},
+	{Name: InstrumentBass, Keys: []string{"diff_bass"}, Tracks: []string{"DoubleBass"}},
+	{Name: InstrumentDrums, Keys: []string{"diff_drums"}, Tracks: []string{"Drums"}},
+	{Name: InstrumentKeys, Keys: []string{"diff_keys"}, Tracks: []string{"Keyboard"}},
+	{Name: InstrumentBand, Keys: []string{"diff_band"}},
+	{Name: InstrumentGuitarGHL, Keys: []string{"diff_guitarghl"}, Tracks: []string{"GHLGuitar"}},
+	{Name: InstrumentBassGHL, Keys: []string{"diff_bassghl"}, Tracks: []string{"GHLBass"}},
+	// Pro guitar and bass come in 17 and 22 fret versions; the harder of the two is kept.
+	// Their tracks only exist in MIDI charts.
+	{Name: InstrumentProGuitar, Keys: []string{"diff_guitar_real", "diff_guitar_real_22"}, Tracks: []string{"ProGuitar"}},
+	{Name: InstrumentProBass, Keys: []string{"diff_bass_real", "diff_bass_real_22"}, Tracks: []string{"ProBass"}},
+	{Name: InstrumentProKeys, Keys: []string{"diff_keys_real"}, Tracks: []string{"ProKeys"}},
+}
+
+// instrumentKeys maps the song.ini difficulty keys of the known instruments to them
+var instrumentKeys = make(map[string]Instrument)
+
+// chartTrackInstruments maps the instrument part of a note track name (e.g. "Single" in
+// "ExpertSingle") to an instrument
+var chartTrackInstruments = make(map[string]Instrument)
+
+func init() {
+	for _, info := range instrumentRegistry {
+		for _, key := range info.Keys {
+			instrumentKeys[key] = info.Name
+		}
+		for _, track := range info.Tracks {
+			chartTrackInstruments[track] = info.Name
+		}
+	}
+}
+
+// lookupInstrument returns the registry entry of inst, or false for instruments only
+// seen as unknown diff_* keys
+func lookupInstrument(inst Instrument) (InstrumentInfo, bool) {
+	for _, info := range instrumentRegistry {
+		if info.Name == inst {
+			return info, true
+		}
+	}
+	return InstrumentInfo{}, false
+}
+
+// instrumentForKey returns the instrument rated by a song.ini key. Unknown diff_* keys
+// become instruments named after the rest of the key, so diff_vocals is "vocals".
+func instrumentForKey(key string) (Instrument, bool) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if inst, ok := instrumentKeys[key]; ok {
+		return inst, true
+	}
+	name := strings.TrimPrefix(key, diffKeyPrefix)
+	if name == key || name == "" {
+		return "", false
+	}
+	return Instrument(name), true
+}
+
+// instrumentKey returns the song.ini key that rates inst
+func instrumentKey(inst Instrument) string {
+	if info, ok := lookupInstrument(inst); ok {
+		return info.Keys[0]
+	}
+	return diffKeyPrefix + string(inst)
+}
+
+// ParseInstrument reads an instrument given on the command line or in a filter file,
+// either by name ("drums") or by its raw song.ini key ("diff_drums", "diff_vocals")
+func ParseInstrument(name string) Instrument {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if inst, ok := instrumentForKey(name); ok {
+		return inst
+	}
+	return Instrument(name)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var filterMaxIntro string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&filterMaxIntro, "max-intro", "", "", "Only songs whose first note comes within this time (e.g. 0:20), read from the notes file; per --instrument if given")
+}
+
+// introPattern matches --max-intro values written as minutes and seconds
+var introPattern = regexp.MustCompile(`^(\d+):(\d{1,2})$`)
+
+// parseIntro parses a --max-intro value, written as m:ss (e.g. 0:20) or as a duration
+// (e.g. 20s)
+func parseIntro(value string) (time.Duration, error) {
+	var intro time.Duration
+	if matches := introPattern.FindStringSubmatch(value); matches != nil {
+		minutes, _ := strconv.Atoi(matches[1])
+		seconds, _ := strconv.Atoi(matches[2])
+		intro = time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second
+	} else if d, err := time.ParseDuration(value); err == nil {
+		intro = d
+	} else {
+		return 0, fmt.Errorf("invalid --max-intro %q (expected m:ss, e.g. 0:20)", value)
+	}
+	if intro <= 0 {
+		return 0, fmt.Errorf("invalid --max-intro %q: must be longer than 0:00", value)
+	}
+	return intro, nil
+}
+
+// FirstNotes returns when each instrument plays its first note, on whichever difficulty
+// starts earliest
+func (c *Chart) FirstNotes() map[Instrument]time.Duration {
+	first := make(map[Instrument]int64)
+	for _, difficulty := range difficulties {
+		prefix := difficulty.trackPrefix()
+		for part, inst := range chartTrackInstruments {
+			notes := c.Tracks[prefix+part]
+			if len(notes) == 0 {
+				continue
+			}
+			if tick, ok := first[inst]; !ok || notes[0].Tick < tick {
+				first[inst] = notes[0].Tick
+			}
+		}
+	}
+
+	times := make(map[Instrument]time.Duration, len(first))
+	for inst, tick := range first {
+		times[inst] = c.TickToTime(tick)
+	}
+	return times
+}
+
+// Intro returns how long a song plays before the first note of inst, or of any
+// instrument if inst is empty. It's false if the notes file hasn't been read or has no
+// notes for the instrument.
+func (s *Song) Intro(inst Instrument) (time.Duration, bool) {
+	if inst != "" {
+		intro, ok := s.FirstNotes[inst]
+		return intro, ok
+	}
+	var intro time.Duration
+	found := false
+	for _, first := range s.FirstNotes {
+		if !found || first < intro {
+			intro, found = first, true
+		}
+	}
+	return intro, found
+}
+
+// introFilters returns every --max-intro value used by the spec or its nested clauses
+func (spec FilterSpec) introFilters() []string {
+	var values []string
+	if spec.MaxIntro != "" {
+		values = append(values, spec.MaxIntro)
+	}
+	for _, clause := range spec.clauses() {
+		values = append(values, clause.introFilters()...)
+	}
+	return values
+}
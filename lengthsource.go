@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Length sources for --length-source
+const (
+	LengthSourceIni   = "ini"
+	LengthSourceAudio = "audio"
+	LengthSourceChart = "chart"
+)
+
+// lengthSources lists the values accepted by --length-source
+var lengthSources = []string{LengthSourceIni, LengthSourceAudio, LengthSourceChart}
+
+// applyLengthSource replaces each song's song_length with its measured audio duration or
+// the time of its last chart note. Songs that can't be measured keep their song_length.
+func applyLengthSource(songs []*Song, source string) error {
+	switch source {
+	case "", LengthSourceIni:
+		return nil
+	case LengthSourceAudio, LengthSourceChart:
+	default:
+		return fmt.Errorf("unknown length source %q (available: %s)", source, strings.Join(lengthSources, ", "))
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("--length-source %s needs a local library", source)
+	}
+
+	caches := make(map[string]*lengthCache)
+	unmeasured := 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		root := songRoot(song)
+		cache, ok := caches[root]
+		if !ok {
+			cache = loadLengthCache(NewScanner(root, ScanOptions{}).lengthCacheFile())
+			caches[root] = cache
+		}
+		length, err := cache.songLength(song, source)
+		if err != nil || length <= 0 {
+			unmeasured++
+			continue
+		}
+		song.Length = length
+	}
+	for root, cache := range caches {
+		if err := cache.save(NewScanner(root, ScanOptions{}).lengthCacheFile()); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save length cache: %v\n", err)
+		}
+	}
+
+	if unmeasured > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't measure the %s length of %d song(s); using song_length for those\n", source, unmeasured)
+	}
+	return nil
+}
+
+// lengthCacheVersion is bumped when lengths are measured differently, so older ones are redone
+const lengthCacheVersion = 1
+
+// lengthCache holds the measured lengths of a library's songs per source and song, with
+// the mod times and sizes of the files they were measured from
+type lengthCache struct {
+	Version int                               `json:"version"`
+	Songs   map[string]map[string]lengthEntry `json:"songs"`
+	changed bool
+}
+
+// lengthEntry is the cached length of one song from one source
+type lengthEntry struct {
+	Files    string `json:"files"`
+	LengthMs int64  `json:"length_ms"`
+}
+
+// lengthCacheFile returns where the measured lengths of the scanner's library are cached,
+// next to its cache so that cache gc handles both
+func (s *Scanner) lengthCacheFile() string {
+	return strings.TrimSuffix(s.cacheFile, ".json") + ".lengths.json"
+}
+
+// loadLengthCache reads a length cache, starting afresh if it's missing, unreadable or
+// from another version
+func loadLengthCache(path string) *lengthCache {
+	cache := &lengthCache{Version: lengthCacheVersion, Songs: make(map[string]map[string]lengthEntry)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var cached lengthCache
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Version != lengthCacheVersion || cached.Songs == nil {
+		return cache
+	}
+	return &cached
+}
+
+// save writes the length cache if anything in it changed
+func (c *lengthCache) save(path string) error {
+	if !c.changed {
+		touchFile(path)
+		return nil
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// songLength returns a song's length according to source, from the cache while the files
+// it was measured from keep their mod times and sizes
+func (c *lengthCache) songLength(song *Song, source string) (time.Duration, error) {
+	files, err := lengthFiles(song, source)
+	if err != nil {
+		return 0, err
+	}
+	entry, ok := c.Songs[source][song.Path]
+	if ok && entry.Files == files {
+		return time.Duration(entry.LengthMs) * time.Millisecond, nil
+	}
+	length, err := measureSongLength(song, source)
+	if err != nil {
+		return 0, err
+	}
+	if c.Songs[source] == nil {
+		c.Songs[source] = make(map[string]lengthEntry)
+	}
+	c.Songs[source][song.Path] = lengthEntry{Files: files, LengthMs: length.Milliseconds()}
+	c.changed = true
+	return length, nil
+}
+
+// lengthFiles describes the files a song's length is measured from, by name, mod time and
+// size: its audio stems, or its notes file (the .sng file of packed songs)
+func lengthFiles(song *Song, source string) (string, error) {
+	var paths []string
+	switch {
+	case source == LengthSourceAudio && song.Packed:
+		return "", errPackedAudio
+	case source == LengthSourceAudio:
+		paths = songAudioFiles(filepath.Dir(song.Path))
+	case song.Packed:
+		paths = []string{song.Path}
+	default:
+		path, err := findChartFile(filepath.Dir(song.Path))
+		if err != nil {
+			return "", err
+		}
+		paths = []string{path}
+	}
+
+	var files strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&files, "%s %s %d;", filepath.Base(path), info.ModTime().UTC().Format(time.RFC3339Nano), info.Size())
+	}
+	return files.String(), nil
+}
+
+// measureSongLength returns a song's length according to source
+func measureSongLength(song *Song, source string) (time.Duration, error) {
+	if source == LengthSourceAudio {
+		if song.Packed {
+			return 0, errPackedAudio
+		}
+		return FolderAudioDuration(filepath.Dir(song.Path))
+	}
+
+	chart, err := loadSongChart(song)
+	if err != nil {
+		return 0, err
+	}
+	return chart.LastNoteTime(), nil
+}
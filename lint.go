@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	lintFix    bool
+	lintRules  []string
+	lintFailOn string
+
+	lintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "Check songs for common metadata problems",
+		Long: `Check every matching song against a set of lint rules and report problems, grouped
+by severity: errors, then warnings, then info. With --fix, problems that have a safe
+automatic fix are corrected in song.ini.
+
+lint fails while problems of --fail-on severity or worse remain (default: warning), so
+it can gate a release. --format json writes a machine-readable report.`,
+		RunE: runLint,
+	}
+)
+
+func init() {
+	lintCmd.Flags().BoolVar(&lintFix, "fix", false, "Apply automatic fixes to song.ini files")
+	lintCmd.Flags().StringSliceVar(&lintRules, "rule", nil, "Only run the given rules (comma-separated, default all)")
+	lintCmd.Flags().StringVar(&lintFailOn, "fail-on", string(SeverityWarning), "Fail when problems of this severity or worse remain (error, warning, info)")
+	rootCmd.AddCommand(lintCmd)
+}
+
+// LintSeverity is how bad a lint issue is
+type LintSeverity string
+
+const (
+	SeverityError   LintSeverity = "error"   // the game can't show the song properly
+	SeverityWarning LintSeverity = "warning" // the song works, but looks wrong or is hard to find
+	SeverityInfo    LintSeverity = "info"    // harmless, such as keys no game reads
+)
+
+// lintSeverities lists the severities from worst to mildest
+var lintSeverities = []LintSeverity{SeverityError, SeverityWarning, SeverityInfo}
+
+// rank orders severities from worst (0) to mildest
+func (severity LintSeverity) rank() int {
+	for i, s := range lintSeverities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(lintSeverities)
+}
+
+// parseSeverity reads a --fail-on value
+func parseSeverity(value string) (LintSeverity, error) {
+	severity := LintSeverity(strings.ToLower(strings.TrimSpace(value)))
+	if severity.rank() == len(lintSeverities) {
+		return "", fmt.Errorf("invalid --fail-on %q (expected error, warning or info)", value)
+	}
+	return severity, nil
+}
+
+// previewStartFraction is where the preview is placed when fixing it, as a fraction of the song length
+const previewStartFraction = 0.3
+
+// LintRule checks songs for one kind of problem
+type LintRule struct {
+	Name        string
+	Description string
+	Severity    LintSeverity
+	Check       func(song *Song) []LintIssue
+}
+
+// LintIssue is a problem found by a lint rule
+type LintIssue struct {
+	Song     *Song
+	Rule     string
+	Severity LintSeverity // set from the rule by lintSongs
+	Message  string
+	Fix      map[string]string // song.ini keys to set to fix the issue, nil if there's no automatic fix
+	Rename   string            // folder name to rename the song's folder to, to fix the issue
+}
+
+// LintReport is the JSON representation of a lint run
+type LintReport struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Checked       int                  `json:"checked"`
+	Counts        map[LintSeverity]int `json:"counts"` // issues per severity
+	Fixed         int                  `json:"fixed"`
+	Issues        []LintIssueRecord    `json:"issues"`
+}
+
+// LintIssueRecord is the JSON representation of a lint issue
+type LintIssueRecord struct {
+	Path     string       `json:"path"`
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+	Fixable  bool         `json:"fixable"`
+	Fixed    bool         `json:"fixed"`
+}
+
+// lintRuleSet lists every available lint rule
+var lintRuleSet = []LintRule{
+	{
+		Name:        "missing-fields",
+		Description: "name or artist is missing",
+		Severity:    SeverityError,
+		Check:       checkMissingFields,
+	},
+	{
+		Name:        "encoding",
+		Description: "song.ini isn't UTF-8",
+		Severity:    SeverityError,
+		Check:       checkEncoding,
+	},
+	{
+		Name:        "malformed",
+		Description: "song.ini has lines without = or sets keys twice",
+		Severity:    SeverityWarning,
+		Check:       checkMalformed,
+	},
+	{
+		Name:        "song-length",
+		Description: "song_length is missing or 0",
+		Severity:    SeverityWarning,
+		Check:       checkSongLength,
+	},
+	{
+		Name:        "year",
+		Description: "year isn't a number between 1900 and next year",
+		Severity:    SeverityWarning,
+		Check:       checkYear,
+	},
+	{
+		Name:        "preview-start",
+		Description: "preview_start_time is at 0 or beyond the end of the song",
+		Severity:    SeverityWarning,
+		Check:       checkPreviewStart,
+	},
+	{
+		Name:        "chart-mismatch",
+		Description: "notes.chart and song.ini disagree on the name, artist, album, genre, year, charter or offset",
+		Severity:    SeverityWarning,
+		Check:       checkChartMismatch,
+	},
+	{
+		Name:        "folder-name",
+		Description: "the song's folder name doesn't contain its name",
+		Severity:    SeverityWarning,
+		Check:       checkFolderName,
+	},
+	{
+		Name:        "unknown-keys",
+		Description: "song.ini has keys no game reads, often typos",
+		Severity:    SeverityInfo,
+		Check:       checkUnknownKeys,
+	},
+}
+
+// checkPreviewStart flags previews that start at the very beginning or after the song ends
+func checkPreviewStart(song *Song) []LintIssue {
+	lengthMs := song.Length.Milliseconds()
+
+	var message string
+	switch {
+	case song.PreviewStart <= 0:
+		message = "preview starts at 0:00"
+	case lengthMs > 0 && song.PreviewStart >= lengthMs:
+		message = fmt.Sprintf("preview starts at %s, after the song ends (%s)", formatMillis(song.PreviewStart), song.FormatLength())
+	default:
+		return nil
+	}
+
+	issue := LintIssue{Song: song, Rule: "preview-start", Message: message}
+	if lengthMs > 0 {
+		preview := int64(float64(lengthMs) * previewStartFraction)
+		issue.Fix = map[string]string{"preview_start_time": strconv.FormatInt(preview, 10)}
+		issue.Message += fmt.Sprintf(" (fix: %s)", formatMillis(preview))
+	}
+	return []LintIssue{issue}
+}
+
+// selectLintRules resolves rule names, returning every rule when names is empty
+func selectLintRules(names []string) ([]LintRule, error) {
+	if len(names) == 0 {
+		return lintRuleSet, nil
+	}
+
+	rules := make([]LintRule, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, rule := range lintRuleSet {
+			if rule.Name == name {
+				rules = append(rules, rule)
+				found = true
+				break
+			}
+		}
+		if !found {
+			available := make([]string, len(lintRuleSet))
+			for i, rule := range lintRuleSet {
+				available[i] = rule.Name
+			}
+			return nil, fmt.Errorf("unknown lint rule %q (available: %s)", name, strings.Join(available, ", "))
+		}
+	}
+	return rules, nil
+}
+
+// lintSongs runs rules over songs, returning the issues found with their severity
+func lintSongs(songs []*Song, rules []LintRule) ([]LintIssue, error) {
+	var issues []LintIssue
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			for _, issue := range rule.Check(song) {
+				issue.Severity = rule.Severity
+				issues = append(issues, issue)
+			}
+		}
+	}
+	return issues, nil
+}
+
+// fixLintIssue applies the automatic fix of an issue
+func fixLintIssue(issue LintIssue) error {
+	if issue.Fix != nil {
+		return setIniValues(issue.Song.Path, issue.Fix)
+	}
+	return renameSongFolder(issue.Song, issue.Rename)
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	rules, err := selectLintRules(lintRules)
+	if err != nil {
+		return err
+	}
+	failOn, err := parseSeverity(lintFailOn)
+	if err != nil {
+		return err
+	}
+	if err := validateFolderTemplate(lintFolderTemplate); err != nil {
+		return err
+	}
+	if lintFix {
+		if err := ensureWritable("fix lint issues"); err != nil {
+			return err
+		}
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	issues, err := lintSongs(songs, rules)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Severity.rank() < issues[j].Severity.rank() })
+
+	report := LintReport{SchemaVersion: SchemaVersion, Checked: len(songs), Counts: make(map[LintSeverity]int), Issues: []LintIssueRecord{}}
+	failing := 0
+	for _, issue := range issues {
+		record := LintIssueRecord{
+			Path:     issue.Song.Path,
+			Rule:     issue.Rule,
+			Severity: issue.Severity,
+			Message:  issue.Message,
+			Fixable:  issue.Fix != nil || issue.Rename != "",
+		}
+		if lintFix && record.Fixable {
+			if err := fixLintIssue(issue); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to fix %s: %v\n", record.Path, err)
+			} else {
+				record.Fixed = true
+				report.Fixed++
+			}
+		}
+		if !record.Fixed && issue.Severity.rank() <= failOn.rank() {
+			failing++
+		}
+		report.Counts[issue.Severity]++
+		report.Issues = append(report.Issues, record)
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeLintReport(writer, report)
+	}
+
+	fmt.Fprintf(os.Stderr, "Checked %d song(s): %d error(s), %d warning(s), %d info, %d fixed\n", len(songs),
+		report.Counts[SeverityError], report.Counts[SeverityWarning], report.Counts[SeverityInfo], report.Fixed)
+	if failing > 0 {
+		return fmt.Errorf("%d lint issue(s) of severity %s or worse found", failing, failOn)
+	}
+	return nil
+}
+
+// writeLintReport prints the issues under a heading per severity, one line per issue
+func writeLintReport(w io.Writer, report LintReport) {
+	headings := map[LintSeverity]string{SeverityError: "Errors", SeverityWarning: "Warnings", SeverityInfo: "Info"}
+	var current LintSeverity
+	for _, issue := range report.Issues {
+		if issue.Severity != current {
+			if current != "" {
+				fmt.Fprintln(w)
+			}
+			current = issue.Severity
+			fmt.Fprintf(w, "%s (%d):\n", headings[current], report.Counts[current])
+		}
+		status := ""
+		if issue.Fixed {
+			status = " [fixed]"
+		}
+		fmt.Fprintf(w, "%s: [%s] %s%s\n", issue.Path, issue.Rule, issue.Message, status)
+	}
+}
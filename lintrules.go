@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knownIniKeys are the [song] keys Clone Hero, YARG, Phase Shift and Rock Band conversions
+// use. diff_* keys are checked against the instruments instead.
+var knownIniKeys = map[string]bool{
+	"name": true, "artist": true, "album": true, "genre": true, "sub_genre": true, "year": true,
+	"charter": true, "frets": true, "icon": true, "loading_phrase": true, "song_length": true,
+	"preview_start_time": true, "preview_end_time": true, "preview": true, "delay": true,
+	"album_track": true, "track": true, "playlist_track": true, "playlist": true,
+	"sub_playlist": true, "rating": true, "tags": true, "modchart": true, "lyrics": true,
+	"hopo_frequency": true, "eighthnote_hopo": true, "multiplier_note": true, "star_power_note": true,
+	"sustain_cutoff_threshold": true, "five_lane_drums": true, "pro_drums": true, "pro_drum": true,
+	"drum_fallback_blue": true, "kit_type": true, "guitar_type": true, "bass_type": true,
+	"keys_type": true, "dancer_type": true, "vocal_gender": true, "end_events": true,
+	"chart_offset": true, "video_start_time": true, "video_end_time": true, "video_loop": true,
+	"background": true, "cover": true, "banner_link_a": true, "banner_link_b": true,
+	"link_name_a": true, "link_name_b": true, "link_bandcamp": true, "link_bluesky": true,
+	"link_facebook": true, "link_instagram": true, "link_spotify": true, "link_twitter": true,
+	"link_other": true, "link_youtube": true, "location": true, "real_guitar_tuning": true,
+	"real_guitar_22_tuning": true, "real_bass_tuning": true, "real_bass_22_tuning": true,
+	"real_keys_lane_count_right": true, "real_keys_lane_count_left": true, "count": true,
+	"sysex_slider": true, "sysex_open_bass": true, "sysex_pro_slide": true,
+	"sysex_high_hat_ctrl": true, "sysex_rimshot": true, "unlock_id": true,
+	"unlock_require": true, "unlock_text": true, "unlock_completed": true, "version": true,
+	"tutorial": true, "boss_battle": true, "credit_written_by": true, "credit_performed_by": true,
+	"credit_courtesy_of": true, "credit_album_cover": true, "credit_license": true,
+	"hopofreq": true, "checksum": true, "md5": true,
+	"keys_type_name": true, "background_type": true, "icon_name": true, "mediatype": true,
+	"lyrics_offset": true, "vocal_scroll_speed": true, "scroll_speed": true, "fixed_lane": true,
+}
+
+// lintIniCache holds the raw values of the last song.ini read by lintIniValues, since
+// several rules read the same file one after the other
+var lintIniCache struct {
+	path   string
+	values map[string]string
+	err    error
+}
+
+// lintIniValues returns the raw [song] values of a song, as readIniValues does
+func lintIniValues(song *Song) (map[string]string, error) {
+	if lintIniCache.path != song.Path {
+		lintIniCache.values, lintIniCache.err = readIniValues(song.Path)
+		lintIniCache.path = song.Path
+	}
+	return lintIniCache.values, lintIniCache.err
+}
+
+// oldestSongYear is the earliest year lint accepts; older years are typos such as 199
+const oldestSongYear = 1900
+
+// checkMissingFields flags songs without a name or artist, which the game lists as blank
+func checkMissingFields(song *Song) []LintIssue {
+	var missing []string
+	if strings.TrimSpace(song.Name) == "" {
+		missing = append(missing, "name")
+	}
+	if strings.TrimSpace(song.Artist) == "" {
+		missing = append(missing, "artist")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return []LintIssue{{Song: song, Rule: "missing-fields", Message: "no " + strings.Join(missing, " or ")}}
+}
+
+// checkYear flags year values that aren't a plausible year: text, a number in the future
+// or before 1900. Leading commas and spaces, as notes.chart writes years, are allowed.
+func checkYear(song *Song) []LintIssue {
+	values, err := lintIniValues(song)
+	if err != nil {
+		return nil
+	}
+	raw, ok := values["year"]
+	if !ok {
+		return nil
+	}
+	value := strings.TrimSpace(strings.TrimLeft(string(unquote([]byte(raw))), ", "))
+	year, err := strconv.Atoi(value)
+	latest := time.Now().Year() + 1
+	switch {
+	case value == "":
+		return nil
+	case err != nil:
+		return []LintIssue{{Song: song, Rule: "year", Message: fmt.Sprintf("year %q isn't a number", raw)}}
+	case year < oldestSongYear || year > latest:
+		return []LintIssue{{Song: song, Rule: "year", Message: fmt.Sprintf("year %d isn't between %d and %d", year, oldestSongYear, latest)}}
+	}
+	return nil
+}
+
+// checkSongLength flags songs without a song_length, which the game shows as 0:00 and
+// sorts first by length. The fix measures the notes file. song.ini is read again since
+// --length-source replaces the length of the song.
+func checkSongLength(song *Song) []LintIssue {
+	values, err := lintIniValues(song)
+	if err != nil {
+		return nil
+	}
+	if length, err := strconv.ParseInt(strings.TrimSpace(values["song_length"]), 10, 64); err == nil && length > 0 {
+		return nil
+	}
+	issue := LintIssue{Song: song, Rule: "song-length", Message: "song_length is missing or 0"}
+	if length, err := measureSongLength(song, LengthSourceChart); err == nil && length > 0 {
+		issue.Fix = map[string]string{"song_length": strconv.FormatInt(length.Milliseconds(), 10)}
+		issue.Message += fmt.Sprintf(" (fix: %s, the end of the last note)", formatMillis(length.Milliseconds()))
+	}
+	return []LintIssue{issue}
+}
+
+// songIniCauses returns the malformations of a song's song.ini (see parse-report) among
+// causes. Packed songs have no song.ini text to check.
+func songIniCauses(song *Song, causes ...string) []string {
+	if song.Packed {
+		return nil
+	}
+	data, err := readSongIni(song.Path)
+	if err != nil {
+		return nil
+	}
+	var found []string
+	for _, cause := range diagnoseSongIni(data) {
+		if containsFold(causes, cause) {
+			found = append(found, cause)
+		}
+	}
+	return found
+}
+
+// checkEncoding flags song.ini files that aren't UTF-8, whose text the game shows garbled
+func checkEncoding(song *Song) []LintIssue {
+	if len(songIniCauses(song, causeEncoding)) == 0 {
+		return nil
+	}
+	return []LintIssue{{Song: song, Rule: "encoding", Message: "song.ini isn't UTF-8 (e.g. UTF-16 or Windows-1252)"}}
+}
+
+// checkMalformed flags song.ini files the parser had to work around: lines without "="
+// and keys set twice
+func checkMalformed(song *Song) []LintIssue {
+	var issues []LintIssue
+	for _, cause := range songIniCauses(song, causeMissingEquals, causeDuplicateKeys) {
+		issues = append(issues, LintIssue{Song: song, Rule: "malformed", Message: cause})
+	}
+	return issues
+}
+
+// checkUnknownKeys flags [song] keys no game reads, usually typos such as "arist"
+func checkUnknownKeys(song *Song) []LintIssue {
+	values, err := lintIniValues(song)
+	if err != nil {
+		return nil
+	}
+	var unknown []string
+	for key := range values {
+		if knownIniKeys[key] {
+			continue
+		}
+		if _, ok := instrumentForKey(key); ok {
+			continue
+		}
+		unknown = append(unknown, key)
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return []LintIssue{{Song: song, Rule: "unknown-keys", Message: "unknown key(s): " + strings.Join(unknown, ", ")}}
+}
+
+// checkChartMismatch flags metadata that differs between song.ini and notes.chart, as
+// chart-check does. chart-check --sync fixes them.
+func checkChartMismatch(song *Song) []LintIssue {
+	mismatches, err := findChartMismatches(song)
+	if err != nil {
+		return []LintIssue{{Song: song, Rule: "chart-mismatch", Message: fmt.Sprintf("notes.chart can't be compared with song.ini: %v", err)}}
+	}
+	issues := make([]LintIssue, len(mismatches))
+	for i, m := range mismatches {
+		issues[i] = LintIssue{Song: song, Rule: "chart-mismatch", Message: fmt.Sprintf("%s differs between song.ini (%q) and notes.chart (%q)", m.Field.Name, m.IniValue, m.ChartValue)}
+	}
+	return issues
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var lyricsCmd = &cobra.Command{
+	Use:   "lyrics [name]",
+	Short: "Print a song's timed lyrics",
+	Long: `Print the lyrics of one song with the time each line starts, read from the lyric events
+in notes.chart or the PART VOCALS track of notes.mid. The optional argument filters by song
+name; if several songs match, you are asked to pick one.
+
+--format lrc writes an .lrc file that lyric players can follow along with; --format json
+writes the lines with their start and end times in milliseconds.`,
+	RunE: runLyrics,
+}
+
+func init() {
+	rootCmd.AddCommand(lyricsCmd)
+}
+
+// FormatLRC is the --format value for .lrc lyric files, only accepted by the lyrics command
+const FormatLRC = "lrc"
+
+// lyricLineGap splits lyrics into lines when a chart has no phrase markers
+const lyricLineGap = 2 * time.Second
+
+// LyricLine is one phrase of lyrics
+type LyricLine struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// lyricEventOrder makes phrase ends sort before phrase starts and lyrics at the same tick
+var lyricEventOrder = map[string]int{"phrase_end": 0, "phrase_start": 1}
+
+// LyricLines groups the chart's lyric events into lines using its phrase markers, or
+// pauses between words when there are none
+func (c *Chart) LyricLines() []LyricLine {
+	events := make([]ChartEvent, 0, len(c.Events))
+	hasPhrases := false
+	for _, event := range c.Events {
+		switch {
+		case event.Text == "phrase_start" || event.Text == "phrase_end":
+			hasPhrases = true
+			events = append(events, event)
+		case strings.HasPrefix(event.Text, "lyric "):
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Tick != events[j].Tick {
+			return events[i].Tick < events[j].Tick
+		}
+		return eventOrder(events[i].Text) < eventOrder(events[j].Text)
+	})
+
+	var lines []LyricLine
+	var current *LyricLine
+	var text strings.Builder
+	lastTime := time.Duration(0)
+
+	finish := func(end time.Duration) {
+		if current != nil && strings.TrimSpace(text.String()) != "" {
+			current.Text = strings.TrimSpace(text.String())
+			current.End = end
+			lines = append(lines, *current)
+		}
+		current = nil
+		text.Reset()
+	}
+
+	for _, event := range events {
+		at := c.TickToTime(event.Tick)
+		switch event.Text {
+		case "phrase_start":
+			finish(at)
+			current = &LyricLine{Start: at}
+			continue
+		case "phrase_end":
+			finish(at)
+			continue
+		}
+
+		syllable, joinNext, ok := cleanLyric(strings.TrimPrefix(event.Text, "lyric "))
+		if !ok {
+			continue
+		}
+		if current != nil && !hasPhrases && at-lastTime > lyricLineGap {
+			finish(lastTime)
+		}
+		if current == nil {
+			current = &LyricLine{Start: at}
+		}
+		text.WriteString(syllable)
+		if !joinNext {
+			text.WriteString(" ")
+		}
+		lastTime = at
+	}
+	finish(lastTime)
+	return lines
+}
+
+// eventOrder returns the sort priority of a lyric event at a shared tick
+func eventOrder(text string) int {
+	if order, ok := lyricEventOrder[text]; ok {
+		return order
+	}
+	return 2
+}
+
+// cleanLyric strips the vocal markup from a lyric syllable. joinNext reports whether
+// the syllable continues into the next one without a space; ok is false for syllables
+// that are never shown (pitch slides).
+func cleanLyric(syllable string) (text string, joinNext bool, ok bool) {
+	syllable = strings.TrimSpace(syllable)
+	if syllable == "" || syllable == "+" {
+		return "", false, false
+	}
+
+	switch {
+	case strings.HasSuffix(syllable, "-"):
+		joinNext = true
+		syllable = strings.TrimSuffix(syllable, "-")
+	case strings.HasSuffix(syllable, "="):
+		// "=" is a hyphen that stays visible
+		joinNext = true
+		syllable = strings.TrimSuffix(syllable, "=") + "-"
+	}
+	syllable = strings.NewReplacer("#", "", "^", "", "*", "", "%", "", "/", "", "$", "", "+", "", "§", " ", "_", " ").Replace(syllable)
+	if syllable == "" {
+		return "", false, false
+	}
+	return syllable, joinNext, true
+}
+
+// lyricsDocument is the JSON representation of a song's lyrics
+type lyricsDocument struct {
+	SchemaVersion int               `json:"schema_version"`
+	Name          string            `json:"name"`
+	Artist        string            `json:"artist"`
+	Lines         []lyricLineRecord `json:"lines"`
+}
+
+// lyricLineRecord is a single line in lyricsDocument
+type lyricLineRecord struct {
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
+func runLyrics(cmd *cobra.Command, args []string) error {
+	if outputFormat != FormatLRC {
+		if err := validateFormat(outputFormat); err != nil {
+			return err
+		}
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("lyrics needs a local library")
+	}
+
+	song, _, err := selectSong(args)
+	if err != nil {
+		return err
+	}
+	chart, err := loadSongChart(song)
+	if err != nil {
+		return err
+	}
+	lines := chart.LyricLines()
+	if len(lines) == 0 {
+		return fmt.Errorf("%s - %s has no lyrics", song.Artist, song.Name)
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	switch outputFormat {
+	case FormatLRC:
+		writeLRC(writer, song, lines)
+	case FormatJSON, FormatNDJSON:
+		doc := lyricsDocument{SchemaVersion: SchemaVersion, Name: song.Name, Artist: song.Artist, Lines: []lyricLineRecord{}}
+		for _, line := range lines {
+			doc.Lines = append(doc.Lines, lyricLineRecord{StartMs: line.Start.Milliseconds(), EndMs: line.End.Milliseconds(), Text: line.Text})
+		}
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(doc)
+	default:
+		fmt.Fprintf(writer, "%s - %s\n\n", song.Artist, song.Name)
+		for _, line := range lines {
+			fmt.Fprintf(writer, "%10s  %s\n", formatMillis(line.Start.Milliseconds()), line.Text)
+		}
+	}
+	return nil
+}
+
+// writeLRC writes lyrics in the .lrc format
+func writeLRC(w io.Writer, song *Song, lines []LyricLine) {
+	fmt.Fprintf(w, "[ti:%s]\n[ar:%s]\n", song.Name, song.Artist)
+	if song.Album != "" {
+		fmt.Fprintf(w, "[al:%s]\n", song.Album)
+	}
+	if song.Length > 0 {
+		fmt.Fprintf(w, "[length:%s]\n", formatClock(song.Length))
+	}
+	for _, line := range lines {
+		fmt.Fprintf(w, "%s%s\n", lrcTimestamp(line.Start), line.Text)
+	}
+}
+
+// lrcTimestamp formats a time as an .lrc [mm:ss.xx] tag
+func lrcTimestamp(d time.Duration) string {
+	hundredths := d.Milliseconds() / 10
+	return fmt.Sprintf("[%02d:%02d.%02d]", hundredths/6000, (hundredths/100)%60, hundredths%100)
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -14,64 +20,439 @@ var (
 		Long:  "A CLI tool to search and filter Clone Hero song charts. If no directory is specified, uses the current directory.",
 		Args:  cobra.NoArgs,
 		RunE:  run,
+
+		// main reports errors itself, and usage is noise for runtime failures
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
 	// Flags
-	directory     string
+	directories   []string
+	directory     string // the first of directories, for commands that work on one library
 	outputFile    string
+	outputFormat  string
+	lengthSource  string
 	countOnly     bool
-	filterName    string
-	filterArtist  string
-	filterGenre   string
-	filterCharter string
-	filterYear    int
+	filterName    []string
+	filterArtist  []string
+	filterPrimary []string
+	filterFeat    []string
+	filterGenre   []string
+	filterCharter []string
+	filterYear    []int
 	filterLength  string
 	filterInst    string
+	filterHasDiff string
+	filterNoDiff  string
+	filterFile    string
+	filterPreset  []string
 	sortBy        string
+	noHighlight   bool
+	readOnly      bool
+	networkMode   bool
+	xlsxFile      string
+	xlsxByGenre   bool
+	scoresFile    string
+	player        string
+	columnList    []string
 )
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&directory, "directory", "d", ".", "Directory to recursively search for songs (default: current directory)")
+	rootCmd.PersistentFlags().StringArrayVarP(&directories, "directory", "d", []string{"."}, "Directory to recursively search for songs (default: current directory); repeat it, or separate directories with ':' (';' on Windows), to search several libraries at once")
 	rootCmd.PersistentFlags().StringVarP(&outputFile, "output", "o", "", "Write results to file instead of stdout")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "format", "f", FormatText, "Output format (text, table, json, ndjson, csv, tsv)")
+	rootCmd.Flags().StringSliceVarP(&columnList, "columns", "", nil, "Comma-separated columns for csv, tsv and --xlsx output (default: name, artist, album, genre, year, charter, length, instruments, path)")
 	rootCmd.PersistentFlags().BoolVarP(&countOnly, "count", "c", false, "Only return count of matching songs")
-	rootCmd.PersistentFlags().StringVarP(&filterName, "name", "n", "", "Filter by song name (fuzzy matching)")
-	rootCmd.PersistentFlags().StringVarP(&filterArtist, "artist", "a", "", "Filter by artist")
-	rootCmd.PersistentFlags().StringVarP(&filterGenre, "genre", "g", "", "Filter by genre")
-	rootCmd.PersistentFlags().StringVarP(&filterCharter, "charter", "", "", "Filter by charter")
-	rootCmd.PersistentFlags().IntVarP(&filterYear, "year", "y", 0, "Filter by year")
+	rootCmd.PersistentFlags().StringArrayVarP(&filterName, "name", "n", nil, "Filter by song name (fuzzy matching); repeat to match any of several names")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterArtist, "artist", "a", nil, "Filter by artist; comma-separated or repeated to match any of several")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterPrimary, "primary-artist", "", nil, "Filter by primary artist, ignoring featured artists (exact, case-insensitive); comma-separated or repeated to match any of several")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterFeat, "featured", "", nil, "Filter by featured artist (e.g. the \"B\" in \"A feat. B\"); comma-separated or repeated to match any of several")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterGenre, "genre", "g", nil, "Filter by genre; comma-separated or repeated to match any of several")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterCharter, "charter", "", nil, "Filter by charter; comma-separated or repeated to match any of several")
+	rootCmd.PersistentFlags().IntSliceVarP(&filterYear, "year", "y", nil, "Filter by year; comma-separated or repeated to match any of several")
 	rootCmd.PersistentFlags().StringVarP(&filterLength, "length", "l", "", "Filter by song length (e.g., '>5:00' or '<3:30')")
-	rootCmd.PersistentFlags().StringVarP(&filterInst, "instrument", "i", "", "Filter by instrument (guitar, drums, bass, etc.)")
-	rootCmd.PersistentFlags().StringVarP(&sortBy, "sort", "s", "", "Sort by field (name, artist, year, length, genre, charter)")
+	rootCmd.PersistentFlags().StringVarP(&filterInst, "instrument", "i", "", "Filter by instrument (guitar, drums, bass, etc., or proguitar, probass, prokeys), or by a raw song.ini key such as diff_vocals")
+	rootCmd.PersistentFlags().StringVarP(&filterHasDiff, "has-difficulty", "", "", "Only songs with this difficulty charted in the notes file (easy, medium, hard, expert); per --instrument if given")
+	rootCmd.PersistentFlags().StringVarP(&filterNoDiff, "missing-difficulty", "", "", "Only songs where a charted instrument (or --instrument) lacks this difficulty in the notes file")
+	rootCmd.PersistentFlags().BoolVarP(&noHighlight, "no-highlight", "", false, "Don't highlight the parts of each field that matched a filter")
+	rootCmd.PersistentFlags().BoolVarP(&readOnly, "read-only", "", false, "Refuse to run any command that would modify the song library")
+	rootCmd.PersistentFlags().BoolVarP(&networkMode, "network", "", false, "Optimize scanning for network filesystems (SMB/NFS): batched reads, no media file hashing, retries on I/O errors")
+	rootCmd.Flags().StringVarP(&xlsxFile, "xlsx", "", "", "Export matching songs to an Excel workbook (.xlsx)")
+	rootCmd.Flags().BoolVarP(&xlsxByGenre, "xlsx-by-genre", "", false, "Add one worksheet per genre to the --xlsx export")
+	rootCmd.PersistentFlags().StringVarP(&filterFile, "filter-file", "", "", "Read additional filter criteria from a YAML/JSON file ('-' for stdin)")
+	rootCmd.PersistentFlags().StringSliceVarP(&filterPreset, "preset", "", nil, "Add the criteria of a filter preset saved in the config file (repeatable)")
+	rootCmd.PersistentFlags().StringVarP(&lengthSource, "length-source", "", LengthSourceIni, "Where song lengths come from for filtering, sorting and output (ini, audio, chart)")
+	rootCmd.PersistentFlags().StringVarP(&scoresFile, "scores-file", "", "", "Path to Clone Hero's scoredata.bin (default: found in the Clone Hero data folder)")
+	rootCmd.PersistentFlags().StringVarP(&player, "player", "", "", "Use the scores of this Clone Hero profile")
+	rootCmd.PersistentFlags().StringVarP(&sortBy, "sort", "s", "", "Sort by field (name, artist, album, year, length, genre, charter, score, relevance), or none for library order (default: artist, then name)")
 }
 
 func run(cmd *cobra.Command, args []string) error {
-	// Initialize scanner
-	scanner := NewScanner(directory)
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+	columns, err := selectColumns(columnList)
+	if err != nil {
+		return err
+	}
+	if err := validateCountBy(); err != nil {
+		return err
+	}
+	if countBy != "" {
+		countOnly = true
+	}
+	recordSearch(os.Args[1:])
 
+	total, filteredSongs, filter, err := searchLibrary()
+	if err != nil {
+		return err
+	}
+	diff := compareWithLastRun(filter.Spec(), filteredSongs)
+	if showLinks && !countOnly {
+		if err := addPermalinks(filteredSongs); err != nil {
+			return err
+		}
+	}
+	if showQR {
+		return printQR(filteredSongs)
+	}
+
+	if exportSetlistFile != "" {
+		written, err := exportSetlist(exportSetlistFile, filteredSongs)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", exportSetlistFile, err)
+		}
+		if isCI() {
+			emitEvent("output", map[string]any{"count": written, "total": total, "path": exportSetlistFile})
+			return nil
+		}
+		fmt.Printf("Wrote %d song(s) to %s\n", written, exportSetlistFile)
+		return nil
+	}
+
+	if xlsxFile != "" {
+		if err := WriteXLSX(xlsxFile, filteredSongs, columns, xlsxByGenre); err != nil {
+			return fmt.Errorf("failed to write %s: %w", xlsxFile, err)
+		}
+		if isCI() {
+			emitEvent("output", map[string]any{"count": len(filteredSongs), "total": total, "path": xlsxFile})
+			return nil
+		}
+		fmt.Printf("Wrote %d song(s) to %s\n", len(filteredSongs), xlsxFile)
+		return nil
+	}
+
+	// In CI mode stdout carries events only; the songs themselves are events too unless
+	// they go to a file or stdout is reserved for --porcelain output
+	if isCI() && outputFile == "" && !porcelainMode() {
+		if !countOnly {
+			emitSongEvents(filteredSongs)
+		}
+		if countBy != "" {
+			emitEvent("output", map[string]any{"count": len(filteredSongs), "total": total, "by": countBy, "groups": countGroups(filteredSongs, countBy)})
+			return nil
+		}
+		emitEvent("output", map[string]any{"count": len(filteredSongs), "total": total})
+		return nil
+	}
+
+	// Output
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	format := outputFormat
+	if porcelainMode() {
+		format = FormatPorcelain
+	}
+	output := NewOutput(writer, format, countOnly)
+	if !noHighlight {
+		output.Highlight(filter)
+	}
+	if diff != nil {
+		output.ShowDiff(diff)
+	}
+	output.SetColumns(columns)
+	output.CountBy(countBy)
+	if err := output.Write(total, filteredSongs); err != nil {
+		return err
+	}
+	emitEvent("output", map[string]any{"count": len(filteredSongs), "total": total, "path": outputFile})
+	return nil
+}
+
+// loadFilteredSongs loads the library and applies the filter and sort flags shared by
+// every command, returning all songs, the matching songs and the filter used
+func loadFilteredSongs() ([]*Song, []*Song, *Filter, error) {
+	scanners, err := newLibraryScanners()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	spec, err := buildFilterSpec()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return filterLibrary(scanners, spec)
+}
+
+// filterLibrary is loadFilteredSongs for the given scanners and filter spec
+func filterLibrary(scanners []*Scanner, spec FilterSpec) ([]*Song, []*Song, *Filter, error) {
 	// Load songs (with caching)
-	songs, err := scanner.LoadSongs()
+	songs, err := loadLibraryWith(scanners)
 	if err != nil {
-		return fmt.Errorf("failed to load songs: %w", err)
+		return nil, nil, nil, err
 	}
 
 	// Apply filters
-	filter := NewFilter(filterName, filterArtist, filterGenre, filterCharter, filterYear, filterLength, filterInst)
+	if err := validateFilterSpec(spec); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateInstrumentSource(instrumentSource); err != nil {
+		return nil, nil, nil, err
+	}
+	if spec.readsCharts() {
+		if err := loadChartedDifficulties(songs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if spec.usesScores() || strings.EqualFold(sortBy, sortScore) {
+		if err := loadSongScores(songs); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	filter, err := NewFilter(spec)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	filteredSongs := filter.Apply(songs)
+	matched := len(filteredSongs)
+	emitEvent("filter", map[string]any{"matched": matched, "total": len(songs)})
 
-	// Sort
-	if sortBy != "" {
-		sorter := NewSorter(sortBy)
-		sorter.Sort(filteredSongs)
+	// Sort; without --sort songs are ordered by artist and name (by path in CI mode) so
+	// the output is the same on every machine
+	if sortBy == "" && isCI() {
+		sortByPath(filteredSongs)
+	} else {
+		NewSorter(sortBy).RankBy(spec.nameQueries()).Sort(filteredSongs)
 	}
+	filteredSongs = limitSongs(filteredSongs)
+	recordFilterSummary(matched, len(filteredSongs), len(songs))
 
-	// Output
-	output := NewOutput(outputFile, countOnly)
-	return output.Write(songs, filteredSongs)
+	return songs, filteredSongs, filter, nil
+}
+
+// validateFilterSpec checks the difficulty names and intro lengths of a spec and its
+// nested clauses
+func validateFilterSpec(spec FilterSpec) error {
+	for _, name := range spec.difficultyFilters() {
+		if _, err := parseDifficulty(name); err != nil {
+			return err
+		}
+	}
+	for _, value := range spec.introFilters() {
+		if _, err := parseIntro(value); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range spec.pathFilters() {
+		if err := validatePath(pattern); err != nil {
+			return err
+		}
+	}
+	for _, value := range spec.rootFilters() {
+		if err := validateRoot(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readsCharts reports whether filtering on the spec needs the notes files read. GHL, pro
+// and instrument filters fall back to song.ini for cloud libraries, whose notes files
+// aren't read.
+func (spec FilterSpec) readsCharts() bool {
+	usesChart := spec.usesGHL() || spec.usesPro() || instrumentSource == InstrumentSourceChart
+	return len(spec.difficultyFilters()) > 0 || len(spec.introFilters()) > 0 || spec.usesTechniques() ||
+		(usesChart && !anyRemoteLibrary())
+}
+
+// loadLibrary scans (or loads from cache) every song in the libraries
+func loadLibrary() ([]*Song, error) {
+	scanners, err := newLibraryScanners()
+	if err != nil {
+		return nil, err
+	}
+	return loadLibraryWith(scanners)
+}
+
+// loadLibraryWith is loadLibrary for the given scanners, one per library, which are
+// scanned at the same time
+func loadLibraryWith(scanners []*Scanner) ([]*Song, error) {
+	limits, err := cacheLimits()
+	if err != nil {
+		return nil, err
+	}
+	warnNestedLibraries()
+	songs, scans, err := scanLibraries(scanners)
+	if err != nil {
+		return nil, err
+	}
+	for _, scan := range scans {
+		if len(scan.songs) == 0 && !isRemoteLocation(scan.scanner.rootDir) {
+			warnEmptyLibrary(scan.scanner.rootDir)
+		}
+	}
+	writeScanSummary(scans)
+	if err := applyLengthSource(songs, lengthSource); err != nil {
+		return nil, err
+	}
+	pruneCaches(limits, scanners...)
+	for _, scan := range scans {
+		event := map[string]any{"directory": scan.scanner.rootDir, "songs": len(scan.songs), "errors": len(scan.scanner.Errors())}
+		if scan.scanner.moved > 0 {
+			event["moved"] = scan.scanner.moved
+		}
+		emitEvent("scan", event)
+	}
+	return songs, nil
+}
+
+// buildFilterSpec combines the filter flags with the criteria from --filter-file, if
+// any; songs must match both
+func buildFilterSpec() (FilterSpec, error) {
+	spec := FilterSpec{
+		Length:            filterLength,
+		Instrument:        filterInst,
+		HasDifficulty:     filterHasDiff,
+		MissingDifficulty: filterNoDiff,
+	}
+	ghl, err := ghlFilter()
+	if err != nil {
+		return FilterSpec{}, err
+	}
+	spec.GHL = ghl
+	if spec.Played, spec.FC, err = scoreFilters(); err != nil {
+		return FilterSpec{}, err
+	}
+	anyOf(&spec, trimValues(filterName), func(s *FilterSpec, v string) { s.Name = v })
+	anyOf(&spec, trimValues(filterArtist), func(s *FilterSpec, v string) { s.Artist = v })
+	anyOf(&spec, trimValues(filterPrimary), func(s *FilterSpec, v string) { s.PrimaryArtist = v })
+	anyOf(&spec, trimValues(filterFeat), func(s *FilterSpec, v string) { s.Featured = v })
+	anyOf(&spec, trimValues(filterGenre), func(s *FilterSpec, v string) { s.Genre = v })
+	anyOf(&spec, trimValues(filterCharter), func(s *FilterSpec, v string) { s.Charter = v })
+	anyOf(&spec, filterYear, func(s *FilterSpec, v int) { s.Year = v })
+	anyOf(&spec, trimValues(filterPath), func(s *FilterSpec, v string) { s.Path = v })
+	anyOf(&spec, trimValues(filterRoot), func(s *FilterSpec, v string) { s.Root = v })
+	if filterMaxPlays >= 0 {
+		spec.MaxPlays = &filterMaxPlays
+	}
+	if filterMaxRating < 0 {
+		return FilterSpec{}, fmt.Errorf("--max-rating can't be negative")
+	}
+	spec.MaxRating = filterMaxRating
+	spec.Pro = filterPro
+	spec.MaxIntro = filterMaxIntro
+	spec.NoOpens = filterNoOpens
+	spec.NoTaps = filterNoTaps
+	if spec.Not, err = exclusionFilters(); err != nil {
+		return FilterSpec{}, err
+	}
+
+	if filterFile != "" {
+		fileSpec, err := LoadFilterSpec(filterFile)
+		if err != nil {
+			return FilterSpec{}, err
+		}
+		spec.All = append(spec.All, fileSpec)
+	}
+	for _, name := range trimValues(filterPreset) {
+		preset, ok := userConfig.Presets[name]
+		if !ok {
+			return FilterSpec{}, fmt.Errorf("unknown --preset %q (available: %s)", name, strings.Join(presetNames(), ", "))
+		}
+		spec.All = append(spec.All, preset)
+	}
+
+	return spec, nil
+}
+
+// anyOf sets a filter from the values of a flag that can be given several times: the
+// spec itself for a single value, or a nested "any" clause with an alternative per value.
+// Empty values are ignored.
+func anyOf[T comparable](spec *FilterSpec, values []T, set func(*FilterSpec, T)) {
+	var zero T
+	var kept []T
+	for _, value := range values {
+		if value != zero {
+			kept = append(kept, value)
+		}
+	}
+	if len(kept) == 1 {
+		set(spec, kept[0])
+		return
+	}
+	var clause FilterSpec
+	for _, value := range kept {
+		var alternative FilterSpec
+		set(&alternative, value)
+		clause.Any = append(clause.Any, alternative)
+	}
+	if len(clause.Any) > 0 {
+		spec.All = append(spec.All, clause)
+	}
+}
+
+// trimValues trims the spaces around each value of a comma-separated flag
+func trimValues(values []string) []string {
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+	}
+	return trimmed
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	started := time.Now()
+	args := os.Args[1:]
+	if config, err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring the config file: %v\n", err)
+	} else {
+		userConfig = config
+		if args, err = expandAliases(args, config.Aliases); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	rootCmd.SetArgs(args)
+
+	// The first Ctrl-C cancels the command's context so scans and file operations can
+	// stop cleanly; a second one kills the program as usual
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	runContext = ctx
+
+	cmd, err := rootCmd.ExecuteContextC(ctx)
+	stopPager()
+	// Edits made before a failure or interruption are on disk all the same
+	applyLibraryEdits()
+	if ctx.Err() != nil {
+		err = errInterrupted
+	}
+	stop()
+	if err != nil {
+		emitEvent("error", map[string]any{"message": err.Error()})
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	printSummary(cmd, err)
+	recordUsage(cmd, err, started)
+	if err != nil {
+		if errors.Is(err, errInterrupted) {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
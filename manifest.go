@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Write a JSON manifest of every song folder and its files",
+	Long:  "Write a JSON manifest listing each matching song with the files in its folder and their sizes. Works for local libraries and cloud libraries (s3://, b2://, webdav://) without downloading any audio.",
+	Args:  cobra.NoArgs,
+	RunE:  runManifest,
+}
+
+func init() {
+	rootCmd.AddCommand(manifestCmd)
+}
+
+// Manifest describes the contents of a library
+type Manifest struct {
+	SchemaVersion int             `json:"schema_version"`
+	Root          string          `json:"root"`
+	Generated     time.Time       `json:"generated"`
+	TotalSize     int64           `json:"total_size"`      // in bytes
+	TotalSizeText string          `json:"total_size_text"` // total_size as "1.2 GB"
+	Songs         []ManifestEntry `json:"songs"`
+}
+
+// ManifestEntry describes one song folder in a Manifest
+type ManifestEntry struct {
+	Name     string         `json:"name"`
+	Artist   string         `json:"artist"`
+	Album    string         `json:"album,omitempty"`
+	Charters []string       `json:"charters,omitempty"`
+	Path     string         `json:"path"`
+	Size     int64          `json:"size"`      // in bytes
+	SizeText string         `json:"size_text"` // size as "1.2 GB"
+	Files    []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a single file within a song folder
+type ManifestFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+func runManifest(cmd *cobra.Command, args []string) error {
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	_, filteredSongs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	var folderFiles func(song *Song) ([]ManifestFile, error)
+	if isRemoteLocation(directory) {
+		folderFiles, err = remoteFolderFiles(directory)
+		if err != nil {
+			return err
+		}
+	} else {
+		folderFiles = localFolderFiles
+	}
+
+	manifest := Manifest{SchemaVersion: SchemaVersion, Root: directory, Generated: time.Now().UTC()}
+	for _, song := range filteredSongs {
+		files, err := folderFiles(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list %s: %v\n", song.Path, err)
+			continue
+		}
+
+		entry := ManifestEntry{
+			Name:     song.Name,
+			Artist:   song.Artist,
+			Album:    song.Album,
+			Charters: song.Charters,
+			Path:     song.Path,
+			Files:    files,
+		}
+		for _, file := range files {
+			entry.Size += file.Size
+		}
+		entry.SizeText = formatSize(entry.Size)
+		manifest.TotalSize += entry.Size
+		manifest.Songs = append(manifest.Songs, entry)
+	}
+	manifest.TotalSizeText = formatSize(manifest.TotalSize)
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// localFolderFiles lists the files next to a local song's song.ini, or the files packed
+// in its .sng file
+func localFolderFiles(song *Song) ([]ManifestFile, error) {
+	if song.Packed {
+		return packedFiles(song)
+	}
+	entries, err := os.ReadDir(filepath.Dir(song.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []ManifestFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, ManifestFile{Name: entry.Name(), Size: info.Size(), Modified: info.ModTime().UTC()})
+	}
+	return files, nil
+}
+
+// packedFiles lists the files packed in a song's .sng file, which all share its
+// modification time
+func packedFiles(song *Song) ([]ManifestFile, error) {
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := OpenSng(song.Path)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]ManifestFile, len(archive.Files))
+	for i, file := range archive.Files {
+		files[i] = ManifestFile{Name: file.Name, Size: file.Size, Modified: info.ModTime().UTC()}
+	}
+	return files, nil
+}
+
+// remoteFolderFiles lists a cloud library once and returns a lookup of the files next
+// to each song's song.ini
+func remoteFolderFiles(location string) (func(song *Song) ([]ManifestFile, error), error) {
+	backend, err := NewRemoteBackend(location)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := backend.List(commandContext())
+	if err := interrupted(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", location, err)
+	}
+
+	folders := make(map[string][]ManifestFile)
+	for _, obj := range objects {
+		dir := remoteDir(backend.URL(obj.Key))
+		folders[dir] = append(folders[dir], ManifestFile{Name: path.Base(obj.Key), Size: obj.Size, Modified: obj.ModTime.UTC()})
+	}
+	for _, files := range folders {
+		sort.Slice(files, func(i, j int) bool { return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name) })
+	}
+
+	return func(song *Song) ([]ManifestFile, error) {
+		return folders[remoteDir(song.Path)], nil
+	}, nil
+}
+
+// remoteDir returns the folder part of a remote file URL. path.Dir can't be used since
+// it would collapse the "//" after the scheme.
+func remoteDir(fileURL string) string {
+	if idx := strings.LastIndex(fileURL, "/"); idx >= 0 {
+		return fileURL[:idx]
+	}
+	return fileURL
+}
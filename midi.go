@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// midiTracks maps MIDI track names to the instrument part of .chart track names
+var midiTracks = map[string]string{
+	"PART GUITAR":      "Single",
+	"T1 GEMS":          "Single",
+	"PART GUITAR COOP": "DoubleGuitar",
+	"PART RHYTHM":      "DoubleRhythm",
+	"PART BASS":        "DoubleBass",
+	"PART DRUMS":       "Drums",
+	"PART KEYS":        "Keyboard",
+	"PART GUITAR GHL":  "GHLGuitar",
+	"PART BASS GHL":    "GHLBass",
+	// Pro (real) instruments, only found in MIDI charts
+	"PART REAL_GUITAR":    "ProGuitar",
+	"PART REAL_GUITAR_22": "ProGuitar",
+	"PART REAL_BASS":      "ProBass",
+	"PART REAL_BASS_22":   "ProBass",
+	"PART REAL_KEYS_E":    "ProKeys",
+	"PART REAL_KEYS_M":    "ProKeys",
+	"PART REAL_KEYS_H":    "ProKeys",
+	"PART REAL_KEYS_X":    "ProKeys",
+}
+
+// midiProKeysDifficulties gives the difficulty of each pro keys track; unlike other
+// parts, pro keys has a track per difficulty
+var midiProKeysDifficulties = map[string]string{
+	"PART REAL_KEYS_E": "Easy",
+	"PART REAL_KEYS_M": "Medium",
+	"PART REAL_KEYS_H": "Hard",
+	"PART REAL_KEYS_X": "Expert",
+}
+
+// midiProGuitarBases is the note number of the low E string of each pro guitar and bass
+// difficulty; the six strings are consecutive notes
+var midiProGuitarBases = map[string]int{"Easy": 24, "Medium": 48, "Hard": 72, "Expert": 96}
+
+// Pro keys notes span two octaves from C3
+const (
+	midiProKeysLow  = 48
+	midiProKeysHigh = 72
+)
+
+// MIDI notes marking vocal phrases on PART VOCALS
+const (
+	midiPhraseNote        = 105
+	midiPhraseNotePlayer2 = 106
+)
+
+// midiDifficultyBases is the lowest five-fret note number of each difficulty
+var midiDifficultyBases = map[string]int{"Easy": 60, "Medium": 72, "Hard": 84, "Expert": 96}
+
+var errInvalidMidi = errors.New("invalid MIDI file")
+
+// ParseMidi reads the tempo map and note tracks of a notes.mid file, converting the
+// instrument tracks to their .chart equivalents
+func ParseMidi(path string) (*Chart, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MIDI file: %w", err)
+	}
+	return parseMidiData(path, data)
+}
+
+// parseMidiData is ParseMidi for the contents of a MIDI file
+func parseMidiData(path string, data []byte) (*Chart, error) {
+	if len(data) < 14 || string(data[0:4]) != "MThd" {
+		return nil, errInvalidMidi
+	}
+
+	headerLength := int(binary.BigEndian.Uint32(data[4:8]))
+	division := binary.BigEndian.Uint16(data[12:14])
+	if division&0x8000 != 0 {
+		return nil, fmt.Errorf("SMPTE time division is not supported")
+	}
+
+	chart := &Chart{Path: path, Resolution: int(division), Tracks: make(map[string][]ChartNote)}
+	pos := 8 + headerLength
+	for pos+8 <= len(data) {
+		chunkLength := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		start := pos + 8
+		end := start + chunkLength
+		if end > len(data) {
+			end = len(data)
+		}
+		if string(data[pos:pos+4]) == "MTrk" {
+			if err := chart.readMidiTrack(data[start:end]); err != nil {
+				return nil, err
+			}
+		}
+		pos = start + chunkLength
+	}
+
+	chart.sortEvents()
+	return chart, nil
+}
+
+// midiNote is a note-on matched with its note-off
+type midiNote struct {
+	tick   int64
+	length int64
+	note   int
+}
+
+// readMidiTrack reads the events of a single MTrk chunk
+func (c *Chart) readMidiTrack(track []byte) error {
+	var tick int64
+	var status byte
+	name := ""
+	open := make(map[int]int64) // note number -> start tick
+	var notes []midiNote
+	var texts []ChartEvent
+
+	pos := 0
+	for pos < len(track) {
+		delta, n := readVarInt(track[pos:])
+		if n == 0 {
+			return errInvalidMidi
+		}
+		pos += n
+		tick += int64(delta)
+		if pos >= len(track) {
+			return errInvalidMidi
+		}
+
+		if track[pos]&0x80 != 0 {
+			status = track[pos]
+			pos++
+		} else if status == 0 {
+			return errInvalidMidi
+		}
+
+		switch {
+		case status == 0xFF:
+			if pos >= len(track) {
+				return errInvalidMidi
+			}
+			metaType := track[pos]
+			length, n := readVarInt(track[pos+1:])
+			pos += 1 + n
+			if pos+int(length) > len(track) {
+				return errInvalidMidi
+			}
+			payload := track[pos : pos+int(length)]
+			pos += int(length)
+
+			switch metaType {
+			case 0x01, 0x05:
+				texts = append(texts, ChartEvent{Tick: tick, Text: string(bytes.TrimSpace(payload))})
+			case 0x03:
+				if name == "" {
+					name = string(bytes.TrimSpace(payload))
+				}
+			case 0x51:
+				if len(payload) == 3 {
+					micros := float64(int(payload[0])<<16 | int(payload[1])<<8 | int(payload[2]))
+					c.Tempos = append(c.Tempos, TempoEvent{Tick: tick, MicrosPerBeat: micros})
+				}
+			}
+			// Meta and sysex events cancel running status
+			status = 0
+		case status == 0xF0 || status == 0xF7:
+			length, n := readVarInt(track[pos:])
+			pos += n + int(length)
+			status = 0
+		default:
+			dataBytes := 2
+			if kind := status & 0xF0; kind == 0xC0 || kind == 0xD0 {
+				dataBytes = 1
+			}
+			if pos+dataBytes > len(track) {
+				return errInvalidMidi
+			}
+			kind := status & 0xF0
+			note := int(track[pos])
+			velocity := 0
+			if dataBytes == 2 {
+				velocity = int(track[pos+1])
+			}
+			pos += dataBytes
+
+			switch {
+			case kind == 0x90 && velocity > 0:
+				open[note] = tick
+			case kind == 0x80 || kind == 0x90:
+				if start, ok := open[note]; ok {
+					notes = append(notes, midiNote{tick: start, length: tick - start, note: note})
+					delete(open, note)
+				}
+			}
+		}
+	}
+
+	switch strings.ToUpper(name) {
+	case "EVENTS":
+		// Global events are written as "[section Intro]"; store them the way .chart does
+		for _, text := range texts {
+			text.Text = strings.TrimSuffix(strings.TrimPrefix(text.Text, "["), "]")
+			c.Events = append(c.Events, text)
+		}
+		return nil
+	case "PART VOCALS":
+		c.addMidiVocals(texts, notes)
+		return nil
+	}
+
+	instrument, ok := midiTracks[strings.ToUpper(name)]
+	if !ok {
+		return nil
+	}
+	keysDifficulty := midiProKeysDifficulties[strings.ToUpper(name)]
+	inst := chartTrackInstruments[instrument]
+	markers := make(map[string]*midiMarkers)
+	enhancedOpens := false
+	for _, text := range texts {
+		enhancedOpens = enhancedOpens || strings.Trim(text.Text, "[]") == "ENHANCED_OPENS"
+	}
+
+	// Short MIDI notes are taps, not sustains
+	sustainCutoff := int64(c.Resolution / 3)
+	for _, note := range notes {
+		if hasHOPOs(inst) && addMidiMarker(markers, note) {
+			continue
+		}
+		difficulty, fret, ok := midiNoteLane(instrument, note.note)
+		if !ok && enhancedOpens {
+			difficulty, ok = midiOpenLane(instrument, note.note)
+			fret = chartOpenFret
+		}
+		if !ok {
+			continue
+		}
+		if instrument == "ProKeys" {
+			difficulty = keysDifficulty
+		}
+		length := note.length
+		if length <= sustainCutoff {
+			length = 0
+		}
+		section := difficulty + instrument
+		c.Tracks[section] = append(c.Tracks[section], ChartNote{Tick: note.tick, Fret: fret, Length: length})
+	}
+	for difficulty, m := range markers {
+		c.addMidiModifiers(inst, difficulty+instrument, m)
+	}
+	return nil
+}
+
+// midiOpenLane returns the difficulty of an open note of a five-fret track with enhanced
+// opens, which are charted one note below green
+func midiOpenLane(instrument string, note int) (string, bool) {
+	switch instrument {
+	case "Drums", "GHLGuitar", "GHLBass", "ProGuitar", "ProBass", "ProKeys":
+		return "", false
+	}
+	for difficulty, base := range midiDifficultyBases {
+		if note == base-1 {
+			return difficulty, true
+		}
+	}
+	return "", false
+}
+
+// midiTapNote marks the tap notes of five- and six-fret parts, on every difficulty
+const midiTapNote = 104
+
+// midiMarkers are the notes of one difficulty of a five- or six-fret MIDI track that
+// change how the notes they cover are played
+type midiMarkers struct {
+	hopo  []midiNote // force HOPO
+	strum []midiNote // force strum
+	tap   []midiNote
+}
+
+// addMidiMarker records note in markers if it's a force HOPO, force strum or tap marker,
+// and reports whether it was one
+func addMidiMarker(markers map[string]*midiMarkers, note midiNote) bool {
+	markersFor := func(difficulty string) *midiMarkers {
+		if markers[difficulty] == nil {
+			markers[difficulty] = &midiMarkers{}
+		}
+		return markers[difficulty]
+	}
+	if note.note == midiTapNote {
+		for difficulty := range midiDifficultyBases {
+			m := markersFor(difficulty)
+			m.tap = append(m.tap, note)
+		}
+		return true
+	}
+	for difficulty, base := range midiDifficultyBases {
+		switch note.note - base {
+		case 5:
+			m := markersFor(difficulty)
+			m.hopo = append(m.hopo, note)
+			return true
+		case 6:
+			m := markersFor(difficulty)
+			m.strum = append(m.strum, note)
+			return true
+		}
+	}
+	return false
+}
+
+// covers reports whether a marker note applies to the notes at tick
+func (n midiNote) covers(tick int64) bool {
+	return tick == n.tick || (tick > n.tick && tick < n.tick+n.length)
+}
+
+// addMidiModifiers turns the markers of a MIDI track section into the modifier notes of
+// .chart files: forced (5) where a marker forces a note to the other of strum and HOPO,
+// and tap (6)
+func (c *Chart) addMidiModifiers(inst Instrument, section string, m *midiMarkers) {
+	notes := c.Tracks[section]
+	sort.SliceStable(notes, func(i, j int) bool { return notes[i].Tick < notes[j].Tick })
+	positions := notePositions(inst, notes)
+	threshold := c.hopoThreshold()
+	covered := func(markers []midiNote, tick int64) bool {
+		for _, marker := range markers {
+			if marker.covers(tick) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, position := range positions {
+		var prev *notePosition
+		if i > 0 {
+			prev = &positions[i-1]
+		}
+		natural := position.isHOPO(prev, threshold)
+		if (natural && covered(m.strum, position.tick)) || (!natural && covered(m.hopo, position.tick)) {
+			notes = append(notes, ChartNote{Tick: position.tick, Fret: chartForcedFret})
+		}
+		if covered(m.tap, position.tick) {
+			notes = append(notes, ChartNote{Tick: position.tick, Fret: chartTapFret})
+		}
+	}
+	c.Tracks[section] = notes
+}
+
+// addMidiVocals converts the lyrics and phrase markers of PART VOCALS to the lyric and
+// phrase events used by .chart files
+func (c *Chart) addMidiVocals(texts []ChartEvent, notes []midiNote) {
+	for _, text := range texts {
+		if strings.HasPrefix(text.Text, "[") {
+			continue
+		}
+		c.Events = append(c.Events, ChartEvent{Tick: text.Tick, Text: "lyric " + text.Text})
+	}
+	// Duets mark player 2's phrases separately; only use them when there are no others
+	phraseNote := midiPhraseNotePlayer2
+	for _, note := range notes {
+		if note.note == midiPhraseNote {
+			phraseNote = midiPhraseNote
+			break
+		}
+	}
+	for _, note := range notes {
+		if note.note == phraseNote {
+			c.Events = append(c.Events,
+				ChartEvent{Tick: note.tick, Text: "phrase_start"},
+				ChartEvent{Tick: note.tick + note.length, Text: "phrase_end"})
+		}
+	}
+}
+
+// midiNoteLane maps a MIDI note number on an instrument track to a difficulty and a
+// .chart fret number. Pro guitar and bass lanes are strings (0 for low E) and pro keys
+// lanes are keys (0 for C3); the difficulty of a pro keys note comes from its track.
+func midiNoteLane(instrument string, note int) (string, int, bool) {
+	switch instrument {
+	case "ProKeys":
+		return "", note - midiProKeysLow, note >= midiProKeysLow && note <= midiProKeysHigh
+	case "ProGuitar", "ProBass":
+		for difficulty, base := range midiProGuitarBases {
+			if lane := note - base; lane >= 0 && lane <= 5 {
+				return difficulty, lane, true
+			}
+		}
+		return "", 0, false
+	}
+
+	for difficulty, base := range midiDifficultyBases {
+		lane := note - base
+		switch instrument {
+		case "Drums":
+			if lane >= 0 && lane <= 5 {
+				return difficulty, lane, true
+			}
+			if difficulty == "Expert" && lane == -1 {
+				return difficulty, 32, true // double kick
+			}
+		case "GHLGuitar", "GHLBass":
+			switch {
+			case lane == -2:
+				return difficulty, 7, true // open
+			case lane >= -1 && lane <= 3:
+				return difficulty, lane + 1, true
+			case lane == 4:
+				return difficulty, 8, true
+			}
+		default:
+			if lane >= 0 && lane <= 4 {
+				return difficulty, lane, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// readVarInt reads a MIDI variable-length quantity, returning the value and the number
+// of bytes used (0 if the data ends early)
+func readVarInt(data []byte) (uint32, int) {
+	var value uint32
+	for i := 0; i < len(data) && i < 4; i++ {
+		value = value<<7 | uint32(data[i]&0x7F)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Songs are told apart from the songs they replace by the checksum of their notes file,
+// which Clone Hero identifies charts by: a song whose path is new but whose notes file
+// is that of a song that's gone has moved, whether it was reorganized by hand or by a
+// command such as lint --fix.
+
+// refreshChecksum computes the checksum of a song's notes file, unless the one it has
+// was computed for the notes file as it is now. Songs without a notes file have none.
+func refreshChecksum(song *Song) {
+	chart := song.Path
+	if !song.Packed {
+		var err error
+		if chart, err = findChartFile(filepath.Dir(song.Path)); err != nil {
+			song.Checksum, song.ChartModTime = "", ""
+			return
+		}
+	}
+	info, err := os.Stat(chart)
+	if err != nil {
+		song.Checksum, song.ChartModTime = "", ""
+		return
+	}
+	modTime := info.ModTime().String()
+	if song.Checksum != "" && song.ChartModTime == modTime {
+		return
+	}
+	song.Checksum, song.ChartModTime = "", ""
+	if checksum, err := songChecksum(song); err == nil {
+		song.Checksum, song.ChartModTime = checksum, modTime
+	}
+}
+
+// migrateChecksums computes the notes file checksums of songs cached before they were
+// recorded. Songs that are gone are left for the next scan; cloud libraries have no
+// notes files to read.
+func migrateChecksums(s *Scanner, cache *Cache) error {
+	if isRemoteLocation(s.rootDir) {
+		return nil
+	}
+	for i := range cache.Songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		entry := &cache.Songs[i]
+		song := &Song{Path: entry.Path, Packed: entry.Packed}
+		refreshChecksum(song)
+		entry.Checksum, entry.ChartModTime = song.Checksum, song.ChartModTime
+	}
+	return nil
+}
+
+// findMoves pairs the songs that are new since a previous scan with the songs of that
+// scan that are gone, by notes file checksum. It returns the previous path of each
+// moved song by its new path. A checksum shared by several songs that are gone, such as
+// copies of the same chart, is paired in path order.
+func findMoves(previous map[string]string, current map[string]string) map[string]string {
+	gone := make(map[string][]string)
+	for path, checksum := range previous {
+		if _, ok := current[path]; !ok && checksum != "" {
+			gone[checksum] = append(gone[checksum], path)
+		}
+	}
+	if len(gone) == 0 {
+		return nil
+	}
+	for _, paths := range gone {
+		sort.Strings(paths)
+	}
+
+	var added []string
+	for path, checksum := range current {
+		if _, ok := previous[path]; !ok && checksum != "" {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(added)
+
+	moves := make(map[string]string)
+	for _, path := range added {
+		candidates := gone[current[path]]
+		if len(candidates) == 0 {
+			continue
+		}
+		moves[path] = candidates[0]
+		gone[current[path]] = candidates[1:]
+	}
+	return moves
+}
+
+// songChecksums returns the notes file checksum of each song by path
+func songChecksums(songs []*Song) map[string]string {
+	checksums := make(map[string]string, len(songs))
+	for _, song := range songs {
+		checksums[song.Path] = song.Checksum
+	}
+	return checksums
+}
+
+// countMoves counts the songs of a rescan that were in another folder in the previous scan
+func (s *Scanner) countMoves(songs []*Song) int {
+	previous := make(map[string]string, len(s.previous))
+	for path, song := range s.previous {
+		previous[path] = song.Checksum
+	}
+	return len(findMoves(previous, songChecksums(songs)))
+}
+
+// libraryMoves are the files and folders moved by moveLibraryPath in this run, by their
+// new path, so the cache can follow them instead of rescanning
+var libraryMoves = make(map[string]string)
+
+// recordLibraryMove remembers a move about to happen, along with the mod times of the
+// folders it changes. Moves into folders that don't exist yet can't be followed, as
+// creating them changes the library in more places.
+func recordLibraryMove(src, dst string) {
+	recordLibraryEdit(src)
+	recordLibraryEdit(dst)
+	if _, ok := libraryEdits[filepath.Dir(dst)]; ok {
+		libraryMoves[dst] = src
+	}
+}
+
+// underPath reports whether path is dir or inside it, returning the part after dir
+func underPath(path, dir string) (string, bool) {
+	if path == dir {
+		return "", true
+	}
+	if rest, ok := strings.CutPrefix(path, dir+string(filepath.Separator)); ok {
+		return string(filepath.Separator) + rest, true
+	}
+	return "", false
+}
+
+// applyMoves updates a cache for the moves of this run inside the scanner's library: the
+// hash entries of everything moved are swapped for their new paths, and cached songs
+// follow their folder. edits are the mod times recorded before editing; those of moved
+// paths move along with them. It returns false when a move can't be followed, such as
+// one into or out of the library, which leaves the next search to rescan.
+func (s *Scanner) applyMoves(cache *Cache, hash *treeHash, edits map[string]string) bool {
+	for dst, src := range libraryMoves {
+		srcRel, srcErr := filepath.Rel(s.rootDir, src)
+		dstRel, dstErr := filepath.Rel(s.rootDir, dst)
+		srcInside := srcErr == nil && filepath.IsLocal(srcRel)
+		dstInside := dstErr == nil && filepath.IsLocal(dstRel)
+		if !srcInside && !dstInside {
+			continue
+		}
+		if !srcInside || !dstInside || s.inExcludedDir(src) || s.inExcludedDir(dst) {
+			return false
+		}
+
+		err := filepath.Walk(dst, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rest, _ := underPath(path, dst)
+			oldPath := src + rest
+			// Entries keep their mod time from before the move; the edits of this run
+			// are then applied to them under their new path
+			modTime, ok := edits[oldPath]
+			if ok {
+				delete(edits, oldPath)
+				edits[path] = modTime
+			} else if modTime, ok = edits[path]; !ok {
+				modTime = info.ModTime().String()
+			}
+			oldRel, _ := filepath.Rel(s.rootDir, oldPath)
+			newRel, _ := filepath.Rel(s.rootDir, path)
+			hash.toggle(oldRel, modTime)
+			hash.toggle(newRel, modTime)
+			return nil
+		})
+		if err != nil {
+			return false
+		}
+
+		for i := range cache.Songs {
+			if rest, ok := underPath(cache.Songs[i].Path, src); ok {
+				cache.Songs[i].Path = dst + rest
+			}
+		}
+	}
+	return true
+}
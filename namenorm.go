@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// nameSynonyms are words song names write in several ways, and the way they're compared
+var nameSynonyms = map[string]string{
+	"pt":   "part",
+	"pts":  "parts",
+	"&":    "and",
+	"n":    "and", // rock 'n' roll
+	"vs":   "versus",
+	"feat": "featuring",
+	"ft":   "featuring",
+}
+
+// maxRomanNumeral is the largest roman numeral read as a number; past it, words such as
+// "mix" or "civil" would be taken for numbers
+const maxRomanNumeral = 39
+
+// romanNumerals maps the roman numerals up to maxRomanNumeral to their value
+var romanNumerals = func() map[string]string {
+	numerals := make(map[string]string, maxRomanNumeral)
+	for n := 1; n <= maxRomanNumeral; n++ {
+		numeral := strings.Repeat("x", n/10) + []string{"", "i", "ii", "iii", "iv", "v", "vi", "vii", "viii", "ix"}[n%10]
+		numerals[numeral] = strconv.Itoa(n)
+	}
+	return numerals
+}()
+
+// normalizeName reduces a song name to the words it's made of, so names written
+// differently compare equal: lowercased, without punctuation, with abbreviations such as
+// "Pt." spelled out, "&" as "and" and roman numerals as digits. "2112 Pt. II" and
+// "2112 Part 2" both become "2112 part 2".
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !isWordRune(r) && r != '&'
+	})
+	normalized := words[:0]
+	for _, word := range words {
+		// "&" may be written between words without spaces, as in "R&B"
+		for _, part := range splitAmpersands(word) {
+			if synonym, ok := nameSynonyms[part]; ok {
+				part = synonym
+			} else if number, ok := romanNumerals[part]; ok {
+				part = number
+			}
+			normalized = append(normalized, part)
+		}
+	}
+	return strings.Join(normalized, " ")
+}
+
+// splitAmpersands splits "&" from the letters around it
+func splitAmpersands(word string) []string {
+	if !strings.Contains(word, "&") || word == "&" {
+		return []string{word}
+	}
+	var parts []string
+	for _, part := range strings.SplitAfter(word, "&") {
+		if text, ok := strings.CutSuffix(part, "&"); ok {
+			if text != "" {
+				parts = append(parts, text)
+			}
+			parts = append(parts, "&")
+		} else if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// nameScore scores how well query matches a song name like fuzzyScore, falling back to
+// the normalized forms of both when the name as written doesn't match
+func nameScore(name, query string) (int, bool) {
+	if score, ok := fuzzyScore(name, query); ok {
+		return score, true
+	}
+	return fuzzyScore(normalizeName(name), normalizeName(query))
+}
+
+// sameSongName reports whether two names are the same once normalized
+func sameSongName(a, b string) bool {
+	return normalizeName(a) == normalizeName(b)
+}
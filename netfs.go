@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// networkRetries is how many times a failed read is retried in network mode
+const networkRetries = 3
+
+// retryIO runs op, retrying with backoff while it fails with what looks like a transient
+// I/O error. Missing files and permission errors are returned immediately.
+func retryIO(op func() error) error {
+	var err error
+	backoff := 100 * time.Millisecond
+	for attempt := 0; attempt < networkRetries; attempt++ {
+		if err = op(); err == nil || !isTransientIOError(err) {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 4
+	}
+	return err
+}
+
+// isTransientIOError reports whether err is an I/O error worth retrying
+func isTransientIOError(err error) bool {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrInvalid) {
+		return false
+	}
+	var pathErr *fs.PathError
+	return errors.As(err, &pathErr)
+}
+
+// walkLibrary walks the scanner's root directory calling fn for every entry. In network
+// mode each directory is read with a single batched ReadDir (no per-file stat calls) and
+// transient errors are retried; directories that still can't be read are skipped with a
+// warning rather than aborting the whole scan.
+func (s *Scanner) walkLibrary(fn func(path string, d fs.DirEntry) error) error {
+	visit := fn
+	fn = func(path string, d fs.DirEntry) error {
+		if err := s.interrupted(); err != nil {
+			return err
+		}
+		if d.IsDir() && s.isExcludedDir(path) {
+			return filepath.SkipDir
+		}
+		return visit(path, d)
+	}
+
+	if !s.opts.Network {
+		return filepath.WalkDir(s.rootDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return fn(path, d)
+		})
+	}
+
+	info, err := os.Stat(s.rootDir)
+	if err != nil {
+		return err
+	}
+	return s.walkNetworkDir(s.rootDir, fs.FileInfoToDirEntry(info), fn)
+}
+
+// walkNetworkDir recursively walks dir for walkLibrary in network mode
+func (s *Scanner) walkNetworkDir(dir string, d fs.DirEntry, fn func(path string, d fs.DirEntry) error) error {
+	if err := fn(dir, d); err != nil {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	var entries []fs.DirEntry
+	err := retryIO(func() error {
+		var readErr error
+		entries, readErr = os.ReadDir(dir)
+		return readErr
+	})
+	if err != nil {
+		if dir == s.rootDir {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: skipping unreadable directory %s: %v\n", dir, err)
+		return nil
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := s.walkNetworkDir(path, entry, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultResolution is the ticks per beat assumed when a chart doesn't specify one
+const defaultResolution = 192
+
+// defaultMicrosPerBeat is the tempo (120 BPM) assumed before the first tempo event
+const defaultMicrosPerBeat = 500000
+
+// Chart holds the note data of a .chart or .mid file in a common form. MIDI tracks are
+// converted to .chart track names (e.g. "ExpertSingle") and fret numbers.
+type Chart struct {
+	Path       string
+	Resolution int          // ticks per beat
+	Tempos     []TempoEvent // sorted by tick
+	Tracks     map[string][]ChartNote
+	Events     []ChartEvent // global events (sections, lyrics, phrases), sorted by tick
+}
+
+// ChartEvent is a global text event such as "section Intro" or "lyric Hel-"
+type ChartEvent struct {
+	Tick int64
+	Text string
+}
+
+// TempoEvent is a tempo change
+type TempoEvent struct {
+	Tick          int64
+	MicrosPerBeat float64
+}
+
+// ChartNote is a single note event. Fret numbers follow the .chart format, so flags such
+// as forced (5), tap (6) and open (7) on five-fret tracks are events of their own.
+type ChartNote struct {
+	Tick   int64
+	Fret   int
+	Length int64 // sustain length in ticks
+}
+
+// chartFiles are the note files Clone Hero reads, in order of preference
+var chartFiles = []string{"notes.chart", "notes.mid"}
+
+// findChartFile returns the path of the note file in a song folder
+func findChartFile(dir string) (string, error) {
+	for _, name := range chartFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no notes.chart or notes.mid in %s", dir)
+}
+
+// LoadChart parses the note file of a song folder
+func LoadChart(dir string) (*Chart, error) {
+	path, err := findChartFile(dir)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".mid") {
+		return ParseMidi(path)
+	}
+	return ParseChart(path)
+}
+
+// ParseChart reads the tempo map and note tracks of a .chart file
+func ParseChart(path string) (*Chart, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chart: %w", err)
+	}
+	defer file.Close()
+	return parseChartReader(path, file)
+}
+
+// parseChartReader is ParseChart for a .chart file read from r
+func parseChartReader(path string, r io.Reader) (*Chart, error) {
+	chart := &Chart{Path: path, Resolution: defaultResolution, Tracks: make(map[string][]ChartNote)}
+	section := ""
+
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lines.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(lines.Text(), "\ufeff"))
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		if line == "" || line == "{" || line == "}" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		fields := strings.Fields(value)
+
+		switch section {
+		case "Song":
+			if key == "Resolution" {
+				if resolution, err := strconv.Atoi(unquoteChartValue(value)); err == nil && resolution > 0 {
+					chart.Resolution = resolution
+				}
+			}
+		case "SyncTrack":
+			// "tick = B 120000" sets the tempo in thousandths of a beat per minute
+			tick, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || len(fields) < 2 || fields[0] != "B" {
+				continue
+			}
+			milliBPM, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil || milliBPM <= 0 {
+				continue
+			}
+			chart.Tempos = append(chart.Tempos, TempoEvent{Tick: tick, MicrosPerBeat: 60e9 / milliBPM})
+		case "Events":
+			// "tick = E "section Intro""
+			tick, err := strconv.ParseInt(key, 10, 64)
+			if err != nil || len(fields) < 2 || fields[0] != "E" {
+				continue
+			}
+			text := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "E"))
+			chart.Events = append(chart.Events, ChartEvent{Tick: tick, Text: unquoteChartValue(text)})
+		default:
+			// "tick = N fret length"
+			if len(fields) < 3 || fields[0] != "N" {
+				continue
+			}
+			tick, err1 := strconv.ParseInt(key, 10, 64)
+			fret, err2 := strconv.Atoi(fields[1])
+			length, err3 := strconv.ParseInt(fields[2], 10, 64)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			chart.Tracks[section] = append(chart.Tracks[section], ChartNote{Tick: tick, Fret: fret, Length: length})
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chart: %w", err)
+	}
+
+	chart.sortEvents()
+	return chart, nil
+}
+
+// sortEvents orders the tempo map and every track by tick
+func (c *Chart) sortEvents() {
+	sort.SliceStable(c.Tempos, func(i, j int) bool { return c.Tempos[i].Tick < c.Tempos[j].Tick })
+	sort.SliceStable(c.Events, func(i, j int) bool { return c.Events[i].Tick < c.Events[j].Tick })
+	for _, notes := range c.Tracks {
+		sort.SliceStable(notes, func(i, j int) bool { return notes[i].Tick < notes[j].Tick })
+	}
+}
+
+// TickToTime converts a tick position to the time since the start of the chart, following
+// the tempo map
+func (c *Chart) TickToTime(tick int64) time.Duration {
+	resolution := float64(c.Resolution)
+	if resolution <= 0 {
+		resolution = defaultResolution
+	}
+
+	var micros float64
+	lastTick := int64(0)
+	microsPerBeat := float64(defaultMicrosPerBeat)
+	for _, tempo := range c.Tempos {
+		if tempo.Tick >= tick {
+			break
+		}
+		micros += float64(tempo.Tick-lastTick) / resolution * microsPerBeat
+		lastTick = tempo.Tick
+		microsPerBeat = tempo.MicrosPerBeat
+	}
+	micros += float64(tick-lastTick) / resolution * microsPerBeat
+	return time.Duration(micros * float64(time.Microsecond))
+}
+
+// LastNoteTick returns the tick at which the last note (including its sustain) ends
+func (c *Chart) LastNoteTick() int64 {
+	var last int64
+	for _, notes := range c.Tracks {
+		for _, note := range notes {
+			if end := note.Tick + note.Length; end > last {
+				last = end
+			}
+		}
+	}
+	return last
+}
+
+// LastNoteTime returns the time at which the last note (including its sustain) ends
+func (c *Chart) LastNoteTime() time.Duration {
+	return c.TickToTime(c.LastNoteTick())
+}
+
+// ChartSection is a named practice section of a chart
+type ChartSection struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Sections returns the chart's practice sections. Each section ends where the next one
+// starts; the last one ends with the last note.
+func (c *Chart) Sections() []ChartSection {
+	var sections []ChartSection
+	var ticks []int64
+	for _, event := range c.Events {
+		name, ok := strings.CutPrefix(event.Text, "section ")
+		if !ok {
+			// Rock Band style MIDI sections are named "prc_intro_a"
+			name, ok = strings.CutPrefix(event.Text, "prc_")
+			name = strings.ReplaceAll(name, "_", " ")
+		}
+		if !ok || strings.TrimSpace(name) == "" {
+			continue
+		}
+		sections = append(sections, ChartSection{Name: strings.TrimSpace(name), Start: c.TickToTime(event.Tick)})
+		ticks = append(ticks, event.Tick)
+	}
+
+	lastNote := c.LastNoteTick()
+	for i := range sections {
+		if i+1 < len(sections) {
+			sections[i].End = sections[i+1].Start
+		} else if lastNote > ticks[i] {
+			sections[i].End = c.TickToTime(lastNote)
+		} else {
+			sections[i].End = sections[i].Start
+		}
+	}
+	return sections
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	offsetThreshold int64
+	offsetShowAll   bool
+
+	offsetsCmd = &cobra.Command{
+		Use:   "offsets",
+		Short: "Audit song delay/offset values for likely sync problems",
+		Long: `Collect the audio offset of every matching song (song.ini delay plus the notes.chart
+Offset) and report the ones beyond --threshold, largest first. Charts with a large offset
+are usually the ones that feel "off" in game.`,
+		RunE: runOffsets,
+	}
+)
+
+func init() {
+	offsetsCmd.Flags().Int64Var(&offsetThreshold, "threshold", 500, "Report songs whose total offset exceeds this many milliseconds")
+	offsetsCmd.Flags().BoolVar(&offsetShowAll, "all", false, "Report every song with a non-zero offset")
+	rootCmd.AddCommand(offsetsCmd)
+}
+
+// SongOffset is the audio offset of a single song
+type SongOffset struct {
+	Song        *Song
+	Delay       int64 // song.ini delay, in milliseconds
+	ChartOffset int64 // notes.chart Offset, in milliseconds
+}
+
+// Total returns the combined offset in milliseconds
+func (o SongOffset) Total() int64 {
+	return o.Delay + o.ChartOffset
+}
+
+// readSongOffset reads the delay from song.ini and the offset from notes.chart, if present
+func readSongOffset(song *Song) (SongOffset, error) {
+	offset := SongOffset{Song: song}
+
+	values, err := readIniValues(song.Path)
+	if err != nil {
+		return offset, err
+	}
+	if delay := values["delay"]; delay != "" {
+		ms, err := strconv.ParseFloat(delay, 64)
+		if err != nil {
+			return offset, fmt.Errorf("invalid delay %q", delay)
+		}
+		offset.Delay = int64(ms)
+	}
+
+	meta, err := loadSongChartMetadata(song)
+	if err != nil {
+		return offset, err
+	}
+	if meta != nil {
+		offset.ChartOffset = int64(meta.Offset * 1000)
+	}
+	return offset, nil
+}
+
+// offsetsDocument is the JSON representation of offsets
+type offsetsDocument struct {
+	SchemaVersion int            `json:"schema_version"`
+	Checked       int            `json:"checked"`
+	WithOffset    int            `json:"with_offset"`
+	Flagged       int            `json:"flagged"`
+	ThresholdMs   int64          `json:"threshold_ms"`
+	Offsets       []offsetRecord `json:"offsets"`
+}
+
+// offsetRecord is a single reported song in offsetsDocument
+type offsetRecord struct {
+	TotalMs       int64      `json:"total_ms"`
+	DelayMs       int64      `json:"delay_ms"`
+	ChartOffsetMs int64      `json:"chart_offset_ms"`
+	Song          SongRecord `json:"song"`
+}
+
+func runOffsets(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("offsets needs a local library")
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	var nonZero, flagged []SongOffset
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		offset, err := readSongOffset(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to read offset for %s: %v\n", song.Path, err)
+			continue
+		}
+		if offset.Total() == 0 {
+			continue
+		}
+		nonZero = append(nonZero, offset)
+		if abs64(offset.Total()) > offsetThreshold {
+			flagged = append(flagged, offset)
+		}
+	}
+
+	report := flagged
+	if offsetShowAll {
+		report = nonZero
+	}
+	sort.SliceStable(report, func(i, j int) bool {
+		return abs64(report[i].Total()) > abs64(report[j].Total())
+	})
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if reportJSON() {
+		doc := offsetsDocument{
+			SchemaVersion: SchemaVersion,
+			Checked:       len(songs),
+			WithOffset:    len(nonZero),
+			Flagged:       len(flagged),
+			ThresholdMs:   offsetThreshold,
+			Offsets:       make([]offsetRecord, len(report)),
+		}
+		for i, offset := range report {
+			doc.Offsets[i] = offsetRecord{offset.Total(), offset.Delay, offset.ChartOffset, NewSongRecord(offset.Song)}
+		}
+		return writeReport(writer, doc)
+	}
+
+	fmt.Fprintf(writer, "Checked %d song(s): %d with an offset, %d beyond %dms\n", len(songs), len(nonZero), len(flagged), offsetThreshold)
+	for _, offset := range report {
+		fmt.Fprintf(writer, "\n%+6dms  %s - %s\n", offset.Total(), offset.Song.Artist, offset.Song.Name)
+		fmt.Fprintf(writer, "          delay: %dms, chart offset: %dms\n", offset.Delay, offset.ChartOffset)
+		fmt.Fprintf(writer, "          %s\n", offset.Song.Path)
+	}
+	return nil
+}
+
+// abs64 returns the absolute value of n
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -1,76 +1,284 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"html"
 	"io"
 	"os"
-	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 )
 
 // Output handles writing results to stdout or file
 type Output struct {
-	writer    io.Writer
-	countOnly bool
+	writer      io.Writer
+	format      string
+	countOnly   bool
+	highlighter *Filter
+	matchStyle  []color.Attribute // how highlighted matches look; the theme's highlight if nil
+	diff        *ResultDiff
+	columns     []Column // for csv and tsv; nil for the defaults
+	countBy     string   // --count-by grouping; "" to write the songs
 }
 
-// NewOutput creates a new Output instance
-func NewOutput(outputFile string, countOnly bool) *Output {
-	var writer io.Writer = os.Stdout
+// Output formats
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatTable  = "table"
+	FormatCSV    = "csv"
+	FormatTSV    = "tsv"
+)
+
+// outputFormats lists the formats accepted by --format
+var outputFormats = []string{FormatText, FormatTable, FormatJSON, FormatNDJSON, FormatCSV, FormatTSV}
 
-	if outputFile != "" {
-		file, err := os.Create(outputFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to create output file: %v\n", err)
-		} else {
-			writer = file
+// validateFormat checks that format is one of the supported output formats
+func validateFormat(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
 		}
 	}
+	return fmt.Errorf("unknown output format %q (available: %s)", format, strings.Join(outputFormats, ", "))
+}
+
+// NewOutput creates an Output writing to w (see openOutput)
+func NewOutput(w io.Writer, format string, countOnly bool) *Output {
+	if format == "" {
+		format = FormatText
+	}
 
 	return &Output{
-		writer:    writer,
+		writer:    w,
+		format:    format,
 		countOnly: countOnly,
 	}
 }
 
+// Highlight enables highlighting of the substrings matched by the given filter
+func (o *Output) Highlight(filter *Filter) {
+	o.highlighter = filter
+}
+
+// ShowDiff marks the songs added and removed since the previous run of the search
+func (o *Output) ShowDiff(diff *ResultDiff) {
+	o.diff = diff
+}
+
 // Write writes the results
-func (o *Output) Write(allSongs, filteredSongs []*Song) error {
+func (o *Output) Write(total int, filteredSongs []*Song) error {
+	if o.countBy != "" {
+		return o.writeCountBy(total, filteredSongs)
+	}
+	switch o.format {
+	case FormatJSON:
+		return o.writeJSON(total, filteredSongs)
+	case FormatNDJSON:
+		return o.writeNDJSON(total, filteredSongs)
+	case FormatPorcelain:
+		return o.writePorcelain(total, filteredSongs)
+	}
+
+	if (o.format == FormatCSV || o.format == FormatTSV) && !o.countOnly {
+		return o.writeDelimited(filteredSongs)
+	}
+
 	if o.countOnly {
+		if o.diff != nil && len(o.diff.Moved) > 0 {
+			fmt.Fprintf(o.writer, "%d (+%d, ~%d, -%d)\n", len(filteredSongs), len(o.diff.Added), len(o.diff.Moved), len(o.diff.Removed))
+			return nil
+		}
+		if o.diff != nil {
+			fmt.Fprintf(o.writer, "%d (+%d, -%d)\n", len(filteredSongs), len(o.diff.Added), len(o.diff.Removed))
+			return nil
+		}
 		fmt.Fprintf(o.writer, "%d\n", len(filteredSongs))
 		return nil
 	}
 
 	// Write summary
-	fmt.Fprintf(o.writer, "Found %d song(s) (out of %d total)\n\n", len(filteredSongs), len(allSongs))
+	if o.diff != nil && len(o.diff.Moved) > 0 {
+		fmt.Fprintf(o.writer, "Found %d song(s) (out of %d total), %d added, %d moved and %d removed since %s\n\n",
+			len(filteredSongs), total, len(o.diff.Added), len(o.diff.Moved), len(o.diff.Removed), o.diff.Since.Local().Format("2006-01-02 15:04"))
+	} else if o.diff != nil {
+		fmt.Fprintf(o.writer, "Found %d song(s) (out of %d total), %d added and %d removed since %s\n\n",
+			len(filteredSongs), total, len(o.diff.Added), len(o.diff.Removed), o.diff.Since.Local().Format("2006-01-02 15:04"))
+	} else {
+		fmt.Fprintf(o.writer, "Found %d song(s) (out of %d total)\n\n", len(filteredSongs), total)
+	}
+
+	// Write songs
+	if o.format == FormatTable {
+		o.writeTable(filteredSongs)
+	} else {
+		for i, song := range filteredSongs {
+			o.writeSong(song, songOffset+i+1)
+			fmt.Fprintln(o.writer)
+		}
+	}
+
+	if o.diff != nil && len(o.diff.Moved) > 0 {
+		fmt.Fprintln(o.writer, "Moved since the last run:")
+		for _, song := range filteredSongs {
+			if from, ok := o.diff.Moved[song.Path]; ok {
+				fmt.Fprintf(o.writer, "   %s %s - %s (%s -> %s)\n", color.YellowString("~"), song.Name, song.Artist, from.Path, song.Path)
+			}
+		}
+	}
+	if o.diff != nil && len(o.diff.Removed) > 0 {
+		fmt.Fprintln(o.writer, "Removed since the last run:")
+		for _, song := range o.diff.Removed {
+			fmt.Fprintf(o.writer, "   %s %s - %s (%s)\n", color.RedString("-"), song.Name, song.Artist, song.Path)
+		}
+	}
 
-	if len(filteredSongs) == 0 {
+	return nil
+}
+
+// jsonOutput is the document written by --format json
+type jsonOutput struct {
+	SchemaVersion int          `json:"schema_version"`
+	Count         int          `json:"count"`
+	Total         int          `json:"total"`
+	Songs         []SongRecord `json:"songs,omitempty"`
+	Diff          *jsonDiff    `json:"diff,omitempty"`
+}
+
+// jsonDiff is the --diff-last part of the JSON output
+type jsonDiff struct {
+	Since   time.Time    `json:"since"`
+	Added   []string     `json:"added"`
+	Moved   []jsonMove   `json:"moved"`
+	Removed []ResultSong `json:"removed"`
+}
+
+// jsonMove is a song that moved folders since the last run
+type jsonMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// newJSONDiff lists the songs added and moved (by path, in result order) and removed since
+// the last run
+func newJSONDiff(diff *ResultDiff, filteredSongs []*Song) *jsonDiff {
+	if diff == nil {
 		return nil
 	}
+	doc := &jsonDiff{Since: diff.Since, Added: []string{}, Moved: []jsonMove{}, Removed: diff.Removed}
+	for _, song := range filteredSongs {
+		if diff.Added[song.Path] {
+			doc.Added = append(doc.Added, song.Path)
+		}
+		if from, ok := diff.Moved[song.Path]; ok {
+			doc.Moved = append(doc.Moved, jsonMove{From: from.Path, To: song.Path})
+		}
+	}
+	if doc.Removed == nil {
+		doc.Removed = []ResultSong{}
+	}
+	return doc
+}
 
-	// Write songs
-	for i, song := range filteredSongs {
-		o.writeSong(song, i+1)
-		fmt.Fprintln(o.writer)
+// ndjsonSongRecord is a single line written by --format ndjson
+type ndjsonSongRecord struct {
+	SchemaVersion int `json:"schema_version"`
+	SongRecord
+}
+
+// writeJSON writes the results as a single JSON document
+func (o *Output) writeJSON(total int, filteredSongs []*Song) error {
+	doc := jsonOutput{
+		SchemaVersion: SchemaVersion,
+		Count:         len(filteredSongs),
+		Total:         total,
+		Diff:          newJSONDiff(o.diff, filteredSongs),
+	}
+	if !o.countOnly {
+		doc.Songs = newSongRecords(filteredSongs)
 	}
 
+	encoder := json.NewEncoder(o.writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+// writeNDJSON writes one JSON object per matching song. With --count a single object
+// with the counts is written instead. With --diff-last a last line holds the diff.
+func (o *Output) writeNDJSON(total int, filteredSongs []*Song) error {
+	encoder := json.NewEncoder(o.writer)
+	if o.countOnly {
+		return encoder.Encode(jsonOutput{SchemaVersion: SchemaVersion, Count: len(filteredSongs), Total: total, Diff: newJSONDiff(o.diff, filteredSongs)})
+	}
+
+	for _, song := range filteredSongs {
+		if err := encoder.Encode(ndjsonSongRecord{SchemaVersion: SchemaVersion, SongRecord: NewSongRecord(song)}); err != nil {
+			return err
+		}
+	}
+	if o.diff != nil {
+		return encoder.Encode(struct {
+			SchemaVersion int       `json:"schema_version"`
+			Diff          *jsonDiff `json:"diff"`
+		}{SchemaVersion, newJSONDiff(o.diff, filteredSongs)})
+	}
 	return nil
 }
 
+// diffStatus returns what --diff-last says about a song: new, moved or nothing
+func (o *Output) diffStatus(song *Song) string {
+	if o.diff == nil {
+		return ""
+	}
+	if o.diff.Added[song.Path] {
+		return "new"
+	}
+	if _, ok := o.diff.Moved[song.Path]; ok {
+		return "moved"
+	}
+	return ""
+}
+
+// diffMarker returns how --diff-last marks a song in the results: (new), (moved) or nothing
+func (o *Output) diffMarker(song *Song) string {
+	switch o.diffStatus(song) {
+	case "new":
+		return color.GreenString("(new)")
+	case "moved":
+		return color.YellowString("(moved)")
+	}
+	return ""
+}
+
 // writeSong writes a single song entry
 func (o *Output) writeSong(song *Song, index int) {
-	fmt.Fprintf(o.writer, "%d. %s\n", index, color.New(color.Bold).Sprint(song.Name))
-	fmt.Fprintf(o.writer, "   Artist: %s\n", song.Artist)
+	name := o.formatRichText("name", song.rawText("name", song.Name), outputStyles.Name...)
+	if accessibleMode {
+		// A label for every line, and the --diff-last status as a line of its own
+		fmt.Fprintf(o.writer, "Song %d: %s\n", index, name)
+		if status := o.diffStatus(song); status != "" {
+			fmt.Fprintf(o.writer, "   %s %s\n", o.label("Status"), status)
+		}
+	} else {
+		marker := ""
+		if mark := o.diffMarker(song); mark != "" {
+			marker = " " + mark
+		}
+		fmt.Fprintf(o.writer, "%d. %s%s\n", index, name, marker)
+	}
+	fmt.Fprintf(o.writer, "   %s %s\n", o.label("Artist"), o.formatRichText("artist", song.rawText("artist", song.Artist)))
 	if song.Album != "" {
-		fmt.Fprintf(o.writer, "   Album: %s\n", song.Album)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Album"), song.Album)
 	}
 	if song.Genre != "" {
-		fmt.Fprintf(o.writer, "   Genre: %s\n", song.Genre)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Genre"), o.highlight("genre", song.Genre))
 	}
 	if song.Year > 0 {
-		fmt.Fprintf(o.writer, "   Year: %d\n", song.Year)
+		fmt.Fprintf(o.writer, "   %s %d\n", o.label("Year"), song.Year)
 	}
 	if len(song.Charters) > 0 {
 		// Format all charters with colors
@@ -79,75 +287,197 @@ func (o *Output) writeSong(song *Song, index int) {
 			formattedCharters[i] = o.formatCharter(charter)
 		}
 		charterStr := strings.Join(formattedCharters, ", ")
-		fmt.Fprintf(o.writer, "   Charter: %s\n", charterStr)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Charter"), charterStr)
+	}
+	fmt.Fprintf(o.writer, "   %s %s\n", o.label("Length"), formatSongLength(song))
+	if sum := shownHash(song); sum != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Hash"), sum)
 	}
-	fmt.Fprintf(o.writer, "   Length: %s\n", song.FormatLength())
 
 	instruments := song.InstrumentList()
 	if instruments != "" {
-		fmt.Fprintf(o.writer, "   Instruments: %s\n", instruments)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Instruments"), instruments)
+	}
+	if best, ok := song.BestScore(""); ok {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Best score"), formatScore(best))
+	}
+	if song.Permalink != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Link"), song.Permalink)
 	}
 
 	// Show path relative to current directory
 	wd, _ := os.Getwd()
 	if strings.HasPrefix(song.Path, wd) {
 		relPath := strings.TrimPrefix(song.Path, wd+"/")
-		fmt.Fprintf(o.writer, "   Path: %s\n", relPath)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Path"), relPath)
 	} else {
-		fmt.Fprintf(o.writer, "   Path: %s\n", song.Path)
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Path"), song.Path)
 	}
 }
 
-// formatCharter formats charter name, handling HTML colors
-func (o *Output) formatCharter(charter string) string {
-	if charter == "" {
-		return ""
+// WriteDetail writes every known field of a single song
+func (o *Output) WriteDetail(song *Song) {
+	if o.format == FormatJSON || o.format == FormatNDJSON {
+		json.NewEncoder(o.writer).Encode(ndjsonSongRecord{SchemaVersion: SchemaVersion, SongRecord: NewSongRecord(song)})
+		return
+	}
+
+	fmt.Fprintf(o.writer, "%s\n", o.formatRichText("name", song.rawText("name", song.Name), outputStyles.Name...))
+	fmt.Fprintf(o.writer, "   %s %s\n", o.label("Artist"), o.formatRichText("artist", song.rawText("artist", song.Artist)))
+	if featured := song.FeaturedArtists(); len(featured) > 0 {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Featuring"), strings.Join(featured, ", "))
+	}
+	if song.Album != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Album"), song.Album)
+	}
+	if song.AlbumTrack > 0 {
+		fmt.Fprintf(o.writer, "   %s %d\n", o.label("Album Track"), song.AlbumTrack)
+	}
+	if song.Genre != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Genre"), o.highlight("genre", song.Genre))
+	}
+	if song.Year > 0 {
+		fmt.Fprintf(o.writer, "   %s %d\n", o.label("Year"), song.Year)
+	}
+	if len(song.Charters) > 0 {
+		formattedCharters := make([]string, len(song.Charters))
+		for i, charter := range song.Charters {
+			formattedCharters[i] = o.formatCharter(charter)
+		}
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Charter"), strings.Join(formattedCharters, ", "))
+	}
+	fmt.Fprintf(o.writer, "   %s %s\n", o.label("Length"), formatSongLength(song))
+	if sum := shownHash(song); sum != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Hash"), sum)
+	}
+	if song.PreviewStart > 0 {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Preview Start"), formatMillis(song.PreviewStart))
+	}
+	if song.PlaylistTrack > 0 {
+		fmt.Fprintf(o.writer, "   %s %d\n", o.label("Playlist Track"), song.PlaylistTrack)
+	}
+	if song.Icon != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Icon"), song.Icon)
+	}
+	if len(song.Tags) > 0 {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Tags"), strings.Join(song.Tags, ", "))
+	}
+	if best, ok := song.BestScore(""); ok {
+		fmt.Fprintf(o.writer, "   %s %s, %d stars (played %d times)\n", o.label("Best score"), formatScore(best), best.Stars, song.Scores.PlayCount)
+	}
+	if song.Rating > 0 {
+		fmt.Fprintf(o.writer, "   %s %d\n", o.label("Rating"), song.Rating)
 	}
-	
-	// Check for HTML color tags (e.g., <color=#FF0000>text</color>)
-	// Use a more robust regex that handles multiple consecutive tags
-	re := regexp.MustCompile(`<color=#([0-9A-Fa-f]{6})>(.*?)</color>`)
 
-	// If we're writing to a file or stdout without color support, strip HTML
+	if len(song.Instruments) > 0 {
+		fmt.Fprintf(o.writer, "   %s\n", o.label("Difficulties"))
+		instruments := make([]string, 0, len(song.Instruments))
+		for inst := range song.Instruments {
+			instruments = append(instruments, string(inst))
+		}
+		sort.Strings(instruments)
+		for _, inst := range instruments {
+			fmt.Fprintf(o.writer, "     %s %d\n", padWidth(inst, 10), song.Instruments[Instrument(inst)])
+		}
+	}
+
+	if len(song.Charted) > 0 {
+		fmt.Fprintf(o.writer, "   %s\n", o.label("Charted"))
+		instruments := make([]string, 0, len(song.Charted))
+		for inst := range song.Charted {
+			instruments = append(instruments, string(inst))
+		}
+		sort.Strings(instruments)
+		for _, inst := range instruments {
+			marks := make([]string, len(difficulties))
+			for i, difficulty := range difficulties {
+				marks[i] = "-"
+				if song.HasDifficulty(Instrument(inst), difficulty) {
+					marks[i] = difficultyMarks[difficulty]
+				}
+			}
+			line := fmt.Sprintf("     %s %s  %d notes", padWidth(inst, 10), strings.Join(marks, " "), song.NoteCounts[Instrument(inst)])
+			if first, ok := song.FirstNotes[Instrument(inst)]; ok {
+				line += ", first at " + formatMillis(first.Milliseconds())
+			}
+			fmt.Fprintln(o.writer, line)
+			if stats, ok := song.PartStats[Instrument(inst)]; ok {
+				fmt.Fprintf(o.writer, "     %s %s\n", padWidth("", 19), formatTechniques(Instrument(inst), stats))
+			}
+		}
+	}
+	if len(song.Sections) > 0 {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Sections"), strings.Join(song.Sections, ", "))
+	}
+
+	if song.LoadingPhrase != "" {
+		fmt.Fprintf(o.writer, "   %s %s\n", o.label("Loading Phrase"), o.formatRichText("loading_phrase", song.rawText("loading_phrase", song.LoadingPhrase)))
+	}
+	fmt.Fprintf(o.writer, "   %s %s\n", o.label("Path"), song.Path)
+	if song.Packed {
+		fmt.Fprintf(o.writer, "   %s .sng archive\n", o.label("Packed"))
+	}
+}
+
+// formatMillis formats a millisecond offset as m:ss.mmm
+func formatMillis(ms int64) string {
+	return fmt.Sprintf("%d:%02d.%03d", ms/60000, (ms/1000)%60, ms%1000)
+}
+
+// highlight renders text with the given base attributes, underlining the ranges that
+// matched the active filter for field. Files and plain output get the text unchanged.
+func (o *Output) highlight(field, text string, base ...color.Attribute) string {
 	if o.writer != os.Stdout {
-		// Remove HTML tags
-		charter = re.ReplaceAllString(charter, "$2")
-		charter = html.UnescapeString(charter)
-		return charter
+		return text
 	}
 
-	// Replace all HTML color tags with ANSI colors
-	// Find all matches and replace them
+	var ranges [][2]int
+	if o.highlighter != nil {
+		ranges = o.highlighter.MatchRanges(field, text)
+	}
+	paint := func(s string) string {
+		if len(base) == 0 {
+			return s
+		}
+		return color.New(base...).Sprint(s)
+	}
+	if len(ranges) == 0 {
+		return paint(text)
+	}
+
+	matched := color.New(append(base, o.matchAttrs()...)...)
 	var result strings.Builder
 	lastIndex := 0
-	
-	for _, match := range re.FindAllStringSubmatchIndex(charter, -1) {
-		// Add text before the match
-		result.WriteString(charter[lastIndex:match[0]])
-		
-		// Extract color hex and text
-		colorHex := charter[match[2]:match[3]]
-		text := charter[match[4]:match[5]]
-		
-		// Convert hex to RGB
-		var r, g, b uint8
-		if _, err := fmt.Sscanf(colorHex, "%02x%02x%02x", &r, &g, &b); err == nil {
-			// Create color function and write colored text
-			c := color.RGB(int(r), int(g), int(b))
-			result.WriteString(c.Sprint(text))
-		} else {
-			// Fallback to plain text if color parsing fails
-			result.WriteString(text)
-		}
-		
-		lastIndex = match[1]
-	}
-	
-	// Add remaining text after last match
-	result.WriteString(charter[lastIndex:])
-	
-	// Handle any remaining HTML entities
-	finalResult := html.UnescapeString(result.String())
-	
-	return finalResult
+	for _, r := range ranges {
+		if r[0] < lastIndex {
+			continue
+		}
+		if r[0] > lastIndex {
+			result.WriteString(paint(text[lastIndex:r[0]]))
+		}
+		result.WriteString(matched.Sprint(text[r[0]:r[1]]))
+		lastIndex = r[1]
+	}
+	if lastIndex < len(text) {
+		result.WriteString(paint(text[lastIndex:]))
+	}
+	return result.String()
+}
+
+// plainCharter strips rich text tags and entities from a charter name
+func plainCharter(charter string) string {
+	return plainText(charter)
+}
+
+// formatCharter formats charter name, turning its rich text tags into ANSI styles
+func (o *Output) formatCharter(charter string) string {
+	return o.formatRichText("charter", charter, outputStyles.Charter...)
+}
+
+// matchAttrs returns how the parts of fields matching a filter look
+func (o *Output) matchAttrs() []color.Attribute {
+	if o.matchStyle != nil {
+		return o.matchStyle
+	}
+	return outputStyles.Highlight
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	packDupesMinOverlap float64
+	packDupesMerge      bool
+	packDupesDryRun     bool
+
+	packDupesCmd = &cobra.Command{
+		Use:   "pack-dupes [pack] [pack]",
+		Short: "Find packs that are copies of each other and merge them",
+		Long: `Find packs, the top-level folders of the library, that hold the same charts, such as
+the v1 and v2 folders of a pack downloaded twice. Charts are compared by the checksum of
+their notes file; two packs are reported when at least --min-overlap percent of the
+charts of the smaller one are in the other. Give pack names to only report on those.
+
+With --merge and two pack names, the packs are merged into the one with the newest
+files. Of each chart both have, the copy whose song.ini (or .sng) is newer is kept and
+the other is moved to the cold-storage archive (see "cold"), where "thaw" can bring it
+back. The songs only the other pack has are moved over, and its emptied folders removed.`,
+		Args: cobra.MaximumNArgs(2),
+		RunE: runPackDupes,
+	}
+)
+
+func init() {
+	packDupesCmd.Flags().Float64Var(&packDupesMinOverlap, "min-overlap", 50, "Percentage of the smaller pack's charts that must be in the other pack")
+	packDupesCmd.Flags().BoolVar(&packDupesMerge, "merge", false, "Merge the two packs given as arguments")
+	packDupesCmd.Flags().BoolVar(&packDupesDryRun, "dry-run", false, "Only print what --merge would move")
+	packDupesCmd.Flags().StringVar(&coldArchive, "archive", "", "Cold-storage archive for the copies --merge replaces (default: <directory>_cold next to the library)")
+	rootCmd.AddCommand(packDupesCmd)
+}
+
+// libraryPack is a top-level folder of the library and the songs in it
+type libraryPack struct {
+	name   string
+	songs  []*Song
+	hashes map[string]*Song // songs by the checksum of their notes file
+	hashOf map[*Song]string
+	newest time.Time // mod time of the newest song.ini or .sng
+}
+
+// packOverlap is a pair of packs that share charts
+type packOverlap struct {
+	a, b   *libraryPack
+	shared int
+}
+
+// share returns the shared charts as a fraction of the charts of the smaller pack
+func (o packOverlap) share() float64 {
+	return float64(o.shared) / float64(min(len(o.a.hashes), len(o.b.hashes)))
+}
+
+// songModTime returns the mod time of a song's song.ini or .sng file
+func songModTime(song *Song) time.Time {
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// loadPacks groups songs by the pack they're in, sorted by name. Songs right in root
+// aren't in a pack.
+func loadPacks(root string, songs []*Song) ([]*libraryPack, error) {
+	byName := make(map[string]*libraryPack)
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return nil, err
+		}
+		folder, err := filepath.Abs(songFolder(song))
+		if err != nil {
+			continue
+		}
+		name := packOf(root, folder)
+		if name == "." {
+			continue
+		}
+		pack := byName[name]
+		if pack == nil {
+			pack = &libraryPack{name: name, hashes: make(map[string]*Song), hashOf: make(map[*Song]string)}
+			byName[name] = pack
+		}
+		pack.songs = append(pack.songs, song)
+		if modTime := songModTime(song); modTime.After(pack.newest) {
+			pack.newest = modTime
+		}
+		if checksum, err := songChecksum(song); err == nil {
+			pack.hashes[checksum] = song
+			pack.hashOf[song] = checksum
+		}
+	}
+
+	packs := make([]*libraryPack, 0, len(byName))
+	for _, pack := range byName {
+		packs = append(packs, pack)
+	}
+	sort.Slice(packs, func(i, j int) bool { return packs[i].name < packs[j].name })
+	return packs, nil
+}
+
+// findOverlaps returns the pairs of packs that share at least minShare of the charts of
+// the smaller one, most overlapping first
+func findOverlaps(packs []*libraryPack, minShare float64) []packOverlap {
+	var overlaps []packOverlap
+	for i, a := range packs {
+		for _, b := range packs[i+1:] {
+			overlap := packOverlap{a: a, b: b}
+			for checksum := range a.hashes {
+				if _, ok := b.hashes[checksum]; ok {
+					overlap.shared++
+				}
+			}
+			if overlap.shared > 0 && overlap.share() >= minShare {
+				overlaps = append(overlaps, overlap)
+			}
+		}
+	}
+	sort.SliceStable(overlaps, func(i, j int) bool { return overlaps[i].share() > overlaps[j].share() })
+	return overlaps
+}
+
+func runPackDupes(cmd *cobra.Command, args []string) error {
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("pack-dupes needs a local library")
+	}
+	if packDupesMerge && len(args) != 2 {
+		return fmt.Errorf("--merge needs the names of the two packs to merge")
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	songs, err := loadLibrary()
+	if err != nil {
+		return err
+	}
+	packs, err := loadPacks(root, songs)
+	if err != nil {
+		return err
+	}
+
+	if packDupesMerge {
+		older, newer, err := pickPacks(packs, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return mergePacks(root, older, newer)
+	}
+
+	var overlaps []packOverlap
+	for _, overlap := range findOverlaps(packs, packDupesMinOverlap/100) {
+		if len(args) == 0 || containsFold(args, overlap.a.name) || containsFold(args, overlap.b.name) {
+			overlaps = append(overlaps, overlap)
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	for _, overlap := range overlaps {
+		older, newer := overlap.a, overlap.b
+		if older.newest.After(newer.newest) {
+			older, newer = newer, older
+		}
+		fmt.Fprintf(writer, "%s <-> %s: %d shared chart(s), %.0f%% of the smaller pack\n",
+			older.name, newer.name, overlap.shared, overlap.share()*100)
+		fmt.Fprintf(writer, "  newer: %s; merge with: pack-dupes --merge %q %q\n", newer.name, older.name, newer.name)
+	}
+	fmt.Fprintf(os.Stderr, "%d duplicated pack pair(s) among %d pack(s)\n", len(overlaps), len(packs))
+	return nil
+}
+
+// containsFold reports whether values holds value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickPacks finds the packs named a and b, returning the one with the older files first
+func pickPacks(packs []*libraryPack, a, b string) (*libraryPack, *libraryPack, error) {
+	find := func(name string) (*libraryPack, error) {
+		name = strings.Trim(filepath.ToSlash(name), "/")
+		for _, pack := range packs {
+			if strings.EqualFold(pack.name, name) {
+				return pack, nil
+			}
+		}
+		return nil, fmt.Errorf("no pack named %q in %s", name, directory)
+	}
+	first, err := find(a)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := find(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if first == second {
+		return nil, nil, fmt.Errorf("can't merge %s with itself", first.name)
+	}
+	if first.newest.After(second.newest) {
+		return second, first, nil
+	}
+	return first, second, nil
+}
+
+// mergePacks merges the older pack into the newer one: of each chart both have, the
+// newer copy is kept and the other archived, and the rest of the older pack is moved over
+func mergePacks(root string, older, newer *libraryPack) error {
+	if err := ensureWritable("merge packs"); err != nil {
+		return err
+	}
+	archive, err := coldArchiveDir()
+	if err != nil {
+		return err
+	}
+	index, err := loadColdIndex(archive)
+	if err != nil {
+		return err
+	}
+
+	olderDir, newerDir := filepath.Join(root, older.name), filepath.Join(root, newer.name)
+	moved, archived := 0, 0
+	retire := func(song *Song) error {
+		folder, _ := filepath.Abs(songFolder(song))
+		rel, err := filepath.Rel(root, folder)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("archive: %s -> %s\n", rel, filepath.Join(archive, rel))
+		if packDupesDryRun {
+			return nil
+		}
+		ok, err := index.archive(archive, rel, folder, song)
+		if ok {
+			archived++
+		}
+		return err
+	}
+
+	sort.Slice(older.songs, func(i, j int) bool { return older.songs[i].Path < older.songs[j].Path })
+	for _, song := range older.songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		folder, _ := filepath.Abs(songFolder(song))
+		rel, err := filepath.Rel(olderDir, folder)
+		if err != nil {
+			continue
+		}
+
+		if other, ok := newer.hashes[older.hashOf[song]]; ok {
+			if !songModTime(song).After(songModTime(other)) {
+				if err := retire(song); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := retire(other); err != nil {
+				return err
+			}
+		}
+
+		dest := filepath.Join(newerDir, rel)
+		fmt.Printf("move: %s -> %s\n", filepath.Join(older.name, rel), filepath.Join(newer.name, rel))
+		if packDupesDryRun {
+			continue
+		}
+		if _, err := os.Stat(dest); err == nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %s already exists\n", folder, dest)
+			continue
+		}
+		if err := moveLibraryPath(folder, dest); err != nil {
+			return fmt.Errorf("failed to move %s: %w", folder, err)
+		}
+		moved++
+	}
+
+	if !packDupesDryRun {
+		removeEmptyDirs(olderDir)
+	}
+	fmt.Printf("Merged %s into %s: %d song(s) moved, %d older copies archived to %s\n", older.name, newer.name, moved, archived, archive)
+	return nil
+}
+
+// removeEmptyDirs removes dir and the folders in it if they hold no files
+func removeEmptyDirs(dir string) {
+	var dirs []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
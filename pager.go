@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+// defaultPager is used when $PAGER isn't set
+const defaultPager = "less"
+
+var (
+	usePager bool
+
+	// pager is the running pager, and pagedStdout the terminal it writes to
+	pager       *exec.Cmd
+	pagedStdout *os.File
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&usePager, "pager", "", false, "Show the output in $PAGER (default less) when it's a terminal")
+}
+
+// startPager sends stdout through $PAGER for --pager, if stdout is a terminal and the
+// command writes results to it rather than taking over the terminal. less is started
+// with LESS=FRX unless LESS is set, so short output is printed as usual and colors work.
+func startPager(cmd *cobra.Command) {
+	if !usePager || outputFile != "" || porcelainMode() || isCI() || !pagesOutput(cmd) || !isatty.IsTerminal(os.Stdout.Fd()) {
+		return
+	}
+	command := strings.Fields(os.Getenv("PAGER"))
+	if len(command) == 0 {
+		command = []string{defaultPager}
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't start the pager: %v\n", err)
+		return
+	}
+	pager = exec.Command(command[0], command[1:]...)
+	pager.Stdin, pager.Stdout, pager.Stderr = reader, os.Stdout, os.Stderr
+	pager.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		pager.Env = append(pager.Env, "LESS=FRX")
+	}
+	if err := pager.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: can't start the pager: %v\n", err)
+		reader.Close()
+		writer.Close()
+		pager = nil
+		return
+	}
+	reader.Close()
+	pagedStdout, os.Stdout = os.Stdout, writer
+}
+
+// stopPager ends the output to the pager and waits for it to be closed
+func stopPager() {
+	if pager == nil {
+		return
+	}
+	os.Stdout.Close()
+	os.Stdout = pagedStdout
+	pager.Wait()
+	pager = nil
+}
+
+// pagesOutput reports whether --pager applies to a command: not to those that draw on
+// or ask questions at the terminal, or that keep running
+func pagesOutput(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		switch c.Name() {
+		case "browse", "doctor", "edit", "open", "preview", "serve", "setup", "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
+	}
+	return true
+}
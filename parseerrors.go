@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// ParsePolicy decides what a scan does with song.ini files that fail to parse
+type ParsePolicy string
+
+const (
+	// ParseSkip warns about the file and leaves the song out, retrying on the next scan
+	ParseSkip ParsePolicy = "skip"
+	// ParseRetry re-reads the file as UTF-16 or Windows-1252 before giving up
+	ParseRetry ParsePolicy = "retry"
+	// ParseQuarantine leaves the song out without a warning and doesn't retry it until
+	// its song.ini changes; "cloneheroer errors" lists quarantined folders
+	ParseQuarantine ParsePolicy = "quarantine"
+)
+
+// ParseFailure is a song.ini that failed to parse, kept in the cache for "errors"
+type ParseFailure struct {
+	Path    string `json:"path"`
+	Error   string `json:"error"`
+	ModTime string `json:"mod_time,omitempty"`
+}
+
+var (
+	onParseError string
+	maxErrors    int
+
+	errorsCmd = &cobra.Command{
+		Use:   "errors",
+		Short: "List song folders whose song.ini failed to parse",
+		Long: `List the song folders whose song.ini failed to parse during the last scan, with the
+reason. Scan with --on-parse-error quarantine to keep these out of the warnings of every
+other command; they're only retried once their song.ini changes.`,
+		Args: cobra.NoArgs,
+		RunE: runErrors,
+	}
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&onParseError, "on-parse-error", "", string(ParseSkip), "What to do with song.ini files that fail to parse: skip, retry (other text encodings) or quarantine")
+	rootCmd.PersistentFlags().IntVarP(&maxErrors, "max-errors", "", 0, "Abort the scan when more than this many song.ini files fail to parse (0 for no limit)")
+	rootCmd.AddCommand(errorsCmd)
+}
+
+// parsePolicy returns the --on-parse-error policy
+func parsePolicy() (ParsePolicy, error) {
+	switch policy := ParsePolicy(strings.ToLower(onParseError)); policy {
+	case ParseSkip, ParseRetry, ParseQuarantine:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown --on-parse-error policy %q (available: skip, retry, quarantine)", onParseError)
+}
+
+// parseSongDecoded parses the contents of a song.ini written in an encoding other than
+// UTF-8: UTF-16 (recognised by its byte order mark or zero bytes) or, failing that,
+// Windows-1252
+func parseSongDecoded(path string, data []byte) (*Song, error) {
+	if err := checkSongIniData(data); err != nil {
+		return nil, err
+	}
+	return parseSongLines(path, []byte(decodeText(data)))
+}
+
+// decodeText converts UTF-16 or Windows-1252 text to UTF-8. Valid UTF-8 is returned as is.
+func decodeText(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], binary.LittleEndian)
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], binary.BigEndian)
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+		return decodeUTF16(data, binary.LittleEndian)
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		return decodeUTF16(data, binary.BigEndian)
+	case utf8.Valid(data):
+		return string(data)
+	}
+
+	var b strings.Builder
+	for _, c := range data {
+		if c >= 0x80 && c < 0xA0 {
+			b.WriteRune(windows1252[c-0x80])
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// decodeUTF16 converts UTF-16 text without a byte order mark to UTF-8
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// windows1252 maps bytes 0x80-0x9F of Windows-1252 to runes; the rest of the code page
+// matches Latin-1
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008d', 'Ž', '\u008f',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009d', 'ž', 'Ÿ',
+}
+
+// hasInvalidText reports whether any text field of a song isn't valid UTF-8, a sign
+// that its song.ini was saved in a legacy encoding
+func hasInvalidText(song *Song) bool {
+	for _, field := range append([]string{song.Name, song.Artist, song.Album, song.Genre}, song.Charters...) {
+		if !utf8.ValidString(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorsDocument is the JSON representation of errors
+type errorsDocument struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Count         int                  `json:"count"`
+	Errors        []parseFailureRecord `json:"errors"`
+}
+
+// parseFailureRecord is a song folder whose song.ini failed to parse
+type parseFailureRecord struct {
+	Folder string `json:"folder"`
+	Path   string `json:"path"`
+	Error  string `json:"error"`
+}
+
+func runErrors(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	policy, err := parsePolicy()
+	if err != nil {
+		return err
+	}
+	scanner := NewScanner(directory, ScanOptions{Network: networkMode, Context: commandContext(), OnError: policy, ExcludeDirs: excludeDirs})
+	if _, err := scanner.LoadSongs(); err != nil {
+		return err
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	failures := scanner.Errors()
+	doc := errorsDocument{SchemaVersion: SchemaVersion, Count: len(failures), Errors: []parseFailureRecord{}}
+	for _, failure := range failures {
+		folder := filepath.Dir(failure.Path)
+		if isSngFile(failure.Path) {
+			folder = failure.Path
+		}
+		if reportJSON() {
+			doc.Errors = append(doc.Errors, parseFailureRecord{folder, failure.Path, failure.Error})
+			continue
+		}
+		fmt.Fprintf(writer, "%s: %s\n", folder, failure.Error)
+	}
+	fmt.Fprintf(os.Stderr, "%d song folder(s) failed to parse\n", len(failures))
+	if reportJSON() {
+		return writeReport(writer, doc)
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// Causes of song.ini parse failures and of the malformations the parser works around
+const (
+	causeMissingEquals = "missing ="
+	causeEncoding      = "bad encoding"
+	causeNoSection     = "no [song] section"
+	causeDuplicateKeys = "duplicate keys"
+	causeUnreadable    = "unreadable"
+)
+
+// parseCauses lists the causes in the order the report shows them
+var parseCauses = []string{causeMissingEquals, causeEncoding, causeNoSection, causeDuplicateKeys, causeUnreadable}
+
+var (
+	parseReportFiles bool
+
+	parseReportCmd = &cobra.Command{
+		Use:   "parse-report",
+		Short: "Count song.ini parse failures and malformations by cause and pack",
+		Long: `Read the song.ini of every song in the library again and count the files that failed
+to parse, or that the parser had to work around, by cause:
+
+  missing =          lines of the [song] section without "=" (or ":") between key and value
+  bad encoding       text that isn't UTF-8, such as UTF-16 or Windows-1252
+  no [song] section  files without a [song] section
+  duplicate keys     keys set more than once in the [song] section
+  unreadable         files that are too large, binary or can't be read
+
+Counts are broken down by pack, the top-level folder of the library a song is in, so the
+pack most of the junk comes from stands out. Packed .sng songs are only counted when they
+fail to parse. With --files, every affected file is listed with its causes.`,
+		Args: cobra.NoArgs,
+		RunE: runParseReport,
+	}
+)
+
+func init() {
+	parseReportCmd.Flags().BoolVar(&parseReportFiles, "files", false, "List every affected file with its causes")
+	rootCmd.AddCommand(parseReportCmd)
+}
+
+// parseDiagnosis is what was wrong with one song.ini
+type parseDiagnosis struct {
+	path   string
+	pack   string
+	causes []string
+	failed bool
+}
+
+// diagnoseSongIni returns the malformations of song.ini text, in parseCauses order
+func diagnoseSongIni(data []byte) []string {
+	var causes []string
+	if isUTF16(data) || !utf8.Valid(data) {
+		causes = append(causes, causeEncoding)
+		data = []byte(decodeText(data))
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	missingEquals, duplicate, foundSection, inSong := false, false, false, false
+	keys := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			inSong = strings.EqualFold(strings.TrimSpace(line[1:len(line)-1]), "song")
+			foundSection = foundSection || inSong
+			continue
+		}
+		if !inSong {
+			continue
+		}
+		end := strings.IndexAny(line, "=:")
+		if end <= 0 {
+			missingEquals = true
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:end]))
+		duplicate = duplicate || keys[key]
+		keys[key] = true
+	}
+
+	if missingEquals {
+		causes = append([]string{causeMissingEquals}, causes...)
+	}
+	if !foundSection {
+		causes = append(causes, causeNoSection)
+	}
+	if duplicate {
+		causes = append(causes, causeDuplicateKeys)
+	}
+	return causes
+}
+
+// diagnoseFile reads a song.ini again and returns its malformations. Files that failed
+// to parse for any other reason than their text are unreadable.
+func diagnoseFile(path string, failure *ParseFailure) []string {
+	if isSngFile(path) || (failure != nil && failure.Error != errNoSongSection.Error()) {
+		return []string{causeUnreadable}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) > maxSongIniSize {
+		return []string{causeUnreadable}
+	}
+	causes := diagnoseSongIni(data)
+	if failure != nil && len(causes) == 0 {
+		return []string{causeUnreadable}
+	}
+	return causes
+}
+
+// packOf returns the top-level folder of root that a song folder is in, or "." for a
+// song right in root
+func packOf(root, folder string) string {
+	rel, err := filepath.Rel(root, folder)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "."
+	}
+	pack, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return pack
+}
+
+func runParseReport(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if err := requireSingleLibrary(cmd.Name()); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("parse-report needs a local library")
+	}
+	policy, err := parsePolicy()
+	if err != nil {
+		return err
+	}
+	scanner := NewScanner(directory, ScanOptions{Network: networkMode, Context: commandContext(), OnError: policy, ExcludeDirs: excludeDirs})
+	songs, err := scanner.LoadSongs()
+	if err != nil {
+		return err
+	}
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", directory, err)
+	}
+
+	var diagnoses []parseDiagnosis
+	diagnose := func(path string, failure *ParseFailure) {
+		folder := path
+		if !isSngFile(path) {
+			folder = filepath.Dir(path)
+		}
+		if abs, err := filepath.Abs(folder); err == nil {
+			folder = abs
+		}
+		if causes := diagnoseFile(path, failure); len(causes) > 0 {
+			diagnoses = append(diagnoses, parseDiagnosis{path: path, pack: packOf(root, folder), causes: causes, failed: failure != nil})
+		}
+	}
+	for _, song := range songs {
+		if err := commandContext().Err(); err != nil {
+			return errInterrupted
+		}
+		if !song.Packed {
+			diagnose(song.Path, nil)
+		}
+	}
+	for _, failure := range scanner.Errors() {
+		diagnose(failure.Path, &failure)
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if reportJSON() {
+		return writeReport(writer, newParseReportDocument(diagnoses, len(songs)+len(scanner.Errors()), len(scanner.Errors())))
+	}
+	writeParseReport(writer, diagnoses)
+	fmt.Fprintf(writer, "\n%d of %d song.ini file(s) affected, %d failed to parse\n",
+		len(diagnoses), len(songs)+len(scanner.Errors()), len(scanner.Errors()))
+	return nil
+}
+
+// parseCounts are the affected files per cause, overall and per pack
+type parseCounts struct {
+	files, failed map[string]int            // files per cause, and those that failed to parse
+	packs         map[string]map[string]int // files per pack and cause
+	packTotals    map[string]int            // affected files per pack
+	names         []string                  // packs with the most affected files first
+}
+
+// countDiagnoses adds up the causes of the diagnoses, overall and per pack
+func countDiagnoses(diagnoses []parseDiagnosis) parseCounts {
+	counts := parseCounts{
+		files:      make(map[string]int),
+		failed:     make(map[string]int),
+		packs:      make(map[string]map[string]int),
+		packTotals: make(map[string]int),
+	}
+	for _, d := range diagnoses {
+		if counts.packs[d.pack] == nil {
+			counts.packs[d.pack] = make(map[string]int)
+		}
+		counts.packTotals[d.pack]++
+		for _, cause := range d.causes {
+			counts.files[cause]++
+			counts.packs[d.pack][cause]++
+			if d.failed {
+				counts.failed[cause]++
+			}
+		}
+	}
+	for pack := range counts.packs {
+		counts.names = append(counts.names, pack)
+	}
+	sort.Slice(counts.names, func(i, j int) bool {
+		a, b := counts.names[i], counts.names[j]
+		if counts.packTotals[a] != counts.packTotals[b] {
+			return counts.packTotals[a] > counts.packTotals[b]
+		}
+		return a < b
+	})
+	return counts
+}
+
+// parseReportDocument is the JSON representation of parse-report
+type parseReportDocument struct {
+	SchemaVersion int                `json:"schema_version"`
+	Checked       int                `json:"checked"`
+	Affected      int                `json:"affected"`
+	Failed        int                `json:"failed"`
+	Causes        []parseCauseRecord `json:"causes"`
+	Packs         []parsePackRecord  `json:"packs"`
+	Files         []parseFileRecord  `json:"files"`
+}
+
+// parseCauseRecord is the number of files with one cause
+type parseCauseRecord struct {
+	Cause  string `json:"cause"`
+	Files  int    `json:"files"`
+	Failed int    `json:"failed"`
+}
+
+// parsePackRecord is the number of affected files of one pack, per cause
+type parsePackRecord struct {
+	Pack   string         `json:"pack"`
+	Causes map[string]int `json:"causes"`
+	Total  int            `json:"total"`
+}
+
+// parseFileRecord is one affected file with its causes
+type parseFileRecord struct {
+	Path   string   `json:"path"`
+	Pack   string   `json:"pack"`
+	Causes []string `json:"causes"`
+	Failed bool     `json:"failed"`
+}
+
+// newParseReportDocument converts the diagnoses of checked files to their JSON
+// representation
+func newParseReportDocument(diagnoses []parseDiagnosis, checked, failed int) parseReportDocument {
+	counts := countDiagnoses(diagnoses)
+	doc := parseReportDocument{
+		SchemaVersion: SchemaVersion,
+		Checked:       checked,
+		Affected:      len(diagnoses),
+		Failed:        failed,
+		Packs:         []parsePackRecord{},
+		Files:         []parseFileRecord{},
+	}
+	for _, cause := range parseCauses {
+		doc.Causes = append(doc.Causes, parseCauseRecord{cause, counts.files[cause], counts.failed[cause]})
+	}
+	for _, pack := range counts.names {
+		doc.Packs = append(doc.Packs, parsePackRecord{pack, counts.packs[pack], counts.packTotals[pack]})
+	}
+	for _, d := range diagnoses {
+		doc.Files = append(doc.Files, parseFileRecord{d.path, d.pack, d.causes, d.failed})
+	}
+	return doc
+}
+
+// writeParseReport prints the files per cause, then per pack and cause with the packs
+// with the most affected files first, then each file if --files is given
+func writeParseReport(writer io.Writer, diagnoses []parseDiagnosis) {
+	counts := countDiagnoses(diagnoses)
+	files, failed, packs, packTotals := counts.files, counts.failed, counts.packs, counts.packTotals
+
+	causeWidth := len("Cause")
+	for _, cause := range parseCauses {
+		causeWidth = max(causeWidth, len(cause))
+	}
+	fmt.Fprintf(writer, "%s  %s  %s\n", padWidth("Cause", causeWidth), align("Files", 6, true), align("Failed", 6, true))
+	for _, cause := range parseCauses {
+		fmt.Fprintf(writer, "%s  %s  %s\n", padWidth(cause, causeWidth),
+			align(strconv.Itoa(files[cause]), 6, true), align(strconv.Itoa(failed[cause]), 6, true))
+	}
+	if len(diagnoses) == 0 {
+		return
+	}
+
+	names := counts.names
+	packWidth := len("Pack")
+	for _, pack := range names {
+		packWidth = max(packWidth, displayWidth(pack))
+	}
+
+	header := "\n" + padWidth("Pack", packWidth)
+	for _, cause := range parseCauses {
+		header += "  " + cause
+	}
+	fmt.Fprintln(writer, header+"  Total")
+	for _, pack := range names {
+		line := padWidth(pack, packWidth)
+		for _, cause := range parseCauses {
+			line += "  " + align(strconv.Itoa(packs[pack][cause]), len(cause), true)
+		}
+		fmt.Fprintln(writer, line+"  "+align(strconv.Itoa(packTotals[pack]), len("Total"), true))
+	}
+
+	if parseReportFiles {
+		fmt.Fprintln(writer)
+		for _, d := range diagnoses {
+			status := ""
+			if d.failed {
+				status = " (failed)"
+			}
+			fmt.Fprintf(writer, "%s: %s%s\n", d.path, strings.Join(d.causes, ", "), status)
+		}
+	}
+}
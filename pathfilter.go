@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var filterPath []string
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVarP(&filterPath, "path", "", nil, "Only songs under a folder matching this glob or substring, relative to the library (e.g. '*Anti Hero*'); comma-separated or repeated to match any of several")
+}
+
+// matchesPath checks whether the folder of a song, relative to the library, or one of the
+// folders above it matches a --path pattern. A pattern without glob characters matches
+// any folder path containing it. Matching ignores case.
+func matchesPath(song *Song, pattern string) bool {
+	pattern = strings.ToLower(filepath.ToSlash(pattern))
+	parts := songRelativeFolder(song)
+	for i := range parts {
+		parts[i] = strings.ToLower(parts[i])
+	}
+	if !strings.ContainsAny(pattern, "*?[") {
+		return strings.Contains(strings.Join(parts, "/"), strings.Trim(pattern, "/"))
+	}
+
+	pattern = strings.Trim(pattern, "/")
+	for i, part := range parts {
+		// "*Anti Hero*" matches a folder at any level, "Packs/Anti*" the folders from the top
+		if ok, _ := path.Match(pattern, part); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, strings.Join(parts[:i+1], "/")); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathFilters returns every --path value used by the spec or its nested clauses
+func (spec FilterSpec) pathFilters() []string {
+	var values []string
+	if spec.Path != "" {
+		values = append(values, spec.Path)
+	}
+	for _, clause := range spec.clauses() {
+		values = append(values, clause.pathFilters()...)
+	}
+	return values
+}
+
+// validatePath checks that a --path value is a valid glob
+func validatePath(pattern string) error {
+	if _, err := path.Match(filepath.ToSlash(pattern), ""); err != nil {
+		return fmt.Errorf("invalid --path %q: %w", pattern, err)
+	}
+	return nil
+}
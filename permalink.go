@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var showLinks bool
+
+func init() {
+	rootCmd.Flags().BoolVarP(&showLinks, "links", "", false, "Look up each song on Chorus Encore and include a download link for the exact same chart")
+}
+
+// encoreSearchURL is Chorus Encore's chart search endpoint; CLONEHEROER_ENCORE_API
+// overrides it, e.g. for a mirror
+const encoreSearchURL = "https://api.enchor.us/search/advanced"
+
+// encoreFilesURL is where Chorus Encore serves charts, by the MD5 of the packed chart
+const encoreFilesURL = "https://files.enchor.us/"
+
+// encoreInterval spaces out lookups so large libraries don't hammer the API
+const encoreInterval = 250 * time.Millisecond
+
+// encoreRecheck is how long a chart that wasn't found on Chorus Encore is remembered
+// before it's looked up again
+const encoreRecheck = 7 * 24 * time.Hour
+
+// encoreMatch is a cached Chorus Encore lookup of a notes file checksum
+type encoreMatch struct {
+	MD5     string    `json:"md5,omitempty"` // Chorus Encore's id of the chart, empty if not found
+	Checked time.Time `json:"checked"`
+}
+
+// encoreLinker finds the Chorus Encore charts of local songs
+type encoreLinker struct {
+	path       string
+	matches    map[string]encoreMatch // by notes file checksum
+	client     *http.Client
+	lastLookup time.Time
+	changed    bool
+	offline    error // set after a failed request, so the rest of the songs don't each time out
+}
+
+// newEncoreLinker loads the cached lookups, kept next to the song cache
+func newEncoreLinker() *encoreLinker {
+	linker := &encoreLinker{
+		path:    filepath.Join(cacheDir(), "encore.json"),
+		matches: make(map[string]encoreMatch),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+	if data, err := os.ReadFile(linker.path); err == nil {
+		json.Unmarshal(data, &linker.matches)
+	}
+	return linker
+}
+
+// save writes the cached lookups back if any were added
+func (l *encoreLinker) save() error {
+	if !l.changed {
+		return nil
+	}
+	data, err := json.Marshal(l.matches)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(l.path, data, 0644)
+}
+
+// link returns the Chorus Encore download link of a song's chart, or "" if the chart
+// isn't on Chorus Encore
+func (l *encoreLinker) link(song *Song) (string, error) {
+	checksum, err := songChecksum(song)
+	if err != nil {
+		return "", err
+	}
+	match, ok := l.matches[checksum]
+	if !ok || (match.MD5 == "" && time.Since(match.Checked) > encoreRecheck) {
+		if l.offline != nil {
+			return "", l.offline
+		}
+		md5, err := l.lookup(checksum)
+		if err != nil {
+			if !errors.Is(err, errInterrupted) {
+				l.offline = err
+			}
+			return "", err
+		}
+		match = encoreMatch{MD5: md5, Checked: time.Now().UTC()}
+		l.matches[checksum] = match
+		l.changed = true
+	}
+	if match.MD5 == "" {
+		return "", nil
+	}
+	return encoreFilesURL + match.MD5 + ".sng", nil
+}
+
+// encoreSearchResult is the subset of a Chorus Encore search response the linker needs
+type encoreSearchResult struct {
+	Data []struct {
+		MD5       string `json:"md5"`
+		ChartHash string `json:"chartHash"`
+	} `json:"data"`
+}
+
+// lookup asks Chorus Encore for the chart whose notes file has the given checksum
+func (l *encoreLinker) lookup(checksum string) (string, error) {
+	ctx := commandContext()
+	if wait := encoreInterval - time.Since(l.lastLookup); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return "", errInterrupted
+		}
+	}
+	l.lastLookup = time.Now()
+
+	endpoint := encoreSearchURL
+	if override := os.Getenv("CLONEHEROER_ENCORE_API"); override != "" {
+		endpoint = override
+	}
+	body, err := json.Marshal(map[string]any{"hash": checksum, "page": 1})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "cloneheroer-songcli (https://github.com/mxygem/cloneheroer-songcli)")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Chorus Encore lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Chorus Encore lookup failed: %s", resp.Status)
+	}
+
+	var result encoreSearchResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid Chorus Encore response: %w", err)
+	}
+	// The search also matches on other fields, so only trust an exact hash match
+	for _, chart := range result.Data {
+		if strings.EqualFold(chart.ChartHash, checksum) || strings.EqualFold(chart.MD5, checksum) {
+			return chart.MD5, nil
+		}
+	}
+	return "", nil
+}
+
+// addPermalinks sets the Chorus Encore link of every song whose chart is found there.
+// Songs that can't be looked up are left without a link.
+func addPermalinks(songs []*Song) error {
+	if anyRemoteLibrary() {
+		return fmt.Errorf("--links needs a local library")
+	}
+
+	linker := newEncoreLinker()
+	defer func() {
+		if err := linker.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save Chorus Encore lookups: %v\n", err)
+		}
+	}()
+
+	failed := 0
+	for _, song := range songs {
+		link, err := linker.link(song)
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+		if err != nil {
+			failed++
+			if failed == 1 {
+				fmt.Fprintf(os.Stderr, "Warning: %s - %s: %v\n", song.Artist, song.Name, err)
+			}
+			continue
+		}
+		song.Permalink = link
+	}
+	if failed > 1 {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't look up %d song(s) on Chorus Encore\n", failed)
+	}
+	return nil
+}
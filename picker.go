@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// maxPickerChoices limits how many candidates are listed before asking for a narrower filter
+const maxPickerChoices = 30
+
+// isInteractive reports whether both stdin and stdout are attached to a terminal
+func isInteractive() bool {
+	return !isCI() && isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// pickSong resolves a list of matches to a single song for commands that operate on one
+// song. When several songs match, the user picks one from a numbered list; without a
+// terminal to prompt on, an error listing the candidates is returned instead.
+func pickSong(songs []*Song, in io.Reader, out io.Writer, interactive bool) (*Song, error) {
+	switch {
+	case len(songs) == 0:
+		return nil, fmt.Errorf("no songs match the given filters")
+	case len(songs) == 1:
+		return songs[0], nil
+	case !interactive:
+		return nil, fmt.Errorf("%d songs match the given filters, narrow the search:\n%s", len(songs), describeCandidates(songs))
+	case len(songs) > maxPickerChoices:
+		return nil, fmt.Errorf("%d songs match the given filters, narrow the search to %d or fewer", len(songs), maxPickerChoices)
+	}
+
+	fmt.Fprintf(out, "%d songs match:\n", len(songs))
+	for i, song := range songs {
+		fmt.Fprintf(out, "  %2d) %s\n", i+1, describeSong(song))
+	}
+
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Select a song [1-%d, q to cancel]: ", len(songs))
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("no song selected")
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "q" || line == "" {
+			return nil, fmt.Errorf("no song selected")
+		}
+		if choice, err := strconv.Atoi(line); err == nil && choice >= 1 && choice <= len(songs) {
+			return songs[choice-1], nil
+		}
+		fmt.Fprintf(out, "Invalid selection %q\n", line)
+	}
+}
+
+// describeSong returns a one-line description of a song for pickers and error messages
+func describeSong(song *Song) string {
+	desc := song.Name
+	if song.Artist != "" {
+		desc += " - " + song.Artist
+	}
+	if len(song.Charters) > 0 {
+		desc += " (" + plainCharters(song) + ")"
+	}
+	return desc + " [" + song.Path + "]"
+}
+
+// describeCandidates lists the first few candidate songs, one per line
+func describeCandidates(songs []*Song) string {
+	var lines []string
+	for i, song := range songs {
+		if i == 10 {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(songs)-i))
+			break
+		}
+		lines = append(lines, "  "+describeSong(song))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	playlistBy       string
+	playlistMinSongs int
+	playlistOutDir   string
+
+	playlistCmd = &cobra.Command{
+		Use:   "playlist",
+		Short: "Generate playlists from the library",
+	}
+
+	playlistAutoCmd = &cobra.Command{
+		Use:   "auto",
+		Short: "Generate one setlist file per genre, decade or charter",
+		Long: `Group the matching songs by genre, decade or charter (--by) and write every group with
+at least --min-songs songs as a setlist file in --out-dir, in one pass. Songs keep the
+--sort order within each playlist. Files are plain text setlists, or JSON with --format json.
+
+Songs with several charters appear in each charter's playlist; songs without a genre or
+year are left out of genre and decade playlists.`,
+		RunE: runPlaylistAuto,
+	}
+)
+
+func init() {
+	playlistAutoCmd.Flags().StringVar(&playlistBy, "by", "genre", "Group songs by genre, decade or charter")
+	playlistAutoCmd.Flags().IntVar(&playlistMinSongs, "min-songs", 20, "Only write playlists with at least this many songs")
+	playlistAutoCmd.Flags().StringVar(&playlistOutDir, "out-dir", "playlists", "Folder to write the setlist files to")
+	playlistCmd.AddCommand(playlistAutoCmd)
+	rootCmd.AddCommand(playlistCmd)
+}
+
+// Playlist is a named group of songs
+type Playlist struct {
+	Name  string
+	Songs []*Song
+}
+
+// playlistGroupers return the playlist names a song belongs to for each --by value
+var playlistGroupers = map[string]func(song *Song) []string{
+	"genre": func(song *Song) []string {
+		if isPlaceholderGenre(song.Genre) {
+			return nil
+		}
+		return []string{strings.TrimSpace(song.Genre)}
+	},
+	"decade": func(song *Song) []string {
+		if song.Year <= 0 {
+			return nil
+		}
+		return []string{strconv.Itoa(song.Year/10*10) + "s"}
+	},
+	"charter": func(song *Song) []string {
+		var names []string
+		for _, charter := range song.Charters {
+			if name := strings.TrimSpace(plainCharter(charter)); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	},
+}
+
+// groupPlaylists splits songs into playlists, merging names that differ only in case.
+// Playlists are ordered by name and keep the order of songs.
+func groupPlaylists(songs []*Song, by string) ([]Playlist, error) {
+	grouper, ok := playlistGroupers[by]
+	if !ok {
+		return nil, fmt.Errorf("unknown --by value %q (available: genre, decade, charter)", by)
+	}
+
+	byKey := make(map[string]*Playlist)
+	var keys []string
+	for _, song := range songs {
+		for _, name := range grouper(song) {
+			key := strings.ToLower(name)
+			playlist, ok := byKey[key]
+			if !ok {
+				playlist = &Playlist{Name: name}
+				byKey[key] = playlist
+				keys = append(keys, key)
+			}
+			playlist.Songs = append(playlist.Songs, song)
+		}
+	}
+
+	sort.Strings(keys)
+	playlists := make([]Playlist, len(keys))
+	for i, key := range keys {
+		playlists[i] = *byKey[key]
+	}
+	return playlists, nil
+}
+
+// playlistFileName turns a playlist name into a file name such as "genre-math-rock.txt"
+func playlistFileName(by, name, ext string) string {
+	var b strings.Builder
+	b.WriteString(by)
+	dash := true
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String() + ext
+}
+
+func runPlaylistAuto(cmd *cobra.Command, args []string) error {
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	playlists, err := groupPlaylists(songs, strings.ToLower(playlistBy))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(playlistOutDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", playlistOutDir, err)
+	}
+
+	ext := ".txt"
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		ext = ".json"
+	}
+
+	written, skipped := 0, 0
+	for _, playlist := range playlists {
+		if len(playlist.Songs) < playlistMinSongs {
+			skipped++
+			continue
+		}
+
+		entries := make([]SetlistEntry, len(playlist.Songs))
+		for i, song := range playlist.Songs {
+			entries[i] = SetlistEntry{Song: song}
+		}
+
+		path := filepath.Join(playlistOutDir, playlistFileName(strings.ToLower(playlistBy), playlist.Name, ext))
+		if err := writePlaylistFile(path, entries); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s (%d song(s))\n", path, playlist.Name, len(playlist.Songs))
+		written++
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %d playlist(s) to %s; %d group(s) had fewer than %d songs\n", written, playlistOutDir, skipped, playlistMinSongs)
+	return nil
+}
+
+// writePlaylistFile writes a setlist file in the --format output format
+func writePlaylistFile(path string, entries []SetlistEntry) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		return writeSetlistJSON(file, entries)
+	}
+	writeSetlist(file, entries)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Porcelain versions accepted by --porcelain. A version's format never changes once
+// released; new fields or records mean a new version.
+const (
+	PorcelainV1 = "v1"
+)
+
+// FormatPorcelain is the output format used by --porcelain; it can't be picked with --format
+const FormatPorcelain = "porcelain"
+
+var porcelainVersion string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&porcelainVersion, "porcelain", "", "", "Stable, tab-separated output for scripts (v1), ending with a summary line on stderr; no colors")
+	rootCmd.PersistentFlags().Lookup("porcelain").NoOptDefVal = PorcelainV1
+}
+
+// porcelainMode reports whether --porcelain is set
+func porcelainMode() bool {
+	return porcelainVersion != ""
+}
+
+// validatePorcelain checks the version given to --porcelain
+func validatePorcelain() error {
+	if porcelainVersion != "" && porcelainVersion != PorcelainV1 {
+		return fmt.Errorf("unknown --porcelain version %q (available: %s)", porcelainVersion, PorcelainV1)
+	}
+	return nil
+}
+
+// porcelainValue formats a field of a porcelain line. Values containing tabs, line
+// breaks or quotes are quoted Go-style, so every record stays on one line.
+func porcelainValue(value string) string {
+	if strings.ContainsAny(value, "\t\r\n\"") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// writePorcelainRecord writes one tab-separated porcelain line: the record type, then
+// its fields
+func (o *Output) writePorcelainRecord(record string, fields ...string) {
+	var line strings.Builder
+	line.WriteString(record)
+	for _, field := range fields {
+		line.WriteByte('\t')
+		line.WriteString(porcelainValue(field))
+	}
+	line.WriteByte('\n')
+	o.writer.Write([]byte(line.String()))
+}
+
+// writePorcelain writes the results in porcelain v1 format: a "song" record per song
+// with the fields path, name, artist, album, genre, year, charters, length in
+// milliseconds and instruments, or a single "count" record with --count
+func (o *Output) writePorcelain(total int, filteredSongs []*Song) error {
+	if o.countOnly {
+		o.writePorcelainRecord("count", strconv.Itoa(len(filteredSongs)), strconv.Itoa(total))
+		return nil
+	}
+	for _, song := range filteredSongs {
+		charters := make([]string, len(song.Charters))
+		for i, charter := range song.Charters {
+			charters[i] = plainCharter(charter)
+		}
+		o.writePorcelainRecord("song",
+			song.Path,
+			song.Name,
+			song.Artist,
+			song.Album,
+			song.Genre,
+			optionalInt(song.Year),
+			strings.Join(charters, ","),
+			strconv.FormatInt(song.Length.Milliseconds(), 10),
+			porcelainInstruments(song),
+		)
+	}
+	return nil
+}
+
+// porcelainInstruments lists a song's instruments as name=difficulty pairs, sorted by
+// name and separated by commas
+func porcelainInstruments(song *Song) string {
+	instruments := make([]string, 0, len(song.Instruments))
+	for inst, diff := range song.Instruments {
+		instruments = append(instruments, fmt.Sprintf("%s=%d", inst, diff))
+	}
+	sort.Strings(instruments)
+	return strings.Join(instruments, ",")
+}
@@ -0,0 +1,49 @@
+package main
+
+var filterPro bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&filterPro, "pro", "", false, "Only songs with a pro guitar, pro bass or pro keys part, read from the notes file")
+}
+
+// proInstruments are the pro (real) parts of YARG and Rock Band style charts: pro guitar
+// and bass are played string by string and pro keys on a full keyboard
+var proInstruments = []Instrument{InstrumentProGuitar, InstrumentProBass, InstrumentProKeys}
+
+// isProInstrument reports whether inst is a pro part
+func isProInstrument(inst Instrument) bool {
+	for _, pro := range proInstruments {
+		if inst == pro {
+			return true
+		}
+	}
+	return false
+}
+
+// HasProPart reports whether a song has a pro guitar, bass or keys part. Like IsGHL, the
+// notes file decides once it has been read, and song.ini otherwise.
+func (s *Song) HasProPart() bool {
+	for _, inst := range proInstruments {
+		if len(s.Charted) > 0 {
+			if len(s.Charted[inst]) > 0 {
+				return true
+			}
+		} else if s.HasInstrument(inst) {
+			return true
+		}
+	}
+	return false
+}
+
+// usesPro reports whether the spec or any of its nested clauses filters on pro parts
+func (spec FilterSpec) usesPro() bool {
+	if spec.Pro {
+		return true
+	}
+	for _, clause := range spec.clauses() {
+		if clause.usesPro() {
+			return true
+		}
+	}
+	return false
+}
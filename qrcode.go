@@ -0,0 +1,522 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// QR codes are encoded in byte mode at the smallest version that fits, with error
+// correction level M raised as far as the version allows. See ISO/IEC 18004.
+
+// qrMaxBytes is the most a QR code can hold in byte mode (version 40, level L)
+const qrMaxBytes = 2953
+
+// qrLevel is an error correction level, in order of increasing strength
+type qrLevel int
+
+const (
+	qrLevelL qrLevel = iota
+	qrLevelM
+	qrLevelQ
+	qrLevelH
+)
+
+// qrFormatBits are the two bits that identify each level in the format information
+var qrFormatBits = [4]int{1, 0, 3, 2}
+
+// qrECCPerBlock is the number of error correction codewords per block, by level and version
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrBlocks is the number of error correction blocks, by level and version
+var qrBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// QRCode is an encoded QR code symbol
+type QRCode struct {
+	version  int
+	level    qrLevel
+	size     int
+	modules  [][]bool // true for dark modules, indexed [y][x]
+	function [][]bool // modules that belong to function patterns rather than data
+}
+
+// EncodeQR encodes data in a QR code
+func EncodeQR(data []byte) (*QRCode, error) {
+	if len(data) > qrMaxBytes {
+		return nil, fmt.Errorf("%d bytes is too much for a QR code (at most %d)", len(data), qrMaxBytes)
+	}
+
+	level := qrLevelM
+	version := 1
+	for ; ; version++ {
+		if version > 40 {
+			// Doesn't fit at level M; level L holds a little more
+			level, version = qrLevelL, 1
+			for qrDataBits(version, level) < qrPayloadBits(version, len(data)) {
+				version++
+			}
+			break
+		}
+		if qrDataBits(version, level) >= qrPayloadBits(version, len(data)) {
+			break
+		}
+	}
+	for level < qrLevelH && qrDataBits(version, level+1) >= qrPayloadBits(version, len(data)) {
+		level++
+	}
+
+	// Byte mode segment, terminator and padding
+	var bits qrBitBuffer
+	bits.append(0x4, 4)
+	countBits := 8
+	if version > 9 {
+		countBits = 16
+	}
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := qrDataBits(version, level)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	codewords := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			codewords[i/8] |= 1 << (7 - i%8)
+		}
+	}
+
+	qr := &QRCode{version: version, level: level, size: version*4 + 17}
+	qr.modules = make([][]bool, qr.size)
+	qr.function = make([][]bool, qr.size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, qr.size)
+		qr.function[i] = make([]bool, qr.size)
+	}
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qr.addECC(codewords))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask) // masking twice undoes it
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+	return qr, nil
+}
+
+// qrPayloadBits is the length of a byte mode segment of n bytes
+func qrPayloadBits(version, n int) int {
+	if version > 9 {
+		return 4 + 16 + 8*n
+	}
+	return 4 + 8 + 8*n
+}
+
+// qrRawModules is the number of modules available for data and error correction
+func qrRawModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		result -= (25*align-10)*align - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataBits is the number of data bits a version holds at a level
+func qrDataBits(version int, level qrLevel) int {
+	return (qrRawModules(version)/8 - qrECCPerBlock[level][version]*qrBlocks[level][version]) * 8
+}
+
+// qrBitBuffer is a sequence of bits
+type qrBitBuffer []bool
+
+func (b *qrBitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+// addECC splits the data into blocks, appends each block's error correction codewords
+// and interleaves the blocks
+func (qr *QRCode) addECC(data []byte) []byte {
+	blocks := qrBlocks[qr.level][qr.version]
+	eccLen := qrECCPerBlock[qr.level][qr.version]
+	raw := qrRawModules(qr.version) / 8
+	shortBlocks := blocks - raw%blocks
+	shortLen := raw / blocks
+
+	divisor := rsDivisor(eccLen)
+	var all [][]byte
+	for i, k := 0, 0; i < blocks; i++ {
+		n := shortLen - eccLen
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0) // placeholder, skipped when interleaving
+		}
+		all = append(all, append(block, ecc...))
+	}
+
+	var result []byte
+	for i := range all[0] {
+		for j, block := range all {
+			if i != shortLen-eccLen || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of a degree, without its
+// leading term
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder returns the Reed-Solomon error correction codewords of data
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+func (qr *QRCode) setFunction(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns and reserves the
+// format and version areas
+func (qr *QRCode) drawFunctionPatterns() {
+	for i := 0; i < qr.size; i++ {
+		qr.setFunction(6, i, i%2 == 0)
+		qr.setFunction(i, 6, i%2 == 0)
+	}
+	qr.drawFinder(3, 3)
+	qr.drawFinder(qr.size-4, 3)
+	qr.drawFinder(3, qr.size-4)
+
+	positions := qr.alignmentPositions()
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // overlaps a finder pattern
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centred on x, y
+func (qr *QRCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < qr.size && yy >= 0 && yy < qr.size {
+				dist := max(abs(dx), abs(dy))
+				qr.setFunction(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+// alignmentPositions returns the centre coordinates of the alignment patterns
+func (qr *QRCode) alignmentPositions() []int {
+	if qr.version == 1 {
+		return nil
+	}
+	count := qr.version/7 + 2
+	step := (qr.version*8 + count*3 + 5) / (count*4 - 4) * 2
+	result := make([]int, count)
+	result[0] = 6
+	for i, pos := count-1, qr.size-7; i >= 1; i, pos = i-1, pos-step {
+		result[i] = pos
+	}
+	return result
+}
+
+// drawFormatBits draws both copies of the level and mask information
+func (qr *QRCode) drawFormatBits(mask int) {
+	data := qrFormatBits[qr.level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.setFunction(8, i, bit(i))
+	}
+	qr.setFunction(8, 7, bit(6))
+	qr.setFunction(8, 8, bit(7))
+	qr.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.setFunction(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.setFunction(qr.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.setFunction(8, qr.size-15+i, bit(i))
+	}
+	qr.setFunction(8, qr.size-8, true) // always dark
+}
+
+// drawVersion draws both copies of the version information of versions 7 and up
+func (qr *QRCode) drawVersion() {
+	if qr.version < 7 {
+		return
+	}
+	rem := qr.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := qr.size-11+i%3, i/3
+		qr.setFunction(a, b, dark)
+		qr.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the data in the zigzag order, two columns at a time from the
+// bottom right
+func (qr *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // skip the vertical timing pattern
+		}
+		for vert := 0; vert < qr.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.size - 1 - vert // upwards
+				}
+				if !qr.function[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by a mask pattern
+func (qr *QRCode) applyMask(mask int) {
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.function[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the symbol is to scan; the mask with the lowest score is used
+func (qr *QRCode) penalty() int {
+	penalty := 0
+	dark := 0
+	for y := 0; y < qr.size; y++ {
+		for x := 0; x < qr.size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			// Blocks of 2x2 modules of the same colour
+			if x+1 < qr.size && y+1 < qr.size {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x+1] && c == qr.modules[y+1][x] && c == qr.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	for i := 0; i < qr.size; i++ {
+		row := make([]bool, qr.size)
+		column := make([]bool, qr.size)
+		for j := 0; j < qr.size; j++ {
+			row[j] = qr.modules[i][j]
+			column[j] = qr.modules[j][i]
+		}
+		penalty += qrLinePenalty(row) + qrLinePenalty(column)
+	}
+
+	// Deviation from an even balance of dark and light modules
+	total := qr.size * qr.size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return penalty + max(k, 0)*10
+}
+
+// qrLinePenalty scores runs of same-coloured modules and finder-like patterns in a row
+// or column
+func qrLinePenalty(line []bool) int {
+	penalty := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += run - 2
+		}
+		run = 1
+	}
+
+	finder := []bool{true, false, true, true, true, false, true}
+	for i := 0; i+len(finder) <= len(line); i++ {
+		match := true
+		for j, dark := range finder {
+			if line[i+j] != dark {
+				match = false
+				break
+			}
+		}
+		if match && (qrLightRun(line, i-4, i) || qrLightRun(line, i+7, i+11)) {
+			penalty += 40
+		}
+	}
+	return penalty
+}
+
+// qrLightRun reports whether line[from:to] is light, counting the quiet zone outside
+// the symbol as light
+func qrLightRun(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// qrQuietZone is the light border around a symbol, in modules
+const qrQuietZone = 2
+
+// WriteTerminal draws the code with Unicode half blocks, two rows per line. Light
+// modules are drawn as blocks, which suits terminals with a dark background.
+func (qr *QRCode) WriteTerminal(w io.Writer) {
+	light := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= qr.size || y >= qr.size {
+			return true
+		}
+		return !qr.modules[y][x]
+	}
+
+	var b strings.Builder
+	for y := -qrQuietZone; y < qr.size+qrQuietZone; y += 2 {
+		for x := -qrQuietZone; x < qr.size+qrQuietZone; x++ {
+			top, bottom := light(x, y), light(x, y+1)
+			if y+1 >= qr.size+qrQuietZone {
+				bottom = false
+			}
+			switch {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	io.WriteString(w, b.String())
+}
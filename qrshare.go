@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var showQR bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&showQR, "qr", "", false, "Print the results as a QR code to scan with a phone instead of listing them")
+}
+
+// qrPayload is the text a QR code of songs carries: one "Artist - Name" line per song,
+// followed by its Chorus Encore link when --links found one
+func qrPayload(songs []*Song) string {
+	var b strings.Builder
+	for _, song := range songs {
+		b.WriteString(song.Artist + " - " + song.Name)
+		if song.Permalink != "" {
+			b.WriteString(" " + song.Permalink)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// printQR prints songs as a QR code on stdout. Only small result sets fit: a QR code
+// holds under 3 KB.
+func printQR(songs []*Song) error {
+	if len(songs) == 0 {
+		return fmt.Errorf("no songs to put in a QR code")
+	}
+	payload := qrPayload(songs)
+	if len(payload) > qrMaxBytes {
+		return fmt.Errorf("%d songs don't fit in a QR code (%d bytes, at most %d); narrow the search", len(songs), len(payload), qrMaxBytes)
+	}
+	qr, err := EncodeQR([]byte(payload))
+	if err != nil {
+		return err
+	}
+	qr.WriteTerminal(os.Stdout)
+	fmt.Fprintf(os.Stderr, "%d song(s) in the QR code\n", len(songs))
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"strings"
+)
+
+// The quick index is a small file written next to the cache that summarises the text of
+// the library, so a search that can't match anything is answered without reading the
+// cache. Scripts calling the CLI over and over with names that aren't in the library
+// are the common case. Any search the index can't rule out loads the library as usual.
+
+// quickIndexVersion is bumped whenever the layout of QuickIndex changes; other versions
+// are ignored
+const quickIndexVersion = 2
+
+// Bloom filter sizing: about 10 bits per trigram and 4 probes give roughly a 1% false
+// positive rate per trigram, and a search needs only one of its trigrams to be absent
+const (
+	bloomBitsPerKey = 10
+	bloomProbes     = 4
+)
+
+// QuickIndex is the quick-reject summary of a cached library
+type QuickIndex struct {
+	Version   int                     `json:"version"`
+	Hash      string                  `json:"hash"`    // directory hash of the cache it was built from
+	Decoded   bool                    `json:"decoded"` // whether that cache was scanned with ParseRetry
+	Songs     int                     `json:"songs"`
+	Fields    map[string]*bloomFilter `json:"fields"`     // trigrams of the fields matched by substring
+	NameBytes [4]uint64               `json:"name_bytes"` // bytes used in any name or normalized name, for the fuzzy name match
+}
+
+// bloomFilter is a set of strings that may report false positives but never false
+// negatives
+type bloomFilter struct {
+	Bits []byte `json:"bits"`
+}
+
+// quickIndexFields are the substring-matched fields in the quick index, with the text
+// each filter matches against
+var quickIndexFields = map[string]func(entry *CacheEntry) []string{
+	"artist": func(e *CacheEntry) []string { return []string{e.Artist} },
+	"genre":  func(e *CacheEntry) []string { return []string{e.Genre} },
+	"charter": func(e *CacheEntry) []string {
+		charters := make([]string, len(e.Charters))
+		for i, charter := range e.Charters {
+			charters[i] = plainCharter(charter)
+		}
+		return charters
+	},
+}
+
+// newBloomFilter sizes an empty filter for n keys
+func newBloomFilter(n int) *bloomFilter {
+	return &bloomFilter{Bits: make([]byte, (max(n, 1)*bloomBitsPerKey+7)/8)}
+}
+
+// probes returns the bit positions of key, by double hashing
+func (b *bloomFilter) probes(key string) [bloomProbes]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31 | 1
+	size := uint64(len(b.Bits)) * 8
+	var positions [bloomProbes]uint64
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % size
+	}
+	return positions
+}
+
+func (b *bloomFilter) add(key string) {
+	for _, bit := range b.probes(key) {
+		b.Bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	if len(b.Bits) == 0 {
+		return true
+	}
+	for _, bit := range b.probes(key) {
+		if b.Bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// trigrams adds the trigrams of the lowercased text to into
+func trigrams(text string, into map[string]bool) {
+	text = strings.ToLower(text)
+	for i := 0; i+3 <= len(text); i++ {
+		into[text[i:i+3]] = true
+	}
+}
+
+// quickIndexFile returns the path of the quick index of the cache
+func (s *Scanner) quickIndexFile() string {
+	return strings.TrimSuffix(s.cacheFile, ".json") + ".idx.json"
+}
+
+// newQuickIndex builds the quick index of a complete cache
+func newQuickIndex(cache *Cache) *QuickIndex {
+	idx := &QuickIndex{
+		Version: quickIndexVersion,
+		Hash:    cache.Hash,
+		Decoded: cache.Decoded,
+		Songs:   len(cache.Songs),
+		Fields:  make(map[string]*bloomFilter, len(quickIndexFields)),
+	}
+	for field, values := range quickIndexFields {
+		keys := make(map[string]bool)
+		for i := range cache.Songs {
+			for _, value := range values(&cache.Songs[i]) {
+				trigrams(value, keys)
+			}
+		}
+		filter := newBloomFilter(len(keys))
+		for key := range keys {
+			filter.add(key)
+		}
+		idx.Fields[field] = filter
+	}
+	for i := range cache.Songs {
+		name := strings.ToLower(cache.Songs[i].Name)
+		for _, text := range []string{name, normalizeName(name)} {
+			for j := 0; j < len(text); j++ {
+				idx.NameBytes[text[j]/64] |= 1 << (text[j] % 64)
+			}
+		}
+	}
+	return idx
+}
+
+// writeQuickIndex writes the quick index of a cache that was just saved
+func (s *Scanner) writeQuickIndex(cache *Cache) error {
+	if cache.Partial {
+		os.Remove(s.quickIndexFile())
+		return nil
+	}
+	data, err := json.Marshal(newQuickIndex(cache))
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.quickIndexFile(), data, 0644)
+}
+
+// rejects reports whether no song in the indexed library can match the name, artist,
+// genre and charter criteria of spec. Other criteria and nested clauses can only narrow
+// a search further, so they're ignored.
+func (idx *QuickIndex) rejects(spec FilterSpec) bool {
+	if name := strings.ToLower(spec.Name); name != "" && !idx.mayContainName(name) && !idx.mayContainName(normalizeName(name)) {
+		return true
+	}
+	for field, pattern := range map[string]string{"artist": spec.Artist, "genre": spec.Genre, "charter": spec.Charter} {
+		filter := idx.Fields[field]
+		if filter == nil {
+			continue
+		}
+		keys := make(map[string]bool)
+		trigrams(pattern, keys)
+		for key := range keys {
+			if !filter.mayContain(key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mayContainName reports whether every byte of a lowercased name query is in some name
+func (idx *QuickIndex) mayContainName(name string) bool {
+	for j := 0; j < len(name); j++ {
+		if idx.NameBytes[name[j]/64]&(1<<(name[j]%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// QuickReject checks the quick index for a search that can't match any song, returning
+// the number of songs in the library if so. The directory hash it computes is reused by
+// the next LoadSongs.
+func (s *Scanner) QuickReject(spec FilterSpec) (int, bool) {
+	if isRemoteLocation(s.rootDir) || (spec.Name == "" && spec.Artist == "" && spec.Genre == "" && spec.Charter == "") {
+		return 0, false
+	}
+	data, err := os.ReadFile(s.quickIndexFile())
+	if err != nil {
+		return 0, false
+	}
+	var idx QuickIndex
+	if err := json.Unmarshal(data, &idx); err != nil || idx.Version != quickIndexVersion {
+		return 0, false
+	}
+	if idx.Decoded != (s.opts.OnError == ParseRetry) {
+		return 0, false
+	}
+
+	hash, err := s.calculateDirHash()
+	if err != nil {
+		return 0, false
+	}
+	s.dirHash = hash
+	if idx.Hash != hash || !idx.rejects(spec) {
+		return 0, false
+	}
+	touchFile(s.quickIndexFile())
+	return idx.Songs, true
+}
+
+// searchLibrary runs the search of the root command, returning the number of songs in
+// the library, the matching songs and the filter used. A search the quick index rules
+// out is answered without loading the library.
+func searchLibrary() (int, []*Song, *Filter, error) {
+	scanners, err := newLibraryScanners()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	spec, err := buildFilterSpec()
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	// Difficulty names, intros and libraries are validated while loading, so those
+	// searches take the long way
+	if len(spec.difficultyFilters()) == 0 && len(spec.introFilters()) == 0 && len(spec.rootFilters()) == 0 {
+		if totals, ok := quickRejectAll(scanners, spec); ok {
+			total := 0
+			for i, scanner := range scanners {
+				emitEvent("scan", map[string]any{"directory": scanner.rootDir, "songs": totals[i]})
+				total += totals[i]
+			}
+			emitEvent("filter", map[string]any{"matched": 0, "total": total})
+			recordFilterSummary(0, 0, total)
+			filter, err := NewFilter(spec)
+			return total, nil, filter, err
+		}
+	}
+
+	songs, filteredSongs, filter, err := filterLibrary(scanners, spec)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return len(songs), filteredSongs, filter, nil
+}
+
+// quickRejectAll is QuickReject for several libraries: the search is only ruled out
+// when the quick index of every library rules it out. It returns the number of songs
+// in each library.
+func quickRejectAll(scanners []*Scanner, spec FilterSpec) ([]int, bool) {
+	totals := make([]int, len(scanners))
+	for i, scanner := range scanners {
+		total, ok := scanner.QuickReject(spec)
+		if !ok {
+			return nil, false
+		}
+		totals[i] = total
+	}
+	return totals, true
+}
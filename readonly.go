@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// readOnlyEnv lets shared setups force read-only mode without passing the flag every time
+const readOnlyEnv = "CLONEHEROER_READ_ONLY"
+
+// ErrReadOnly is returned when a command tries to modify the library in read-only mode
+type ErrReadOnly struct {
+	Action string
+}
+
+func (e *ErrReadOnly) Error() string {
+	return fmt.Sprintf("refusing to %s: read-only mode is enabled (--read-only or %s)", e.Action, readOnlyEnv)
+}
+
+// isReadOnly reports whether library modifications are disabled
+func isReadOnly() bool {
+	if readOnly {
+		return true
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv(readOnlyEnv))
+	return enabled
+}
+
+// ensureWritable returns an error if library modifications are disabled. Every command
+// that changes files in a song library must call this (directly or through the helpers
+// below) before touching anything.
+func ensureWritable(action string) error {
+	if isReadOnly() {
+		return &ErrReadOnly{Action: action}
+	}
+	return nil
+}
+
+// writeLibraryFile writes a file inside a song library, honouring read-only mode. The
+// file is replaced atomically so an interrupted write can't truncate it, and the cache
+// is updated for it once the command is done (see applyLibraryEdits).
+func writeLibraryFile(path string, data []byte, perm os.FileMode) error {
+	if err := ensureWritable("write " + path); err != nil {
+		return err
+	}
+	recordLibraryEdit(path)
+	return writeFileAtomic(path, data, perm)
+}
+
+// moveLibraryPath moves a file or folder inside a song library, honouring read-only mode.
+// The cache follows the move once the command is done (see applyLibraryEdits).
+func moveLibraryPath(src, dst string) error {
+	if err := ensureWritable("move " + src); err != nil {
+		return err
+	}
+	recordLibraryMove(src, dst)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// removeLibraryPath removes a file or folder inside a song library, honouring read-only mode
+func removeLibraryPath(path string) error {
+	if err := ensureWritable("remove " + path); err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
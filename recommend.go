@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	recommendDifficulty string
+	recommendMastery    float64
+	recommendLimit      int
+
+	recommendCmd = &cobra.Command{
+		Use:   "recommend",
+		Short: "Suggest the next songs to challenge yourself with",
+		Long: `Suggest a "next challenge" list for --instrument from your Clone Hero scores.
+
+Songs you have scored --mastery percent or better on are taken as your current level: the
+hardest diff_* intensity among them and the highest note density (notes per second) you
+handled at that intensity. Recommended songs are ones you haven't mastered yet that are one
+intensity step above that level, or at the same intensity but denser, easiest first.
+
+Scores are read from scoredata.bin in the Clone Hero data folder (the profile picked with
+--player, or --scores-file) and matched to songs by the checksum of their notes file. The
+file records no dates, so every mastered score counts, however long ago it was set.`,
+		RunE: runRecommend,
+	}
+)
+
+func init() {
+	recommendCmd.Flags().StringVar(&recommendDifficulty, "difficulty", "", "Difficulty you play (default: the one you have the most scores on)")
+	recommendCmd.Flags().Float64Var(&recommendMastery, "mastery", 95, "Score percentage that counts a song as mastered")
+	recommendCmd.Flags().IntVar(&recommendLimit, "limit", 10, "Number of songs to recommend")
+	rootCmd.AddCommand(recommendCmd)
+}
+
+// Recommendation is a suggested song with the chart stats it was picked by
+type Recommendation struct {
+	Song      *Song
+	Intensity int
+	Stats     ChartStats
+	Best      *ScoreEntry // nil if never played
+}
+
+// skillLevel describes the hardest songs a player has mastered
+type skillLevel struct {
+	Mastered  int
+	Intensity int
+	MaxNPS    float64 // densest mastered chart at Intensity
+}
+
+// playedSong is a song joined with its scores and chart stats
+type playedSong struct {
+	song   *Song
+	scores *SongScores
+	stats  ChartStats
+}
+
+func runRecommend(cmd *cobra.Command, args []string) error {
+	if filterInst == "" {
+		return fmt.Errorf("recommend needs --instrument")
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("recommend needs a local library")
+	}
+	inst := ParseInstrument(filterInst)
+
+	scores, scoresPath, err := loadScores()
+	if err != nil {
+		return err
+	}
+
+	difficulty, err := recommendedDifficulty(scores, inst)
+	if err != nil {
+		return err
+	}
+
+	allSongs, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	level := skillLevel{}
+	for _, played := range joinScores(allSongs, scores, inst, difficulty) {
+		best, ok := played.scores.Best(inst, difficulty)
+		if !ok || best.Percent() < recommendMastery {
+			continue
+		}
+		level.Mastered++
+		intensity := played.song.Instruments[inst]
+		nps := played.stats.NotesPerSecond()
+		switch {
+		case intensity > level.Intensity:
+			level.Intensity, level.MaxNPS = intensity, nps
+		case intensity == level.Intensity && nps > level.MaxNPS:
+			level.MaxNPS = nps
+		}
+	}
+	if level.Mastered == 0 {
+		return fmt.Errorf("no %s %s scores of %g%% or better in %s", inst, difficulty, recommendMastery, scoresPath)
+	}
+
+	recommendations := recommendSongs(songs, scores, inst, difficulty, level)
+	if recommendLimit > 0 && len(recommendations) > recommendLimit {
+		recommendations = recommendations[:recommendLimit]
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if player != "" {
+		fmt.Fprintf(writer, "Player: %s\n", player)
+	}
+	fmt.Fprintf(writer, "%s on %s: %d song(s) at %g%%+, up to intensity %d at %.1f notes/s\n\n",
+		inst, difficulty, level.Mastered, recommendMastery, level.Intensity, level.MaxNPS)
+	if len(recommendations) == 0 {
+		fmt.Fprintln(writer, "No harder songs found; you've mastered everything at the next level")
+		return nil
+	}
+	fmt.Fprintln(writer, "Next challenges:")
+	for i, r := range recommendations {
+		played := "not played"
+		if r.Best != nil {
+			played = fmt.Sprintf("best %.0f%%", r.Best.Percent())
+		}
+		fmt.Fprintf(writer, "%3d. %s - %s  (intensity %d, %.1f notes/s, %s)\n",
+			i+1, r.Song.Artist, r.Song.Name, r.Intensity, r.Stats.NotesPerSecond(), played)
+	}
+	return nil
+}
+
+// recommendedDifficulty returns --difficulty, or the difficulty with the most scores on inst
+func recommendedDifficulty(scores ScoreData, inst Instrument) (Difficulty, error) {
+	if recommendDifficulty != "" {
+		return parseDifficulty(recommendDifficulty)
+	}
+
+	counts := make(map[Difficulty]int)
+	for _, song := range scores {
+		for _, entry := range song.Scores {
+			if entry.Instrument == inst {
+				counts[entry.Difficulty]++
+			}
+		}
+	}
+	var most Difficulty
+	for _, difficulty := range difficulties {
+		if counts[difficulty] > 0 && counts[difficulty] >= counts[most] {
+			most = difficulty
+		}
+	}
+	if most == "" {
+		return "", fmt.Errorf("no %s scores found", inst)
+	}
+	return most, nil
+}
+
+// joinScores reads the notes file of every song that has a score on inst at difficulty
+func joinScores(songs []*Song, scores ScoreData, inst Instrument, difficulty Difficulty) []playedSong {
+	var played []playedSong
+	for _, song := range songs {
+		checksum, err := songChecksum(song)
+		if err != nil {
+			continue
+		}
+		songScores, ok := scores[checksum]
+		if !ok {
+			continue
+		}
+		if _, ok := songScores.Best(inst, difficulty); !ok {
+			continue
+		}
+		chart, err := loadSongChart(song)
+		if err != nil {
+			continue
+		}
+		played = append(played, playedSong{song: song, scores: songScores, stats: chart.Stats(inst, difficulty)})
+	}
+	return played
+}
+
+// recommendSongs picks the unmastered songs just above the player's level, ordered by
+// intensity and then note density
+func recommendSongs(songs []*Song, scores ScoreData, inst Instrument, difficulty Difficulty, level skillLevel) []Recommendation {
+	var recommendations []Recommendation
+	for _, song := range songs {
+		intensity := song.Instruments[inst]
+		if intensity < level.Intensity || intensity > level.Intensity+1 {
+			continue
+		}
+
+		chart, err := loadSongChart(song)
+		if err != nil {
+			continue
+		}
+		stats := chart.Stats(inst, difficulty)
+		if stats.Notes == 0 || (intensity == level.Intensity && stats.NotesPerSecond() <= level.MaxNPS) {
+			continue
+		}
+
+		r := Recommendation{Song: song, Intensity: intensity, Stats: stats}
+		if checksum, err := songChecksum(song); err == nil {
+			if songScores, ok := scores[checksum]; ok {
+				if best, ok := songScores.Best(inst, difficulty); ok {
+					if best.Percent() >= recommendMastery {
+						continue
+					}
+					r.Best = &best
+				}
+			}
+		}
+		recommendations = append(recommendations, r)
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Intensity != recommendations[j].Intensity {
+			return recommendations[i].Intensity < recommendations[j].Intensity
+		}
+		return recommendations[i].Stats.NotesPerSecond() < recommendations[j].Stats.NotesPerSecond()
+	})
+	return recommendations
+}
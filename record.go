@@ -0,0 +1,152 @@
+package main
+
+import "math"
+
+// SchemaVersion is the version of the JSON/NDJSON output schema. Changes to the schema
+// are additive only: fields may be added, but existing fields are never removed, renamed
+// or change type without bumping this version.
+const SchemaVersion = 1
+
+// SongRecord is the JSON representation of a song used by machine-readable output
+type SongRecord struct {
+	Name          string         `json:"name"`
+	Artist        string         `json:"artist"`
+	Album         string         `json:"album,omitempty"`
+	Genre         string         `json:"genre,omitempty"`
+	Year          int            `json:"year,omitempty"`
+	Charters      []string       `json:"charters"`
+	Length        string         `json:"length"`    // in the --duration-format
+	LengthMs      int64          `json:"length_ms"` // the same in milliseconds
+	Instruments   map[string]int `json:"instruments"`
+	AlbumTrack    int            `json:"album_track,omitempty"`
+	PlaylistTrack int            `json:"playlist_track,omitempty"`
+	Tags          []string       `json:"tags,omitempty"`
+	Rating        int            `json:"rating,omitempty"`
+	Link          string         `json:"link,omitempty"`
+	LoadingPhrase string         `json:"loading_phrase,omitempty"`
+	Path          string         `json:"path"`
+	Packed        bool           `json:"packed,omitempty"`
+	Root          string         `json:"root,omitempty"` // library (-d) the song was found in
+	Hash          string         `json:"hash,omitempty"` // hash of the notes file, with --show-hash
+
+	// What the notes file holds, when it was read (e.g. for --has-difficulty or
+	// --instrument-source chart)
+	Charted    map[string][]string        `json:"charted,omitempty"`
+	NoteCounts map[string]int             `json:"note_counts,omitempty"`
+	FirstNotes map[string]int64           `json:"first_notes_ms,omitempty"` // when each part starts, in milliseconds
+	Techniques map[string]TechniqueRecord `json:"techniques,omitempty"`
+	Sections   []string                   `json:"sections,omitempty"`
+
+	// Original values of fields that had rich text tags (e.g. <color=#FF0000>), which
+	// are stripped from the fields above
+	NameRaw          string   `json:"name_raw,omitempty"`
+	ArtistRaw        string   `json:"artist_raw,omitempty"`
+	AlbumRaw         string   `json:"album_raw,omitempty"`
+	GenreRaw         string   `json:"genre_raw,omitempty"`
+	ChartersRaw      []string `json:"charters_raw,omitempty"`
+	LoadingPhraseRaw string   `json:"loading_phrase_raw,omitempty"`
+}
+
+// TechniqueRecord is the JSON representation of the chords, HOPOs, taps and sustains of
+// the hardest charted difficulty of a part
+type TechniqueRecord struct {
+	Chords           int     `json:"chords"`
+	HOPOs            int     `json:"hopos"`
+	Taps             int     `json:"taps"`
+	Opens            int     `json:"opens"`
+	Sustains         int     `json:"sustains"`
+	SustainCoverage  float64 `json:"sustain_coverage"` // share of the part during which a note is held, from 0 to 1
+	LongestSustainMs int64   `json:"longest_sustain_ms"`
+}
+
+// NewSongRecord converts a song to its JSON representation
+func NewSongRecord(song *Song) SongRecord {
+	charters := make([]string, len(song.Charters))
+	var chartersRaw []string
+	for i, charter := range song.Charters {
+		charters[i] = plainCharter(charter)
+		if charters[i] != charter {
+			chartersRaw = song.Charters
+		}
+	}
+
+	instruments := make(map[string]int, len(song.Instruments))
+	for inst, diff := range song.Instruments {
+		instruments[string(inst)] = diff
+	}
+
+	var charted map[string][]string
+	var noteCounts map[string]int
+	var firstNotes map[string]int64
+	var techniques map[string]TechniqueRecord
+	if len(song.Charted) > 0 {
+		charted = make(map[string][]string, len(song.Charted))
+		noteCounts = make(map[string]int, len(song.NoteCounts))
+		for inst, ds := range song.Charted {
+			for _, d := range ds {
+				charted[string(inst)] = append(charted[string(inst)], string(d))
+			}
+			noteCounts[string(inst)] = song.NoteCounts[inst]
+		}
+		firstNotes = make(map[string]int64, len(song.FirstNotes))
+		for inst, first := range song.FirstNotes {
+			firstNotes[string(inst)] = first.Milliseconds()
+		}
+		techniques = make(map[string]TechniqueRecord, len(song.PartStats))
+		for inst, stats := range song.PartStats {
+			techniques[string(inst)] = TechniqueRecord{
+				Chords:           stats.Chords,
+				HOPOs:            stats.HOPOs,
+				Taps:             stats.Taps,
+				Opens:            stats.Opens,
+				Sustains:         stats.Sustains,
+				SustainCoverage:  math.Round(stats.SustainCoverage()*1000) / 1000,
+				LongestSustainMs: stats.LongestSustain.Milliseconds(),
+			}
+		}
+	}
+
+	return SongRecord{
+		Name:          song.Name,
+		Artist:        song.Artist,
+		Album:         song.Album,
+		Genre:         song.Genre,
+		Year:          song.Year,
+		Charters:      charters,
+		Length:        song.DataLength(),
+		LengthMs:      song.Length.Milliseconds(),
+		Instruments:   instruments,
+		AlbumTrack:    song.AlbumTrack,
+		PlaylistTrack: song.PlaylistTrack,
+		Tags:          song.Tags,
+		Rating:        song.Rating,
+		Link:          song.Permalink,
+		LoadingPhrase: song.LoadingPhrase,
+		Path:          song.Path,
+		Packed:        song.Packed,
+		Root:          song.Root,
+		Hash:          shownHash(song),
+
+		Charted:    charted,
+		NoteCounts: noteCounts,
+		FirstNotes: firstNotes,
+		Techniques: techniques,
+		Sections:   song.Sections,
+
+		NameRaw:          song.Raw["name"],
+		ArtistRaw:        song.Raw["artist"],
+		AlbumRaw:         song.Raw["album"],
+		GenreRaw:         song.Raw["genre"],
+		ChartersRaw:      chartersRaw,
+		LoadingPhraseRaw: song.Raw["loading_phrase"],
+	}
+}
+
+// newSongRecords converts a list of songs to their JSON representation
+func newSongRecords(songs []*Song) []SongRecord {
+	records := make([]SongRecord, len(songs))
+	for i, song := range songs {
+		records[i] = NewSongRecord(song)
+	}
+	return records
+}
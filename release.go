@@ -0,0 +1,412 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	releaseZip       string
+	releaseForce     bool
+	releaseKeepNames bool
+	releaseDryRun    bool
+
+	releaseCmd = &cobra.Command{
+		Use:   "release <folder>",
+		Short: "Check, tidy and zip a pack of songs for distribution",
+		Long: `Get a pack of songs ready to share:
+
+ 1. Check every song: the lint rules, that its song.ini parses, that its notes file can
+    be read and has notes, that notes.chart agrees with song.ini (see chart-check) and
+    that it has audio. Any problem stops the release, unless --force is given.
+ 2. Rename each song folder to "Artist - Name (Charter)", unless --keep-names is given.
+ 3. Zip the pack as <folder>.zip next to it (or --zip), with a folder per song inside a
+    folder named after the pack, leaving out system files such as .DS_Store. The zip
+    also holds a README.txt listing the songs, the manifest.json of "manifest" and the
+    SHA256SUMS of "checksum create", which "checksum verify" checks after unzipping.
+
+With --dry-run, the songs are checked and the renames printed, but nothing is changed
+or written.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runRelease,
+	}
+)
+
+func init() {
+	releaseCmd.Flags().StringVar(&releaseZip, "zip", "", "Where to write the zip (default: <folder>.zip next to the folder)")
+	releaseCmd.Flags().BoolVar(&releaseForce, "force", false, "Release the pack even if some songs have problems")
+	releaseCmd.Flags().BoolVar(&releaseKeepNames, "keep-names", false, "Don't rename the song folders")
+	releaseCmd.Flags().BoolVar(&releaseDryRun, "dry-run", false, "Only check the songs and print the renames")
+	rootCmd.AddCommand(releaseCmd)
+}
+
+// releaseJunk are files that operating systems leave in folders, which don't belong in
+// a released pack
+var releaseJunk = map[string]bool{".ds_store": true, "thumbs.db": true, "desktop.ini": true}
+
+// isReleaseJunk reports whether a file or folder is left out of a released pack: system
+// files and the files cloneheroer keeps in a library
+func isReleaseJunk(name string) bool {
+	return releaseJunk[strings.ToLower(name)] || strings.HasPrefix(name, "._") || strings.HasPrefix(name, ".cloneheroer")
+}
+
+// releaseStored are extensions of files that are already compressed, so they're stored
+// in the zip as is
+var releaseStored = map[string]bool{".ogg": true, ".opus": true, ".mp3": true, ".png": true, ".jpg": true,
+	".jpeg": true, ".sng": true, ".mp4": true, ".webm": true, ".zip": true}
+
+// invalidFolderChars are characters Windows doesn't allow in file names
+const invalidFolderChars = `<>:"/\|?*`
+
+func runRelease(cmd *cobra.Command, args []string) error {
+	folder, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", args[0])
+	}
+	if !releaseDryRun {
+		if err := ensureWritable("release a pack"); err != nil {
+			return err
+		}
+	}
+	zipPath := releaseZip
+	if zipPath == "" {
+		zipPath = folder + ".zip"
+	}
+
+	policy, err := parsePolicy()
+	if err != nil {
+		return err
+	}
+	scanner := NewScanner(folder, ScanOptions{Context: commandContext(), OnError: policy})
+	songs, err := scanner.LoadSongs()
+	if err != nil {
+		return err
+	}
+	if len(songs) == 0 {
+		return fmt.Errorf("no songs found in %s", folder)
+	}
+	tagRoot(songs, folder)
+	sort.Slice(songs, func(i, j int) bool { return songs[i].Path < songs[j].Path })
+
+	problems := 0
+	for _, failure := range scanner.Errors() {
+		fmt.Printf("%s: song.ini doesn't parse: %s\n", failure.Path, failure.Error)
+		problems++
+	}
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		for _, problem := range releaseProblems(song) {
+			fmt.Printf("%s: %s\n", song.Path, problem)
+			problems++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Checked %d song(s): %d problem(s)\n", len(songs), problems)
+	if problems > 0 && !releaseForce {
+		return fmt.Errorf("%d problem(s) found; fix them or release anyway with --force", problems)
+	}
+
+	if !releaseKeepNames {
+		if err := renameSongFolders(folder, songs); err != nil {
+			return err
+		}
+	}
+	if releaseDryRun {
+		return nil
+	}
+
+	if err := writeReleaseZip(zipPath, folder, songs); err != nil {
+		return err
+	}
+	fmt.Printf("Released %d song(s) to %s\n", len(songs), zipPath)
+	return nil
+}
+
+// releaseProblems checks a song before release, returning what's wrong with it
+func releaseProblems(song *Song) []string {
+	var problems []string
+	issues, _ := lintSongs([]*Song{song}, lintRuleSet)
+	for _, issue := range issues {
+		if issue.Severity == SeverityInfo || (issue.Rename != "" && !releaseKeepNames) {
+			continue // harmless, or the folder is renamed on release
+		}
+		problems = append(problems, fmt.Sprintf("[%s] %s", issue.Rule, issue.Message))
+	}
+
+	if chart, err := loadSongChart(song); err != nil {
+		problems = append(problems, fmt.Sprintf("notes file can't be read: %v", err))
+	} else if len(chart.ChartedDifficulties()) == 0 {
+		problems = append(problems, "notes file has no notes")
+	}
+
+	if !hasSongAudio(song) {
+		problems = append(problems, "no audio files")
+	}
+	return problems
+}
+
+// hasSongAudio reports whether a song folder, or .sng file, has any of the audio stems
+// Clone Hero plays
+func hasSongAudio(song *Song) bool {
+	if !song.Packed {
+		return len(songAudioFiles(filepath.Dir(song.Path))) > 0
+	}
+	archive, err := OpenSng(song.Path)
+	if err != nil {
+		return false
+	}
+	for _, file := range archive.Files {
+		ext := strings.ToLower(path.Ext(file.Name))
+		stem := strings.ToLower(strings.TrimSuffix(file.Name, path.Ext(file.Name)))
+		for _, audio := range audioStems {
+			if stem == audio && containsFold(audioExtensions, ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// releaseFolderName returns the folder name of a released song: "Artist - Name (Charter)"
+func releaseFolderName(song *Song) string {
+	return formatFolderName(song, defaultFolderTemplate)
+}
+
+// renameSongFolders renames the folder of every song to its release name, updating the
+// song's path. Songs not in a folder of their own are left alone.
+func renameSongFolders(root string, songs []*Song) error {
+	renamed := 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		folder, err := filepath.Abs(songFolder(song))
+		if err != nil || folder == root {
+			continue
+		}
+		name := releaseFolderName(song)
+		if name == filepath.Base(folder) {
+			continue
+		}
+		rel, _ := filepath.Rel(root, folder)
+		fmt.Printf("rename: %s -> %s\n", rel, name)
+		if releaseDryRun {
+			continue
+		}
+		if err := renameSongFolder(song, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", rel, err)
+			continue
+		}
+		renamed++
+	}
+	if renamed > 0 {
+		fmt.Printf("Renamed %d song folder(s)\n", renamed)
+	}
+	return nil
+}
+
+// writeReleaseZip zips the pack folder into zipPath, along with its README.txt and
+// manifest.json. The zip is written next to zipPath first, so an interrupted release
+// never leaves half a zip behind.
+func writeReleaseZip(zipPath, folder string, songs []*Song) error {
+	tmp := zipPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(file)
+	err = addReleaseFiles(zw, folder, zipPath, songs)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", zipPath, err)
+	}
+	return os.Rename(tmp, zipPath)
+}
+
+// addReleaseFiles writes the files of the pack, then README.txt, manifest.json and the
+// SHA256SUMS of them all, into a folder named after the pack
+func addReleaseFiles(zw *zip.Writer, folder, zipPath string, songs []*Song) error {
+	pack := filepath.Base(folder)
+	var checksums []FileChecksum
+	err := filepath.WalkDir(folder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+		if isReleaseJunk(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || p == zipPath || p == zipPath+".tmp" {
+			return nil
+		}
+		rel, err := filepath.Rel(folder, p)
+		if err != nil || rel == checksumFileName {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		sum, err := addZipFile(zw, p, path.Join(pack, rel))
+		checksums = append(checksums, FileChecksum{Path: rel, Sum: sum})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var readme bytes.Buffer
+	writeReleaseReadme(&readme, pack, songs)
+	manifest, err := releaseManifest(folder, pack, songs)
+	if err != nil {
+		return err
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	generated := []struct {
+		name string
+		data []byte
+	}{{"README.txt", readme.Bytes()}, {"manifest.json", append(manifestJSON, '\n')}}
+	for _, file := range generated {
+		sum := sha256.Sum256(file.data)
+		checksums = append(checksums, FileChecksum{Path: file.name, Sum: hex.EncodeToString(sum[:])})
+		if err := addZipData(zw, path.Join(pack, file.name), file.data); err != nil {
+			return err
+		}
+	}
+	return addZipData(zw, path.Join(pack, checksumFileName), encodeChecksums(checksums))
+}
+
+// addZipFile copies a file into the zip, compressing it unless it's already compressed,
+// and returns its SHA-256 checksum
+func addZipFile(zw *zip.Writer, source, name string) (string, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return "", err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	if releaseStored[strings.ToLower(filepath.Ext(source))] {
+		header.Method = zip.Store
+	}
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, hash), file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addZipData writes a file generated by the release into the zip
+func addZipData(zw *zip.Writer, name string, data []byte) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// writeReleaseReadme writes the README.txt of a pack: its songs with their length,
+// charters and parts
+func writeReleaseReadme(w io.Writer, pack string, songs []*Song) {
+	var total time.Duration
+	for _, song := range songs {
+		total += song.Length
+	}
+	fmt.Fprintf(w, "%s\r\n\r\n%d song(s), %s\r\n\r\n", pack, len(songs), formatDuration(total))
+	for i, song := range songs {
+		fmt.Fprintf(w, "%d. %s - %s (%s)\r\n", i+1, song.Artist, song.Name, formatDuration(song.Length))
+		if charters := plainCharters(song); charters != "" {
+			fmt.Fprintf(w, "   Charted by %s\r\n", charters)
+		}
+		if parts := sortedInstruments(song); parts != "" {
+			fmt.Fprintf(w, "   Parts: %s\r\n", parts)
+		}
+	}
+	fmt.Fprintf(w, "\r\nGenerated by cloneheroer on %s\r\n", time.Now().Format("2006-01-02"))
+}
+
+// sortedInstruments lists a song's parts with their difficulty, sorted by name
+func sortedInstruments(song *Song) string {
+	parts := make([]string, 0, len(song.Instruments))
+	for inst, diff := range song.Instruments {
+		parts = append(parts, fmt.Sprintf("%s %d", inst, diff))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// releaseManifest builds the manifest of a released pack, with song paths relative to
+// the pack folder
+func releaseManifest(folder, pack string, songs []*Song) (Manifest, error) {
+	manifest := Manifest{SchemaVersion: SchemaVersion, Root: pack, Generated: time.Now().UTC()}
+	for _, song := range songs {
+		files, err := localFolderFiles(song)
+		if err != nil {
+			return Manifest{}, err
+		}
+		rel, err := filepath.Rel(folder, song.Path)
+		if err != nil {
+			return Manifest{}, err
+		}
+		entry := ManifestEntry{
+			Name:     song.Name,
+			Artist:   song.Artist,
+			Album:    song.Album,
+			Charters: song.Charters,
+			Path:     filepath.ToSlash(rel),
+		}
+		for _, file := range files {
+			if !isReleaseJunk(file.Name) {
+				entry.Files = append(entry.Files, file)
+				entry.Size += file.Size
+			}
+		}
+		entry.SizeText = formatSize(entry.Size)
+		manifest.TotalSize += entry.Size
+		manifest.Songs = append(manifest.Songs, entry)
+	}
+	manifest.TotalSizeText = formatSize(manifest.TotalSize)
+	return manifest, nil
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RemoteObject is a file in a cloud-hosted library
+type RemoteObject struct {
+	Key     string // path relative to the library root, using forward slashes
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// RemoteBackend enumerates and reads files from a cloud-hosted library. Backends are
+// read-only: the tool never writes to remote libraries.
+type RemoteBackend interface {
+	// List returns every file under the library root
+	List(ctx context.Context) ([]RemoteObject, error)
+	// Read downloads a single file
+	Read(ctx context.Context, key string) ([]byte, error)
+	// URL returns a printable location for a file, used as the song path
+	URL(key string) string
+}
+
+// isRemoteLocation reports whether dir refers to a cloud library rather than a local path
+func isRemoteLocation(dir string) bool {
+	for _, scheme := range []string{"s3://", "b2://", "webdav://", "webdav+http://"} {
+		if strings.HasPrefix(dir, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewRemoteBackend creates the backend for a remote library location. Supported forms:
+//
+//	s3://bucket/prefix          (AWS or any S3-compatible endpoint)
+//	b2://bucket/prefix          (Backblaze B2 through its S3-compatible API)
+//	webdav://host/path          (WebDAV over https)
+//	webdav+http://host/path     (WebDAV over plain http)
+func NewRemoteBackend(location string) (RemoteBackend, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote location %q: %w", location, err)
+	}
+
+	switch u.Scheme {
+	case "s3":
+		return newS3Backend(u, firstEnv("CLONEHEROER_S3_ENDPOINT", "AWS_ENDPOINT_URL"),
+			firstEnv("AWS_ACCESS_KEY_ID"), firstEnv("AWS_SECRET_ACCESS_KEY"))
+	case "b2":
+		endpoint := firstEnv("CLONEHEROER_S3_ENDPOINT", "B2_ENDPOINT")
+		if endpoint == "" {
+			return nil, fmt.Errorf("b2 libraries need the bucket's S3 endpoint in CLONEHEROER_S3_ENDPOINT (e.g. https://s3.us-west-004.backblazeb2.com)")
+		}
+		return newS3Backend(u, endpoint,
+			firstEnv("B2_APPLICATION_KEY_ID", "AWS_ACCESS_KEY_ID"), firstEnv("B2_APPLICATION_KEY", "AWS_SECRET_ACCESS_KEY"))
+	case "webdav", "webdav+http":
+		scheme := "https"
+		if u.Scheme == "webdav+http" {
+			scheme = "http"
+		}
+		return &webdavBackend{
+			base:     &url.URL{Scheme: scheme, Host: u.Host, Path: strings.TrimSuffix(u.Path, "/") + "/"},
+			location: strings.TrimSuffix(location, "/"),
+			username: os.Getenv("WEBDAV_USERNAME"),
+			password: os.Getenv("WEBDAV_PASSWORD"),
+			client:   &http.Client{Timeout: 60 * time.Second},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported remote location %q", location)
+}
+
+// firstEnv returns the first non-empty environment variable of the given names
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// s3Backend reads a library from an S3-compatible bucket using path-style requests
+type s3Backend struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	location  string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	client    *http.Client
+}
+
+func newS3Backend(u *url.URL, endpoint, accessKey, secretKey string) (*s3Backend, error) {
+	region := firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &s3Backend{
+		endpoint:  endpointURL,
+		bucket:    u.Host,
+		prefix:    prefix,
+		location:  fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, prefix),
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// s3ListResult is the subset of a ListObjectsV2 response the scanner needs
+type s3ListResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+	}
+}
+
+func (b *s3Backend) List(ctx context.Context) ([]RemoteObject, error) {
+	var objects []RemoteObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {b.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		body, err := b.do(ctx, "/"+b.bucket, query)
+		if err != nil {
+			return nil, err
+		}
+		var result s3ListResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("invalid bucket listing: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			objects = append(objects, RemoteObject{
+				Key:     strings.TrimPrefix(c.Key, b.prefix),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+				ETag:    strings.Trim(c.ETag, `"`),
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (b *s3Backend) Read(ctx context.Context, key string) ([]byte, error) {
+	return b.do(ctx, "/"+b.bucket+"/"+b.prefix+key, nil)
+}
+
+func (b *s3Backend) URL(key string) string {
+	return b.location + key
+}
+
+// do performs a signed GET request against the bucket and returns the response body
+func (b *s3Backend) do(ctx context.Context, objectPath string, query url.Values) ([]byte, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.accessKey != "" {
+		b.sign(req, time.Now().UTC())
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u.Redacted(), resp.Status)
+	}
+	return body, nil
+}
+
+// emptyPayloadHash is the SHA256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign adds AWS Signature Version 4 headers to a body-less request
+func (b *s3Backend) sign(req *http.Request, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if b.token != "" {
+		req.Header.Set("x-amz-security-token", b.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := dateStamp + "/" + b.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+b.secretKey), dateStamp)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters, as
+// required by SigV4 canonical requests
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EscapePath escapes each segment of a path, keeping the slashes
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery encodes query parameters sorted by key, as SigV4 expects
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// webdavBackend reads a library from a WebDAV share
+type webdavBackend struct {
+	base     *url.URL
+	location string
+	username string
+	password string
+	client   *http.Client
+}
+
+// webdavMultistatus is the subset of a PROPFIND response the scanner needs
+type webdavMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength int64  `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+				ETag          string `xml:"getetag"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const webdavPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:getlastmodified/><d:getetag/><d:resourcetype/></d:prop></d:propfind>`
+
+func (b *webdavBackend) List(ctx context.Context) ([]RemoteObject, error) {
+	var objects []RemoteObject
+	// Depth: infinity is disabled on most servers, so walk one level at a time
+	pending := []string{b.base.Path}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		u := *b.base
+		u.Path = dir
+		req, err := http.NewRequestWithContext(ctx, "PROPFIND", u.String(), strings.NewReader(webdavPropfindBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Depth", "1")
+		req.Header.Set("Content-Type", "application/xml")
+		body, err := b.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var status webdavMultistatus
+		if err := xml.Unmarshal(body, &status); err != nil {
+			return nil, fmt.Errorf("invalid PROPFIND response for %s: %w", dir, err)
+		}
+		for _, r := range status.Responses {
+			href, err := url.Parse(r.Href)
+			if err != nil || len(r.Propstat) == 0 {
+				continue
+			}
+			hrefPath := href.Path
+			if strings.TrimSuffix(hrefPath, "/") == strings.TrimSuffix(dir, "/") {
+				continue // the directory itself
+			}
+
+			prop := r.Propstat[0].Prop
+			if prop.ResourceType.Collection != nil {
+				pending = append(pending, strings.TrimSuffix(hrefPath, "/")+"/")
+				continue
+			}
+			modTime, _ := http.ParseTime(prop.LastModified)
+			objects = append(objects, RemoteObject{
+				Key:     strings.TrimPrefix(hrefPath, b.base.Path),
+				Size:    prop.ContentLength,
+				ModTime: modTime,
+				ETag:    strings.Trim(prop.ETag, `"`),
+			})
+		}
+	}
+	return objects, nil
+}
+
+func (b *webdavBackend) Read(ctx context.Context, key string) ([]byte, error) {
+	u := *b.base
+	u.Path = path.Join(b.base.Path, key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return b.do(req)
+}
+
+func (b *webdavBackend) URL(key string) string {
+	return b.location + "/" + key
+}
+
+// do sends an authenticated request and returns the response body
+func (b *webdavBackend) do(req *http.Request) ([]byte, error) {
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("%s: %s", req.URL.Redacted(), resp.Status)
+	}
+	return body, nil
+}
+
+// loadRemoteSongs lists a cloud library and parses its song.ini files. Only the song.ini
+// files are downloaded, into a local mirror next to the cache file; audio is never fetched.
+func (s *Scanner) loadRemoteSongs() ([]*Song, error) {
+	backend, err := NewRemoteBackend(s.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	ctx := s.opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	objects, err := backend.List(ctx)
+	if err := s.interrupted(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", s.rootDir, err)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+
+	// The listing stands in for the directory hash: any added, removed or changed
+	// object invalidates the cache
+	hash := sha256.New()
+	for _, obj := range objects {
+		fmt.Fprintf(hash, "%s\x00%s\x00%d\n", obj.Key, obj.ETag, obj.Size)
+	}
+	currentHash := hex.EncodeToString(hash.Sum(nil))
+
+	cached, err := s.loadCache()
+	if err == nil && cached.Hash == currentHash && s.cacheUsable(cached) {
+		s.errors = cached.Errors
+		touchFile(s.cacheFile)
+		return s.convertCacheToSongs(cached), nil
+	}
+	if err == nil && cached.Partial {
+		s.resumeFrom(cached)
+	}
+	if err == nil {
+		s.quarantineFrom(cached)
+	}
+
+	mirror := strings.TrimSuffix(s.cacheFile, ".json") + "_remote"
+	var songs []*Song
+	for _, obj := range objects {
+		if !isRemoteSongIni(obj.Key) {
+			continue
+		}
+		if song, ok := s.resumed(backend.URL(obj.Key), obj.ModTime); ok {
+			songs = append(songs, song)
+			s.found.Add(1)
+			continue
+		}
+
+		songURL, modTime := backend.URL(obj.Key), obj.ModTime.String()
+		if prev, ok := s.quarantined[songURL]; ok && prev.ModTime == modTime {
+			if err := s.recordFailure(songURL, modTime, errors.New(prev.Error)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		song, err := s.parseRemoteSong(ctx, backend, mirror, obj.Key)
+		if err := s.interrupted(); err != nil {
+			s.savePartialCache(songs)
+			return nil, err
+		}
+		if err != nil {
+			if err := s.recordFailure(songURL, modTime, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		songs = append(songs, song)
+		s.found.Add(1)
+	}
+	s.reportQuarantine()
+
+	if err := s.saveCache(currentHash, songs, false); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save cache: %v\n", err)
+	}
+	return songs, nil
+}
+
+// isRemoteSongIni reports whether a remote key is a song.ini file that is safe to mirror
+func isRemoteSongIni(key string) bool {
+	return strings.EqualFold(path.Base(key), "song.ini") && !strings.Contains(key, "..")
+}
+
+// parseRemoteSong downloads a single song.ini into the mirror and parses it
+func (s *Scanner) parseRemoteSong(ctx context.Context, backend RemoteBackend, mirror, key string) (*Song, error) {
+	data, err := backend.Read(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	local := filepath.Join(mirror, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(local, data, 0644); err != nil {
+		return nil, err
+	}
+
+	song, err := s.parseFile(local)
+	if err != nil {
+		return nil, err
+	}
+	song.Path = backend.URL(key)
+	return song, nil
+}
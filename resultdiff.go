@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var diffLast bool
+
+func init() {
+	rootCmd.Flags().BoolVarP(&diffLast, "diff-last", "", false, "Mark songs added to, moved in and removed from the results since the last run of the same search")
+}
+
+// ResultSnapshot is the matched set of a search, saved after every run so the next run
+// of the same search can be compared with it
+type ResultSnapshot struct {
+	Time      time.Time    `json:"time"`
+	Directory string       `json:"directory,omitempty"` // the library searched
+	Songs     []ResultSong `json:"songs"`
+}
+
+// ResultSong identifies a matched song; name and artist are kept so removed songs can
+// still be shown once their folder is gone, and the checksum of its notes file to tell
+// when it moved
+type ResultSong struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Artist   string `json:"artist"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// ResultDiff is the difference between a search's results and its previous run
+type ResultDiff struct {
+	Since   time.Time             // when the previous run happened
+	Added   map[string]bool       // paths of songs that weren't matched last time
+	Moved   map[string]ResultSong // songs matched last time in another folder, by their new path
+	Removed []ResultSong          // songs matched last time but not now
+}
+
+// resultSnapshotFile returns where the results of a search are saved: searches are the
+// same when they cover the same library with the same filters
+func resultSnapshotFile(spec FilterSpec) (string, error) {
+	key, err := json.Marshal(struct {
+		Directory    string
+		Filter       FilterSpec
+		LengthSource string
+	}{librariesKey(), spec, lengthSource})
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(key)
+	return filepath.Join(cacheDir(), fmt.Sprintf("results_%x.json", hash[:8])), nil
+}
+
+// librariesKey identifies the libraries searched, the absolute path of each
+func librariesKey() string {
+	roots := make([]string, len(directories))
+	for i, dir := range directories {
+		roots[i] = absLibrary(dir)
+	}
+	return strings.Join(roots, "\n")
+}
+
+// loadResultSnapshot reads the saved results of the previous run; nil if there are none
+func loadResultSnapshot(path string) (*ResultSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot ResultSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("invalid results file %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// saveResultSnapshot saves the matched songs of this run
+func saveResultSnapshot(path string, songs []*Song) error {
+	snapshot := ResultSnapshot{Time: time.Now(), Directory: absLibrary(directory), Songs: make([]ResultSong, len(songs))}
+	for i, song := range songs {
+		snapshot.Songs[i] = ResultSong{Path: song.Path, Name: song.Name, Artist: song.Artist, Checksum: song.Checksum}
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// diffResults compares the matched songs with a previous snapshot. A song that's new to
+// the results but has the notes file of one that's gone from them has moved folders,
+// and is neither added nor removed.
+func diffResults(previous *ResultSnapshot, songs []*Song) *ResultDiff {
+	diff := &ResultDiff{Since: previous.Time, Added: make(map[string]bool), Moved: make(map[string]ResultSong)}
+	before := make(map[string]string, len(previous.Songs))
+	byPath := make(map[string]ResultSong, len(previous.Songs))
+	for _, song := range previous.Songs {
+		before[song.Path] = song.Checksum
+		byPath[song.Path] = song
+	}
+	now := songChecksums(songs)
+	moves := findMoves(before, now)
+	moved := make(map[string]bool, len(moves))
+	for _, song := range songs {
+		if from, ok := moves[song.Path]; ok {
+			diff.Moved[song.Path] = byPath[from]
+			moved[from] = true
+		} else if _, ok := before[song.Path]; !ok {
+			diff.Added[song.Path] = true
+		}
+	}
+	for _, song := range previous.Songs {
+		if _, ok := now[song.Path]; !ok && !moved[song.Path] {
+			diff.Removed = append(diff.Removed, song)
+		}
+	}
+	return diff
+}
+
+// compareWithLastRun saves this run's results and, with --diff-last, returns how they
+// differ from the previous run of the same search. A nil diff means there was nothing
+// to compare with.
+func compareWithLastRun(spec FilterSpec, songs []*Song) *ResultDiff {
+	path, err := resultSnapshotFile(spec)
+	if err != nil {
+		return nil
+	}
+
+	var diff *ResultDiff
+	if diffLast {
+		previous, err := loadResultSnapshot(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: can't compare with the last run: %v\n", err)
+		} else if previous == nil {
+			fmt.Fprintln(os.Stderr, "No previous run of this search to compare with")
+		} else {
+			diff = diffResults(previous, songs)
+		}
+	}
+
+	if err := saveResultSnapshot(path, songs); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save results for --diff-last: %v\n", err)
+	}
+	return diff
+}
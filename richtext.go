@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// richSpan is a run of text with the styles of the rich text tags open around it
+type richSpan struct {
+	text  string
+	attrs []color.Attribute
+	rgb   []int // color of the innermost <color> tag, nil for the default
+}
+
+// richTextColors are the color names Unity accepts in place of a hex value
+var richTextColors = map[string]string{
+	"aqua":      "00ffff",
+	"black":     "000000",
+	"blue":      "0000ff",
+	"brown":     "a52a2a",
+	"cyan":      "00ffff",
+	"darkblue":  "0000a0",
+	"fuchsia":   "ff00ff",
+	"green":     "008000",
+	"grey":      "808080",
+	"lightblue": "add8e6",
+	"lime":      "00ff00",
+	"magenta":   "ff00ff",
+	"maroon":    "800000",
+	"navy":      "000080",
+	"olive":     "808000",
+	"orange":    "ffa500",
+	"purple":    "800080",
+	"red":       "ff0000",
+	"silver":    "c0c0c0",
+	"teal":      "008080",
+	"white":     "ffffff",
+	"yellow":    "ffff00",
+}
+
+// richTag is an open rich text tag
+type richTag struct {
+	name  string
+	value string
+}
+
+// parseRichText splits a song.ini value into spans of plain text, each carrying the
+// terminal styles of the tags around it. Tags without a terminal equivalent (e.g.
+// <font>) are dropped, as are closing tags that were never opened.
+func parseRichText(value string) []richSpan {
+	var spans []richSpan
+	var open []richTag
+	emit := func(text string) {
+		if text == "" {
+			return
+		}
+		span := richSpan{text: html.UnescapeString(text)}
+		for _, tag := range open {
+			switch tag.name {
+			case "b":
+				span.attrs = append(span.attrs, color.Bold)
+			case "i":
+				span.attrs = append(span.attrs, color.Italic)
+			case "u":
+				span.attrs = append(span.attrs, color.Underline)
+			case "s", "strikethrough":
+				span.attrs = append(span.attrs, color.CrossedOut)
+			case "size":
+				if attr, ok := richTextSize(tag.value); ok {
+					span.attrs = append(span.attrs, attr)
+				}
+			case "color":
+				if rgb, ok := richTextColor(tag.value); ok {
+					span.rgb = rgb
+				}
+			}
+		}
+		spans = append(spans, span)
+	}
+
+	last := 0
+	for _, match := range richTextTag.FindAllStringIndex(value, -1) {
+		emit(value[last:match[0]])
+		last = match[1]
+
+		tag := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value[match[0]+1:match[1]-1]), "/"))
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			name = strings.ToLower(strings.TrimSpace(name))
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i].name == name {
+					open = append(open[:i], open[i+1:]...)
+					break
+				}
+			}
+			continue
+		}
+		name, tagValue, _ := strings.Cut(tag, "=")
+		open = append(open, richTag{name: strings.ToLower(strings.TrimSpace(name)), value: strings.Trim(strings.TrimSpace(tagValue), `"'`)})
+	}
+	emit(value[last:])
+	return spans
+}
+
+// richTextColor reads a <color> value: #RGB, #RRGGBB, #RRGGBBAA or a color name
+func richTextColor(value string) ([]int, bool) {
+	hex := strings.ToLower(value)
+	if named, ok := richTextColors[hex]; ok {
+		hex = named
+	}
+	hex = strings.TrimPrefix(hex, "#")
+	switch len(hex) {
+	case 3:
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	case 8:
+		hex = hex[:6]
+	case 6:
+	default:
+		return nil, false
+	}
+	var r, g, b int
+	if _, err := fmt.Sscanf(hex, "%02x%02x%02x", &r, &g, &b); err != nil {
+		return nil, false
+	}
+	return []int{r, g, b}, true
+}
+
+// richTextSize maps a relative <size> to a terminal style: bigger text is bold and
+// smaller text faint. Absolute sizes depend on the font Clone Hero renders with, so
+// they have no equivalent.
+func richTextSize(value string) (color.Attribute, bool) {
+	var delta float64
+	switch {
+	case strings.HasSuffix(value, "%"):
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, false
+		}
+		delta = percent - 100
+	case strings.HasSuffix(value, "em"):
+		em, err := strconv.ParseFloat(strings.TrimSuffix(value, "em"), 64)
+		if err != nil {
+			return 0, false
+		}
+		delta = em - 1
+	case strings.HasPrefix(value, "+"), strings.HasPrefix(value, "-"):
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, false
+		}
+		delta = n
+	}
+	switch {
+	case delta > 0:
+		return color.Bold, true
+	case delta < 0:
+		return color.Faint, true
+	}
+	return 0, false
+}
+
+// formatRichText renders a song.ini value for the terminal, turning its rich text tags
+// into ANSI styles on top of base and underlining what matched the active filter for
+// field. Files get the plain text.
+func (o *Output) formatRichText(field, value string, base ...color.Attribute) string {
+	if o.writer != os.Stdout {
+		return plainText(value)
+	}
+	if !strings.Contains(value, "<") {
+		return o.highlight(field, plainText(value), base...)
+	}
+
+	spans := parseRichText(value)
+	var plain strings.Builder
+	for _, span := range spans {
+		plain.WriteString(span.text)
+	}
+	var ranges [][2]int
+	if o.highlighter != nil {
+		ranges = o.highlighter.MatchRanges(field, plain.String())
+	}
+
+	var result strings.Builder
+	offset := 0
+	for _, span := range spans {
+		paint := func(text string, extra ...color.Attribute) string {
+			attrs := append(append(append([]color.Attribute{}, base...), span.attrs...), extra...)
+			if len(attrs) == 0 && span.rgb == nil {
+				return text
+			}
+			c := color.New(attrs...)
+			if span.rgb != nil {
+				c.AddRGB(span.rgb[0], span.rgb[1], span.rgb[2])
+			}
+			return c.Sprint(text)
+		}
+		// Split the span where filter matches start and end
+		start, end := offset, offset+len(span.text)
+		pos := start
+		for _, r := range ranges {
+			from, to := max(r[0], pos), min(r[1], end)
+			if from >= to {
+				continue
+			}
+			if from > pos {
+				result.WriteString(paint(span.text[pos-start : from-start]))
+			}
+			result.WriteString(paint(span.text[from-start:to-start], o.matchAttrs()...))
+			pos = to
+		}
+		if pos < end {
+			result.WriteString(paint(span.text[pos-start:]))
+		}
+		offset = end
+	}
+	return result.String()
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+var filterRoot []string
+
+func init() {
+	rootCmd.PersistentFlags().StringSliceVarP(&filterRoot, "root", "", nil, "Only songs from the library (-d) containing this text, when several are searched (e.g. 'deck'); comma-separated or repeated to match any of several")
+}
+
+// selectDirectories checks the -d values and sets directory to the first. A value may
+// list several libraries, separated like $PATH. The same library given twice is only
+// scanned once.
+func selectDirectories() error {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, dir := range splitLibraryLists(directories) {
+		if strings.TrimSpace(dir) == "" {
+			return fmt.Errorf("invalid -d: empty directory")
+		}
+		if key := absLibrary(dir); !seen[key] {
+			seen[key] = true
+			selected = append(selected, dir)
+		}
+	}
+	if len(selected) == 0 {
+		selected = []string{"."}
+	}
+	directories = selected
+	directory = directories[0]
+	return nil
+}
+
+// splitLibraryLists splits -d values listing several libraries, separated by ":" (";"
+// on Windows) as in $PATH. Cloud locations aren't split, since their scheme has a colon.
+func splitLibraryLists(values []string) []string {
+	var dirs []string
+	for _, value := range values {
+		if isRemoteLocation(value) || strings.TrimSpace(value) == "" {
+			dirs = append(dirs, value)
+			continue
+		}
+		dirs = append(dirs, filepath.SplitList(value)...)
+	}
+	return dirs
+}
+
+// multipleLibraries reports whether several libraries are searched at once
+func multipleLibraries() bool {
+	return len(directories) > 1
+}
+
+// anyRemoteLibrary reports whether any of the libraries is a cloud location
+func anyRemoteLibrary() bool {
+	for _, dir := range directories {
+		if isRemoteLocation(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireSingleLibrary fails for commands that work on one library at a time when
+// several are given
+func requireSingleLibrary(command string) error {
+	if multipleLibraries() {
+		return fmt.Errorf("%s works on one library at a time; pass a single -d", command)
+	}
+	return nil
+}
+
+// songRoot returns the library a song was found in. Songs loaded outside of a library
+// scan, such as those of release, belong to the first library.
+func songRoot(song *Song) string {
+	if song.Root != "" {
+		return song.Root
+	}
+	return directory
+}
+
+// tagRoot records the library songs were found in
+func tagRoot(songs []*Song, root string) {
+	for _, song := range songs {
+		song.Root = root
+	}
+}
+
+// matchesRoot checks whether the library a song was found in, as given to -d, contains
+// a --root value, ignoring case
+func matchesRoot(song *Song, value string) bool {
+	return strings.Contains(strings.ToLower(filepath.ToSlash(songRoot(song))), strings.ToLower(filepath.ToSlash(value)))
+}
+
+// rootFilters returns every --root value used by the spec or its nested clauses
+func (spec FilterSpec) rootFilters() []string {
+	var values []string
+	if spec.Root != "" {
+		values = append(values, spec.Root)
+	}
+	for _, clause := range spec.clauses() {
+		values = append(values, clause.rootFilters()...)
+	}
+	return values
+}
+
+// validateRoot checks that a --root value matches one of the libraries, to catch typos
+// that would otherwise silently match nothing
+func validateRoot(value string) error {
+	for _, dir := range directories {
+		if matchesRoot(&Song{Root: dir}, value) {
+			return nil
+		}
+	}
+	return fmt.Errorf("--root %q matches none of the libraries (%s)", value, strings.Join(directories, ", "))
+}
+
+// warnNestedLibraries warns about libraries inside one another, whose songs would be
+// listed twice
+func warnNestedLibraries() {
+	for _, dir := range directories {
+		for _, other := range directories {
+			if dir == other || isRemoteLocation(dir) || isRemoteLocation(other) {
+				continue
+			}
+			if rel, err := filepath.Rel(absLibrary(other), absLibrary(dir)); err == nil && filepath.IsLocal(rel) {
+				fmt.Fprintf(os.Stderr, "Warning: %s is inside %s, so its songs are listed twice\n", dir, other)
+			}
+		}
+	}
+}
+
+// newLibraryScanners creates a scanner for each library, with the scan flags
+func newLibraryScanners() ([]*Scanner, error) {
+	policy, err := parsePolicy()
+	if err != nil {
+		return nil, err
+	}
+	scanners := make([]*Scanner, len(directories))
+	for i, dir := range directories {
+		scanners[i] = NewScanner(dir, ScanOptions{Network: networkMode, Context: commandContext(), OnError: policy, MaxErrors: maxErrors, ExcludeDirs: excludeDirs})
+	}
+	return scanners, nil
+}
+
+// libraryScan is the outcome of loading one library
+type libraryScan struct {
+	scanner *Scanner
+	songs   []*Song
+	err     error
+	elapsed time.Duration
+}
+
+// scanLibraries loads every library at the same time, returning their songs in the
+// order the libraries were given. Scans that fail don't stop the others; the first
+// error is returned once all of them are done.
+func scanLibraries(scanners []*Scanner) ([]*Song, []libraryScan, error) {
+	scans := make([]libraryScan, len(scanners))
+	var wg sync.WaitGroup
+	for i, scanner := range scanners {
+		scans[i].scanner = scanner
+		wg.Add(1)
+		go func(scan *libraryScan) {
+			defer wg.Done()
+			start := time.Now()
+			scan.songs, scan.err = scan.scanner.LoadSongs()
+			scan.elapsed = time.Since(start)
+		}(&scans[i])
+	}
+	stopProgress := showScanProgress(scans)
+	wg.Wait()
+	stopProgress()
+
+	var songs []*Song
+	for _, scan := range scans {
+		if errors.Is(scan.err, errInterrupted) {
+			return nil, nil, scan.err
+		}
+	}
+	for _, scan := range scans {
+		if scan.err != nil {
+			if len(scans) > 1 {
+				return nil, nil, fmt.Errorf("failed to load songs from %s: %w", scan.scanner.rootDir, scan.err)
+			}
+			return nil, nil, fmt.Errorf("failed to load songs: %w", scan.err)
+		}
+		tagRoot(scan.songs, scan.scanner.rootDir)
+		songs = append(songs, scan.songs...)
+	}
+	return songs, scans, nil
+}
+
+// scanProgressInterval is how often the progress of a multi-library scan is redrawn
+const scanProgressInterval = 200 * time.Millisecond
+
+// showScanProgress keeps a single line on stderr up to date with the songs found so far
+// in each library, while several are scanned at once. It returns a function that
+// stops it and clears the line. Nothing is shown for a single library, in CI or
+// accessible mode or when stderr isn't a terminal.
+func showScanProgress(scans []libraryScan) (stop func()) {
+	if len(scans) < 2 || isCI() || accessibleMode || !isatty.IsTerminal(os.Stderr.Fd()) {
+		return func() {}
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(scanProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+				parts := make([]string, len(scans))
+				for i, scan := range scans {
+					parts[i] = fmt.Sprintf("%s: %d", scan.scanner.rootDir, scan.scanner.found.Load())
+				}
+				fmt.Fprintf(os.Stderr, "\r\033[KScanning %s", strings.Join(parts, ", "))
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// writeScanSummary prints the songs and parse errors of each library after scanning
+// several, on stderr
+func writeScanSummary(scans []libraryScan) {
+	if len(scans) < 2 || isCI() {
+		return
+	}
+	total := 0
+	for _, scan := range scans {
+		total += len(scan.songs)
+	}
+	fmt.Fprintf(os.Stderr, "Scanned %d libraries, %d song(s):\n", len(scans), total)
+	for _, scan := range scans {
+		how := fmt.Sprintf("%.1fs", scan.elapsed.Seconds())
+		if scan.scanner.found.Load() == 0 && len(scan.songs) > 0 {
+			how = "cached"
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %d song(s), %d error(s) (%s)\n", scan.scanner.rootDir, len(scan.songs), len(scan.scanner.Errors()), how)
+	}
+}
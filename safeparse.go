@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Limits that keep a hostile or corrupted song.ini from hanging or exhausting memory
+// during a scan. Real song.ini files are a few kilobytes.
+const (
+	maxSongIniSize      = 1 << 20  // bytes
+	maxSongIniLine      = 64 << 10 // bytes
+	songIniParseTimeout = 5 * time.Second
+)
+
+// guardSongIni gives up on parses that take longer than songIniParseTimeout. A parse
+// that times out keeps running in the background, but the scan moves on. Parsers open
+// the file with openSongIni and check the contents as they read them (see songIniCheck).
+func guardSongIni(path string, parse func(string) (*Song, error)) (*Song, error) {
+	type result struct {
+		song *Song
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		song, err := parse(path)
+		done <- result{song, err}
+	}()
+
+	timer := time.NewTimer(songIniParseTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.song, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("gave up parsing after %s", songIniParseTimeout)
+	}
+}
+
+// openSongIni opens a song.ini, rejecting files too large to be one before anything is
+// read. It returns the file's size.
+func openSongIni(path string) (*os.File, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.Size() > maxSongIniSize {
+		file.Close()
+		return nil, 0, fmt.Errorf("file is %d KB, larger than the %d KB a song.ini can be", info.Size()>>10, maxSongIniSize>>10)
+	}
+	return file, info.Size(), nil
+}
+
+// readSongIni reads a whole song.ini into memory, with the size limit of openSongIni
+func readSongIni(path string) ([]byte, error) {
+	file, size, err := openSongIni(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// The file may have grown since it was opened
+	data := bytes.NewBuffer(make([]byte, 0, size+1))
+	if _, err := data.ReadFrom(io.LimitReader(file, maxSongIniSize+1)); err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if data.Len() > maxSongIniSize {
+		return nil, fmt.Errorf("file is larger than the %d KB a song.ini can be", maxSongIniSize>>10)
+	}
+	return data.Bytes(), nil
+}
+
+// songIniCheck rejects song.ini contents with overlong lines or binary data, a line at
+// a time
+type songIniCheck struct {
+	lines   int
+	bytes   int
+	control int
+}
+
+// line checks the next line, including its line ending
+func (c *songIniCheck) line(line []byte) error {
+	c.lines++
+	if len(bytes.TrimSuffix(line, []byte("\n"))) > maxSongIniLine {
+		return fmt.Errorf("line %d is longer than %d KB", c.lines, maxSongIniLine>>10)
+	}
+	for _, b := range line {
+		if b == 0 {
+			return fmt.Errorf("binary data, not a text file")
+		}
+		if b < 0x20 && b != '\t' && b != '\r' && b != '\n' {
+			c.control++
+		}
+	}
+	c.bytes += len(line)
+	return nil
+}
+
+// finish checks the share of control characters in everything read
+func (c *songIniCheck) finish() error {
+	if c.control > c.bytes/10 {
+		return fmt.Errorf("binary data, not a text file")
+	}
+	return nil
+}
+
+// checkSongIniData makes the checks of songIniCheck on a whole file. UTF-16 text is let
+// through for the caller to decode.
+func checkSongIniData(data []byte) error {
+	if isUTF16(data) {
+		return nil
+	}
+	var check songIniCheck
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if end == 0 {
+			end = len(data)
+		}
+		if err := check.line(data[:end]); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	return check.finish()
+}
+
+// isUTF16 reports whether data looks like UTF-16 text, by its byte order mark or the
+// zero bytes of ASCII characters; the same test decodeText uses
+func isUTF16(data []byte) bool {
+	return bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) ||
+		(len(data) >= 2 && (data[0] == 0) != (data[1] == 0))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// richTextTag matches the Unity rich text tags Clone Hero renders in song.ini text, such
+// as <color=#FF0000>, <b>, </i> and <size=20>. Only known tag names are matched, so
+// text like "Songs <3" is left alone.
+var richTextTag = regexp.MustCompile(`(?i)</?(?:color|b|i|u|s|size|material|quad|sup|sub|mark|alpha|font|voffset|br|align|lowercase|uppercase|smallcaps|nobr|noparse|strikethrough)(?:=[^<>]*)?\s*/?>`)
+
+// plainText strips rich text tags and HTML entities from a song.ini value
+func plainText(value string) string {
+	if !strings.ContainsAny(value, "<&") {
+		return value
+	}
+	return strings.TrimSpace(html.UnescapeString(richTextTag.ReplaceAllString(value, "")))
+}
+
+// sanitize replaces the text fields of a song with their plain text, keeping the
+// original of every field that changed in Raw. Charters keep their tags, which are
+// rendered as colors in terminal output.
+func (s *Song) sanitize() {
+	for key, field := range map[string]*string{
+		"name":           &s.Name,
+		"artist":         &s.Artist,
+		"album":          &s.Album,
+		"genre":          &s.Genre,
+		"loading_phrase": &s.LoadingPhrase,
+	} {
+		plain := plainText(*field)
+		if plain == *field {
+			continue
+		}
+		if s.Raw == nil {
+			s.Raw = make(map[string]string)
+		}
+		s.Raw[key] = *field
+		*field = plain
+	}
+}
+
+// rawText returns the song.ini value of the text field key, with its rich text tags, or
+// value when it had none
+func (s *Song) rawText(key, value string) string {
+	if raw, ok := s.Raw[key]; ok {
+		return raw
+	}
+	return value
+}
@@ -1,234 +1,751 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Scanner handles scanning directories for songs and caching results
 type Scanner struct {
-	rootDir string
-	cacheFile string
+	rootDir     string
+	cacheFile   string
+	opts        ScanOptions
+	failed      map[string]string       // song.ini path -> mod time of files that failed to parse
+	errors      []ParseFailure          // song.ini files that failed to parse in this scan
+	quarantined map[string]ParseFailure // failures of the previous scan, by path
+	cacheGood   bool                    // the cache file on disk is complete and readable, so worth backing up
+	dirHash     string                  // directory hash already computed by QuickReject
+	songFiles   []scanJob               // song.ini files found while computing dirHash
+	found       atomic.Int64            // songs read so far in this scan, for the progress of multi-library scans
+
+	// Songs of the previous scan by path, reused while their song.ini is unchanged
+	previous map[string]*Song
+	moved    int // songs found in another folder than in the previous scan
+
+	// Songs from an interrupted scan's partial cache, reused while their files are
+	// older than the partial cache
+	resume       map[string]*Song
+	resumeBefore time.Time
+}
+
+// ScanOptions controls how a Scanner walks and reads a library
+type ScanOptions struct {
+	// Network enables the network filesystem (SMB/NFS) friendly mode: batched
+	// directory reads, no hashing of media files, cached parse failures and
+	// retries on transient I/O errors
+	Network bool
+
+	// IncludeCold scans cold-storage archives (see cold.go) that are normally skipped
+	IncludeCold bool
+
+	// ExcludeDirs are glob patterns of folders to leave out of scans and the directory
+	// hash (see matchesExcludeDir)
+	ExcludeDirs []string
+
+	// OnError is the policy for song.ini files that fail to parse; empty means ParseSkip
+	OnError ParsePolicy
+
+	// MaxErrors aborts the scan once more song.ini files than this fail to parse, which
+	// usually means the wrong folder was picked; 0 means no limit
+	MaxErrors int
+
+	// Context stops the scan when cancelled; nil never cancels. An interrupted scan
+	// saves the songs parsed so far as a partial cache for the next scan to resume from.
+	Context context.Context
 }
 
 // CacheEntry represents a cached song entry
 type CacheEntry struct {
-	Path      string
-	Name      string
-	Artist    string
-	Album     string
-	Genre     string
-	Year      int
-	Charters  []string `json:"charters,omitempty"` // Multiple charters
-	Charter   string   `json:"charter,omitempty"`   // Legacy single charter (for backward compatibility)
-	Length    int64 // milliseconds
-	Instruments map[string]int
-	PreviewStart int64
-	Icon       string
+	Path          string
+	Name          string
+	Artist        string
+	Album         string
+	Genre         string
+	Year          int
+	Charters      []string `json:"charters,omitempty"` // Multiple charters
+	Charter       string   `json:"charter,omitempty"`  // Legacy single charter, moved to Charters by migrateCharters
+	Length        int64    // milliseconds
+	Instruments   map[string]int
+	PreviewStart  int64
+	Icon          string
 	LoadingPhrase string
-	AlbumTrack int
+	AlbumTrack    int
 	PlaylistTrack int
+	Tags          []string          `json:"tags,omitempty"`
+	Rating        int               `json:"rating,omitempty"`
+	Raw           map[string]string `json:"raw,omitempty"`            // original values of sanitized text fields
+	ModTime       string            `json:"mod_time,omitempty"`       // song.ini mod time, for incremental rescans
+	Packed        bool              `json:"packed,omitempty"`         // a .sng file
+	Checksum      string            `json:"checksum,omitempty"`       // notes file MD5, to tell moved songs from new ones
+	ChartModTime  string            `json:"chart_mod_time,omitempty"` // notes file mod time when Checksum was computed
 }
 
 // Cache represents the cache file structure
 type Cache struct {
-	Hash  string
-	Songs []CacheEntry
+	Version int `json:"version,omitempty"` // CacheSchemaVersion of the writer; 0 before versioning
+	Hash    string
+	Songs   []CacheEntry
+	Failed  map[string]string `json:"failed,omitempty"`  // negative results: song.ini files that failed to parse, by mod time
+	Partial bool              `json:"partial,omitempty"` // written by an interrupted scan; only used to resume
+	Errors  []ParseFailure    `json:"errors,omitempty"`  // song.ini files that failed to parse
+	Decoded bool              `json:"decoded,omitempty"` // scanned with ParseRetry, which reads legacy encodings
+	Root    string            `json:"root,omitempty"`    // library the cache is for, so cache gc can tell when it's gone
 }
 
 // NewScanner creates a new Scanner instance
-func NewScanner(rootDir string) *Scanner {
-	cacheDir := filepath.Join(os.TempDir(), "cloneheroer")
-	os.MkdirAll(cacheDir, 0755)
+func NewScanner(rootDir string, opts ScanOptions) *Scanner {
+	os.MkdirAll(cacheDir(), 0755)
 	hash := sha256.Sum256([]byte(rootDir))
-	cacheFile := filepath.Join(cacheDir, fmt.Sprintf("cache_%x.json", hash[:8]))
-	
+	cacheFile := filepath.Join(cacheDir(), fmt.Sprintf("cache_%x.json", hash[:8]))
+
 	return &Scanner{
 		rootDir:   rootDir,
 		cacheFile: cacheFile,
+		opts:      opts,
+		failed:    make(map[string]string),
 	}
 }
 
 // LoadSongs loads songs from directory, using cache if available and valid
 func (s *Scanner) LoadSongs() ([]*Song, error) {
-	// Calculate directory hash
-	currentHash, err := s.calculateDirHash()
-	if err != nil {
-		return nil, fmt.Errorf("failed to calculate directory hash: %w", err)
+	if isRemoteLocation(s.rootDir) {
+		return s.loadRemoteSongs()
+	}
+
+	// Calculate directory hash, unless QuickReject just did
+	currentHash := s.dirHash
+	if currentHash == "" {
+		hash, err := s.calculateDirHash()
+		if errors.Is(err, errInterrupted) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate directory hash: %w", err)
+		}
+		currentHash = hash
 	}
-	
+
 	// Try to load from cache
-	if cached, err := s.loadCache(); err == nil && cached.Hash == currentHash {
+	cached, err := s.loadCache()
+	if err == nil && cached.Hash == currentHash && s.cacheUsable(cached) {
+		s.errors = cached.Errors
+		touchFile(s.cacheFile)
 		return s.convertCacheToSongs(cached), nil
 	}
-	
+	if err == nil && s.opts.Network && cached.Failed != nil {
+		s.failed = cached.Failed
+	}
+	if err == nil && cached.Partial {
+		s.resumeFrom(cached)
+	}
+	if err == nil {
+		s.reuseFrom(cached)
+	}
+	if err == nil {
+		s.quarantineFrom(cached)
+	}
+
 	// Cache miss or invalid, scan directory
 	songs, err := s.scanDirectory()
+	if errors.Is(err, errInterrupted) {
+		s.savePartialCache(songs)
+		return nil, err
+	}
 	if err != nil {
 		return nil, err
 	}
-	
+	s.reportQuarantine()
+	if s.previous != nil {
+		s.moved = s.countMoves(songs)
+	}
+
 	// Save to cache
-	if err := s.saveCache(currentHash, songs); err != nil {
+	if err := s.saveCache(currentHash, songs, false); err != nil {
 		// Log but don't fail - caching is optional
 		fmt.Fprintf(os.Stderr, "Warning: failed to save cache: %v\n", err)
 	}
-	
+
 	return songs, nil
 }
 
-// calculateDirHash calculates a hash of the directory structure
+// Errors returns the song.ini files that failed to parse in the last scan
+func (s *Scanner) Errors() []ParseFailure {
+	return s.errors
+}
+
+// cacheUsable reports whether a cache with a matching hash can be used as is: it must
+// come from a complete scan that read files the way this one would
+func (s *Scanner) cacheUsable(cached *Cache) bool {
+	return !cached.Partial && cached.Decoded == (s.opts.OnError == ParseRetry)
+}
+
+// quarantineFrom remembers the failures of the previous scan, so that quarantined files
+// are skipped until they change
+func (s *Scanner) quarantineFrom(cached *Cache) {
+	if s.opts.OnError != ParseQuarantine {
+		return
+	}
+	s.quarantined = make(map[string]ParseFailure, len(cached.Errors))
+	for _, failure := range cached.Errors {
+		s.quarantined[failure.Path] = failure
+	}
+}
+
+// recordFailure notes a song.ini that failed to parse, warning about it unless failures
+// are quarantined. It returns an error once there are more failures than MaxErrors.
+func (s *Scanner) recordFailure(path, modTime string, err error) error {
+	s.errors = append(s.errors, ParseFailure{Path: path, Error: err.Error(), ModTime: modTime})
+	if s.opts.OnError != ParseQuarantine {
+		fmt.Fprintf(os.Stderr, "Warning: failed to parse %s: %v\n", path, err)
+	}
+	if s.opts.MaxErrors > 0 && len(s.errors) > s.opts.MaxErrors {
+		return fmt.Errorf("aborting scan: more than %d song.ini files failed to parse (--max-errors); is %s a Clone Hero songs folder?", s.opts.MaxErrors, s.rootDir)
+	}
+	return nil
+}
+
+// reportQuarantine summarises the quarantined files after a scan
+func (s *Scanner) reportQuarantine() {
+	if s.opts.OnError == ParseQuarantine && len(s.errors) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d song folder(s) quarantined after failing to parse; list them with \"cloneheroer errors\"\n", len(s.errors))
+	}
+}
+
+// parseFile parses a song.ini according to the OnError policy. With ParseRetry, files
+// that fail to parse or contain invalid UTF-8 are parsed again in other text encodings.
+// Those files, and every file in network mode, are read into memory in one go, so each
+// is read once however many times it's parsed. Packed .sng songs are read by ParseSng.
+func (s *Scanner) parseFile(path string) (*Song, error) {
+	if isSngFile(path) {
+		return ParseSng(path)
+	}
+	if s.opts.OnError != ParseRetry && !s.opts.Network {
+		return ParseSong(path)
+	}
+	return guardSongIni(path, func(path string) (*Song, error) {
+		data, err := readSongIni(path)
+		if err != nil {
+			return nil, err
+		}
+		song, err := parseSongData(path, data)
+		if s.opts.OnError != ParseRetry || (err == nil && !hasInvalidText(song)) {
+			return song, err
+		}
+		if decoded, decodeErr := parseSongDecoded(path, data); decodeErr == nil {
+			return decoded, nil
+		}
+		return song, err
+	})
+}
+
+// interrupted returns errInterrupted once the scan's context has been cancelled
+func (s *Scanner) interrupted() error {
+	if s.opts.Context != nil && s.opts.Context.Err() != nil {
+		return errInterrupted
+	}
+	return nil
+}
+
+// reuseFrom keeps the songs of the previous scan for parseSong to reuse, so a rescan only
+// parses the song.ini files that changed. Songs read in another encoding mode than this
+// scan's are parsed again.
+func (s *Scanner) reuseFrom(cached *Cache) {
+	if cached.Decoded != (s.opts.OnError == ParseRetry) {
+		return
+	}
+	s.previous = make(map[string]*Song, len(cached.Songs))
+	for _, song := range s.convertCacheToSongs(cached) {
+		if song.ModTime != "" {
+			s.previous[song.Path] = song
+		}
+	}
+}
+
+// resumeFrom keeps the songs of an interrupted scan's partial cache for parseSong to reuse
+func (s *Scanner) resumeFrom(cached *Cache) {
+	info, err := os.Stat(s.cacheFile)
+	if err != nil {
+		return
+	}
+	s.resume = make(map[string]*Song, len(cached.Songs))
+	for _, song := range s.convertCacheToSongs(cached) {
+		s.resume[song.Path] = song
+	}
+	s.resumeBefore = info.ModTime()
+}
+
+// resumed returns the song parsed from path by an interrupted scan, if its song.ini
+// hasn't changed since
+func (s *Scanner) resumed(path string, modTime time.Time) (*Song, bool) {
+	song, ok := s.resume[path]
+	if !ok || modTime.IsZero() || !modTime.Before(s.resumeBefore) {
+		return nil, false
+	}
+	return song, true
+}
+
+// savePartialCache saves the songs of an interrupted scan. The partial cache never
+// matches a directory hash, so the next scan still walks the whole library.
+func (s *Scanner) savePartialCache(songs []*Song) {
+	if len(songs) == 0 {
+		return
+	}
+	if err := s.saveCache("", songs, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save partial cache: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Scan interrupted: kept %d song(s) for the next scan to resume from\n", len(songs))
+}
+
+// isExcludedDir reports whether a directory should be left out of scans
+func (s *Scanner) isExcludedDir(path string) bool {
+	if path == s.rootDir {
+		return false
+	}
+	// Cold archives are only looked for directly under the root, to avoid an extra
+	// stat call for every folder in the library
+	if !s.opts.IncludeCold && filepath.Dir(path) == filepath.Clean(s.rootDir) && isColdArchive(path) {
+		return true
+	}
+	if len(s.opts.ExcludeDirs) > 0 {
+		if rel, err := filepath.Rel(s.rootDir, path); err == nil && matchesExcludeDir(rel, s.opts.ExcludeDirs) {
+			return true
+		}
+	}
+	return false
+}
+
+// calculateDirHash calculates a hash of the directory structure. The song.ini files
+// found on the way are kept for scanDirectory, so a rescan doesn't walk the tree again.
 func (s *Scanner) calculateDirHash() (string, error) {
-	hash := sha256.New()
-	
+	if s.opts.Network {
+		return s.calculateNetworkDirHash()
+	}
+
+	var hash treeHash
+	var songFiles []scanJob
+
 	err := filepath.Walk(s.rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		
+		if err := s.interrupted(); err != nil {
+			return err
+		}
+		if info.IsDir() && s.isExcludedDir(path) {
+			return filepath.SkipDir
+		}
+
 		// Include file paths and modification times in hash
 		relPath, _ := filepath.Rel(s.rootDir, path)
-		hash.Write([]byte(relPath))
-		hash.Write([]byte(info.ModTime().String()))
-		
+		modTime := info.ModTime().String()
+		hash.toggle(relPath, modTime)
+		if isSongFile(path, info.IsDir()) {
+			songFiles = append(songFiles, scanJob{path: path, d: fs.FileInfoToDirEntry(info), modTime: modTime})
+		}
+
 		return nil
 	})
-	
+
 	if err != nil {
 		return "", err
 	}
-	
-	return hex.EncodeToString(hash.Sum(nil)), nil
+
+	s.songFiles = songFiles
+	return hash.String(), nil
 }
 
-// scanDirectory recursively scans for song.ini files
-func (s *Scanner) scanDirectory() ([]*Song, error) {
-	var songs []*Song
-	
-	err := filepath.Walk(s.rootDir, func(path string, info os.FileInfo, err error) error {
+// calculateNetworkDirHash hashes the directory listings and the mod times of the
+// directories only, with one stat per directory rather than per file, which is slow over
+// the network. Adding, removing or renaming a file, or replacing it as cloneheroer's own
+// writes do, changes its directory; a file rewritten in place by another program doesn't.
+func (s *Scanner) calculateNetworkDirHash() (string, error) {
+	var hash treeHash
+	var songFiles []scanJob
+
+	err := s.walkLibrary(func(path string, d fs.DirEntry) error {
+		relPath, _ := filepath.Rel(s.rootDir, path)
+		if !d.IsDir() {
+			hash.toggle(relPath, "")
+			if isSongFile(path, false) {
+				songFiles = append(songFiles, scanJob{path: path, d: d})
+			}
+			return nil
+		}
+
+		var info fs.FileInfo
+		err := retryIO(func() error {
+			var statErr error
+			info, statErr = d.Info()
+			return statErr
+		})
 		if err != nil {
 			return err
 		}
-		
-		if info.IsDir() {
-			return nil
+		hash.toggle(relPath, info.ModTime().String())
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	s.songFiles = songFiles
+	return hash.String(), nil
+}
+
+// isSongFile reports whether a walked path is a song.ini file or a packed .sng song
+func isSongFile(path string, isDir bool) bool {
+	return !isDir && (strings.HasSuffix(strings.ToLower(path), "song.ini") || isSngFile(path))
+}
+
+// scanJob is a song.ini found by the walk of scanDirectory, numbered in walk order. Its
+// mod time is empty until the file is stat-ed.
+type scanJob struct {
+	index   int
+	path    string
+	d       fs.DirEntry
+	modTime string
+}
+
+// scanResult is a parsed scanJob; a nil song with no error means the file was skipped
+type scanResult struct {
+	index   int
+	path    string
+	modTime string
+	song    *Song
+	err     error
+}
+
+// errScanStopped stops the walk of scanDirectory once the scan is aborted
+var errScanStopped = errors.New("scan stopped")
+
+// scanDirectory recursively scans for song.ini files. The walk, or the song.ini files
+// calculateDirHash found, feed a pool of GOMAXPROCS workers that stat and parse the
+// files, and their results are collected in walk order, so songs, warnings and
+// --max-errors come out as in a sequential scan. Songs whose song.ini is unchanged since
+// the previous scan are reused rather than parsed again.
+func (s *Scanner) scanDirectory() ([]*Song, error) {
+	parent := s.opts.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	jobs := make(chan scanJob)
+	var walkErr error
+	go func() {
+		defer close(jobs)
+		index := 0
+		send := func(job scanJob) error {
+			job.index = index
+			select {
+			case jobs <- job:
+				index++
+				return nil
+			case <-ctx.Done():
+				return errScanStopped
+			}
+		}
+		if s.songFiles != nil {
+			for _, job := range s.songFiles {
+				if walkErr = send(job); walkErr != nil {
+					return
+				}
+			}
+			return
 		}
-		
-		if strings.HasSuffix(strings.ToLower(path), "song.ini") {
-			song, err := ParseSong(path)
-			if err != nil {
-				// Log but continue - some files might be malformed
-				fmt.Fprintf(os.Stderr, "Warning: failed to parse %s: %v\n", path, err)
+		walkErr = s.walkLibrary(func(path string, d fs.DirEntry) error {
+			if !isSongFile(path, d.IsDir()) {
 				return nil
 			}
-			songs = append(songs, song)
+			return send(scanJob{path: path, d: d})
+		})
+	}()
+
+	var failedMu sync.Mutex
+	failed := make(map[string]string)
+	markFailed := func(path, modTime string) {
+		failedMu.Lock()
+		failed[path] = modTime
+		failedMu.Unlock()
+	}
+
+	results := make(chan scanResult)
+	var workers sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue
+				}
+				result := scanResult{index: job.index, path: job.path, modTime: job.modTime}
+				if result.modTime == "" {
+					if info, err := job.d.Info(); err == nil {
+						result.modTime = info.ModTime().String()
+					}
+				}
+				result.song, result.err = s.parseSong(job.path, job.d, result.modTime, markFailed)
+				if result.song != nil {
+					result.song.ModTime = result.modTime
+					// Over the network notes files are only read for songs not seen before
+					if !s.opts.Network || result.song.Checksum == "" {
+						refreshChecksum(result.song)
+					}
+				}
+				results <- result
+			}
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	// Results arrive in any order; hold them back until those before them are in. After
+	// an error the remaining results are drained so the workers can finish.
+	var songs []*Song
+	var err error
+	pending := make(map[int]scanResult)
+	next := 0
+	for result := range results {
+		if err != nil {
+			continue
 		}
-		
-		return nil
-	})
-	
+		pending[result.index] = result
+		for ; err == nil; next++ {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			if result.err != nil {
+				// Continue unless failing too often - some files might be malformed
+				if err = s.recordFailure(result.path, result.modTime, result.err); err != nil {
+					cancel()
+				}
+				continue
+			}
+			if result.song != nil {
+				songs = append(songs, result.song)
+				s.found.Add(1)
+			}
+		}
+	}
+
+	if err == nil {
+		if err = s.interrupted(); err == nil {
+			err = walkErr
+		}
+	}
+	s.failed = failed
 	return songs, err
 }
 
-// loadCache loads the cache from disk
+// parseSong parses a single song.ini found during a scan. In network mode reads are
+// retried, and files that failed to parse last time are skipped until they change.
+// Quarantined files are not parsed again until they change either, and songs of the
+// previous scan are reused while unchanged. A nil song with no error means the file was
+// skipped.
+func (s *Scanner) parseSong(path string, d fs.DirEntry, modTime string, markFailed func(path, modTime string)) (*Song, error) {
+	if song, ok := s.previous[path]; ok && modTime != "" && song.ModTime == modTime {
+		return song, nil
+	}
+	if s.resume != nil {
+		if info, err := d.Info(); err == nil {
+			if song, ok := s.resumed(path, info.ModTime()); ok {
+				return song, nil
+			}
+		}
+	}
+	if prev, ok := s.quarantined[path]; ok && prev.ModTime == modTime {
+		return nil, errors.New(prev.Error)
+	}
+	if !s.opts.Network {
+		return s.parseFile(path)
+	}
+
+	if prev, ok := s.failed[path]; ok && prev == modTime {
+		markFailed(path, modTime)
+		return nil, nil
+	}
+
+	var song *Song
+	err := retryIO(func() error {
+		var parseErr error
+		song, parseErr = s.parseFile(path)
+		return parseErr
+	})
+	if err != nil {
+		markFailed(path, modTime)
+		return nil, err
+	}
+	return song, nil
+}
+
+// loadCache loads the cache from disk. A corrupted cache is replaced by its most recent
+// good backup, if there is one.
 func (s *Scanner) loadCache() (*Cache, error) {
-	file, err := os.Open(s.cacheFile)
+	cache, err := readCacheFile(s.cacheFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		cache, err = s.recoverCache(err)
+	} else if err == nil {
+		s.cacheGood = !cache.Partial
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Older caches are upgraded in place rather than rescanned
+	migrated, err := s.migrateCache(cache)
+	if err != nil {
+		return nil, err
+	}
+	if migrated {
+		if err := s.writeCache(cache); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save migrated cache: %v\n", err)
+		}
+	}
+
+	return cache, nil
+}
+
+// readCacheFile reads and decodes a cache file
+func readCacheFile(path string) (*Cache, error) {
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
-	
+
 	var cache Cache
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&cache); err != nil {
+	if err := json.NewDecoder(file).Decode(&cache); err != nil {
 		return nil, err
 	}
-	
 	return &cache, nil
 }
 
-// saveCache saves songs to cache
-func (s *Scanner) saveCache(hash string, songs []*Song) error {
+// saveCache saves songs to cache. The file is replaced atomically, so an interrupted
+// save leaves the previous cache intact.
+func (s *Scanner) saveCache(hash string, songs []*Song, partial bool) error {
 	cache := Cache{
-		Hash:  hash,
-		Songs: make([]CacheEntry, len(songs)),
+		Version: CacheSchemaVersion,
+		Hash:    hash,
+		Songs:   make([]CacheEntry, len(songs)),
+		Failed:  s.failed,
+		Partial: partial,
+		Errors:  s.errors,
+		Decoded: s.opts.OnError == ParseRetry,
 	}
-	
+
 	for i, song := range songs {
-		instruments := make(map[string]int)
-		for inst, diff := range song.Instruments {
-			instruments[string(inst)] = diff
-		}
-		
-		cache.Songs[i] = CacheEntry{
-			Path:        song.Path,
-			Name:        song.Name,
-			Artist:      song.Artist,
-			Album:       song.Album,
-			Genre:       song.Genre,
-			Year:        song.Year,
-			Charters:    song.Charters,
-			Length:      int64(song.Length / time.Millisecond),
-			Instruments: instruments,
-			PreviewStart: song.PreviewStart,
-			Icon:        song.Icon,
-			LoadingPhrase: song.LoadingPhrase,
-			AlbumTrack:   song.AlbumTrack,
-			PlaylistTrack: song.PlaylistTrack,
-		}
-	}
-	
-	file, err := os.Create(s.cacheFile)
+		cache.Songs[i] = newCacheEntry(song)
+	}
+
+	return s.writeCache(&cache)
+}
+
+// newCacheEntry converts a song to its cache entry
+func newCacheEntry(song *Song) CacheEntry {
+	instruments := make(map[string]int)
+	for inst, diff := range song.Instruments {
+		instruments[string(inst)] = diff
+	}
+
+	return CacheEntry{
+		Path:          song.Path,
+		Name:          song.Name,
+		Artist:        song.Artist,
+		Album:         song.Album,
+		Genre:         song.Genre,
+		Year:          song.Year,
+		Charters:      song.Charters,
+		Length:        int64(song.Length / time.Millisecond),
+		Instruments:   instruments,
+		PreviewStart:  song.PreviewStart,
+		Icon:          song.Icon,
+		LoadingPhrase: song.LoadingPhrase,
+		AlbumTrack:    song.AlbumTrack,
+		PlaylistTrack: song.PlaylistTrack,
+		Tags:          song.Tags,
+		Rating:        song.Rating,
+		Raw:           song.Raw,
+		ModTime:       song.ModTime,
+		Packed:        song.Packed,
+		Checksum:      song.Checksum,
+		ChartModTime:  song.ChartModTime,
+	}
+}
+
+// writeCache writes a cache file, replacing the previous one atomically. A complete
+// cache being replaced is kept as a backup first.
+func (s *Scanner) writeCache(cache *Cache) error {
+	cache.Root = absLibrary(s.rootDir)
+	data, err := json.MarshalIndent(cache, "", "  ")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-	return encoder.Encode(cache)
+	if s.cacheGood {
+		s.rotateCacheBackups()
+	}
+	if err := writeFileAtomic(s.cacheFile, append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	s.cacheGood = !cache.Partial
+	if err := s.writeQuickIndex(cache); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save quick index: %v\n", err)
+	}
+	return nil
 }
 
 // convertCacheToSongs converts cache entries back to Song structs
 func (s *Scanner) convertCacheToSongs(cache *Cache) []*Song {
 	songs := make([]*Song, len(cache.Songs))
-	
+
 	for i, entry := range cache.Songs {
 		instruments := make(map[Instrument]int)
 		for instStr, diff := range entry.Instruments {
 			instruments[Instrument(instStr)] = diff
 		}
-		
-		charters := entry.Charters
-		if len(charters) == 0 && entry.Charter != "" {
-			// Handle old cache format with single Charter field
-			charters = []string{entry.Charter}
-		}
-		
+
 		songs[i] = &Song{
-			Path:        entry.Path,
-			Name:        entry.Name,
-			Artist:      entry.Artist,
-			Album:       entry.Album,
-			Genre:       entry.Genre,
-			Year:        entry.Year,
-			Charters:    charters,
-			Length:      time.Duration(entry.Length) * time.Millisecond,
-			Instruments: instruments,
-			PreviewStart: entry.PreviewStart,
-			Icon:        entry.Icon,
+			Path:          entry.Path,
+			Name:          entry.Name,
+			Artist:        entry.Artist,
+			Album:         entry.Album,
+			Genre:         entry.Genre,
+			Year:          entry.Year,
+			Charters:      entry.Charters,
+			Length:        time.Duration(entry.Length) * time.Millisecond,
+			Instruments:   instruments,
+			PreviewStart:  entry.PreviewStart,
+			Icon:          entry.Icon,
 			LoadingPhrase: entry.LoadingPhrase,
-			AlbumTrack:   entry.AlbumTrack,
+			AlbumTrack:    entry.AlbumTrack,
 			PlaylistTrack: entry.PlaylistTrack,
+			Tags:          entry.Tags,
+			Rating:        entry.Rating,
+			Raw:           entry.Raw,
+			ModTime:       entry.ModTime,
+			Packed:        entry.Packed,
+			Checksum:      entry.Checksum,
+			ChartModTime:  entry.ChartModTime,
 		}
 	}
-	
+
 	return songs
 }
-
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var (
+	filterPlayed    bool
+	filterUnplayed  bool
+	filterFC        bool
+	filterNoFC      bool
+	filterMaxPlays  int
+	filterMaxRating int
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&filterPlayed, "played", "", false, "Only songs you have a score on in scoredata.bin (on --instrument, if given)")
+	rootCmd.PersistentFlags().BoolVarP(&filterUnplayed, "unplayed", "", false, "Only songs you've never played (on --instrument, if given)")
+	rootCmd.PersistentFlags().BoolVarP(&filterFC, "fc", "", false, "Only songs you've full combo'd, hitting every note (on --instrument, if given)")
+	rootCmd.PersistentFlags().BoolVarP(&filterNoFC, "no-fc", "", false, "Only songs you haven't full combo'd yet, played or not (on --instrument, if given)")
+	rootCmd.PersistentFlags().IntVarP(&filterMaxPlays, "max-plays", "", -1, "Only songs you've played at most this many times, on any instrument (0 for never played)")
+	rootCmd.PersistentFlags().IntVarP(&filterMaxRating, "max-rating", "", 0, "Only songs rated this or lower by the \"rating\" key in song.ini; unrated songs are left out")
+}
+
+// sortScore is the --sort value ordering songs by their best score
+const sortScore = "score"
+
+// scoreFilters returns the played and full combo criteria of the --played, --unplayed,
+// --fc and --no-fc flags, nil for those not set
+func scoreFilters() (played, fc *bool, err error) {
+	if filterPlayed && filterUnplayed {
+		return nil, nil, fmt.Errorf("--played and --unplayed can't be used together")
+	}
+	if filterFC && filterNoFC {
+		return nil, nil, fmt.Errorf("--fc and --no-fc can't be used together")
+	}
+	if filterPlayed || filterUnplayed {
+		played = &filterPlayed
+	}
+	if filterFC || filterNoFC {
+		fc = &filterFC
+	}
+	return played, fc, nil
+}
+
+// usesScores reports whether the spec or any of its nested clauses filters on scores
+func (spec FilterSpec) usesScores() bool {
+	if spec.Played != nil || spec.FC != nil || spec.MaxPlays != nil {
+		return true
+	}
+	for _, clause := range spec.clauses() {
+		if clause.usesScores() {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSongScores joins the scores of --scores-file (or --player) to the songs, by the
+// checksum of their notes file
+func loadSongScores(songs []*Song) error {
+	if anyRemoteLibrary() {
+		return fmt.Errorf("filtering and sorting by scores needs a local library")
+	}
+	scores, _, err := loadScores()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return err
+		}
+		checksum := song.Checksum
+		if checksum == "" {
+			if checksum, err = songChecksum(song); err != nil {
+				failed++
+				continue
+			}
+		}
+		song.Scores = scores[checksum]
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: couldn't read the notes file of %d song(s), counted as never played\n", failed)
+	}
+	return nil
+}
+
+// BestScore returns a song's best score by percentage of notes hit, on inst or, if
+// it's empty, on any instrument. Songs without scores (see loadSongScores) have none.
+func (s *Song) BestScore(inst Instrument) (ScoreEntry, bool) {
+	var best ScoreEntry
+	found := false
+	if s.Scores == nil {
+		return best, false
+	}
+	for _, entry := range s.Scores.Scores {
+		if inst != "" && entry.Instrument != inst {
+			continue
+		}
+		if !found || entry.Percent() > best.Percent() || (entry.Percent() == best.Percent() && entry.Score > best.Score) {
+			best = entry
+			found = true
+		}
+	}
+	return best, found
+}
+
+// PlayCount returns how many times scoredata.bin says a song was played, 0 for songs
+// without scores
+func (s *Song) PlayCount() int {
+	if s.Scores == nil {
+		return 0
+	}
+	return s.Scores.PlayCount
+}
+
+// formatScore describes a score for output, e.g. "98.0% on expert guitar (FC)"
+func formatScore(e ScoreEntry) string {
+	text := fmt.Sprintf("%.1f%% on %s %s", e.Percent(), e.Difficulty, e.Instrument)
+	if e.isFullCombo() {
+		text += " (FC)"
+	}
+	return text
+}
+
+// isFullCombo reports whether a score hit every note
+func (e ScoreEntry) isFullCombo() bool {
+	return e.NotesTotal > 0 && e.NotesHit == e.NotesTotal
+}
+
+// matchesScores checks the played and full combo criteria, on the instrument filtered on
+// or on any instrument
+func (f *Filter) matchesScores(song *Song) bool {
+	var inst Instrument
+	if f.inst != "" {
+		inst = ParseInstrument(f.inst)
+	}
+	best, played := song.BestScore(inst)
+	if f.played != nil && played != *f.played {
+		return false
+	}
+	if f.fc != nil && (played && best.isFullCombo()) != *f.fc {
+		return false
+	}
+	if f.maxPlays != nil && song.PlayCount() > *f.maxPlays {
+		return false
+	}
+	return true
+}
+
+// scoreSortKey returns the best score percentage --sort score orders a song by, on
+// --instrument if given; -1 for songs never played, which go last
+func scoreSortKey(song *Song) float64 {
+	var inst Instrument
+	if filterInst != "" {
+		inst = ParseInstrument(filterInst)
+	}
+	if best, ok := song.BestScore(inst); ok {
+		return best.Percent()
+	}
+	return -1
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scoreInstruments maps Clone Hero's instrument ids in scoredata.bin to instruments
+var scoreInstruments = map[uint16]Instrument{
+	0: InstrumentGuitar,
+	1: InstrumentBass,
+	2: InstrumentRhythm,
+	3: InstrumentGuitar, // co-op guitar
+	4: InstrumentGuitarGHL,
+	5: InstrumentBassGHL,
+	6: InstrumentDrums,
+	7: InstrumentKeys,
+	8: InstrumentBand,
+}
+
+var errInvalidScoreData = errors.New("invalid scoredata.bin")
+
+// ScoreEntry is the best score on one instrument and difficulty of a song
+type ScoreEntry struct {
+	Instrument Instrument
+	Difficulty Difficulty
+	NotesHit   int
+	NotesTotal int
+	Stars      int
+	Score      int
+}
+
+// Percent returns the percentage of notes hit
+func (e ScoreEntry) Percent() float64 {
+	if e.NotesTotal <= 0 {
+		return 0
+	}
+	return float64(e.NotesHit) * 100 / float64(e.NotesTotal)
+}
+
+// SongScores holds the scores of one song, identified by the MD5 checksum of its notes file
+type SongScores struct {
+	Checksum  string
+	PlayCount int
+	Scores    []ScoreEntry
+}
+
+// Best returns the score on inst at difficulty, if the song was played that way
+func (s *SongScores) Best(inst Instrument, difficulty Difficulty) (ScoreEntry, bool) {
+	var best ScoreEntry
+	found := false
+	for _, entry := range s.Scores {
+		if entry.Instrument == inst && entry.Difficulty == difficulty && (!found || entry.Percent() > best.Percent()) {
+			best = entry
+			found = true
+		}
+	}
+	return best, found
+}
+
+// ScoreData maps notes file checksums to the scores recorded for them
+type ScoreData map[string]*SongScores
+
+// ParseScoreData reads Clone Hero's scoredata.bin. The file starts with a version and a
+// song count; each song is its notes file checksum, an instrument count, a 24-bit play
+// count and one 16-byte record per instrument played.
+func ParseScoreData(path string) (ScoreData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read score data: %w", err)
+	}
+	if len(data) < 8 {
+		return nil, errInvalidScoreData
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[4:8]))
+	scores := make(ScoreData, count)
+	pos := 8
+	for i := 0; i < count; i++ {
+		if pos+20 > len(data) {
+			return nil, errInvalidScoreData
+		}
+		song := &SongScores{
+			Checksum:  hex.EncodeToString(data[pos : pos+16]),
+			PlayCount: int(data[pos+17]) | int(data[pos+18])<<8 | int(data[pos+19])<<16,
+		}
+		instruments := int(data[pos+16])
+		pos += 20
+
+		for j := 0; j < instruments; j++ {
+			if pos+16 > len(data) {
+				return nil, errInvalidScoreData
+			}
+			record := data[pos : pos+16]
+			pos += 16
+
+			inst, ok := scoreInstruments[binary.LittleEndian.Uint16(record[0:2])]
+			if !ok || int(record[2]) >= len(difficulties) {
+				continue
+			}
+			song.Scores = append(song.Scores, ScoreEntry{
+				Instrument: inst,
+				Difficulty: difficulties[record[2]],
+				NotesHit:   int(binary.LittleEndian.Uint16(record[3:5])),
+				NotesTotal: int(binary.LittleEndian.Uint16(record[5:7])),
+				Stars:      int(record[7]),
+				Score:      int(binary.LittleEndian.Uint32(record[12:16])),
+			})
+		}
+		scores[song.Checksum] = song
+	}
+	return scores, nil
+}
+
+// cloneHeroDataDirs returns the folders Clone Hero keeps its data in on each platform
+func cloneHeroDataDirs() ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		filepath.Join(home, ".clonehero"),
+		filepath.Join(home, ".config", "unity3d", "srylain Inc_", "Clone Hero"),
+		filepath.Join(home, "Documents", "Clone Hero"),
+		filepath.Join(home, "AppData", "LocalLow", "srylain Inc_", "Clone Hero"),
+		filepath.Join(home, "Library", "Application Support", "com.srylain.CloneHero"),
+	}, nil
+}
+
+// scoresFilePath returns the score file to read: --scores-file, or the scoredata.bin of
+// --player (profiles/<player>/scoredata.bin) or of the default profile in the Clone Hero
+// data folder. With --player, --scores-file may also point at the data folder itself.
+func scoresFilePath() (string, error) {
+	var dirs []string
+	if scoresFile != "" {
+		info, err := os.Stat(scoresFile)
+		if err != nil || !info.IsDir() {
+			return scoresFile, nil
+		}
+		dirs = []string{scoresFile}
+	} else {
+		var err error
+		if dirs, err = cloneHeroDataDirs(); err != nil {
+			return "", fmt.Errorf("couldn't find scoredata.bin, pass --scores-file: %w", err)
+		}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir, "scoredata.bin")
+		if player != "" {
+			path = filepath.Join(dir, "profiles", player, "scoredata.bin")
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	if player != "" {
+		var known []string
+		for _, dir := range dirs {
+			known = append(known, scoreProfiles(dir)...)
+		}
+		if len(known) > 0 {
+			return "", fmt.Errorf("no scores for player %q (players: %s)", player, strings.Join(known, ", "))
+		}
+		return "", fmt.Errorf("no scores for player %q in the Clone Hero data folder, pass --scores-file", player)
+	}
+	return "", fmt.Errorf("couldn't find scoredata.bin in the Clone Hero data folder, pass --scores-file")
+}
+
+// scoreProfiles lists the players with a score file in a Clone Hero data folder
+func scoreProfiles(dir string) []string {
+	entries, err := os.ReadDir(filepath.Join(dir, "profiles"))
+	if err != nil {
+		return nil
+	}
+	var players []string
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(dir, "profiles", entry.Name(), "scoredata.bin")); err == nil {
+			players = append(players, entry.Name())
+		}
+	}
+	return players
+}
+
+// loadScores reads the score file selected by --scores-file and --player, returning
+// the scores and the path they were read from
+func loadScores() (ScoreData, string, error) {
+	path, err := scoresFilePath()
+	if err != nil {
+		return nil, "", err
+	}
+	scores, err := ParseScoreData(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return scores, path, nil
+}
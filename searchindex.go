@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// SearchIndex is an in-memory index over the name, artist and charter of a loaded
+// library, for answering many text searches without scanning every song each time. It
+// only narrows a search down to candidates; the filter still decides what matches.
+type SearchIndex struct {
+	songs  []*Song
+	fields map[string]*fieldIndex
+}
+
+// fieldIndex holds the posting lists (song positions, ascending) of one field's
+// lowercased text: one per trigram for substring searches, and one per byte for the
+// character-order fallback of fuzzyMatch
+type fieldIndex struct {
+	trigrams map[string][]int32
+	bytes    [256][]int32
+}
+
+// searchFields are the indexed fields and the text indexed for each
+var searchFields = map[string]func(song *Song) string{
+	"name":   func(s *Song) string { return s.Name },
+	"artist": func(s *Song) string { return s.Artist },
+	// --name falls back to comparing normalized names, so "Pt. II" finds "Part 2"
+	"normalized_name": func(s *Song) string { return normalizeName(s.Name) },
+	// Charters are joined with a byte no search contains, so no trigram spans two of them
+	"charter": func(s *Song) string {
+		charters := make([]string, len(s.Charters))
+		for i, charter := range s.Charters {
+			charters[i] = plainCharter(charter)
+		}
+		return strings.Join(charters, "\x00")
+	},
+}
+
+// NewSearchIndex indexes songs, keeping their order
+func NewSearchIndex(songs []*Song) *SearchIndex {
+	idx := &SearchIndex{songs: songs, fields: make(map[string]*fieldIndex, len(searchFields))}
+	for field, text := range searchFields {
+		fi := &fieldIndex{trigrams: make(map[string][]int32)}
+		for i, song := range songs {
+			value := strings.ToLower(text(song))
+			var seen [256]bool
+			for j := 0; j < len(value); j++ {
+				if b := value[j]; !seen[b] {
+					seen[b] = true
+					fi.bytes[b] = append(fi.bytes[b], int32(i))
+				}
+			}
+			for j := 0; j+3 <= len(value); j++ {
+				trigram := value[j : j+3]
+				// Songs are added in order, so a repeat of this song is always last
+				if postings := fi.trigrams[trigram]; len(postings) == 0 || postings[len(postings)-1] != int32(i) {
+					fi.trigrams[trigram] = append(postings, int32(i))
+				}
+			}
+		}
+		idx.fields[field] = fi
+	}
+	return idx
+}
+
+// Narrow returns the songs that can match the name, artist and charter criteria of spec
+// and of its "all" and "any" clauses, in library order. Other criteria and "not" clauses
+// are left to the filter, so the result is a superset of what the spec matches.
+func (idx *SearchIndex) Narrow(spec FilterSpec) []*Song {
+	positions, ok := idx.positions(spec)
+	if !ok {
+		return idx.songs
+	}
+	songs := make([]*Song, len(positions))
+	for i, position := range positions {
+		songs[i] = idx.songs[position]
+	}
+	return songs
+}
+
+// positions returns the positions of the songs that can match spec, or false when the
+// index can't narrow it down
+func (idx *SearchIndex) positions(spec FilterSpec) ([]int32, bool) {
+	var lists [][]int32
+	if spec.Name != "" {
+		// matchesName also accepts the characters of the name in order, as written or
+		// once both are normalized, so only songs containing every one of them in either
+		// form can match. A query that normalizes to nothing matches every song.
+		if normalized := normalizeName(spec.Name); normalized != "" {
+			lists = append(lists, unionPostings(
+				intersectPostings(idx.fields["name"].containingBytes(strings.ToLower(spec.Name))),
+				intersectPostings(idx.fields["normalized_name"].containingBytes(normalized)),
+			))
+		}
+	}
+	if spec.Artist != "" {
+		lists = append(lists, idx.fields["artist"].containing(strings.ToLower(spec.Artist))...)
+	}
+	if spec.Charter != "" {
+		lists = append(lists, idx.fields["charter"].containing(strings.ToLower(spec.Charter))...)
+	}
+	for _, clause := range spec.All {
+		if positions, ok := idx.positions(clause); ok {
+			lists = append(lists, positions)
+		}
+	}
+	// "any" narrows only when each of its clauses does
+	if len(spec.Any) > 0 {
+		var union []int32
+		narrowed := true
+		for _, clause := range spec.Any {
+			positions, ok := idx.positions(clause)
+			if !ok {
+				narrowed = false
+				break
+			}
+			union = unionPostings(union, positions)
+		}
+		if narrowed {
+			lists = append(lists, union)
+		}
+	}
+	if len(lists) == 0 {
+		return nil, false
+	}
+	return intersectPostings(lists), true
+}
+
+// containing returns the posting lists a song must be in for its text to contain
+// pattern: those of its trigrams, or of its bytes when it's too short to have any
+func (fi *fieldIndex) containing(pattern string) [][]int32 {
+	if len(pattern) < 3 {
+		return fi.containingBytes(pattern)
+	}
+	lists := make([][]int32, 0, len(pattern)-2)
+	for j := 0; j+3 <= len(pattern); j++ {
+		lists = append(lists, fi.trigrams[pattern[j:j+3]])
+	}
+	return lists
+}
+
+// containingBytes returns the posting lists of every byte of pattern
+func (fi *fieldIndex) containingBytes(pattern string) [][]int32 {
+	lists := make([][]int32, 0, len(pattern))
+	for j := 0; j < len(pattern); j++ {
+		lists = append(lists, fi.bytes[pattern[j]])
+	}
+	return lists
+}
+
+// unionPostings merges two ascending posting lists into one, without repeats
+func unionPostings(a, b []int32) []int32 {
+	result := make([]int32, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0] < b[0]:
+			result, a = append(result, a[0]), a[1:]
+		case b[0] < a[0]:
+			result, b = append(result, b[0]), b[1:]
+		default:
+			result, a, b = append(result, a[0]), a[1:], b[1:]
+		}
+	}
+	result = append(result, a...)
+	return append(result, b...)
+}
+
+// intersectPostings returns the positions in every list, starting from the shortest
+// list so the work is bounded by the rarest trigram or byte
+func intersectPostings(lists [][]int32) []int32 {
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	result := append([]int32(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		if len(result) == 0 {
+			break
+		}
+		kept := result[:0]
+		k := 0
+		for _, position := range result {
+			for k < len(list) && list[k] < position {
+				k++
+			}
+			if k < len(list) && list[k] == position {
+				kept = append(kept, position)
+			}
+		}
+		result = kept
+	}
+	return result
+}
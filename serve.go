@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	servePort int
+	serveHost string
+
+	serveCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the library over a small REST API",
+		Long: `Load the library once and serve it over HTTP, to browse it from a phone or another
+computer on the same network:
+
+  GET /         a search page
+  GET /songs    the matching songs as JSON
+  GET /stats    song counts per instrument, difficulty tier and genre as JSON
+
+Both endpoints take filter file keys as query parameters, e.g.
+/songs?artist=Polyphia&sort=length or /stats?genre=metal. A key given several times
+matches any of its values; not=<key>=<value>, repeatable, leaves songs out. /songs also takes sort,
+limit (default 100, 0 for all) and offset. The filter flags of the command line apply
+to every request.`,
+		Args: cobra.NoArgs,
+		RunE: runServe,
+	}
+)
+
+func init() {
+	serveCmd.Flags().IntVar(&servePort, "port", 8080, "Port to listen on")
+	serveCmd.Flags().StringVar(&serveHost, "host", "", "Address to listen on (default: every network interface)")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// defaultServeLimit is the number of songs /songs returns without a limit parameter
+const defaultServeLimit = 100
+
+// librarySongs is the response of /songs
+type librarySongs struct {
+	SchemaVersion int          `json:"schema_version"`
+	Count         int          `json:"count"`   // songs in this response
+	Matched       int          `json:"matched"` // songs matching the filters
+	Total         int          `json:"total"`   // songs in the library
+	Songs         []SongRecord `json:"songs"`
+}
+
+// libraryStats is the response of /stats
+type libraryStats struct {
+	SchemaVersion int              `json:"schema_version"`
+	Songs         int              `json:"songs"`
+	LengthMs      int64            `json:"length_ms"`
+	Length        string           `json:"length"` // length_ms in the --duration-format
+	Instruments   map[string]int   `json:"instruments"`
+	Tiers         map[string][]int `json:"tiers"` // songs per instrument and diff_* tier, from 0 to 6+
+	Genres        map[string]int   `json:"genres"`
+}
+
+// libraryServer answers requests from a library loaded once. Requests are handled one
+// at a time, since the notes files are read into the songs the first time a filter
+// needs them.
+type libraryServer struct {
+	mu           sync.Mutex
+	songs        []*Song
+	index        *SearchIndex // of songs, to only filter the songs a request can match
+	base         FilterSpec
+	chartsLoaded bool
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	base, err := buildFilterSpec()
+	if err != nil {
+		return err
+	}
+	if err := validateFilterSpec(base); err != nil {
+		return err
+	}
+	songs, err := loadLibrary()
+	if err != nil {
+		return err
+	}
+	server := &libraryServer{songs: songs, index: NewSearchIndex(songs), base: base}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", server.handleIndex)
+	mux.HandleFunc("GET /songs", server.handleSongs)
+	mux.HandleFunc("GET /stats", server.handleStats)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(serveHost, strconv.Itoa(servePort)))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Serving %d song(s) on %s (Ctrl-C to stop)\n", len(songs), serveURLs(listener.Addr().(*net.TCPAddr)))
+
+	httpServer := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-commandContext().Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+	}()
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// serveURLs returns the URLs the server can be reached at: one per network interface
+// when it listens on all of them
+func serveURLs(addr *net.TCPAddr) string {
+	port := strconv.Itoa(addr.Port)
+	if !addr.IP.IsUnspecified() {
+		return "http://" + net.JoinHostPort(addr.IP.String(), port)
+	}
+	urls := "http://localhost:" + port
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ip, ok := a.(*net.IPNet); ok && ip.IP.To4() != nil && !ip.IP.IsLoopback() {
+				urls += ", http://" + net.JoinHostPort(ip.IP.String(), port)
+			}
+		}
+	}
+	return urls
+}
+
+// requestSpec builds the filter of a request from its query parameters, on top of the
+// filter flags. Parameters in skip aren't filters.
+func (s *libraryServer) requestSpec(r *http.Request, skip ...string) (FilterSpec, error) {
+	spec := s.base
+	spec.All = append([]FilterSpec{}, s.base.All...)
+	spec.Not = append([]FilterSpec{}, s.base.Not...)
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if containsFold(skip, key) {
+			continue
+		}
+		if key == "not" {
+			for _, value := range query[key] {
+				excluded, err := parseNot(value)
+				if err != nil {
+					return FilterSpec{}, err
+				}
+				spec.Not = append(spec.Not, excluded)
+			}
+			continue
+		}
+		var clause FilterSpec
+		for _, value := range query[key] {
+			alternative, err := specFromKey(key, value)
+			if err != nil {
+				return FilterSpec{}, fmt.Errorf("invalid %s=%q: %w", key, value, err)
+			}
+			clause.Any = append(clause.Any, alternative)
+		}
+		spec.All = append(spec.All, clause)
+	}
+	if err := validateFilterSpec(spec); err != nil {
+		return FilterSpec{}, err
+	}
+	return spec, nil
+}
+
+// match returns the songs matching a spec, reading the notes files first if the spec
+// needs them and they haven't been read yet
+func (s *libraryServer) match(spec FilterSpec) ([]*Song, error) {
+	if spec.readsCharts() && !s.chartsLoaded {
+		if err := loadChartedDifficulties(s.songs); err != nil {
+			return nil, err
+		}
+		s.chartsLoaded = true
+	}
+	filter, err := NewFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+	// Apply returns the library itself without filters, and it's sorted in place
+	return append([]*Song{}, filter.Apply(s.index.Narrow(spec))...), nil
+}
+
+func (s *libraryServer) handleSongs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	limit, offset := defaultServeLimit, 0
+	for name, target := range map[string]*int{"limit": &limit, "offset": &offset} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				writeServeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+	spec, err := s.requestSpec(r, "sort", "limit", "offset")
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	songs, err := s.match(spec)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	sortField := sortBy
+	if query.Has("sort") {
+		sortField = query.Get("sort")
+	}
+	NewSorter(sortField).RankBy(spec.nameQueries()).Sort(songs)
+	matched := len(songs)
+	songs = songs[min(offset, len(songs)):]
+	if limit > 0 && len(songs) > limit {
+		songs = songs[:limit]
+	}
+	writeServeJSON(w, librarySongs{
+		SchemaVersion: SchemaVersion,
+		Count:         len(songs),
+		Matched:       matched,
+		Total:         len(s.songs),
+		Songs:         newSongRecords(songs),
+	})
+}
+
+func (s *libraryServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spec, err := s.requestSpec(r)
+	if err != nil {
+		writeServeError(w, http.StatusBadRequest, err)
+		return
+	}
+	songs, err := s.match(spec)
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	stats := libraryStats{
+		SchemaVersion: SchemaVersion,
+		Songs:         len(songs),
+		Instruments:   make(map[string]int),
+		Tiers:         make(map[string][]int),
+		Genres:        make(map[string]int),
+	}
+	var total time.Duration
+	for _, song := range songs {
+		stats.LengthMs += song.Length.Milliseconds()
+		total += song.Length
+		if song.Genre != "" {
+			stats.Genres[song.Genre]++
+		}
+	}
+	stats.Length = formatDataDuration(total)
+	for inst, counts := range tierCounts(songs) {
+		stats.Tiers[string(inst)] = counts
+		for _, count := range counts {
+			stats.Instruments[string(inst)] += count
+		}
+	}
+	writeServeJSON(w, stats)
+}
+
+func (s *libraryServer) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, serveIndexPage)
+}
+
+// writeServeJSON writes a JSON response
+func writeServeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+// writeServeError writes an error as a JSON response: {"error": "..."}
+func writeServeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// serveIndexPage is a search page for phones, built on /songs
+const serveIndexPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>cloneheroer</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+input, select { font-size: 1.1em; margin: 0.2em 0; width: 100%; box-sizing: border-box; }
+li { margin: 0.5em 0; }
+small { color: #666; }
+</style>
+</head>
+<body>
+<input id="q" type="search" placeholder="Artist" autofocus>
+<select id="sort">
+<option value="">Artist</option><option value="name">Name</option><option value="length">Length</option><option value="year">Year</option>
+</select>
+<p id="count"></p>
+<ol id="songs"></ol>
+<script>
+const q = document.getElementById("q"), sort = document.getElementById("sort");
+async function search() {
+  const params = new URLSearchParams();
+  if (q.value) params.set("artist", q.value);
+  if (sort.value) params.set("sort", sort.value);
+  const res = await (await fetch("/songs?" + params)).json();
+  document.getElementById("count").textContent = res.error || res.matched + " of " + res.total + " songs";
+  const list = document.getElementById("songs");
+  list.replaceChildren(...(res.songs || []).map(song => {
+    const item = document.createElement("li");
+    item.textContent = song.artist + " - " + song.name + " ";
+    const details = document.createElement("small");
+    details.textContent = [song.year, song.genre, (song.charters || []).join(", ")].filter(Boolean).join(" · ");
+    item.append(details);
+    return item;
+  }));
+}
+q.addEventListener("input", search);
+sort.addEventListener("change", search);
+search();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	setlistSections    []string
+	setlistMaxSongs    int
+	setlistMaxDuration time.Duration
+	setlistBreak       time.Duration
+
+	setlistCmd = &cobra.Command{
+		Use:   "setlist",
+		Short: "Build a setlist or practice plan from the matching songs",
+		Long: `Build an ordered setlist from the matching songs (in --sort order) and print it with a
+running clock, so you know when each song starts.
+
+Long songs can be cut down to a single practice section with --section "<song>=<section>",
+e.g. --section "goat=solo" plays just the solo of G.O.A.T. Sections come from the chart's
+section events; the entry shows where in the song the section starts and ends. Songs named
+in --section are added to the setlist if the filters didn't already include them.
+
+--alternate and --artist-gap reorder the setlist so it flows like a show: easier and harder
+songs take turns, and songs by the same artist are kept apart. Songs are rated by their
+diff_* intensity, or with --rate-by scores by your best score on them.`,
+		RunE: runSetlist,
+	}
+)
+
+func init() {
+	setlistCmd.Flags().StringArrayVar(&setlistSections, "section", nil, "Only play one section of a song: \"<song name>=<section name>\" (repeatable)")
+	setlistCmd.Flags().IntVar(&setlistMaxSongs, "max-songs", 0, "Stop after this many entries (0 for no limit)")
+	setlistCmd.Flags().DurationVar(&setlistMaxDuration, "max-duration", 0, "Stop before the setlist gets longer than this (e.g. 45m)")
+	setlistCmd.Flags().DurationVar(&setlistBreak, "break", 0, "Pause between entries, included in the running clock")
+	rootCmd.AddCommand(setlistCmd)
+}
+
+// SetlistEntry is a song in a setlist, optionally limited to one section
+type SetlistEntry struct {
+	Song    *Song
+	Section *ChartSection
+}
+
+// Duration returns how long the entry plays for
+func (e SetlistEntry) Duration() time.Duration {
+	if e.Section != nil {
+		return e.Section.End - e.Section.Start
+	}
+	return e.Song.Length
+}
+
+// setlistRecord is the JSON representation of a setlist entry
+type setlistRecord struct {
+	SongRecord
+	StartsAtMs int64          `json:"starts_at_ms"`
+	StartsAt   string         `json:"starts_at"` // starts_at_ms as m:ss
+	DurationMs int64          `json:"duration_ms"`
+	Duration   string         `json:"duration"` // duration_ms in the --duration-format
+	Section    *sectionRecord `json:"section,omitempty"`
+}
+
+// sectionRecord is the JSON representation of a practice section
+type sectionRecord struct {
+	Name    string `json:"name"`
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+}
+
+// setlistDocument is the JSON representation of a setlist
+type setlistDocument struct {
+	SchemaVersion int             `json:"schema_version"`
+	TotalMs       int64           `json:"total_ms"`
+	Total         string          `json:"total"` // total_ms in the --duration-format
+	Entries       []setlistRecord `json:"entries"`
+}
+
+func runSetlist(cmd *cobra.Command, args []string) error {
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+
+	allSongs, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+
+	entries := make([]SetlistEntry, 0, len(songs))
+	for _, song := range songs {
+		entries = append(entries, SetlistEntry{Song: song})
+	}
+	for _, spec := range setlistSections {
+		entries, err = applySetlistSection(entries, allSongs, spec)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err = applySetlistBalance(entries)
+	if err != nil {
+		return err
+	}
+	entries = limitSetlist(entries, setlistMaxSongs, setlistMaxDuration, setlistBreak)
+	warnArtistGap(entries)
+	summarize("count", len(entries))
+	if showQR {
+		setSongs := make([]*Song, len(entries))
+		for i, entry := range entries {
+			setSongs[i] = entry.Song
+		}
+		return printQR(setSongs)
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		return writeSetlistJSON(writer, entries)
+	}
+	writeSetlist(writer, entries)
+	return nil
+}
+
+// applySetlistSection limits the song named in a "<song>=<section>" spec to that section,
+// adding the song to the setlist if needed
+func applySetlistSection(entries []SetlistEntry, library []*Song, spec string) ([]SetlistEntry, error) {
+	songName, sectionName, ok := strings.Cut(spec, "=")
+	songName, sectionName = strings.TrimSpace(songName), strings.TrimSpace(sectionName)
+	if !ok || songName == "" || sectionName == "" {
+		return nil, fmt.Errorf("invalid --section %q, expected \"<song name>=<section name>\"", spec)
+	}
+
+	filter, err := NewFilter(FilterSpec{Name: songName})
+	if err != nil {
+		return nil, err
+	}
+	song, err := pickSong(filter.Apply(library), os.Stdin, os.Stderr, isInteractive())
+	if err != nil {
+		return nil, fmt.Errorf("--section %q: %w", spec, err)
+	}
+	section, err := findSection(song, sectionName)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if entries[i].Song == song {
+			entries[i].Section = section
+			return entries, nil
+		}
+	}
+	return append(entries, SetlistEntry{Song: song, Section: section}), nil
+}
+
+// findSection looks up a practice section of a song by (partial, case-insensitive) name,
+// preferring an exact match
+func findSection(song *Song, name string) (*ChartSection, error) {
+	chart, err := loadSongChart(song)
+	if err != nil {
+		return nil, err
+	}
+	sections := chart.Sections()
+
+	var partial *ChartSection
+	for i := range sections {
+		if strings.EqualFold(sections[i].Name, name) {
+			return &sections[i], nil
+		}
+		if partial == nil && strings.Contains(strings.ToLower(sections[i].Name), strings.ToLower(name)) {
+			partial = &sections[i]
+		}
+	}
+	if partial != nil {
+		return partial, nil
+	}
+
+	names := make([]string, len(sections))
+	for i, section := range sections {
+		names[i] = section.Name
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s - %s has no practice sections", song.Artist, song.Name)
+	}
+	return nil, fmt.Errorf("%s - %s has no section matching %q (sections: %s)", song.Artist, song.Name, name, strings.Join(names, ", "))
+}
+
+// limitSetlist cuts the setlist down to at most maxSongs entries and maxDuration of
+// playing time (including breaks); zero means no limit
+func limitSetlist(entries []SetlistEntry, maxSongs int, maxDuration, pause time.Duration) []SetlistEntry {
+	if maxSongs > 0 && len(entries) > maxSongs {
+		entries = entries[:maxSongs]
+	}
+	if maxDuration <= 0 {
+		return entries
+	}
+
+	var total time.Duration
+	for i, entry := range entries {
+		if i > 0 {
+			total += pause
+		}
+		total += entry.Duration()
+		if total > maxDuration {
+			return entries[:i]
+		}
+	}
+	return entries
+}
+
+// writeSetlist prints the setlist as a practice plan with a running clock
+func writeSetlist(w io.Writer, entries []SetlistEntry) {
+	var clock time.Duration
+	var lines []string
+	for i, entry := range entries {
+		if i > 0 {
+			clock += setlistBreak
+		}
+
+		line := fmt.Sprintf("%3d. [%s] %s - %s (%s)", i+1, formatClock(clock), entry.Song.Artist, entry.Song.Name, formatDuration(entry.Duration()))
+		if entry.Section != nil {
+			line += fmt.Sprintf("\n        Section %q: %s - %s", entry.Section.Name,
+				formatMillis(entry.Section.Start.Milliseconds()), formatMillis(entry.Section.End.Milliseconds()))
+		}
+		lines = append(lines, line)
+		clock += entry.Duration()
+	}
+
+	fmt.Fprintf(w, "Setlist: %d song(s), %s total\n\n", len(entries), formatDuration(clock))
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// writeSetlistJSON writes the setlist as a single JSON document
+func writeSetlistJSON(w io.Writer, entries []SetlistEntry) error {
+	doc := setlistDocument{SchemaVersion: SchemaVersion, Entries: []setlistRecord{}}
+	var clock time.Duration
+	for i, entry := range entries {
+		if i > 0 {
+			clock += setlistBreak
+		}
+		record := setlistRecord{
+			SongRecord: NewSongRecord(entry.Song),
+			StartsAtMs: clock.Milliseconds(),
+			StartsAt:   formatClock(clock),
+			DurationMs: entry.Duration().Milliseconds(),
+			Duration:   formatDataDuration(entry.Duration()),
+		}
+		if entry.Section != nil {
+			record.Section = &sectionRecord{
+				Name:    entry.Section.Name,
+				StartMs: entry.Section.Start.Milliseconds(),
+				EndMs:   entry.Section.End.Milliseconds(),
+			}
+		}
+		doc.Entries = append(doc.Entries, record)
+		clock += entry.Duration()
+	}
+	doc.TotalMs = clock.Milliseconds()
+	doc.Total = formatDataDuration(clock)
+
+	encoder := json.NewEncoder(w)
+	if outputFormat == FormatJSON {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(doc)
+}
+
+// formatClock formats a duration as m:ss, or h:mm:ss for an hour or more
+func formatClock(d time.Duration) string {
+	totalSeconds := int(d.Seconds())
+	if totalSeconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", totalSeconds/3600, (totalSeconds%3600)/60, totalSeconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", totalSeconds/60, totalSeconds%60)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Ways to rate how hard a setlist entry is, for --rate-by
+const (
+	RateByIntensity = "intensity"
+	RateByScores    = "scores"
+)
+
+var (
+	setlistAlternate bool
+	setlistArtistGap int
+	setlistRateBy    string
+)
+
+func init() {
+	setlistCmd.Flags().BoolVar(&setlistAlternate, "alternate", false, "Alternate easier and harder songs, starting with an easier one")
+	setlistCmd.Flags().IntVar(&setlistArtistGap, "artist-gap", 0, "Keep at least this many other songs between two songs by the same artist")
+	setlistCmd.Flags().StringVar(&setlistRateBy, "rate-by", RateByIntensity, "How --alternate rates songs: intensity (diff_* value of --instrument, or the highest) or scores (your best percentage on --instrument)")
+}
+
+// rateSetlist returns how hard each entry is, higher being harder, by the --rate-by
+// method
+func rateSetlist(entries []SetlistEntry, rateBy string) ([]float64, error) {
+	ratings := make([]float64, len(entries))
+	switch rateBy {
+	case RateByIntensity:
+		for i, entry := range entries {
+			ratings[i] = float64(songIntensity(entry.Song))
+		}
+		return ratings, nil
+	case RateByScores:
+	default:
+		return nil, fmt.Errorf("unknown --rate-by %q (available: %s, %s)", rateBy, RateByIntensity, RateByScores)
+	}
+
+	if filterInst == "" {
+		return nil, fmt.Errorf("--rate-by scores needs --instrument")
+	}
+	inst := ParseInstrument(filterInst)
+	scores, _, err := loadScores()
+	if err != nil {
+		return nil, err
+	}
+	difficulty, err := recommendedDifficulty(scores, inst)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lower the best score, the harder the song; songs never played count as the
+	// hardest
+	for i, entry := range entries {
+		ratings[i] = 100
+		checksum, err := songChecksum(entry.Song)
+		if err != nil {
+			continue
+		}
+		if songScores, ok := scores[checksum]; ok {
+			if best, ok := songScores.Best(inst, difficulty); ok {
+				ratings[i] = 100 - best.Percent()
+			}
+		}
+	}
+	return ratings, nil
+}
+
+// songIntensity returns the diff_* value of --instrument, or the highest of the song's
+// parts without one
+func songIntensity(song *Song) int {
+	if filterInst != "" {
+		return song.Instruments[ParseInstrument(filterInst)]
+	}
+	intensity := 0
+	for _, value := range song.Instruments {
+		intensity = max(intensity, value)
+	}
+	return intensity
+}
+
+// balanceSetlist reorders entries so easier and harder songs alternate (if alternate is
+// set) and songs by the same artist are at least artistGap entries apart. Otherwise the
+// order of entries is kept as far as possible.
+func balanceSetlist(entries []SetlistEntry, ratings []float64, alternate bool, artistGap int) []SetlistEntry {
+	// Split the entries into the easier and the harder half, keeping their order
+	indexes := make([]int, len(entries))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool { return ratings[indexes[a]] < ratings[indexes[b]] })
+	harder := make([]bool, len(entries))
+	for _, i := range indexes[len(indexes)/2:] {
+		harder[i] = true
+	}
+
+	used := make([]bool, len(entries))
+	first := 0 // entries before this one are all used
+	balanced := make([]SetlistEntry, 0, len(entries))
+	for len(balanced) < len(entries) {
+		for used[first] {
+			first++
+		}
+		wantHarder := len(balanced)%2 == 1
+		// Prefer the wanted half and an artist far enough back, giving up the
+		// alternation before the artist gap
+		pick := -1
+		for _, pass := range []struct{ half, gap bool }{{true, true}, {false, true}, {true, false}, {false, false}} {
+			for i := first; i < len(entries); i++ {
+				if used[i] || (pass.half && alternate && harder[i] != wantHarder) || (pass.gap && sameArtistWithin(balanced, entries[i], artistGap)) {
+					continue
+				}
+				pick = i
+				break
+			}
+			if pick >= 0 {
+				break
+			}
+		}
+		used[pick] = true
+		balanced = append(balanced, entries[pick])
+	}
+	return balanced
+}
+
+// sameArtistWithin reports whether one of the last gap entries of setlist is by the
+// primary artist of entry
+func sameArtistWithin(setlist []SetlistEntry, entry SetlistEntry, gap int) bool {
+	artist := strings.ToLower(entry.Song.PrimaryArtist())
+	for _, previous := range setlist[max(0, len(setlist)-gap):] {
+		if strings.ToLower(previous.Song.PrimaryArtist()) == artist {
+			return true
+		}
+	}
+	return false
+}
+
+// warnArtistGap warns about the entries of the final setlist that are closer than
+// --artist-gap to a song by the same artist
+func warnArtistGap(entries []SetlistEntry) {
+	if setlistArtistGap <= 0 {
+		return
+	}
+	nearby := 0
+	for i, entry := range entries {
+		if sameArtistWithin(entries[:i], entry, setlistArtistGap) {
+			nearby++
+		}
+	}
+	if nearby > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d song(s) are closer than --artist-gap %d to another song by the same artist; there are too few other artists\n", nearby, setlistArtistGap)
+	}
+}
+
+// applySetlistBalance balances the setlist according to --alternate and --artist-gap
+func applySetlistBalance(entries []SetlistEntry) ([]SetlistEntry, error) {
+	if !setlistAlternate && setlistArtistGap <= 0 {
+		return entries, nil
+	}
+	var ratings []float64
+	if setlistAlternate {
+		var err error
+		if ratings, err = rateSetlist(entries, setlistRateBy); err != nil {
+			return nil, err
+		}
+	} else {
+		ratings = make([]float64, len(entries))
+	}
+
+	return balanceSetlist(entries, ratings, setlistAlternate, setlistArtistGap), nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+var exportSetlistFile string
+
+func init() {
+	rootCmd.Flags().StringVarP(&exportSetlistFile, "export-setlist", "", "", "Write the matching songs to a Clone Hero .setlist file, to load them in-game as a setlist")
+}
+
+// encodeSetlist encodes notes file checksums as a Clone Hero .setlist file: each song
+// is the checksum as 32 lowercase hex digits, in a string prefixed with its length as
+// .NET's BinaryWriter writes it (a single byte for strings this short)
+func encodeSetlist(checksums []string) ([]byte, error) {
+	data := make([]byte, 0, len(checksums)*33)
+	for _, checksum := range checksums {
+		if raw, err := hex.DecodeString(checksum); err != nil || len(raw) != 16 {
+			return nil, fmt.Errorf("invalid chart checksum %q", checksum)
+		}
+		data = append(data, byte(len(checksum)))
+		data = append(data, checksum...)
+	}
+	return data, nil
+}
+
+// exportSetlist writes songs to a .setlist file, identified by the checksums Clone Hero
+// computes for their notes file (see songChecksum). Songs whose notes file can't be read
+// are left out with a warning. It returns the number of songs written.
+func exportSetlist(path string, songs []*Song) (int, error) {
+	if anyRemoteLibrary() {
+		return 0, fmt.Errorf("--export-setlist needs a local library")
+	}
+	var checksums []string
+	seen := make(map[string]bool)
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return 0, err
+		}
+		checksum, err := songChecksum(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: leaving %s - %s out of the setlist: %v\n", song.Artist, song.Name, err)
+			continue
+		}
+		// The game lists a chart once however many copies the library has
+		if !seen[checksum] {
+			seen[checksum] = true
+			checksums = append(checksums, checksum)
+		}
+	}
+	data, err := encodeSetlist(checksums)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeFileAtomic(path, data, 0644); err != nil {
+		return 0, err
+	}
+	return len(checksums), nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Choose your songs folder, cache location and colors",
+	Long: `Answer a few questions to write the config file: where your Clone Hero songs are, so
+you don't need -d every time, where the song cache is kept, and whether to use colors.
+
+setup runs by itself the first time the CLI is used on a terminal. Run it again at any
+time to change the answers; -d and --color still override them for a single run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !isInteractive() {
+			path, _ := configFile()
+			return fmt.Errorf("setup asks questions and needs a terminal; edit %s instead", path)
+		}
+		return runSetupWizard(bufio.NewReader(os.Stdin), os.Stderr)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+}
+
+// errSetupCancelled is returned when the input ends in the middle of setup
+var errSetupCancelled = errors.New("setup cancelled, nothing was saved")
+
+// firstRunSetup offers to run setup when there's no config file yet and someone is at
+// the terminal to answer. Declining writes an empty config file, so it's only offered
+// once.
+func firstRunSetup(cmd *cobra.Command) error {
+	if !isInteractive() || porcelainMode() || !offersSetup(cmd) {
+		return nil
+	}
+	path, err := configFile()
+	if err != nil {
+		return nil
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	fmt.Fprintln(os.Stderr, "Welcome to cloneheroer! There's no config file yet.")
+	setUp, err := askYesNo(in, os.Stderr, "Set up your songs folder, cache and colors now?", true)
+	if err != nil {
+		return err
+	}
+	if !setUp {
+		if err := updateConfig(func(root *yaml.Node) {}); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Skipped. Run \"cloneheroer setup\" any time.\n\n")
+		return nil
+	}
+	if err := runSetupWizard(in, os.Stderr); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr)
+	return nil
+}
+
+// offersSetup reports whether a command may start with the first-run setup; help,
+// shell completion and the commands that edit the config file don't
+func offersSetup(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		switch c.Name() {
+		case "setup", "alias", "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
+	}
+	return true
+}
+
+// runSetupWizard asks for the songs folder, cache folder and color preference, and
+// saves the answers to the config file, keeping anything else in it
+func runSetupWizard(in *bufio.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "Press Enter to keep the answer in brackets.")
+	fmt.Fprintln(out)
+
+	songs, err := askSongsFolder(in, out)
+	if err != nil {
+		return err
+	}
+	cache, err := askCacheFolder(in, out)
+	if err != nil {
+		return err
+	}
+	colors, err := askColor(in, out)
+	if err != nil {
+		return err
+	}
+
+	err = updateConfig(func(root *yaml.Node) {
+		setMappingScalar(root, "directory", songs)
+		setMappingScalar(root, "cache_dir", cache)
+		setMappingScalar(root, "color", colors)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save the config: %w", err)
+	}
+	userConfig.Directory, userConfig.CacheDir, userConfig.Color = songs, cache, colors
+
+	path, _ := configFile()
+	fmt.Fprintf(out, "\nSaved to %s. Run \"cloneheroer setup\" to change it.\n", path)
+	return nil
+}
+
+// ask prints a question with its default answer and reads the answer, the default if
+// it's left empty
+func ask(in *bufio.Reader, out io.Writer, question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(out, "%s: ", question)
+	}
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		fmt.Fprintln(out)
+		return "", errSetupCancelled
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// askYesNo asks a yes or no question
+func askYesNo(in *bufio.Reader, out io.Writer, question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := ask(in, out, question+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(out, "Please answer y or n.")
+	}
+}
+
+// askChoice lists choices and asks for one by number, or for a folder typed in. Folder
+// answers are returned as typed.
+func askChoice(in *bufio.Reader, out io.Writer, question string, choices []string, labels []string, def string) (string, error) {
+	fmt.Fprintln(out, question)
+	defNumber := ""
+	for i, choice := range choices {
+		fmt.Fprintf(out, "  %d) %s%s\n", i+1, choice, labels[i])
+		if choice == def {
+			defNumber = strconv.Itoa(i + 1)
+		}
+	}
+	if defNumber == "" {
+		defNumber = def
+	}
+	prompt := "Type a folder"
+	if len(choices) > 0 {
+		prompt = "Pick a number or type a folder"
+	}
+	answer, err := ask(in, out, prompt, defNumber)
+	if err != nil {
+		return "", err
+	}
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+		return choices[n-1], nil
+	}
+	return answer, nil
+}
+
+// setupPath makes a typed folder absolute, expanding a leading ~
+func setupPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~"); ok && (rest == "" || os.IsPathSeparator(rest[0])) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + rest
+		}
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// songsFolderCandidates returns the folders that look like a songs folder, with the songs
+// found in each: the one already configured, the usual Clone Hero songs folders and the
+// current folder
+func songsFolderCandidates() ([]string, []libraryProbe) {
+	var dirs []string
+	if userConfig.Directory != "" {
+		dirs = append(dirs, userConfig.Directory)
+	}
+	if dataDirs, err := cloneHeroDataDirs(); err == nil {
+		for _, dataDir := range dataDirs {
+			dirs = append(dirs, filepath.Join(dataDir, "Songs"))
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Clone Hero", "Songs"))
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, filepath.Join(cwd, "Songs"), filepath.Join(filepath.Dir(cwd), "Songs"), cwd)
+	}
+
+	var seen []os.FileInfo
+	var candidates []string
+	var probes []libraryProbe
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() || containsSameFile(seen, info) {
+			continue
+		}
+		seen = append(seen, info)
+		if probe := probeLibrary(dir); probe.Songs+probe.Sng > 0 {
+			candidates = append(candidates, dir)
+			probes = append(probes, probe)
+		}
+	}
+	return candidates, probes
+}
+
+// askSongsFolder asks where the songs are. An empty answer means the current folder,
+// which isn't saved.
+func askSongsFolder(in *bufio.Reader, out io.Writer) (string, error) {
+	candidates, probes := songsFolderCandidates()
+	labels := make([]string, len(candidates))
+	for i, probe := range probes {
+		more := ""
+		if probe.Truncated {
+			more = "+"
+		}
+		labels[i] = fmt.Sprintf(" (%d%s songs)", probe.Songs+probe.Sng, more)
+	}
+	def := userConfig.Directory
+	if def == "" && len(candidates) > 0 {
+		def = candidates[0]
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintln(out, "No songs folder found in the usual places.")
+	}
+
+	for {
+		answer, err := askChoice(in, out, "Where are your Clone Hero songs?", candidates, labels, def)
+		if err != nil {
+			return "", err
+		}
+		if answer == "" {
+			fmt.Fprintln(out, "No folder saved; the current folder is searched unless -d is given.")
+			fmt.Fprintln(out)
+			return "", nil
+		}
+		dir := setupPath(answer)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Fprintf(out, "%s isn't a folder.\n\n", dir)
+			continue
+		}
+		if probe := probeLibrary(dir); probe.Songs+probe.Sng == 0 {
+			useAnyway, err := askYesNo(in, out, fmt.Sprintf("No songs found in %s. Use it anyway?", dir), false)
+			if err != nil {
+				return "", err
+			}
+			if !useAnyway {
+				fmt.Fprintln(out)
+				continue
+			}
+		}
+		fmt.Fprintln(out)
+		return dir, nil
+	}
+}
+
+// askCacheFolder asks where caches are kept. The temp folder, the default, isn't saved.
+func askCacheFolder(in *bufio.Reader, out io.Writer) (string, error) {
+	temp := filepath.Join(os.TempDir(), "cloneheroer")
+	choices := []string{temp}
+	labels := []string{" (the temp folder, which the system may empty)"}
+	if dir, err := os.UserCacheDir(); err == nil {
+		choices = append(choices, filepath.Join(dir, "cloneheroer"))
+		labels = append(labels, " (kept until you remove it)")
+	}
+	def := userConfig.CacheDir
+	if def == "" {
+		def = temp
+	}
+
+	for {
+		answer, err := askChoice(in, out, "Where should the song cache go? It makes every search after the first fast.", choices, labels, def)
+		if err != nil {
+			return "", err
+		}
+		dir := setupPath(answer)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(out, "Can't use %s: %v\n\n", dir, err)
+			continue
+		}
+		fmt.Fprintln(out)
+		if dir == temp {
+			return "", nil
+		}
+		return dir, nil
+	}
+}
+
+// askColor asks when to use colors. auto, the default, isn't saved.
+func askColor(in *bufio.Reader, out io.Writer) (string, error) {
+	def := userConfig.Color
+	if def == "" {
+		def = ColorAuto
+	}
+	for {
+		answer, err := ask(in, out, fmt.Sprintf("Colors: %s (on a terminal), %s or %s?", ColorAuto, ColorAlways, ColorNever), def)
+		if err != nil {
+			return "", err
+		}
+		switch answer = strings.ToLower(answer); answer {
+		case ColorAuto:
+			return "", nil
+		case ColorAlways, ColorNever:
+			return answer, nil
+		}
+		fmt.Fprintf(out, "Please answer %s, %s or %s.\n", ColorAuto, ColorAlways, ColorNever)
+	}
+}
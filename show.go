@@ -0,0 +1,223 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	showCmd = &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show every detail of a single song",
+		Long:  "Show all metadata for one song, below its album art when shown on a terminal (see --art). The optional argument filters by song name; if several songs match, you are asked to pick one.",
+		RunE:  runShow,
+	}
+
+	openCmd = &cobra.Command{
+		Use:   "open [name]",
+		Short: "Open a song's folder in the system file manager",
+		Long:  "Open the folder containing a song. The optional argument filters by song name; if several songs match, you are asked to pick one.",
+		RunE:  runOpen,
+	}
+
+	editCmd = &cobra.Command{
+		Use:   "edit [name]",
+		Short: "Edit a song's song.ini in your text editor",
+		Long:  "Open the song.ini of a song in $VISUAL or $EDITOR (vi, or Notepad on Windows, without either). The optional argument filters by song name; if several songs match, you are asked to pick one.",
+		RunE:  runEdit,
+	}
+
+	previewCmd = &cobra.Command{
+		Use:   "preview [name]",
+		Short: "Play a song's audio preview",
+		Long: `Play a song's audio from its preview_start_time for --play-for, with ffplay or mpv, or open
+the audio file in the default player when neither is installed. Songs split into stems
+play the first of song, guitar, rhythm, bass, keys, vocals and drums that's there. The
+optional argument filters by song name; if several songs match, you are asked to pick one.`,
+		RunE: runPreview,
+	}
+
+	previewPlayFor time.Duration
+)
+
+// showArtCols is how many cells wide show draws album art, at most
+const showArtCols = 32
+
+func init() {
+	rootCmd.AddCommand(showCmd)
+	rootCmd.AddCommand(openCmd)
+	previewCmd.Flags().DurationVar(&previewPlayFor, "play-for", 30*time.Second, "How long to play")
+	rootCmd.AddCommand(editCmd)
+	rootCmd.AddCommand(previewCmd)
+}
+
+// selectSong loads the library and narrows the matches down to a single song,
+// treating any positional arguments as a name filter
+func selectSong(args []string) (*Song, *Filter, error) {
+	if len(args) > 0 {
+		filterName = []string{strings.Join(args, " ")}
+	}
+
+	_, filteredSongs, filter, err := loadFilteredSongs()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	song, err := pickSong(filteredSongs, os.Stdin, os.Stderr, isInteractive())
+	if err != nil {
+		return nil, nil, err
+	}
+	return song, filter, nil
+}
+
+func runShow(cmd *cobra.Command, args []string) error {
+	if err := validateFormat(outputFormat); err != nil {
+		return err
+	}
+	protocol, err := resolveArtProtocol(artProtocol)
+	if err != nil {
+		return err
+	}
+	song, filter, err := selectSong(args)
+	if err != nil {
+		return err
+	}
+
+	// The notes file of a single song is quick to read, and says more than song.ini
+	if song.Charted == nil && !isRemoteLocation(songRoot(song)) {
+		if chart, err := loadSongChart(song); err == nil {
+			song.readChartData(chart)
+		}
+	}
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+	output := NewOutput(writer, outputFormat, false)
+	if !noHighlight {
+		output.Highlight(filter)
+	}
+	if writer == os.Stdout && (outputFormat == FormatText || outputFormat == FormatTable) {
+		width := 80
+		if w, _, err := terminalSize(int(os.Stdout.Fd())); err == nil {
+			width = w
+		}
+		if art := renderAlbumArt(song, protocol, min(showArtCols, width), showArtCols/2); art != nil {
+			art.Write(writer)
+			fmt.Fprintln(writer)
+		}
+	}
+	output.WriteDetail(song)
+	return nil
+}
+
+func runOpen(cmd *cobra.Command, args []string) error {
+	song, _, err := selectSong(args)
+	if err != nil {
+		return err
+	}
+
+	return openPath(filepath.Dir(song.Path))
+}
+
+// openPath opens a folder or file with the application the system associates with it
+func openPath(path string) error {
+	var opener *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		opener = exec.Command("open", path)
+	case "windows":
+		opener = exec.Command("explorer", path)
+	default:
+		opener = exec.Command("xdg-open", path)
+	}
+
+	if err := opener.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return nil
+}
+
+func runEdit(cmd *cobra.Command, args []string) error {
+	if err := ensureWritable("edit song.ini"); err != nil {
+		return err
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("edit needs a local library")
+	}
+	song, _, err := selectSong(args)
+	if err != nil {
+		return err
+	}
+	if song.Packed {
+		return packedEditError(song.Path)
+	}
+
+	editor := cmp.Or(os.Getenv("VISUAL"), os.Getenv("EDITOR"))
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// $EDITOR may carry arguments, as in "code --wait"
+	fields := strings.Fields(editor)
+	edit := exec.Command(fields[0], append(fields[1:], song.Path)...)
+	edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := edit.Run(); err != nil {
+		return fmt.Errorf("failed to edit %s: %w", song.Path, err)
+	}
+	return nil
+}
+
+func runPreview(cmd *cobra.Command, args []string) error {
+	if previewPlayFor <= 0 {
+		return fmt.Errorf("--play-for must be positive")
+	}
+	if anyRemoteLibrary() {
+		return fmt.Errorf("preview needs a local library")
+	}
+	song, _, err := selectSong(args)
+	if err != nil {
+		return err
+	}
+	if song.Packed {
+		return errPackedAudio
+	}
+	stems := songAudioFiles(filepath.Dir(song.Path))
+	if len(stems) == 0 {
+		return fmt.Errorf("%s has no audio", filepath.Dir(song.Path))
+	}
+	audio := stems[0]
+
+	start := strconv.FormatFloat(float64(max(song.PreviewStart, 0))/1000, 'f', 3, 64)
+	length := strconv.FormatFloat(previewPlayFor.Seconds(), 'f', 3, 64)
+	var player *exec.Cmd
+	if path, err := exec.LookPath("ffplay"); err == nil {
+		player = exec.Command(path, "-nodisp", "-autoexit", "-loglevel", "error", "-ss", start, "-t", length, audio)
+	} else if path, err := exec.LookPath("mpv"); err == nil {
+		player = exec.Command(path, "--no-video", "--really-quiet", "--start="+start, "--length="+length, audio)
+	}
+	if player == nil {
+		fmt.Fprintln(os.Stderr, "Warning: ffplay and mpv not found; opening the audio in the default player from the start")
+		return openPath(audio)
+	}
+
+	fmt.Printf("Playing %s - %s from %s\n", song.Artist, song.Name, formatClock(time.Duration(song.PreviewStart)*time.Millisecond))
+	player.Stdin, player.Stdout, player.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := player.Run(); err != nil {
+		return fmt.Errorf("failed to play %s: %w", audio, err)
+	}
+	return nil
+}
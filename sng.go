@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Clone Hero can read songs packed into a single .sng file: a header, the song.ini
+// metadata as key/value pairs, a table of the packed files and their (masked) contents.
+// See https://github.com/mdsitton/SngFileFormat for the format.
+
+// sngIdentifier starts every .sng file
+const sngIdentifier = "SNGPKG"
+
+// Limits on the sections read from a .sng file, so a corrupted one can't make the
+// scanner allocate huge amounts of memory
+const (
+	maxSngMetadata  = 1 << 20
+	maxSngFileCount = 1 << 12
+)
+
+// errPackedAudio is returned where a packed song's audio would be needed
+var errPackedAudio = errors.New("the audio of packed .sng songs isn't read")
+
+// packedEditError is returned when asked to change a packed song, which is read-only
+func packedEditError(path string) error {
+	return fmt.Errorf("%s is a packed .sng song, which can't be edited", path)
+}
+
+// SngArchive is an opened .sng file: its metadata and the table of the files in it
+type SngArchive struct {
+	Path     string
+	Version  uint32
+	Metadata []SngMetadata
+	Files    []SngFile
+	mask     [16]byte
+}
+
+// SngMetadata is a song.ini key and its value, in the order they're stored
+type SngMetadata struct {
+	Key   string
+	Value string
+}
+
+// SngFile is a file packed in a .sng archive
+type SngFile struct {
+	Name   string
+	Size   int64
+	offset int64 // from the start of the .sng file
+}
+
+// isSngFile reports whether path is a packed .sng song
+func isSngFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".sng")
+}
+
+// OpenSng reads the header, metadata and file table of a .sng file. File contents are
+// only read by ReadFile.
+func OpenSng(path string) (*SngArchive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	r := bufio.NewReader(file)
+
+	archive := &SngArchive{Path: path}
+	identifier := make([]byte, len(sngIdentifier))
+	if _, err := io.ReadFull(r, identifier); err != nil || string(identifier) != sngIdentifier {
+		return nil, fmt.Errorf("not a .sng file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &archive.Version); err != nil {
+		return nil, fmt.Errorf("truncated .sng header: %w", err)
+	}
+	if _, err := io.ReadFull(r, archive.mask[:]); err != nil {
+		return nil, fmt.Errorf("truncated .sng header: %w", err)
+	}
+
+	var metadataLength, metadataCount uint64
+	if err := readSngFields(r, &metadataLength, &metadataCount); err != nil {
+		return nil, fmt.Errorf("truncated .sng metadata: %w", err)
+	}
+	if metadataLength > maxSngMetadata || metadataCount > metadataLength/8 {
+		return nil, fmt.Errorf("invalid .sng metadata section of %d bytes with %d entries", metadataLength, metadataCount)
+	}
+	for i := uint64(0); i < metadataCount; i++ {
+		key, err := readSngString(r, 4)
+		if err != nil {
+			return nil, fmt.Errorf("truncated .sng metadata: %w", err)
+		}
+		value, err := readSngString(r, 4)
+		if err != nil {
+			return nil, fmt.Errorf("truncated .sng metadata: %w", err)
+		}
+		archive.Metadata = append(archive.Metadata, SngMetadata{Key: key, Value: value})
+	}
+
+	var indexLength, fileCount uint64
+	if err := readSngFields(r, &indexLength, &fileCount); err != nil {
+		return nil, fmt.Errorf("truncated .sng file index: %w", err)
+	}
+	if fileCount > maxSngFileCount {
+		return nil, fmt.Errorf("invalid .sng file index with %d files", fileCount)
+	}
+	for i := uint64(0); i < fileCount; i++ {
+		name, err := readSngString(r, 1)
+		if err != nil {
+			return nil, fmt.Errorf("truncated .sng file index: %w", err)
+		}
+		var length, offset uint64
+		if err := readSngFields(r, &length, &offset); err != nil {
+			return nil, fmt.Errorf("truncated .sng file index: %w", err)
+		}
+		if offset > uint64(size) || length > uint64(size)-offset {
+			return nil, fmt.Errorf("%s lies outside of the .sng file", name)
+		}
+		archive.Files = append(archive.Files, SngFile{Name: name, Size: int64(length), offset: int64(offset)})
+	}
+	return archive, nil
+}
+
+// readSngFields reads little-endian unsigned 64-bit fields
+func readSngFields(r io.Reader, fields ...*uint64) error {
+	for _, field := range fields {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSngString reads a string prefixed by its length, stored in lengthSize bytes
+func readSngString(r *bufio.Reader, lengthSize int) (string, error) {
+	var length int
+	switch lengthSize {
+	case 1:
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		length = int(b)
+	default:
+		var n int32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return "", err
+		}
+		if n < 0 || n > maxSngMetadata {
+			return "", fmt.Errorf("invalid string length %d", n)
+		}
+		length = int(n)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Lookup returns the packed file with the given name (case-insensitive)
+func (a *SngArchive) Lookup(name string) (SngFile, bool) {
+	for _, file := range a.Files {
+		if strings.EqualFold(file.Name, name) {
+			return file, true
+		}
+	}
+	return SngFile{}, false
+}
+
+// ReadFile reads and unmasks the contents of a packed file
+func (a *SngArchive) ReadFile(name string) ([]byte, error) {
+	packed, ok := a.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("no %s in %s: %w", name, a.Path, os.ErrNotExist)
+	}
+	file, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data := make([]byte, packed.Size)
+	if _, err := file.ReadAt(data, packed.offset); err != nil {
+		return nil, fmt.Errorf("failed to read %s from %s: %w", name, a.Path, err)
+	}
+	for i := range data {
+		data[i] ^= a.mask[i%len(a.mask)] ^ byte(i)
+	}
+	return data, nil
+}
+
+// ParseSng reads the metadata of a .sng file into a Song, as ParseSong does for a
+// song.ini. The song's path is the .sng file.
+func ParseSng(path string) (*Song, error) {
+	archive, err := OpenSng(path)
+	if err != nil {
+		return nil, err
+	}
+	parser := newSongIniParser(path)
+	parser.foundSection = true
+	for _, pair := range archive.Metadata {
+		parser.set([]byte(strings.TrimSpace(pair.Key)), []byte(strings.TrimSpace(pair.Value)))
+	}
+	song, err := parser.finish()
+	if err != nil {
+		return nil, err
+	}
+	song.Packed = true
+	return song, nil
+}
+
+// readSngValues returns the metadata of a .sng file keyed by lowercased key name, like
+// readIniValues does for a song.ini
+func readSngValues(path string) (map[string]string, error) {
+	archive, err := OpenSng(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	values := make(map[string]string, len(archive.Metadata))
+	for _, pair := range archive.Metadata {
+		values[strings.ToLower(strings.TrimSpace(pair.Key))] = strings.TrimSpace(pair.Value)
+	}
+	return values, nil
+}
+
+// readSongFile reads a file of a song: from its folder, or from its .sng archive
+func readSongFile(song *Song, name string) ([]byte, error) {
+	if !song.Packed {
+		return os.ReadFile(filepath.Join(filepath.Dir(song.Path), name))
+	}
+	archive, err := OpenSng(song.Path)
+	if err != nil {
+		return nil, err
+	}
+	return archive.ReadFile(name)
+}
+
+// findSongChartFile returns the name of a song's notes file, from its folder or its
+// .sng archive
+func findSongChartFile(song *Song) (string, error) {
+	if !song.Packed {
+		path, err := findChartFile(filepath.Dir(song.Path))
+		return filepath.Base(path), err
+	}
+	archive, err := OpenSng(song.Path)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range chartFiles {
+		if _, ok := archive.Lookup(name); ok {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no notes.chart or notes.mid in %s", song.Path)
+}
+
+// loadSongChartMetadata reads the [Song] block of a song's notes.chart, from its folder
+// or its .sng archive. It returns nil if the song has no notes.chart.
+func loadSongChartMetadata(song *Song) (*ChartMetadata, error) {
+	if !song.Packed {
+		path := filepath.Join(filepath.Dir(song.Path), "notes.chart")
+		if _, err := os.Stat(path); err != nil {
+			return nil, nil
+		}
+		return ParseChartMetadata(path)
+	}
+	data, err := readSongFile(song, "notes.chart")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseChartMetadataReader(bytes.NewReader(data))
+}
+
+// songFolder returns what holds a song's files: its folder, or its .sng file
+func songFolder(song *Song) string {
+	if song.Packed {
+		return song.Path
+	}
+	return filepath.Dir(song.Path)
+}
+
+// loadSongChart parses the notes file of a song, packed or not
+func loadSongChart(song *Song) (*Chart, error) {
+	if !song.Packed {
+		return LoadChart(filepath.Dir(song.Path))
+	}
+	name, err := findSongChartFile(song)
+	if err != nil {
+		return nil, err
+	}
+	data, err := readSongFile(song, name)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(song.Path, name)
+	if strings.EqualFold(filepath.Ext(name), ".mid") {
+		return parseMidiData(path, data)
+	}
+	return parseChartReader(path, bytes.NewReader(data))
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// songIniReaders are reused across files, since a scan parses tens of thousands of
+// song.ini files and each reader holds a buffer the size of the longest allowed line
+var songIniReaders = sync.Pool{
+	New: func() any { return bufio.NewReaderSize(nil, maxSongIniLine) },
+}
+
+// songIniParser builds a Song from the lines of a song.ini, one at a time. Keys are
+// case-insensitive, "=" or ":" separates a key from its value, and values are taken
+// whole: rich text tags (<color=#FF0000>) and entities (&amp;) aren't inline comments.
+type songIniParser struct {
+	song          *Song
+	inSongSection bool
+	foundSection  bool
+	done          bool // the [song] section has ended
+}
+
+func newSongIniParser(path string) *songIniParser {
+	return &songIniParser{song: &Song{
+		Path:        path,
+		Instruments: make(map[Instrument]int),
+		Charters:    []string{},
+	}}
+}
+
+// parseLine reads a single line; white space around it, such as the line ending, is
+// ignored
+func (p *songIniParser) parseLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] == ';' || line[0] == '#' {
+		return
+	}
+
+	// Section headers are case-insensitive. Only the [song] section matters, so the
+	// first other section after it ends the parse.
+	if line[0] == '[' && line[len(line)-1] == ']' {
+		isSong := bytes.EqualFold(bytes.TrimSpace(line[1:len(line)-1]), []byte("song"))
+		if !isSong && p.inSongSection {
+			p.done = true
+		}
+		p.inSongSection = isSong
+		p.foundSection = p.foundSection || isSong
+		return
+	}
+	if !p.inSongSection {
+		return
+	}
+
+	end := bytes.IndexAny(line, "=:")
+	if end <= 0 {
+		// A preview time is sometimes written without the "="
+		if fields := bytes.Fields(line); len(fields) == 2 && bytes.EqualFold(fields[0], []byte("preview_start_time")) {
+			if preview, err := strconv.ParseInt(string(fields[1]), 10, 64); err == nil {
+				p.song.PreviewStart = preview
+			}
+		}
+		return
+	}
+	p.set(bytes.TrimSpace(line[:end]), bytes.TrimSpace(line[end+1:]))
+}
+
+// set stores a key's value in the song. Keys are lowercased into a small buffer, so
+// known keys don't allocate.
+func (p *songIniParser) set(key, value []byte) {
+	var buf [32]byte
+	if len(key) > len(buf) {
+		return
+	}
+	lower := buf[:len(key)]
+	for i, c := range key {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	value = unquote(value)
+
+	song := p.song
+	switch string(lower) {
+	case "name":
+		song.Name = string(value)
+	case "artist":
+		song.Artist = string(value)
+	case "album":
+		song.Album = string(value)
+	case "genre":
+		song.Genre = string(value)
+	case "charter":
+		song.Charters = song.Charters[:0]
+		for _, c := range splitCharters(string(value)) {
+			if c = strings.TrimSpace(c); c != "" {
+				song.Charters = append(song.Charters, c)
+			}
+		}
+	case "icon":
+		song.Icon = string(value)
+	case "loading_phrase":
+		song.LoadingPhrase = string(value)
+	case "tags":
+		song.Tags = splitTags(string(value))
+	case "rating":
+		if rating, err := strconv.Atoi(string(value)); err == nil {
+			song.Rating = rating
+		}
+	case "year":
+		if year, err := strconv.Atoi(string(value)); err == nil {
+			song.Year = year
+		}
+	case "song_length":
+		if lengthMs, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			song.Length = time.Duration(lengthMs) * time.Millisecond
+		}
+	case "preview_start_time":
+		if preview, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			song.PreviewStart = preview
+		}
+	case "album_track":
+		if track, err := strconv.Atoi(string(value)); err == nil {
+			song.AlbumTrack = track
+		}
+	case "playlist_track":
+		if track, err := strconv.Atoi(string(value)); err == nil {
+			song.PlaylistTrack = track
+		}
+	default:
+		if bytes.HasPrefix(lower, []byte(diffKeyPrefix)) {
+			if inst, ok := instrumentForKey(string(lower)); ok {
+				song.setInstrument(inst, string(value))
+			}
+		}
+	}
+}
+
+// unquote strips the quotes around a value that is entirely quoted, such as "Name"
+func unquote(value []byte) []byte {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] &&
+		bytes.IndexByte(value[1:len(value)-1], value[0]) < 0 {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// finish returns the parsed song, or errNoSongSection if there was no [song] section
+func (p *songIniParser) finish() (*Song, error) {
+	if !p.foundSection {
+		return nil, errNoSongSection
+	}
+	p.song.sanitize()
+	return p.song, nil
+}
+
+// parseSongFile reads a song.ini in a single pass, stopping once the [song] section is
+// over. The checks of checkSongIniData are made on the lines as they're read.
+func parseSongFile(path string) (*Song, error) {
+	file, _, err := openSongIni(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := songIniReaders.Get().(*bufio.Reader)
+	reader.Reset(file)
+	defer func() {
+		reader.Reset(nil)
+		songIniReaders.Put(reader)
+	}()
+
+	// UTF-16 text passes the checks but can only be parsed once decoded (see
+	// parseSongDecoded)
+	if head, _ := reader.Peek(2); isUTF16(head) {
+		return nil, errNoSongSection
+	}
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte("\ufeff")) {
+		reader.Discard(3)
+	}
+
+	parser := newSongIniParser(path)
+	var check songIniCheck
+	for lineNumber := 1; !parser.done; lineNumber++ {
+		line, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("line %d is longer than %d KB", lineNumber, maxSongIniLine>>10)
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if err := check.line(line); err != nil {
+			return nil, err
+		}
+		parser.parseLine(line)
+		if err == io.EOF {
+			break
+		}
+	}
+	if err := check.finish(); err != nil {
+		return nil, err
+	}
+	return parser.finish()
+}
+
+// parseSongData parses a song.ini that has already been read into memory, making the
+// same checks as parseSongFile
+func parseSongData(path string, data []byte) (*Song, error) {
+	if err := checkSongIniData(data); err != nil {
+		return nil, err
+	}
+	if isUTF16(data) {
+		return nil, errNoSongSection
+	}
+	return parseSongLines(path, data)
+}
+
+// parseSongLines parses UTF-8 song.ini text line by line
+func parseSongLines(path string, data []byte) (*Song, error) {
+	parser := newSongIniParser(path)
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	for len(data) > 0 && !parser.done {
+		line, rest, _ := bytes.Cut(data, []byte("\n"))
+		parser.parseLine(line)
+		data = rest
+	}
+	return parser.finish()
+}
@@ -5,9 +5,14 @@ import (
 	"strings"
 )
 
+// sortNone keeps songs in library (filesystem walk) order
+const sortNone = "none"
+
 // Sorter handles sorting songs by various fields
 type Sorter struct {
-	sortBy string
+	sortBy    string
+	queries   []string      // names --sort relevance ranks by
+	relevance map[*Song]int // scores of the songs being sorted by relevance
 }
 
 // NewSorter creates a new Sorter instance
@@ -15,10 +20,30 @@ func NewSorter(sortBy string) *Sorter {
 	return &Sorter{sortBy: strings.ToLower(sortBy)}
 }
 
-// Sort sorts the songs slice in place
+// RankBy sets the names --sort relevance ranks songs by, the --name values searched for
+func (s *Sorter) RankBy(queries []string) *Sorter {
+	s.queries = queries
+	return s
+}
+
+// Sort sorts the songs slice in place. Songs that compare equal are ordered by path, so
+// the result doesn't depend on the order the library was walked in.
 func (s *Sorter) Sort(songs []*Song) {
+	if s.sortBy == sortNone {
+		return
+	}
+	if s.sortBy == sortRelevance {
+		s.relevance = relevanceScores(songs, s.queries)
+	}
 	sort.Slice(songs, func(i, j int) bool {
-		return s.less(songs[i], songs[j])
+		a, b := songs[i], songs[j]
+		if s.less(a, b) {
+			return true
+		}
+		if s.less(b, a) {
+			return false
+		}
+		return a.Path < b.Path
 	})
 }
 
@@ -28,9 +53,25 @@ func (s *Sorter) less(a, b *Song) bool {
 	case "name":
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	case "artist":
-		if a.Artist != b.Artist {
+		if !strings.EqualFold(a.Artist, b.Artist) {
+			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	case "album":
+		// Artist, album, then track number, so albums read like track listings
+		if !strings.EqualFold(a.Artist, b.Artist) {
 			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
 		}
+		if !strings.EqualFold(a.Album, b.Album) {
+			return strings.ToLower(a.Album) < strings.ToLower(b.Album)
+		}
+		if a.AlbumTrack != b.AlbumTrack {
+			// Songs without a track number go after the numbered ones
+			if a.AlbumTrack == 0 || b.AlbumTrack == 0 {
+				return b.AlbumTrack == 0
+			}
+			return a.AlbumTrack < b.AlbumTrack
+		}
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	case "year":
 		if a.Year != b.Year {
@@ -43,10 +84,32 @@ func (s *Sorter) less(a, b *Song) bool {
 		}
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	case "genre":
-		if a.Genre != b.Genre {
+		if !strings.EqualFold(a.Genre, b.Genre) {
 			return strings.ToLower(a.Genre) < strings.ToLower(b.Genre)
 		}
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	case sortScore:
+		// Lowest score first, to find what to practice; songs never played go last
+		if scoreA, scoreB := scoreSortKey(a), scoreSortKey(b); scoreA != scoreB {
+			if scoreA < 0 || scoreB < 0 {
+				return scoreB < 0
+			}
+			return scoreA < scoreB
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	case sortRelevance:
+		// Best match first, then shorter names, which more of is matched; without a
+		// --name search, the default order
+		if scoreA, scoreB := s.relevance[a], s.relevance[b]; scoreA != scoreB {
+			return scoreA > scoreB
+		}
+		if len(a.Name) != len(b.Name) && len(s.queries) > 0 {
+			return len(a.Name) < len(b.Name)
+		}
+		if !strings.EqualFold(a.Artist, b.Artist) {
+			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	case "charter":
 		charterA := ""
 		charterB := ""
@@ -56,16 +119,15 @@ func (s *Sorter) less(a, b *Song) bool {
 		if len(b.Charters) > 0 {
 			charterB = b.Charters[0]
 		}
-		if charterA != charterB {
+		if !strings.EqualFold(charterA, charterB) {
 			return strings.ToLower(charterA) < strings.ToLower(charterB)
 		}
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	default:
 		// Default: sort by artist, then name
-		if a.Artist != b.Artist {
+		if !strings.EqualFold(a.Artist, b.Artist) {
 			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
 		}
 		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
 	}
 }
-
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tableColumn is a column of --format table
+type tableColumn struct {
+	Header   string
+	Field    string // filter field highlighted in the column, if any
+	MaxWidth int    // longer values are truncated; 0 for no limit
+	Right    bool   // right-aligned
+	Value    func(song *Song) string
+}
+
+// tableColumns are the columns of --format table
+var tableColumns = []tableColumn{
+	{Header: "Name", Field: "name", MaxWidth: 40, Value: func(s *Song) string { return s.Name }},
+	{Header: "Artist", Field: "artist", MaxWidth: 28, Value: func(s *Song) string { return s.Artist }},
+	{Header: "Charter", Field: "charter", MaxWidth: 20, Value: plainCharters},
+	{Header: "Length", Right: true, Value: func(s *Song) string { return s.FormatLength() }},
+	{Header: "Instruments", Value: func(s *Song) string { return s.InstrumentList() }},
+}
+
+// writeTable writes one row per song, with columns aligned by display width so CJK
+// characters and emoji in names don't shift the columns after them
+func (o *Output) writeTable(songs []*Song) {
+	if len(songs) == 0 {
+		return
+	}
+
+	columns := tableColumns
+	if showHash != "" {
+		columns = append(slices.Clip(columns), tableColumn{Header: "Hash", Value: shownHash})
+	}
+
+	indexWidth := len(strconv.Itoa(songOffset + len(songs)))
+	cells := make([][]string, len(songs))
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = displayWidth(column.Header)
+	}
+	for row, song := range songs {
+		cells[row] = make([]string, len(columns))
+		for i, column := range columns {
+			value := column.Value(song)
+			if column.MaxWidth > 0 {
+				value = truncateWidth(value, column.MaxWidth)
+			}
+			cells[row][i] = value
+			widths[i] = max(widths[i], displayWidth(value))
+		}
+	}
+
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = align(column.Header, widths[i], column.Right)
+	}
+	fmt.Fprintf(o.writer, "%s  %s\n", strings.Repeat(" ", indexWidth+1), o.styled(strings.TrimRight(strings.Join(header, "  "), " "), outputStyles.Header))
+
+	for row, song := range songs {
+		line := make([]string, len(columns))
+		for i, column := range columns {
+			value := cells[row][i]
+			// Highlight after measuring, since escape codes take no columns
+			painted := value
+			if column.Field != "" {
+				painted = o.highlight(column.Field, value)
+			}
+			line[i] = strings.Replace(align(value, widths[i], column.Right), value, painted, 1)
+		}
+		marker := ""
+		if mark := o.diffMarker(song); mark != "" {
+			marker = "  " + mark
+		}
+		fmt.Fprintf(o.writer, "%*d.  %s%s\n", indexWidth, songOffset+row+1, strings.TrimRight(strings.Join(line, "  "), " "), marker)
+	}
+	fmt.Fprintln(o.writer)
+}
+
+// align pads value to width columns, on the left when right is set
+func align(value string, width int, right bool) string {
+	if right {
+		if n := width - displayWidth(value); n > 0 {
+			return strings.Repeat(" ", n) + value
+		}
+		return value
+	}
+	return padWidth(value, width)
+}
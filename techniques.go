@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// .chart modifier frets of five- and six-fret tracks, and their open note
+const (
+	chartForcedFret = 5 // flips a note between strum and HOPO
+	chartTapFret    = 6 // makes a note a tap
+	chartOpenFret   = 7
+)
+
+var filterNoOpens, filterNoTaps bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&filterNoOpens, "no-opens", "", false, "Leave out songs with open notes, read from the notes file; per --instrument if given")
+	rootCmd.PersistentFlags().BoolVarP(&filterNoTaps, "no-taps", "", false, "Leave out songs with tap notes, read from the notes file; per --instrument if given")
+}
+
+// tierDensities are the note densities (notes per second) at which estimateTier moves
+// up a tier
+var tierDensities = []float64{2, 3.5, 5, 6.5, 8, 10}
+
+// notePosition is what is played at one tick of a track: a single note or a chord, with
+// its modifiers
+type notePosition struct {
+	tick   int64
+	frets  uint64 // one bit per fret, pad, string or key
+	length int64  // longest sustain, in ticks
+	forced bool
+	tap    bool
+}
+
+// notePositions groups the notes of inst, sorted by tick, into the positions they're
+// played at. Ticks with only modifiers on them are left out.
+func notePositions(inst Instrument, notes []ChartNote) []notePosition {
+	var positions []notePosition
+	var current notePosition
+	flush := func() {
+		if current.frets != 0 {
+			positions = append(positions, current)
+		}
+	}
+	for i, note := range notes {
+		if i == 0 || note.Tick != current.tick {
+			flush()
+			current = notePosition{tick: note.Tick}
+		}
+		switch {
+		case hasHOPOs(inst) && note.Fret == chartForcedFret:
+			current.forced = true
+		case hasHOPOs(inst) && note.Fret == chartTapFret:
+			current.tap = true
+		case isNoteFret(inst, note.Fret) && note.Fret < 64:
+			current.frets |= 1 << note.Fret
+			current.length = max(current.length, note.Length)
+		}
+	}
+	flush()
+	return positions
+}
+
+// isOpen reports whether an open note is played at the position
+func (p notePosition) isOpen() bool {
+	return p.frets&(1<<chartOpenFret) != 0
+}
+
+// isChord reports whether more than one fret is played at the position
+func (p notePosition) isChord() bool {
+	return bits.OnesCount64(p.frets) > 1
+}
+
+// isHOPO reports whether the position is a hammer-on or pull-off: a single note played
+// within threshold ticks of a different previous one, unless forced to a strum (and the
+// other way around). The first note has no previous one, so prev is nil.
+func (p notePosition) isHOPO(prev *notePosition, threshold int64) bool {
+	natural := prev != nil && !p.isChord() && p.frets != prev.frets && p.tick-prev.tick <= threshold
+	return natural != p.forced
+}
+
+// hasHOPOs reports whether inst has strummed notes, and so HOPOs and taps. Drums and
+// pro parts don't.
+func hasHOPOs(inst Instrument) bool {
+	return inst != InstrumentDrums && !isProInstrument(inst)
+}
+
+// hopoThreshold returns how close (in ticks) a note must follow the previous one to be
+// a natural HOPO: 65/192 of a beat, as in Moonscraper and Clone Hero
+func (c *Chart) hopoThreshold() int64 {
+	return int64(c.Resolution) * 65 / 192
+}
+
+// estimateTier guesses the difficulty tier of a part (0 to 6, as in the diff_* values of
+// song.ini) from its note density, moving it up a tier for parts heavy on chords and
+// another for parts heavy on HOPOs and taps
+func estimateTier(stats ChartStats) int {
+	tier := 0
+	for _, density := range tierDensities {
+		if stats.NotesPerSecond() >= density {
+			tier++
+		}
+	}
+	if stats.ChordShare() >= 0.3 {
+		tier++
+	}
+	if stats.Notes > 0 && float64(stats.HOPOs+stats.Taps)/float64(stats.Notes) >= 0.3 {
+		tier++
+	}
+	return min(tier, 6)
+}
+
+// formatTechniques describes the chords, HOPOs, taps, opens and sustains of a part, e.g.
+// "18% chords, 240 HOPOs, 0 taps, 12 opens, 31% sustained (longest 3.5s)"
+func formatTechniques(inst Instrument, stats ChartStats) string {
+	parts := []string{fmt.Sprintf("%.0f%% chords", stats.ChordShare()*100)}
+	if hasHOPOs(inst) {
+		parts = append(parts, fmt.Sprintf("%d HOPOs", stats.HOPOs), fmt.Sprintf("%d taps", stats.Taps), fmt.Sprintf("%d opens", stats.Opens))
+	}
+	sustained := fmt.Sprintf("%.0f%% sustained", stats.SustainCoverage()*100)
+	if stats.LongestSustain > 0 {
+		sustained += fmt.Sprintf(" (longest %.1fs)", stats.LongestSustain.Seconds())
+	}
+	return strings.Join(append(parts, sustained), ", ")
+}
+
+// ChordShare returns the share of notes that are chords, from 0 to 1
+func (s ChartStats) ChordShare() float64 {
+	if s.Notes == 0 {
+		return 0
+	}
+	return float64(s.Chords) / float64(s.Notes)
+}
+
+// SustainCoverage returns the share of the part's duration during which a note is held,
+// from 0 to 1
+func (s ChartStats) SustainCoverage() float64 {
+	if s.Duration < time.Second {
+		return 0
+	}
+	return min(float64(s.SustainTime)/float64(s.Duration), 1)
+}
+
+// OpensAndTaps returns the parts that have open notes and the parts that have tap notes,
+// on any difficulty
+func (c *Chart) OpensAndTaps() (opens, taps map[Instrument]bool) {
+	opens, taps = make(map[Instrument]bool), make(map[Instrument]bool)
+	for _, difficulty := range difficulties {
+		prefix := difficulty.trackPrefix()
+		for part, inst := range chartTrackInstruments {
+			if !hasHOPOs(inst) {
+				continue
+			}
+			for _, position := range notePositions(inst, c.Tracks[prefix+part]) {
+				opens[inst] = opens[inst] || position.isOpen()
+				taps[inst] = taps[inst] || position.tap
+			}
+		}
+	}
+	return opens, taps
+}
+
+// HasOpens reports whether the notes file of a song has open notes for inst, or for any
+// part if inst is empty
+func (s *Song) HasOpens(inst Instrument) bool {
+	return anyPart(s.Opens, inst)
+}
+
+// HasTaps reports whether the notes file of a song has tap notes for inst, or for any
+// part if inst is empty
+func (s *Song) HasTaps(inst Instrument) bool {
+	return anyPart(s.Taps, inst)
+}
+
+// anyPart reports whether parts holds inst, or any part if inst is empty
+func anyPart(parts map[Instrument]bool, inst Instrument) bool {
+	if inst != "" {
+		return parts[inst]
+	}
+	for _, has := range parts {
+		if has {
+			return true
+		}
+	}
+	return false
+}
+
+// usesTechniques reports whether the spec or any of its nested clauses filters on open
+// or tap notes
+func (spec FilterSpec) usesTechniques() bool {
+	if spec.NoOpens || spec.NoTaps {
+		return true
+	}
+	for _, clause := range spec.clauses() {
+		if clause.usesTechniques() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// OutputTheme is how text output is colored: each part is a list of styles such as
+// "bold cyan", set in the config file's themes and picked with --theme
+type OutputTheme struct {
+	Header    string `yaml:"header,omitempty"`    // the "Found ..." line and table headers
+	Name      string `yaml:"name,omitempty"`      // song names
+	Label     string `yaml:"label,omitempty"`     // field labels such as "Artist:"
+	Highlight string `yaml:"highlight,omitempty"` // the parts of fields matching a filter
+	Charter   string `yaml:"charter,omitempty"`   // charters without <color> tags of their own
+}
+
+// builtinThemes are the themes available without defining any
+var builtinThemes = map[string]OutputTheme{
+	"default": {
+		Header:    "bold",
+		Name:      "bold",
+		Highlight: "underline reverse",
+	},
+	"high-contrast": {
+		Header:    "bold underline hi-white",
+		Name:      "bold hi-yellow",
+		Label:     "bold hi-white",
+		Highlight: "bold black bg-hi-yellow",
+		Charter:   "hi-cyan",
+	},
+	"muted": {
+		Label:     "faint",
+		Highlight: "underline",
+		Charter:   "faint",
+	},
+}
+
+// themeName is --theme
+var themeName string
+
+func init() {
+	rootCmd.PersistentFlags().StringVarP(&themeName, "theme", "", "", "Color theme of text output: default, high-contrast, muted or one defined in the config file")
+}
+
+// themeStyle is a parsed theme part
+type themeStyle []color.Attribute
+
+// outputStyles are the parsed parts of the theme in use
+var outputStyles = struct {
+	Header, Name, Label, Highlight, Charter themeStyle
+}{
+	Header:    themeStyle{color.Bold},
+	Name:      themeStyle{color.Bold},
+	Highlight: themeStyle{color.Underline, color.ReverseVideo},
+}
+
+// themeAttributes are the style names a theme part is made of, besides #rrggbb colors
+var themeAttributes = map[string]color.Attribute{
+	"bold":      color.Bold,
+	"faint":     color.Faint,
+	"italic":    color.Italic,
+	"underline": color.Underline,
+	"reverse":   color.ReverseVideo,
+	"black":     color.FgBlack,
+	"red":       color.FgRed,
+	"green":     color.FgGreen,
+	"yellow":    color.FgYellow,
+	"blue":      color.FgBlue,
+	"magenta":   color.FgMagenta,
+	"cyan":      color.FgCyan,
+	"white":     color.FgWhite,
+}
+
+// parseThemeStyle parses a theme part: space-separated style names, colors prefixed
+// with hi- for their bright and bg- for their background variant, and #rrggbb colors
+func parseThemeStyle(value string) (themeStyle, error) {
+	var style themeStyle
+	for _, word := range strings.Fields(strings.ToLower(value)) {
+		name, background := strings.CutPrefix(word, "bg-")
+		if hex, ok := strings.CutPrefix(name, "#"); ok {
+			rgb, err := strconv.ParseUint(hex, 16, 32)
+			if err != nil || len(hex) != 6 {
+				return nil, fmt.Errorf("invalid color %q", word)
+			}
+			mode := color.Attribute(38)
+			if background {
+				mode = 48
+			}
+			style = append(style, mode, 2, color.Attribute(rgb>>16), color.Attribute(rgb>>8&0xff), color.Attribute(rgb&0xff))
+			continue
+		}
+		name, bright := strings.CutPrefix(name, "hi-")
+		attr, ok := themeAttributes[name]
+		if !ok || ((bright || background) && (attr < color.FgBlack || attr > color.FgWhite)) {
+			return nil, fmt.Errorf("unknown style %q", word)
+		}
+		if bright {
+			attr += color.FgHiBlack - color.FgBlack
+		}
+		if background {
+			attr += color.BgBlack - color.FgBlack
+		}
+		style = append(style, attr)
+	}
+	return style, nil
+}
+
+// applyTheme resolves --theme, or the config file's theme, into the styles of output.
+// Themes defined in the config file start from the default theme, so they only need
+// the parts they change.
+func applyTheme() error {
+	name := themeName
+	if name == "" {
+		name = userConfig.Theme
+	}
+	if name == "" {
+		return nil
+	}
+	theme, ok := userConfig.Themes[name]
+	if ok {
+		base := builtinThemes["default"]
+		theme = OutputTheme{
+			Header:    firstNonEmpty(theme.Header, base.Header),
+			Name:      firstNonEmpty(theme.Name, base.Name),
+			Label:     firstNonEmpty(theme.Label, base.Label),
+			Highlight: firstNonEmpty(theme.Highlight, base.Highlight),
+			Charter:   firstNonEmpty(theme.Charter, base.Charter),
+		}
+	} else if theme, ok = builtinThemes[name]; !ok {
+		return fmt.Errorf("unknown --theme %q (available: %s)", name, strings.Join(themeNames(), ", "))
+	}
+
+	parts := []struct {
+		name   string
+		value  string
+		target *themeStyle
+	}{
+		{"header", theme.Header, &outputStyles.Header},
+		{"name", theme.Name, &outputStyles.Name},
+		{"label", theme.Label, &outputStyles.Label},
+		{"highlight", theme.Highlight, &outputStyles.Highlight},
+		{"charter", theme.Charter, &outputStyles.Charter},
+	}
+	for _, part := range parts {
+		style, err := parseThemeStyle(part.value)
+		if err != nil {
+			return fmt.Errorf("theme %s, %s: %w", name, part.name, err)
+		}
+		*part.target = style
+	}
+	return nil
+}
+
+// themeNames lists the built-in themes and those of the config file
+func themeNames() []string {
+	var names []string
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	for name := range userConfig.Themes {
+		if _, ok := builtinThemes[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// firstNonEmpty returns the first of values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// styled renders text in the given style on the terminal; files get the plain text
+func (o *Output) styled(text string, style themeStyle) string {
+	if o.writer != os.Stdout || len(style) == 0 {
+		return text
+	}
+	return color.New(style...).Sprint(text)
+}
+
+// label renders a field label, e.g. "Artist:"
+func (o *Output) label(name string) string {
+	return o.styled(name+":", outputStyles.Label)
+}
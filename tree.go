@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	treeMinSongs int
+	treeDepth    int
+
+	treeCmd = &cobra.Command{
+		Use:   "tree",
+		Short: "Show the folders of the library with their song counts and sizes",
+		Long: `Print the folder hierarchy of the library, annotated with the number of matching songs
+in each folder and below it, and the size of their files. Like du, but counting songs.
+
+Folders holding fewer than --min-songs songs are collapsed into a single line under
+their parent, so the song folders of a pack don't drown out the structure. Use
+--min-songs 0 to list every folder.`,
+		Args: cobra.NoArgs,
+		RunE: runTree,
+	}
+)
+
+func init() {
+	treeCmd.Flags().IntVar(&treeMinSongs, "min-songs", 10, "Collapse folders with fewer songs than this")
+	treeCmd.Flags().IntVar(&treeDepth, "depth", 0, "Only show this many levels of folders (0 for all)")
+	rootCmd.AddCommand(treeCmd)
+}
+
+// folderNode is a folder of the library with the songs in it and below it
+type folderNode struct {
+	name     string
+	songs    int
+	size     int64
+	children map[string]*folderNode
+}
+
+// child returns the subfolder of a node with the given name, creating it if needed
+func (node *folderNode) child(name string) *folderNode {
+	if node.children == nil {
+		node.children = make(map[string]*folderNode)
+	}
+	child, ok := node.children[name]
+	if !ok {
+		child = &folderNode{name: name}
+		node.children[name] = child
+	}
+	return child
+}
+
+// sortedChildren returns the subfolders of a node sorted by name
+func (node *folderNode) sortedChildren() []*folderNode {
+	children := make([]*folderNode, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		a, b := strings.ToLower(children[i].name), strings.ToLower(children[j].name)
+		if a != b {
+			return a < b
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// songRelativeFolder returns the folder holding a song (the folder of its song.ini, or
+// the folder its .sng file is in), relative to the library root and split into its parts
+func songRelativeFolder(song *Song) []string {
+	var rel string
+	if root := songRoot(song); isRemoteLocation(root) {
+		rel = strings.TrimPrefix(remoteDir(song.Path), strings.TrimSuffix(root, "/"))
+	} else {
+		root, _ := filepath.Abs(root)
+		folder, _ := filepath.Abs(filepath.Dir(song.Path))
+		rel, _ = filepath.Rel(root, folder)
+		rel = filepath.ToSlash(rel)
+	}
+	var parts []string
+	for _, part := range strings.Split(rel, "/") {
+		if part != "" && part != "." {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// buildFolderTree adds every song of a library, and the size of its files, to its
+// folder and each folder above it
+func buildFolderTree(library string, songs []*Song) (*folderNode, error) {
+	folderFiles := localFolderFiles
+	if isRemoteLocation(library) {
+		var err error
+		if folderFiles, err = remoteFolderFiles(library); err != nil {
+			return nil, err
+		}
+	}
+
+	root := &folderNode{name: library}
+	for _, song := range songs {
+		if err := interrupted(); err != nil {
+			return nil, err
+		}
+		var size int64
+		files, err := folderFiles(song)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to list %s: %v\n", song.Path, err)
+		}
+		for _, file := range files {
+			size += file.Size
+		}
+
+		node := root
+		node.songs++
+		node.size += size
+		for _, part := range songRelativeFolder(song) {
+			node = node.child(part)
+			node.songs++
+			node.size += size
+		}
+	}
+	return root, nil
+}
+
+// writeFolderTree prints the subfolders of a node, indented below prefix, down to
+// maxDepth levels. Subfolders with fewer than minSongs songs are summed up on one line.
+func writeFolderTree(w io.Writer, node *folderNode, prefix string, depth, minSongs, maxDepth int) {
+	var shown []*folderNode
+	var collapsed folderNode
+	collapsedFolders := 0
+	for _, child := range node.sortedChildren() {
+		if child.songs < minSongs {
+			collapsed.songs += child.songs
+			collapsed.size += child.size
+			collapsedFolders++
+			continue
+		}
+		shown = append(shown, child)
+	}
+	for i, child := range shown {
+		last := i == len(shown)-1 && collapsedFolders == 0
+		branch, indent := "├── ", "│   "
+		if last {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s/  %s\n", prefix, branch, child.name, folderSummary(child.songs, child.size))
+		if maxDepth == 0 || depth < maxDepth {
+			writeFolderTree(w, child, prefix+indent, depth+1, minSongs, maxDepth)
+		}
+	}
+	if collapsedFolders > 0 {
+		fmt.Fprintf(w, "%s└── … %d folder(s) with fewer than %d songs  %s\n", prefix, collapsedFolders, minSongs, folderSummary(collapsed.songs, collapsed.size))
+	}
+}
+
+// treeDocument is the JSON representation of tree: a folder record per library
+type treeDocument struct {
+	SchemaVersion int            `json:"schema_version"`
+	Libraries     []folderRecord `json:"libraries"`
+}
+
+// folderRecord is a folder in treeDocument, with its subfolders as far as --depth goes
+type folderRecord struct {
+	Name      string           `json:"name"`
+	Songs     int              `json:"songs"`
+	Size      int64            `json:"size"`
+	SizeText  string           `json:"size_text"`
+	Folders   []folderRecord   `json:"folders,omitempty"`
+	Collapsed *collapsedRecord `json:"collapsed,omitempty"`
+}
+
+// collapsedRecord sums up the subfolders with fewer than --min-songs songs
+type collapsedRecord struct {
+	Folders  int    `json:"folders"`
+	Songs    int    `json:"songs"`
+	Size     int64  `json:"size"`
+	SizeText string `json:"size_text"`
+}
+
+// newFolderRecord converts a node and its subfolders, as writeFolderTree prints them, to
+// their JSON representation
+func newFolderRecord(node *folderNode, depth, minSongs, maxDepth int) folderRecord {
+	record := folderRecord{Name: node.name, Songs: node.songs, Size: node.size, SizeText: formatSize(node.size)}
+	for _, child := range node.sortedChildren() {
+		if child.songs < minSongs {
+			if record.Collapsed == nil {
+				record.Collapsed = &collapsedRecord{}
+			}
+			record.Collapsed.Folders++
+			record.Collapsed.Songs += child.songs
+			record.Collapsed.Size += child.size
+			record.Collapsed.SizeText = formatSize(record.Collapsed.Size)
+			continue
+		}
+		if maxDepth == 0 || depth < maxDepth {
+			record.Folders = append(record.Folders, newFolderRecord(child, depth+1, minSongs, maxDepth))
+		} else {
+			record.Folders = append(record.Folders, folderRecord{Name: child.name, Songs: child.songs, Size: child.size, SizeText: formatSize(child.size)})
+		}
+	}
+	return record
+}
+
+// folderSummary describes the songs of a folder: "182 song(s), 1.2 GB"
+func folderSummary(songs int, size int64) string {
+	return fmt.Sprintf("%d song(s), %s", songs, formatSize(size))
+}
+
+// formatSize formats a number of bytes with binary units, as du -h does: "1.2 GB"
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value, exp := float64(bytes)/unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGTP"[exp])
+}
+
+func runTree(cmd *cobra.Command, args []string) error {
+	if err := validateReportFormat(cmd); err != nil {
+		return err
+	}
+	if treeMinSongs < 0 || treeDepth < 0 {
+		return fmt.Errorf("--min-songs and --depth can't be negative")
+	}
+	_, songs, _, err := loadFilteredSongs()
+	if err != nil {
+		return err
+	}
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	// One tree per library, in the order they were given
+	byRoot := make(map[string][]*Song)
+	for _, song := range songs {
+		byRoot[songRoot(song)] = append(byRoot[songRoot(song)], song)
+	}
+	doc := treeDocument{SchemaVersion: SchemaVersion, Libraries: []folderRecord{}}
+	for i, library := range directories {
+		root, err := buildFolderTree(library, byRoot[library])
+		if err != nil {
+			return err
+		}
+		if reportJSON() {
+			doc.Libraries = append(doc.Libraries, newFolderRecord(root, 1, treeMinSongs, treeDepth))
+			continue
+		}
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+		fmt.Fprintf(writer, "%s  %s\n", library, folderSummary(root.songs, root.size))
+		writeFolderTree(writer, root, "", 1, treeMinSongs, treeDepth)
+	}
+	if reportJSON() {
+		return writeReport(writer, doc)
+	}
+	return nil
+}
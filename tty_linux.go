@@ -0,0 +1,9 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// Requests that read and set terminal attributes
+const (
+	ioctlGetTermios = unix.TCGETS
+	ioctlSetTermios = unix.TCSETS
+)
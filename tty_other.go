@@ -0,0 +1,25 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoRawTerminal is returned where the terminal can't be switched to raw mode
+var errNoRawTerminal = errors.New("interactive mode needs a Unix terminal")
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errNoRawTerminal
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errNoRawTerminal
+}
+
+func cellSize(fd int) (int, int, error) {
+	return 0, 0, errNoRawTerminal
+}
+
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,59 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+
+	"golang.org/x/sys/unix"
+)
+
+// makeRaw puts the terminal of fd in raw mode, where every key press is read as it's
+// typed and nothing is echoed, returning a function that restores the previous mode
+func makeRaw(fd int) (func(), error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, ioctlSetTermios, old) }, nil
+}
+
+// terminalSize returns the width and height of the terminal of fd, in cells
+func terminalSize(fd int) (int, int, error) {
+	size, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(size.Col), int(size.Row), nil
+}
+
+// cellSize returns the width and height of a cell of the terminal of fd, in pixels
+func cellSize(fd int) (int, int, error) {
+	size, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size.Col == 0 || size.Row == 0 || size.Xpixel == 0 || size.Ypixel == 0 {
+		return 0, 0, errors.New("terminal doesn't report its size in pixels")
+	}
+	return int(size.Xpixel / size.Col), int(size.Ypixel / size.Row), nil
+}
+
+// notifyResize sends to c whenever the terminal is resized
+func notifyResize(c chan<- os.Signal) {
+	signal.Notify(c, unix.SIGWINCH)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	usageSince time.Duration
+
+	usageCmd = &cobra.Command{
+		Use:   "usage",
+		Short: "Summarize the commands and filters you use",
+		Long: `Summarize the local usage log: how often each command ran and how long it took, which
+flags were used most, and how many runs failed.
+
+Nothing is logged unless "usage_log: true" is set in the config file. The log only
+records the command, the names of the flags given (not their values), how long the run
+took and whether it failed, and it never leaves this computer.`,
+		Args: cobra.NoArgs,
+		RunE: runUsage,
+	}
+
+	usageClearCmd = &cobra.Command{
+		Use:   "clear",
+		Short: "Delete the usage log",
+		Args:  cobra.NoArgs,
+		RunE:  runUsageClear,
+	}
+)
+
+func init() {
+	usageCmd.Flags().DurationVar(&usageSince, "since", 0, "Only summarize runs in this recent period (e.g. 168h for a week)")
+	usageCmd.AddCommand(usageClearCmd)
+	rootCmd.AddCommand(usageCmd)
+}
+
+// UsageEntry is a run recorded in the usage log
+type UsageEntry struct {
+	Time       time.Time `json:"time"`
+	Command    string    `json:"command"` // as in the porcelain summary line, e.g. "search" or "cache-gc"
+	Flags      []string  `json:"flags,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	Status     string    `json:"status"` // ok, error or interrupted
+}
+
+// usageFile returns the path of the usage log, one JSON entry per line
+func usageFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "cloneheroer", "usage.jsonl"), nil
+}
+
+// recordUsage appends a run to the usage log when the config file turns it on. Failing
+// to record a run never fails the run itself.
+func recordUsage(cmd *cobra.Command, err error, started time.Time) {
+	if !userConfig.UsageLog || cmd == nil {
+		return
+	}
+	switch cmd.Name() {
+	case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return
+	}
+	entry := UsageEntry{
+		Time:       started,
+		Command:    summaryCommand(cmd),
+		DurationMs: time.Since(started).Milliseconds(),
+		Status:     "ok",
+	}
+	if errors.Is(err, errInterrupted) {
+		entry.Status = "interrupted"
+	} else if err != nil {
+		entry.Status = "error"
+	}
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		entry.Flags = append(entry.Flags, flag.Name)
+	})
+
+	path, pathErr := usageFile()
+	if pathErr == nil {
+		pathErr = appendUsage(path, entry)
+	}
+	if pathErr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: not recording usage: %v\n", pathErr)
+	}
+}
+
+// appendUsage adds an entry to the end of the usage log
+func appendUsage(path string, entry UsageEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// loadUsage reads the usage log, oldest first. Lines that can't be read, such as one
+// cut short by a full disk, are skipped.
+func loadUsage() ([]UsageEntry, error) {
+	path, err := usageFile()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the usage log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []UsageEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry UsageEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// usageCount is how often a command or flag was used
+type usageCount struct {
+	Name      string `json:"name"`
+	Runs      int    `json:"runs"`
+	Failed    int    `json:"failed,omitempty"`
+	AverageMs int64  `json:"average_ms,omitempty"`
+	totalMs   int64
+}
+
+// UsageSummary is the summary of the usage log written by usage
+type UsageSummary struct {
+	SchemaVersion int          `json:"schema_version"`
+	Since         *time.Time   `json:"since,omitempty"` // the first run summarized
+	Runs          int          `json:"runs"`
+	Failed        int          `json:"failed"`
+	Commands      []usageCount `json:"commands"`
+	Flags         []usageCount `json:"flags"`
+}
+
+// summarizeUsage counts the runs of each command and the uses of each flag, most used
+// first
+func summarizeUsage(entries []UsageEntry) UsageSummary {
+	summary := UsageSummary{SchemaVersion: SchemaVersion, Runs: len(entries), Commands: []usageCount{}, Flags: []usageCount{}}
+	commands := make(map[string]*usageCount)
+	flags := make(map[string]*usageCount)
+	for _, entry := range entries {
+		if summary.Since == nil {
+			since := entry.Time
+			summary.Since = &since
+		}
+		command := commands[entry.Command]
+		if command == nil {
+			command = &usageCount{Name: entry.Command}
+			commands[entry.Command] = command
+		}
+		command.Runs++
+		command.totalMs += entry.DurationMs
+		if entry.Status != "ok" {
+			command.Failed++
+			summary.Failed++
+		}
+		for _, name := range entry.Flags {
+			flag := flags[name]
+			if flag == nil {
+				flag = &usageCount{Name: "--" + name}
+				flags[name] = flag
+			}
+			flag.Runs++
+		}
+	}
+	for _, command := range commands {
+		command.AverageMs = command.totalMs / int64(command.Runs)
+		summary.Commands = append(summary.Commands, *command)
+	}
+	for _, flag := range flags {
+		summary.Flags = append(summary.Flags, *flag)
+	}
+	for _, counts := range [][]usageCount{summary.Commands, summary.Flags} {
+		sort.Slice(counts, func(i, j int) bool {
+			if counts[i].Runs != counts[j].Runs {
+				return counts[i].Runs > counts[j].Runs
+			}
+			return counts[i].Name < counts[j].Name
+		})
+	}
+	return summary
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	if usageSince < 0 {
+		return fmt.Errorf("--since can't be negative")
+	}
+	entries, err := loadUsage()
+	if err != nil {
+		return err
+	}
+	if usageSince > 0 {
+		cutoff := time.Now().Add(-usageSince)
+		kept := entries[:0]
+		for _, entry := range entries {
+			if entry.Time.After(cutoff) {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+	summary := summarizeUsage(entries)
+
+	writer, closeOutput, err := openOutput()
+	if err != nil {
+		return err
+	}
+	defer closeOutput()
+
+	if outputFormat == FormatJSON || outputFormat == FormatNDJSON {
+		encoder := json.NewEncoder(writer)
+		if outputFormat == FormatJSON {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(summary)
+	}
+
+	if summary.Runs == 0 {
+		if !userConfig.UsageLog {
+			fmt.Fprintln(writer, `No usage recorded; set "usage_log: true" in the config file to start`)
+		} else {
+			fmt.Fprintln(writer, "No usage recorded yet")
+		}
+		return nil
+	}
+	fmt.Fprintf(writer, "%d run(s) since %s, %d failed\n", summary.Runs, summary.Since.Local().Format("2006-01-02 15:04"), summary.Failed)
+	fmt.Fprintln(writer, "\nCommands:")
+	for _, command := range summary.Commands {
+		line := fmt.Sprintf("  %s %5d  avg %.1fs", padWidth(command.Name, usageNameWidth(summary.Commands)), command.Runs, float64(command.AverageMs)/1000)
+		if command.Failed > 0 {
+			line += fmt.Sprintf(", %d failed", command.Failed)
+		}
+		fmt.Fprintln(writer, line)
+	}
+	if len(summary.Flags) > 0 {
+		fmt.Fprintln(writer, "\nFlags:")
+		for _, flag := range summary.Flags {
+			fmt.Fprintf(writer, "  %s %5d\n", padWidth(flag.Name, usageNameWidth(summary.Flags)), flag.Runs)
+		}
+	}
+	return nil
+}
+
+// usageNameWidth returns the width of the longest name of counts
+func usageNameWidth(counts []usageCount) int {
+	width := 0
+	for _, count := range counts {
+		width = max(width, displayWidth(count.Name))
+	}
+	return width
+}
+
+func runUsageClear(cmd *cobra.Command, args []string) error {
+	path, err := usageFile()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	fmt.Println("Usage log cleared")
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// wideRanges are the code points terminals draw two columns wide: East Asian wide and
+// fullwidth characters and emoji presentation symbols
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo initials
+	{0x231A, 0x231B},   // watch, hourglass
+	{0x2329, 0x232A},   // angle brackets
+	{0x23E9, 0x23EC},   // media controls
+	{0x23F0, 0x23F0},   // alarm clock
+	{0x23F3, 0x23F3},   // hourglass flowing
+	{0x25FD, 0x25FE},   // small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x267F, 0x267F},   // wheelchair
+	{0x2693, 0x2693},   // anchor
+	{0x26A1, 0x26A1},   // high voltage
+	{0x26AA, 0x26AB},   // circles
+	{0x26BD, 0x26BE},   // balls
+	{0x26C4, 0x26C5},   // snowman, sun behind cloud
+	{0x26CE, 0x26CE},   // ophiuchus
+	{0x26D4, 0x26D4},   // no entry
+	{0x26EA, 0x26EA},   // church
+	{0x26F2, 0x26F3},   // fountain, golf
+	{0x26F5, 0x26F5},   // sailboat
+	{0x26FA, 0x26FA},   // tent
+	{0x26FD, 0x26FD},   // fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270A, 0x270B},   // fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274C, 0x274C},   // cross mark
+	{0x274E, 0x274E},   // cross mark button
+	{0x2753, 0x2755},   // question and exclamation marks
+	{0x2757, 0x2757},   // exclamation mark
+	{0x2795, 0x2797},   // plus, minus, divide
+	{0x27B0, 0x27B0},   // curly loop
+	{0x27BF, 0x27BF},   // double curly loop
+	{0x2B1B, 0x2B1C},   // large squares
+	{0x2B50, 0x2B50},   // star
+	{0x2B55, 0x2B55},   // circle
+	{0x2E80, 0x303E},   // CJK radicals, symbols and punctuation
+	{0x3041, 0x33FF},   // kana, Bopomofo, Hangul compatibility Jamo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xA960, 0xA97F},   // Hangul Jamo extended A
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE10, 0xFE19},   // vertical forms
+	{0xFE30, 0xFE6F},   // CJK compatibility forms, small form variants
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x1F004, 0x1F004}, // mahjong tile
+	{0x1F0CF, 0x1F0CF}, // joker
+	{0x1F18E, 0x1F18E}, // AB button
+	{0x1F191, 0x1F19A}, // squared words
+	{0x1F200, 0x1F251}, // enclosed ideographic supplement
+	{0x1F300, 0x1F64F}, // pictographs, emoticons
+	{0x1F680, 0x1F6FF}, // transport and map symbols
+	{0x1F7E0, 0x1F7EB}, // colored circles and squares
+	{0x1F90C, 0x1F9FF}, // supplemental symbols and pictographs
+	{0x1FA70, 0x1FAFF}, // symbols and pictographs extended A
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+const (
+	zeroWidthJoiner = '\u200d'
+	emojiVariation  = '\ufe0f' // asks for the emoji (wide) rendering of the rune before it
+)
+
+// runeWidth returns the number of terminal columns r takes up: 0 for combining marks and
+// format characters, 2 for wide characters and 1 otherwise
+func runeWidth(r rune) int {
+	if r == 0 || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r) || unicode.IsControl(r) {
+		return 0
+	}
+	if r >= 0xFE00 && r <= 0xFE0F {
+		return 0
+	}
+	for _, wide := range wideRanges {
+		if r < wide[0] {
+			break
+		}
+		if r <= wide[1] {
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal columns s takes up. Emoji joined into one
+// glyph with zero width joiners (e.g. family emoji) count once.
+func displayWidth(s string) int {
+	width := 0
+	joined := false
+	last := 0
+	for _, r := range s {
+		switch {
+		case r == zeroWidthJoiner:
+			joined = true
+			continue
+		case r == emojiVariation && last == 1:
+			// A text symbol such as ❤ shown as an emoji
+			width++
+			last = 2
+			continue
+		}
+		w := runeWidth(r)
+		if joined && w > 0 {
+			joined = false
+			continue
+		}
+		width += w
+		if w > 0 {
+			last = w
+		}
+	}
+	return width
+}
+
+// truncateWidth shortens s to at most width columns, ending it with an ellipsis when
+// anything was cut. Wide characters are never split.
+func truncateWidth(s string, width int) string {
+	if displayWidth(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		if used+w > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		used += w
+	}
+	return b.String() + "…"
+}
+
+// padWidth pads s with spaces to width columns
+func padWidth(s string, width int) string {
+	if n := width - displayWidth(s); n > 0 {
+		return s + strings.Repeat(" ", n)
+	}
+	return s
+}
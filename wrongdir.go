@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxProbeEntries bounds how many files and folders are looked at per directory when
+// diagnosing an empty library, so a mistaken "-d /" doesn't walk the whole disk
+const maxProbeEntries = 50000
+
+// maxProbeSubdirs is how many subfolders of an empty library are checked for songs
+const maxProbeSubdirs = 20
+
+// errProbeLimit stops a probe walk at maxProbeEntries
+var errProbeLimit = errors.New("probe limit reached")
+
+// installMarkers are files and folders found in a Clone Hero install folder
+var installMarkers = []string{"Clone Hero.exe", "Clone Hero_Data", "clonehero", "clonehero_Data", "Clone Hero.app", "UnityPlayer.dll"}
+
+// archiveExtensions are song downloads that need extracting before Clone Hero (or this
+// tool) can read them
+var archiveExtensions = map[string]bool{".zip": true, ".rar": true, ".7z": true}
+
+// libraryProbe is what a bounded walk of a folder found
+type libraryProbe struct {
+	Files      int
+	Songs      int // folders with a song.ini
+	BareCharts int // folders with a notes.chart or notes.mid but no song.ini
+	Sng        int // packed .sng songs
+	Archives   int
+	Truncated  bool // the walk stopped at maxProbeEntries
+}
+
+// probeLibrary walks up to maxProbeEntries entries under dir, counting songs and the
+// files that commonly explain why a folder has none
+func probeLibrary(dir string) libraryProbe {
+	var probe libraryProbe
+	charts := make(map[string]bool)
+	inis := make(map[string]bool)
+	entries := 0
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := interrupted(); err != nil {
+			return err
+		}
+		if entries++; entries > maxProbeEntries {
+			probe.Truncated = true
+			return errProbeLimit
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		probe.Files++
+		name := strings.ToLower(d.Name())
+		switch {
+		case name == "song.ini":
+			inis[filepath.Dir(path)] = true
+		case name == "notes.chart" || name == "notes.mid":
+			charts[filepath.Dir(path)] = true
+		case strings.HasSuffix(name, ".sng"):
+			probe.Sng++
+		case archiveExtensions[filepath.Ext(name)]:
+			probe.Archives++
+		}
+		return nil
+	})
+
+	probe.Songs = len(inis)
+	for folder := range charts {
+		if !inis[folder] {
+			probe.BareCharts++
+		}
+	}
+	return probe
+}
+
+// isInstallDir reports whether dir looks like a Clone Hero install folder
+func isInstallDir(dir string) bool {
+	for _, marker := range installMarkers {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// songDirCandidates returns folders near dir, and the usual Clone Hero songs folders,
+// that might be the library the user meant
+func songDirCandidates(dir string) []string {
+	var candidates []string
+	parent := filepath.Dir(dir)
+	for _, base := range []string{dir, parent} {
+		for _, name := range []string{"Songs", "songs"} {
+			candidates = append(candidates, filepath.Join(base, name))
+		}
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		subdirs := 0
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && subdirs < maxProbeSubdirs {
+				candidates = append(candidates, filepath.Join(dir, entry.Name()))
+				subdirs++
+			}
+		}
+	}
+	if parent != dir {
+		candidates = append(candidates, parent)
+	}
+	if dataDirs, err := cloneHeroDataDirs(); err == nil {
+		for _, dataDir := range dataDirs {
+			candidates = append(candidates, filepath.Join(dataDir, "Songs"))
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(home, "Clone Hero", "Songs"))
+	}
+
+	// Drop duplicates (Songs and songs are the same folder on case-insensitive
+	// filesystems) and folders that don't exist
+	var seen []os.FileInfo
+	var existing []string
+	for _, candidate := range append([]string{dir}, candidates...) {
+		info, err := os.Stat(candidate)
+		if err != nil || !info.IsDir() || containsSameFile(seen, info) {
+			continue
+		}
+		seen = append(seen, info)
+		if candidate != dir {
+			existing = append(existing, candidate)
+		}
+	}
+	return existing
+}
+
+// containsSameFile reports whether infos includes the file described by info
+func containsSameFile(infos []os.FileInfo, info os.FileInfo) bool {
+	for _, seen := range infos {
+		if os.SameFile(seen, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnoseEmptyLibrary explains why dir has no songs, returning hints for the user: what
+// the folder looks like and nearby folders that do have songs
+func diagnoseEmptyLibrary(dir string) []string {
+	dir = filepath.Clean(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	var hints []string
+	probe := probeLibrary(dir)
+	if isInstallDir(dir) {
+		hints = append(hints, fmt.Sprintf("%s looks like the Clone Hero install folder, not a songs folder", dir))
+	}
+	if probe.BareCharts > 0 {
+		hints = append(hints, fmt.Sprintf("%d folder(s) have a notes.chart or notes.mid but no song.ini; \"cloneheroer generate-ini\" can create them", probe.BareCharts))
+	}
+	if probe.Sng > 0 {
+		hints = append(hints, fmt.Sprintf("%d packed .sng song(s) found; only song folders are read", probe.Sng))
+	}
+	if probe.Archives > 0 {
+		hints = append(hints, fmt.Sprintf("%d archive(s) (.zip, .rar, .7z) found; extract them first", probe.Archives))
+	}
+
+	var suggestions []string
+	suggested := make(map[string]int)
+	for _, candidate := range songDirCandidates(dir) {
+		found := probeLibrary(candidate)
+		if found.Songs == 0 || containsSuggestion(suggested, candidate, found.Songs) {
+			continue
+		}
+		suggested[candidate] = found.Songs
+		count := fmt.Sprint(found.Songs)
+		if found.Truncated {
+			count += "+"
+		}
+		suggestions = append(suggestions, fmt.Sprintf("  -d %q (%s songs)", candidate, count))
+	}
+	if len(suggestions) > 0 {
+		hints = append(hints, "Songs were found in:\n"+strings.Join(suggestions, "\n"))
+	}
+
+	files := fmt.Sprint(probe.Files)
+	if probe.Truncated {
+		files = "more than " + files
+	}
+	return append([]string{fmt.Sprintf("no songs found in %s (%s files scanned)", dir, files)}, hints...)
+}
+
+// containsSuggestion reports whether a folder already suggested lies inside dir and has
+// all of its songs, making dir itself redundant
+func containsSuggestion(suggested map[string]int, dir string, songs int) bool {
+	for path, count := range suggested {
+		if count == songs && strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnEmptyLibrary prints diagnoseEmptyLibrary's hints as a warning
+func warnEmptyLibrary(dir string) {
+	hints := diagnoseEmptyLibrary(dir)
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", hints[0])
+	for _, hint := range hints[1:] {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSheetNameLength is Excel's limit on worksheet names
+const maxSheetNameLength = 31
+
+// xlsxSheet is one worksheet of an exported workbook
+type xlsxSheet struct {
+	name  string
+	songs []*Song
+}
+
+// WriteXLSX writes songs to an Excel workbook at path. The first sheet contains every
+// song; with byGenre set an extra sheet is added per genre. Every sheet has a bold,
+// frozen header row and an autofilter over the data.
+func WriteXLSX(path string, songs []*Song, columns []Column, byGenre bool) error {
+	sheets := []xlsxSheet{{name: "Songs", songs: songs}}
+	if byGenre {
+		sheets = append(sheets, genreSheets(songs)...)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(file)
+	if err := writeWorkbook(zw, sheets, columns); err != nil {
+		zw.Close()
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// genreSheets groups songs into one sheet per genre, ordered by genre name
+func genreSheets(songs []*Song) []xlsxSheet {
+	byGenre := make(map[string][]*Song)
+	var genres []string
+	for _, song := range songs {
+		genre := strings.TrimSpace(song.Genre)
+		if genre == "" {
+			genre = "No Genre"
+		}
+		if _, ok := byGenre[genre]; !ok {
+			genres = append(genres, genre)
+		}
+		byGenre[genre] = append(byGenre[genre], song)
+	}
+	sort.Slice(genres, func(i, j int) bool { return strings.ToLower(genres[i]) < strings.ToLower(genres[j]) })
+
+	used := map[string]bool{"songs": true}
+	sheets := make([]xlsxSheet, 0, len(genres))
+	for _, genre := range genres {
+		sheets = append(sheets, xlsxSheet{name: uniqueSheetName(genre, used), songs: byGenre[genre]})
+	}
+	return sheets
+}
+
+// uniqueSheetName makes name valid as an Excel sheet name and unique within used
+func uniqueSheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Sheet"
+	}
+
+	candidate := truncateRunes(name, maxSheetNameLength)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		candidate = truncateRunes(name, maxSheetNameLength-len(suffix)) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// truncateRunes shortens s to at most n runes
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// writeWorkbook writes all parts of the workbook package
+func writeWorkbook(zw *zip.Writer, sheets []xlsxSheet, columns []Column) error {
+	var contentTypes, workbook, workbookRels strings.Builder
+
+	contentTypes.WriteString(xmlHeader + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+
+	workbook.WriteString(xmlHeader + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	var definedNames strings.Builder
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+		fmt.Fprintf(&definedNames, `<definedName name="_xlnm._FilterDatabase" localSheetId="%d" hidden="1">'%s'!%s</definedName>`,
+			i, xmlEscape(strings.ReplaceAll(sheet.name, "'", "''")), absoluteRange(len(columns), len(sheet.songs)+1))
+
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", n))
+		if err != nil {
+			return err
+		}
+		if err := writeWorksheet(w, sheet.songs, columns); err != nil {
+			return err
+		}
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets><definedNames>` + definedNames.String() + `</definedNames></workbook>`)
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`, len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWorksheet writes a single sheet with a frozen, bold header row and an autofilter
+func writeWorksheet(w io.Writer, songs []*Song, columns []Column) error {
+	var b strings.Builder
+	b.WriteString(xmlHeader + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+
+	// Size columns to their content, within reason
+	b.WriteString(`<cols>`)
+	for i, column := range columns {
+		width := displayWidth(column.Header)
+		for _, song := range songs {
+			if n := displayWidth(column.Value(song)); n > width {
+				width = n
+			}
+		}
+		if width > 60 {
+			width = 60
+		}
+		fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, width+2)
+	}
+	b.WriteString(`</cols><sheetData>`)
+
+	b.WriteString(`<row r="1">`)
+	for i, column := range columns {
+		fmt.Fprintf(&b, `<c r="%s1" t="inlineStr" s="1"><is><t>%s</t></is></c>`, columnLetter(i), xmlEscape(column.Header))
+	}
+	b.WriteString(`</row>`)
+
+	for r, song := range songs {
+		row := r + 2
+		fmt.Fprintf(&b, `<row r="%d">`, row)
+		for i, column := range columns {
+			value := column.Value(song)
+			if value == "" {
+				continue
+			}
+			ref := columnLetter(i) + strconv.Itoa(row)
+			if _, err := strconv.ParseFloat(value, 64); column.Numeric && err == nil {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, value)
+			} else {
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(value))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+
+	fmt.Fprintf(&b, `</sheetData><autoFilter ref="%s"/></worksheet>`, cellRange(len(columns), len(songs)+1))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// columnLetter converts a zero-based column index to its spreadsheet letters (A, B, ..., AA)
+func columnLetter(index int) string {
+	letters := ""
+	for index >= 0 {
+		letters = string(rune('A'+index%26)) + letters
+		index = index/26 - 1
+	}
+	return letters
+}
+
+// cellRange returns the A1-style range covering the given number of columns and rows
+func cellRange(columns, rows int) string {
+	return fmt.Sprintf("A1:%s%d", columnLetter(columns-1), rows)
+}
+
+// absoluteRange returns cellRange with absolute references ($A$1:$C$10)
+func absoluteRange(columns, rows int) string {
+	return fmt.Sprintf("$A$1:$%s$%d", columnLetter(columns-1), rows)
+}
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+
+// xlsxStyles defines the default cell style (0) and a bold header style (1)
+const xlsxStyles = xmlHeader + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`
+
+// xmlEscape escapes text for XML, dropping characters XML can't represent at all
+func xmlEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '&':
+			b.WriteString("&amp;")
+		case r == '<':
+			b.WriteString("&lt;")
+		case r == '>':
+			b.WriteString("&gt;")
+		case r == '"':
+			b.WriteString("&quot;")
+		case r == '\t' || r == '\n' || r == '\r' || (r >= 0x20 && r != utf8.RuneError && r != 0xFFFE && r != 0xFFFF):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}